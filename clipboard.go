@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ebiten can't get at the system clipboard, so go through whichever of wl-copy, xclip or xsel is installed
+// without any of them copying and pasting still works inside the editor
+
+var internal_clipboard string
+
+// clipboard_commands returns how to write and read the clipboard here, nil if there's no way to
+func clipboard_commands() (copy_cmd, paste_cmd []string) {
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		if _, err := exec.LookPath("wl-copy"); err == nil {
+			return []string{"wl-copy"}, []string{"wl-paste", "--no-newline"}
+		}
+	}
+	if _, err := exec.LookPath("xclip"); err == nil {
+		return []string{"xclip", "-selection", "clipboard"}, []string{"xclip", "-selection", "clipboard", "-o"}
+	}
+	if _, err := exec.LookPath("xsel"); err == nil {
+		return []string{"xsel", "--clipboard", "--input"}, []string{"xsel", "--clipboard", "--output"}
+	}
+	return nil, nil
+}
+
+// ClipboardWrite puts s on the clipboard
+func ClipboardWrite(s string) {
+	internal_clipboard = s
+	copy_cmd, _ := clipboard_commands()
+	if copy_cmd == nil {
+		return
+	}
+	cmd := exec.Command(copy_cmd[0], copy_cmd[1:]...)
+	cmd.Stdin = strings.NewReader(s)
+	//xclip and wl-copy stay running to serve the selection, so don't wait on them
+	if err := cmd.Start(); err == nil {
+		go cmd.Wait()
+	}
+}
+
+// ClipboardRead returns what's on the clipboard
+func ClipboardRead() string {
+	_, paste_cmd := clipboard_commands()
+	if paste_cmd == nil {
+		return internal_clipboard
+	}
+	out, err := exec.Command(paste_cmd[0], paste_cmd[1:]...).Output()
+	if err != nil {
+		return internal_clipboard
+	}
+	return string(out)
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"path/filepath"
+	"strings"
+)
+
+// Things the menus and shortcuts do, mostly acting on whatever editor last had focus
+
+var ErrNoTabs = errors.New("no tab group to open into")
+
+// Opener widgets ask the editor to open files, like the file tree does when a file is clicked
+type Opener interface {
+	//TakeOpenRequest returns the file the widget wants opened since it was last asked, if any
+	TakeOpenRequest() (path string, ok bool)
+}
+
+var _ Opener = &FileTree{}
+
+// FocusedEditor is the editor commands act on, the last one that had keyboard focus
+func (g *Editor) FocusedEditor() *TextEditor {
+	if g.last_editor != nil && InTree(g.MainWidget, g.last_editor) {
+		return g.last_editor
+	}
+	return nil
+}
+
+func (g *Editor) HasFocusedEditor() bool {
+	return g.FocusedEditor() != nil
+}
+
+// TargetTabs is where newly opened things go, the focused group if there is one
+// files opened from the panel group go where the editors are instead
+func (g *Editor) TargetTabs() *Tabs {
+	if tabs := g.FocusedTabs(); tabs != nil && tabs != g.panel_tabs {
+		return tabs
+	}
+	if te := g.FocusedEditor(); te != nil {
+		if tabs, ok := FindParent(g.MainWidget, te).(*Tabs); ok {
+			return tabs
+		}
+	}
+	return FirstTabs(g.MainWidget)
+}
+
+func (g *Editor) SaveFocused() {
+	if te := g.FocusedEditor(); te != nil {
+		g.SaveEditor(te, nil)
+	}
+}
+
+func (g *Editor) SaveFocusedAs() {
+	if te := g.FocusedEditor(); te != nil {
+		g.SaveEditorAs(te, nil)
+	}
+}
+
+// SaveEditor saves te's file, asking where to if it's never been saved
+// saved gets called once it has been, if it isn't nil
+func (g *Editor) SaveEditor(te *TextEditor, saved func()) {
+	if te.buf.filepath == "" {
+		g.SaveEditorAs(te, saved)
+		return
+	}
+	g.format_before_save(te, func() {
+		if err := te.buf.Save(); err != nil {
+			log.Println("couldn't save:", err)
+			return
+		}
+		if saved != nil {
+			saved()
+		}
+	})
+}
+
+// SaveEditorAs asks where to save te's text and saves it there, saved gets called once it has been, if it isn't nil
+func (g *Editor) SaveEditorAs(te *TextEditor, saved func()) {
+	PickFile("Save as", true, func(path string) {
+		te.SetHighlighter(HighlighterFor(path))
+		g.format_before_save(te, func() {
+			if err := te.buf.SaveAs(path); err != nil {
+				log.Println("couldn't save:", err)
+				return
+			}
+			if err := AddRecentFile(te.buf.filepath); err != nil {
+				log.Println("couldn't update recent files:", err)
+			}
+			if saved != nil {
+				saved()
+			}
+		})
+	})
+}
+
+func (g *Editor) OpenFileDialog() {
+	PickFile("Open", false, func(path string) {
+		if err := g.OpenFile(path); err != nil {
+			log.Println("couldn't open:", err)
+		}
+	})
+}
+
+// OpenFile shows path in the target tab group, switching to it instead if it's already open there
+// a file open in another group gets a second view of the same buffer
+func (g *Editor) OpenFile(path string) error {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	tabs := g.TargetTabs()
+	if tabs == nil {
+		return ErrNoTabs
+	}
+	for i, w := range tabs.Tabs {
+		if te, ok := w.(*TextEditor); ok && te.buf.filepath == path {
+			tabs.Select(i)
+			g.Focus(te)
+			return nil
+		}
+	}
+	var te *TextEditor
+	if buf := g.OpenBuffer(path); buf != nil {
+		//open in another tab group, edits in either should show in both
+		te = BufferEditor(buf)
+	} else {
+		var err error
+		if te, err = OpenTextEditor(path); err != nil {
+			return err
+		}
+	}
+	tabs.AddTab(te)
+	g.Focus(te)
+	if err := AddRecentFile(path); err != nil {
+		log.Println("couldn't update recent files:", err)
+	}
+	return nil
+}
+
+// OpenRecent opens a file from the recent files list, taking it off the list if it can't be opened any more
+func (g *Editor) OpenRecent(path string) {
+	if err := g.OpenFile(path); err != nil {
+		log.Println("couldn't open:", err)
+		if err := RemoveRecentFile(path); err != nil {
+			log.Println("couldn't update recent files:", err)
+		}
+	}
+}
+
+// ShowTab switches tabs to tab and focuses it
+func (g *Editor) ShowTab(tabs *Tabs, tab Widget) {
+	i := tabs.IndexOf(tab)
+	if i < 0 {
+		return
+	}
+	tabs.Select(i)
+	g.Focus(tab)
+}
+
+// CloseFocusedTab closes the open tab of the focused group
+func (g *Editor) CloseFocusedTab() {
+	tabs := g.TargetTabs()
+	if tabs == nil {
+		return
+	}
+	tabs.CloseTab(tabs.CurrentTab)
+	if current := tabs.current(); current != nil {
+		g.Focus(current)
+	}
+}
+
+// close_request is a tab with unsaved changes that was closed
+type close_request struct {
+	tabs *Tabs
+	tab  Widget
+}
+
+// HandleCloseRequests asks what to do with the unsaved changes of tabs that were closed
+// one question at a time, requests made while a dialog is up wait in their tab groups
+func (g *Editor) HandleCloseRequests() {
+	if DialogShowing() {
+		return
+	}
+	var requests, ask []close_request
+	Walk(g.MainWidget, func(w Widget) {
+		if tabs, ok := w.(*Tabs); ok {
+			for _, tab := range tabs.TakeCloseRequests() {
+				requests = append(requests, close_request{tabs, tab})
+			}
+		}
+	})
+	for _, r := range requests {
+		if te, ok := r.tab.(*TextEditor); ok && te.Dirty() && !g.shown_elsewhere(te) {
+			ask = append(ask, r)
+		} else {
+			g.discard_tab(r.tabs, r.tab)
+		}
+	}
+	g.close_each(ask)
+}
+
+// close_each asks about each request in turn and closes the ones that get saved or discarded
+// cancelling one leaves the rest open too
+func (g *Editor) close_each(requests []close_request) {
+	if len(requests) == 0 {
+		return
+	}
+	r := requests[0]
+	te, _ := r.tab.(*TextEditor)
+	g.ask_to_save(te, func() {
+		g.discard_tab(r.tabs, r.tab)
+		g.close_each(requests[1:])
+	})
+}
+
+// discard_tab closes tab if it's still in tabs, focus moves to the next tab if it had it
+func (g *Editor) discard_tab(tabs *Tabs, tab Widget) {
+	i := tabs.IndexOf(tab)
+	if i < 0 {
+		return
+	}
+	was_focused := g.last_keyboard_consumer == tab
+	tabs.DiscardTab(i)
+	if current := tabs.current(); current != nil && was_focused {
+		g.Focus(current)
+	}
+}
+
+// ask_to_save shows te and asks whether to save it before it goes away
+// gone gets called if it was saved or they chose to throw the changes away
+func (g *Editor) ask_to_save(te *TextEditor, gone func()) {
+	if tabs, ok := FindParent(g.MainWidget, te).(*Tabs); ok {
+		tabs.Select(tabs.IndexOf(te))
+	}
+	AskSaveChanges(te.Title(), func(choice SaveChoice) {
+		switch choice {
+		case SaveChanges:
+			g.SaveEditor(te, gone)
+		case DiscardChanges:
+			gone()
+		}
+	})
+}
+
+// shown_elsewhere reports whether another editor has te's buffer open, so closing te loses nothing
+func (g *Editor) shown_elsewhere(te *TextEditor) bool {
+	found := false
+	Walk(g.MainWidget, func(w Widget) {
+		if other, ok := w.(*TextEditor); ok && other != te && other.buf == te.buf {
+			found = true
+		}
+	})
+	return found
+}
+
+// ConfirmQuit asks about every file with unsaved changes, quit gets called if none of them were cancelled
+func (g *Editor) ConfirmQuit(quit func()) {
+	if DialogShowing() {
+		return
+	}
+	asked := map[*TextBuffer]bool{}
+	var dirty []*TextEditor
+	Walk(g.MainWidget, func(w Widget) {
+		if te, ok := w.(*TextEditor); ok && te.Dirty() && !asked[te.buf] {
+			asked[te.buf] = true
+			dirty = append(dirty, te)
+		}
+	})
+	var ask_next func(i int)
+	ask_next = func(i int) {
+		if i == len(dirty) {
+			quit()
+			return
+		}
+		g.ask_to_save(dirty[i], func() { ask_next(i + 1) })
+	}
+	ask_next(0)
+}
+
+// HandleOpenRequests opens whatever the focused widget asked for
+func (g *Editor) HandleOpenRequests() {
+	o, ok := g.last_keyboard_consumer.(Opener)
+	if !ok {
+		return
+	}
+	if path, ok := o.TakeOpenRequest(); ok {
+		if err := g.OpenFile(path); err != nil {
+			log.Println("couldn't open:", err)
+		}
+	}
+}
+
+// EditorCommand runs action on the focused editor, for menu items
+func (g *Editor) EditorCommand(action func(te *TextEditor)) func() {
+	return func() {
+		if te := g.FocusedEditor(); te != nil {
+			action(te)
+		}
+	}
+}
+
+/*
+File tree operations, the ones that need a name ask for it with a dialog
+*/
+
+func (g *Editor) NewFileIn(ft *FileTree, dir string) {
+	AskText("New File", "Name of the new file in "+dir, "", func(name string) {
+		path, err := ft.CreateFile(dir, name)
+		if err != nil {
+			log.Println("couldn't create file:", err)
+			return
+		}
+		if err := g.OpenFile(path); err != nil {
+			log.Println("couldn't open:", err)
+		}
+	})
+}
+
+func (g *Editor) NewFolderIn(ft *FileTree, dir string) {
+	AskText("New Folder", "Name of the new folder in "+dir, "", func(name string) {
+		if _, err := ft.CreateDir(dir, name); err != nil {
+			log.Println("couldn't create folder:", err)
+		}
+	})
+}
+
+// RenamePath renames a file or directory, open editors of anything in it follow it to the new name
+func (g *Editor) RenamePath(ft *FileTree, path string) {
+	AskText("Rename", "New name for "+filepath.Base(path), filepath.Base(path), func(name string) {
+		if name == filepath.Base(path) {
+			return
+		}
+		new_path, err := ft.Rename(path, name)
+		if err != nil {
+			log.Println("couldn't rename:", err)
+			return
+		}
+		Walk(g.MainWidget, func(w Widget) {
+			te, ok := w.(*TextEditor)
+			if !ok {
+				return
+			}
+			if p := te.buf.filepath; p == path || strings.HasPrefix(p, path+string(filepath.Separator)) {
+				te.buf.SetPath(new_path + strings.TrimPrefix(p, path))
+			}
+		})
+	})
+}
+
+func (g *Editor) DeletePath(ft *FileTree, path string) {
+	Confirm("Delete", "Delete "+path+"?", func() {
+		if err := ft.Delete(path); err != nil {
+			log.Println("couldn't delete:", err)
+		}
+	})
+}
@@ -0,0 +1,573 @@
+package main
+
+import (
+	"encoding/json"
+	"image"
+	"image/color"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text"
+	"golang.org/x/image/font"
+)
+
+// Completion, a popup under the cursor of what could go there
+// the language server suggests things when there's one, otherwise it's the words in the buffer and the language's keywords
+
+// how many items the popup shows at once
+const completion_rows = 10
+
+// logical pixels
+const completion_padding = 3
+const completion_max_width = 600
+
+// the LSP's completion item kinds, the ones that get their own icon
+const (
+	completion_text        = 1
+	completion_method      = 2
+	completion_function    = 3
+	completion_constructor = 4
+	completion_field       = 5
+	completion_variable    = 6
+	completion_class       = 7
+	completion_interface   = 8
+	completion_module      = 9
+	completion_property    = 10
+	completion_enum        = 13
+	completion_keyword     = 14
+	completion_snippet     = 15
+	completion_enum_member = 20
+	completion_constant    = 21
+	completion_struct      = 22
+	completion_type_param  = 25
+)
+
+// completion_icon is the letter and colour an item's kind is shown with
+func completion_icon(kind int) (string, color.Color) {
+	switch kind {
+	case completion_method, completion_function, completion_constructor:
+		return "f", Style.PurpleStrong
+	case completion_field, completion_property:
+		return "p", Style.AquaStrong
+	case completion_variable:
+		return "v", Style.BlueStrong
+	case completion_class, completion_struct, completion_interface, completion_enum, completion_type_param:
+		return "t", Style.YellowStrong
+	case completion_module:
+		return "m", Style.Gray
+	case completion_keyword:
+		return "k", Style.RedStrong
+	case completion_snippet:
+		return "s", Style.GreenStrong
+	case completion_constant, completion_enum_member:
+		return "c", Style.OrangeStrong
+	}
+	return "w", Style.Gray
+}
+
+// CompletionItem is one suggestion
+type CompletionItem struct {
+	Label  string
+	Detail string //the type or signature, shown after the label
+	Kind   int
+
+	sort    string //what equally good matches are ordered by
+	filter  string //what typing is matched against
+	text    string //what goes in, in snippet syntax if snippet
+	snippet bool
+	edit    *TextEdit  //what to replace instead of the word being typed, positions from when it was asked for
+	extra   []TextEdit //edits that go with it, like adding an import
+}
+
+type completion_match struct {
+	item    *CompletionItem
+	score   int
+	matched []int //byte offsets of the label that matched what was typed
+}
+
+// CompletionPopup is the list of suggestions, it follows what's typed until it's accepted or closed
+type CompletionPopup struct {
+	items      []CompletionItem
+	shown      []completion_match //the items matching what's been typed, best first
+	selected   int
+	scroll     int
+	start      Cursor //where the word being completed starts
+	asked      Cursor //where the cursor was when the items were asked for
+	typed      string //what shown was filtered by
+	incomplete bool   //the server didn't send everything, typing more asks again
+}
+
+// CompletionRequest is the focused editor asking for suggestions, Trigger is the character typed that asked
+type CompletionRequest struct {
+	Trigger    string
+	incomplete bool //asking again because the last answer wasn't everything
+	id         int
+}
+
+/*
+Fuzzy matching
+*/
+
+// FuzzyMatch reports whether pattern's characters all appear in s in order, ignoring case
+// the score is higher for matches at the start, at word starts and in runs, matched is the offsets of s that matched
+func FuzzyMatch(pattern, s string) (score int, matched []int, ok bool) {
+	lower := func(b byte) byte {
+		if b >= 'A' && b <= 'Z' {
+			return b + 'a' - 'A'
+		}
+		return b
+	}
+	prev := -1
+	j := 0
+	for i := 0; i < len(pattern); i++ {
+		for j < len(s) && lower(s[j]) != lower(pattern[i]) {
+			j++
+		}
+		if j == len(s) {
+			return 0, nil, false
+		}
+		switch {
+		case j == 0:
+			score += 10
+		case j == prev+1:
+			score += 6
+		case !is_word_byte(s[j-1]) || s[j-1] == '_' || s[j] >= 'A' && s[j] <= 'Z' && s[j-1] >= 'a' && s[j-1] <= 'z':
+			score += 4
+		default:
+			score -= min(j-prev-1, 3)
+		}
+		if s[j] == pattern[i] {
+			score++
+		}
+		matched = append(matched, j)
+		prev = j
+		j++
+	}
+	return score, matched, true
+}
+
+// filter shows the items that match typed, best first
+func (p *CompletionPopup) filter(typed string) {
+	p.typed = typed
+	p.shown = p.shown[:0]
+	for i := range p.items {
+		item := &p.items[i]
+		score, _, ok := FuzzyMatch(typed, item.filter)
+		if !ok {
+			continue
+		}
+		//the label is what's drawn, so highlight where typed matches it
+		_, matched, _ := FuzzyMatch(typed, item.Label)
+		p.shown = append(p.shown, completion_match{item: item, score: score, matched: matched})
+	}
+	sort.SliceStable(p.shown, func(i, j int) bool {
+		a, b := p.shown[i], p.shown[j]
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		if a.item.sort != b.item.sort {
+			return a.item.sort < b.item.sort
+		}
+		return a.item.Label < b.item.Label
+	})
+	p.selected, p.scroll = 0, 0
+}
+
+func (p *CompletionPopup) move(by int) {
+	if len(p.shown) == 0 {
+		return
+	}
+	p.selected = (p.selected + by + len(p.shown)) % len(p.shown)
+	if p.selected < p.scroll {
+		p.scroll = p.selected
+	} else if p.selected >= p.scroll+completion_rows {
+		p.scroll = p.selected - completion_rows + 1
+	}
+}
+
+/*
+The editor's side
+*/
+
+// RequestCompletion asks for suggestions at the cursor, the Editor answers next update
+func (te *TextEditor) RequestCompletion() {
+	te.request_completion(CompletionRequest{})
+}
+
+func (te *TextEditor) request_completion(req CompletionRequest) {
+	if te.ReadOnly {
+		return
+	}
+	te.completions_asked++
+	req.id = te.completions_asked
+	te.completion_request = &req
+}
+
+// TakeCompletionRequest returns what the editor wants suggestions for since it was last asked, if anything
+func (te *TextEditor) TakeCompletionRequest() (CompletionRequest, bool) {
+	req := te.completion_request
+	te.completion_request = nil
+	if req == nil {
+		return CompletionRequest{}, false
+	}
+	return *req, true
+}
+
+// ShowCompletions opens the popup with items, asked is where the cursor was when they were asked for
+func (te *TextEditor) ShowCompletions(items []CompletionItem, incomplete bool, asked Cursor) {
+	p := &CompletionPopup{items: items, start: te.WordStart(te.cursor), asked: asked, incomplete: incomplete}
+	line := te.buf.lines[te.cursor.row]
+	p.filter(line[p.start.col:te.cursor.col])
+	if len(p.shown) == 0 {
+		te.CloseCompletion()
+		return
+	}
+	te.completion = p
+}
+
+func (te *TextEditor) CloseCompletion() {
+	te.completion = nil
+}
+
+// update_completion filters the popup by what's been typed since it opened, closing it once the cursor leaves the word
+func (te *TextEditor) update_completion() {
+	p := te.completion
+	if p == nil {
+		return
+	}
+	if te.cursor.row != p.start.row || te.cursor.col < p.start.col {
+		te.CloseCompletion()
+		return
+	}
+	typed := te.buf.lines[te.cursor.row][p.start.col:te.cursor.col]
+	if typed == p.typed {
+		return
+	}
+	for i := 0; i < len(typed); i++ {
+		if !is_word_byte(typed[i]) {
+			te.CloseCompletion()
+			return
+		}
+	}
+	if p.incomplete {
+		te.request_completion(CompletionRequest{incomplete: true})
+	}
+	p.filter(typed)
+	if len(p.shown) == 0 && !p.incomplete {
+		te.CloseCompletion()
+	}
+}
+
+// CompletionKeys handles the keys the popup takes while it's open, returns true if the editor shouldn't see them
+func (te *TextEditor) CompletionKeys() bool {
+	p := te.completion
+	if p == nil {
+		return false
+	}
+	switch {
+	case KeyJustPressedOrKeyRepeated(ebiten.KeyDown):
+		p.move(1)
+	case KeyJustPressedOrKeyRepeated(ebiten.KeyUp):
+		p.move(-1)
+	case KeyJustPressedOrKeyRepeated(ebiten.KeyPageDown):
+		p.move(min(completion_rows, len(p.shown)-1-p.selected))
+	case KeyJustPressedOrKeyRepeated(ebiten.KeyPageUp):
+		p.move(-min(completion_rows, p.selected))
+	case KeyJustPressedOrKeyRepeated(ebiten.KeyEnter), KeyJustPressedOrKeyRepeated(ebiten.KeyTab):
+		if p.selected < len(p.shown) {
+			te.AcceptCompletion(p.shown[p.selected].item)
+		}
+		te.CloseCompletion()
+	case KeyJustPressedOrKeyRepeated(ebiten.KeyEscape):
+		te.CloseCompletion()
+	default:
+		return false
+	}
+	return true
+}
+
+// AcceptCompletion puts item in place of the word being typed
+func (te *TextEditor) AcceptCompletion(item *CompletionItem) {
+	p := te.completion
+	main := TextEdit{From: p.start, To: te.cursor, Text: item.text}
+	if e := item.edit; e != nil && e.From.row == te.cursor.row && !te.cursor.Before(e.From) {
+		main.From, main.To = e.From, te.cursor
+		//the edit was for the text as it was when asked, what's been typed since goes too
+		if e.To.row == te.cursor.row && te.cursor.Before(e.To) && p.asked.row == te.cursor.row {
+			main.To = Cursor{row: e.To.row, col: e.To.col + te.cursor.col - p.asked.col}
+		}
+	}
+	var stops []SnippetStop
+	if item.snippet {
+		main.Text, stops = ParseSnippet(main.Text)
+	}
+
+	//apply them from the end of the file back so the ones still to do keep their positions
+	edits := append([]TextEdit{main}, item.extra...)
+	sort.SliceStable(edits, func(i, j int) bool { return edits[j].From.Before(edits[i].From) })
+	var start *Mark
+	for _, e := range edits {
+		te.buf.Replace(e.From, e.To, e.Text)
+		if e == main {
+			start = te.buf.AddMark(e.From, false)
+		}
+	}
+	base := start.Cursor
+	te.buf.RemoveMark(start)
+
+	if len(stops) > 0 {
+		te.StartSnippet(base, main.Text, stops)
+	} else {
+		te.cursor = offset_cursor(base, main.Text, len(main.Text))
+	}
+	te.Interacted()
+	te.MarkRedraw()
+}
+
+// completion_rect is where the popup goes, under the word being completed or above it if there's no room below
+func (te *TextEditor) completion_rect(bounds image.Rectangle) image.Rectangle {
+	p := te.completion
+	width := 0
+	for _, m := range p.shown {
+		width = max(width, font.MeasureString(CodeFontFace, m.item.Label).Round()+font.MeasureString(MainFontFace, m.item.Detail).Round())
+	}
+	width = max(Px(150), min(width+te.completion_row_height()+4*Px(completion_padding), Px(completion_max_width)))
+	height := min(completion_rows, len(p.shown)) * te.completion_row_height()
+
+	line := te.buf.lines[p.start.row]
+	x := te.text_origin().X + font.MeasureString(CodeFontFace, line[:p.start.col]).Round() - te.completion_row_height()
+	y := te.Min.Y + te.line_top(p.start.row) + CodeLineHeight()
+	r := image.Rect(x, y, x+width, y+height)
+	if r.Max.Y > bounds.Max.Y {
+		r = r.Sub(image.Pt(0, height+CodeLineHeight()))
+	}
+	if r.Max.X > bounds.Max.X {
+		r = r.Sub(image.Pt(r.Max.X-bounds.Max.X, 0))
+	}
+	if r.Min.X < bounds.Min.X {
+		r = r.Add(image.Pt(bounds.Min.X-r.Min.X, 0))
+	}
+	return r
+}
+
+func (te *TextEditor) completion_row_height() int {
+	return max(CodeLineHeight(), MainLineHeight()) + 2*Px(completion_padding)
+}
+
+// DrawCompletion draws the popup, over everything else so it's done after the whole layout is drawn
+func (te *TextEditor) DrawCompletion(target *ebiten.Image) {
+	p := te.completion
+	if p == nil || len(p.shown) == 0 {
+		return
+	}
+	r := te.completion_rect(target.Bounds())
+	DrawRect(target, r, Style.BGColorMuted)
+	clipped, ok := target.SubImage(r).(*ebiten.Image)
+	if !ok {
+		return
+	}
+	row_height := te.completion_row_height()
+	pad := Px(completion_padding)
+	for i := p.scroll; i < len(p.shown) && i < p.scroll+completion_rows; i++ {
+		m := p.shown[i]
+		row := image.Rect(r.Min.X, r.Min.Y+(i-p.scroll)*row_height, r.Max.X, r.Min.Y+(i-p.scroll+1)*row_height)
+		if i == p.selected {
+			DrawRect(clipped, row, Style.BlueMuted)
+		}
+		letter, col := completion_icon(m.item.Kind)
+		icon := image.Rect(row.Min.X+pad, row.Min.Y+pad, row.Min.X+row_height-pad, row.Max.Y-pad)
+		DrawRect(clipped, icon, Translucent(col, 0.3))
+		text.Draw(clipped, letter, MainFontFace, icon.Min.X+(icon.Dx()-font.MeasureString(MainFontFace, letter).Round())/2, icon.Min.Y+(icon.Dy()-MainLineHeight())/2+MainFontPeriodFromTop, col)
+
+		x := row.Min.X + row_height + pad
+		baseline := row.Min.Y + pad + CodeFontPeriodFromTop
+		matched := map[int]bool{}
+		for _, j := range m.matched {
+			matched[j] = true
+		}
+		for j, r := range m.item.Label {
+			c := Style.FGColorMuted
+			if matched[j] {
+				c = Style.FGColorStrong
+			}
+			text.Draw(clipped, string(r), CodeFontFace, x+font.MeasureString(CodeFontFace, m.item.Label[:j]).Round(), baseline, c)
+		}
+		x += font.MeasureString(CodeFontFace, m.item.Label).Round() + 2*pad
+		text.Draw(clipped, m.item.Detail, MainFontFace, x, row.Min.Y+pad+MainFontPeriodFromTop, Style.Gray)
+	}
+	DrawBorders(target, r, Style.FGColorMuted)
+}
+
+/*
+Where suggestions come from
+*/
+
+var identifier_regex = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]*`)
+
+// WordCompletions is what we can suggest without a language server, the language's keywords and the words in the buffer
+func WordCompletions(te *TextEditor) []CompletionItem {
+	items := []CompletionItem{}
+	seen := map[string]bool{}
+	if te.highlighter != nil {
+		for _, w := range te.highlighter.words {
+			if seen[w.Word] {
+				continue
+			}
+			seen[w.Word] = true
+			kind := completion_keyword
+			switch w.Scope {
+			case "type":
+				kind = completion_class
+			case "function":
+				kind = completion_function
+			case "number":
+				kind = completion_constant
+			}
+			items = append(items, CompletionItem{Label: w.Word, Kind: kind, filter: w.Word, text: w.Word, sort: "0"})
+		}
+	}
+	for row, line := range te.buf.lines {
+		for _, loc := range identifier_regex.FindAllStringIndex(line, -1) {
+			word := line[loc[0]:loc[1]]
+			//the word being typed doesn't suggest itself
+			if row == te.cursor.row && loc[0] <= te.cursor.col && te.cursor.col <= loc[1] {
+				continue
+			}
+			if len(word) < 2 || seen[word] {
+				continue
+			}
+			seen[word] = true
+			items = append(items, CompletionItem{Label: word, Kind: completion_text, filter: word, text: word, sort: "1"})
+		}
+	}
+	return items
+}
+
+type lsp_completion_params struct {
+	LSPTextDocumentPosition
+	Context struct {
+		TriggerKind      int    `json:"triggerKind"`
+		TriggerCharacter string `json:"triggerCharacter,omitempty"`
+	} `json:"context"`
+}
+
+type lsp_completion_item struct {
+	Label            string `json:"label"`
+	Kind             int    `json:"kind"`
+	Detail           string `json:"detail"`
+	SortText         string `json:"sortText"`
+	FilterText       string `json:"filterText"`
+	InsertText       string `json:"insertText"`
+	InsertTextFormat int    `json:"insertTextFormat"` //2 for snippets
+	TextEdit         *struct {
+		Range   *LSPRange `json:"range"`
+		Insert  *LSPRange `json:"insert"` //an InsertReplaceEdit, in case a server sends one anyway
+		NewText string    `json:"newText"`
+	} `json:"textEdit"`
+	AdditionalTextEdits []LSPTextEdit `json:"additionalTextEdits"`
+}
+
+// parse_completions reads the answer to a completion request, a list of items or a CompletionList
+func parse_completions(ls *LanguageServer, tb *TextBuffer, raw json.RawMessage) ([]CompletionItem, bool, error) {
+	var list struct {
+		IsIncomplete bool                  `json:"isIncomplete"`
+		Items        []lsp_completion_item `json:"items"`
+	}
+	s := strings.TrimSpace(string(raw))
+	switch {
+	case s == "" || s == "null":
+		return nil, false, nil
+	case strings.HasPrefix(s, "["):
+		if err := json.Unmarshal(raw, &list.Items); err != nil {
+			return nil, false, err
+		}
+	default:
+		if err := json.Unmarshal(raw, &list); err != nil {
+			return nil, false, err
+		}
+	}
+	items := make([]CompletionItem, 0, len(list.Items))
+	for _, it := range list.Items {
+		item := CompletionItem{
+			Label:   it.Label,
+			Detail:  it.Detail,
+			Kind:    it.Kind,
+			sort:    it.SortText,
+			filter:  it.FilterText,
+			text:    it.InsertText,
+			snippet: it.InsertTextFormat == 2,
+		}
+		if item.sort == "" {
+			item.sort = it.Label
+		}
+		if item.filter == "" {
+			item.filter = it.Label
+		}
+		if item.text == "" {
+			item.text = it.Label
+		}
+		if e := it.TextEdit; e != nil {
+			r := e.Range
+			if r == nil {
+				r = e.Insert
+			}
+			if r != nil {
+				edit := ls.Edit(tb, LSPTextEdit{Range: *r, NewText: e.NewText})
+				item.edit = &edit
+				item.text = e.NewText
+			}
+		}
+		for _, e := range it.AdditionalTextEdits {
+			item.extra = append(item.extra, ls.Edit(tb, e))
+		}
+		items = append(items, item)
+	}
+	return items, list.IsIncomplete, nil
+}
+
+// HandleCompletionRequests asks for the suggestions the focused editor wants
+func (g *Editor) HandleCompletionRequests() {
+	te := g.FocusedEditor()
+	if te == nil {
+		return
+	}
+	req, ok := te.TakeCompletionRequest()
+	if !ok {
+		return
+	}
+	ls := LanguageServerFor(te.buf)
+	if ls == nil || ls.caps.CompletionProvider == nil {
+		te.ShowCompletions(WordCompletions(te), false, te.cursor)
+		return
+	}
+	params := lsp_completion_params{LSPTextDocumentPosition: ls.DocumentPosition(te.buf, te.cursor)}
+	switch {
+	case req.incomplete:
+		params.Context.TriggerKind = 3
+	case req.Trigger != "":
+		params.Context.TriggerKind = 2
+		params.Context.TriggerCharacter = req.Trigger
+	default:
+		params.Context.TriggerKind = 1
+	}
+	asked := te.cursor
+	ls.Request("textDocument/completion", params, func(result json.RawMessage, err error) {
+		if err != nil {
+			log.Println("completion:", err)
+			return
+		}
+		//a newer request is on its way, or the user has gone elsewhere
+		if te.completions_asked != req.id || g.FocusedEditor() != te || te.cursor.row != asked.row {
+			return
+		}
+		items, incomplete, err := parse_completions(ls, te.buf, result)
+		if err != nil {
+			log.Println("completion:", err)
+			return
+		}
+		te.ShowCompletions(items, incomplete, asked)
+	})
+}
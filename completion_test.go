@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestFuzzyMatch(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		ok         bool
+		score      int
+		matched    []int
+	}{
+		{"", "abc", true, 0, nil},
+		{"abc", "abc", true, 25, []int{0, 1, 2}},
+		{"ABC", "abc", true, 22, []int{0, 1, 2}}, //case only counts for a little
+		{"ac", "abc", true, 11, []int{0, 2}},
+		{"fb", "fooBar", true, 15, []int{0, 3}},
+		{"fB", "fooBar", true, 16, []int{0, 3}},
+		{"b", "foo_bar", true, 5, []int{4}},
+		{"b", "foo.bar", true, 5, []int{4}},
+		{"b", "foobar", true, -2, []int{3}},
+		{"xyz", "abc", false, 0, nil},
+		{"ab", "ba", false, 0, nil},
+		{"abcd", "abc", false, 0, nil},
+	}
+	for _, test := range tests {
+		score, matched, ok := FuzzyMatch(test.pattern, test.s)
+		if ok != test.ok || score != test.score || !reflect.DeepEqual(matched, test.matched) {
+			t.Errorf("%q in %q: got %v %d %v, want %v %d %v", test.pattern, test.s, ok, score, matched, test.ok, test.score, test.matched)
+		}
+	}
+
+	//better matches come first
+	better := []struct{ pattern, a, b string }{
+		{"fmt", "fmt", "formatting"},
+		{"pl", "Println", "Sample"},
+		{"nw", "NewWriter", "unwrap"},
+	}
+	for _, test := range better {
+		a, _, _ := FuzzyMatch(test.pattern, test.a)
+		b, _, _ := FuzzyMatch(test.pattern, test.b)
+		if a <= b {
+			t.Errorf("%q scores %d in %q and %d in %q", test.pattern, a, test.a, b, test.b)
+		}
+	}
+}
+
+func TestParseCompletions(t *testing.T) {
+	ls := &LanguageServer{encoding: "utf-16"}
+	tb := NewTextBuffer("package main\n\tx := \"é😀\".fo\n")
+	edit := func(from_row, from_col, to_row, to_col int, text string) TextEdit {
+		return TextEdit{From: Cursor{row: from_row, col: from_col}, To: Cursor{row: to_row, col: to_col}, Text: text}
+	}
+	tests := []struct {
+		name       string
+		raw        string
+		items      []CompletionItem
+		incomplete bool
+	}{
+		{"null", `null`, nil, false},
+		{"empty", ``, nil, false},
+		{"list", `[{"label": "Println", "kind": 3, "detail": "func(a ...any)"}]`, []CompletionItem{
+			{Label: "Println", Kind: 3, Detail: "func(a ...any)", sort: "Println", filter: "Println", text: "Println"},
+		}, false},
+		{"completion list", `{"isIncomplete": true, "items": [
+			{"label": "Fprint", "sortText": "02", "filterText": "fprint", "insertText": "Fprint(${1:w})", "insertTextFormat": 2},
+			{"label": "Sprint"}
+		]}`, []CompletionItem{
+			{Label: "Fprint", sort: "02", filter: "fprint", text: "Fprint(${1:w})", snippet: true},
+			{Label: "Sprint", sort: "Sprint", filter: "Sprint", text: "Sprint"},
+		}, true},
+		{"text edit in utf-16", `{"items": [{"label": "foo", "insertText": "ignored",
+			"textEdit": {"range": {"start": {"line": 1, "character": 12}, "end": {"line": 1, "character": 14}}, "newText": "foo"},
+			"additionalTextEdits": [{"range": {"start": {"line": 1, "character": 0}, "end": {"line": 1, "character": 0}}, "newText": "// x\n"}]
+		}]}`, []CompletionItem{
+			{Label: "foo", sort: "foo", filter: "foo", text: "foo",
+				edit:  &TextEdit{From: Cursor{row: 1, col: 15}, To: Cursor{row: 1, col: 17}, Text: "foo"},
+				extra: []TextEdit{edit(1, 0, 1, 0, "// x\n")}},
+		}, false},
+		{"insert replace edit", `[{"label": "foo",
+			"textEdit": {"insert": {"start": {"line": 0, "character": 0}, "end": {"line": 0, "character": 3}},
+				"replace": {"start": {"line": 0, "character": 0}, "end": {"line": 0, "character": 7}}, "newText": "foo"}
+		}]`, []CompletionItem{
+			{Label: "foo", sort: "foo", filter: "foo", text: "foo", edit: &TextEdit{To: Cursor{col: 3}, Text: "foo"}},
+		}, false},
+	}
+	for _, test := range tests {
+		items, incomplete, err := parse_completions(ls, tb, json.RawMessage(test.raw))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(items, test.items) && !(len(items) == 0 && len(test.items) == 0) {
+			t.Errorf("%s: got %+v, want %+v", test.name, items, test.items)
+		}
+		if incomplete != test.incomplete {
+			t.Errorf("%s: incomplete %v", test.name, incomplete)
+		}
+	}
+	if _, _, err := parse_completions(ls, tb, json.RawMessage(`{"items": 3}`)); err == nil {
+		t.Errorf("malformed completions didn't give an error")
+	}
+}
+
+// accept shows items in te with the cursor at c and accepts the first one shown
+func accept(t *testing.T, te *TextEditor, c Cursor, items []CompletionItem) {
+	t.Helper()
+	te.cursor = c
+	te.ShowCompletions(items, false, c)
+	if te.completion == nil || len(te.completion.shown) == 0 {
+		t.Fatalf("nothing matched")
+	}
+	te.AcceptCompletion(te.completion.shown[0].item)
+}
+
+func TestAcceptCompletion(t *testing.T) {
+	const src = "package main\n\nfunc f() {\n\tfmt.Pr\n}"
+	add_import := TextEdit{From: Cursor{row: 1}, To: Cursor{row: 1}, Text: "import \"fmt\"\n"}
+
+	//a snippet with an import added above it, which moves it down a line
+	te := NewTextEditor(NewTextBuffer(src))
+	accept(t, te, Cursor{row: 3, col: 7}, []CompletionItem{
+		{Label: "Println", filter: "Println", text: "Println(${1:a})$0", snippet: true, extra: []TextEdit{add_import}},
+	})
+	want := "package main\nimport \"fmt\"\n\nfunc f() {\n\tfmt.Println(a)\n}"
+	if got := te.buf.Text(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if te.cursor != (Cursor{row: 4, col: 14}) || te.snippet == nil {
+		t.Errorf("cursor at %+v, want the end of the first placeholder", te.cursor)
+	}
+	te.NextSnippetStop()
+	if te.cursor != (Cursor{row: 4, col: 15}) || te.snippet != nil {
+		t.Errorf("after the last stop the cursor is at %+v", te.cursor)
+	}
+
+	//the server's edit replaces what was there when it was asked, and what's been typed since
+	te = NewTextEditor(NewTextBuffer(src))
+	asked := Cursor{row: 3, col: 7}
+	te.cursor = asked
+	te.buf.Replace(asked, asked, "i")
+	item := CompletionItem{Label: "Printf", filter: "Printf", text: "Printf",
+		edit:  &TextEdit{From: Cursor{row: 3, col: 1}, To: Cursor{row: 3, col: 7}, Text: "Printf"},
+		extra: []TextEdit{add_import},
+	}
+	te.cursor = Cursor{row: 3, col: 8}
+	te.ShowCompletions([]CompletionItem{item}, false, asked)
+	te.AcceptCompletion(te.completion.shown[0].item)
+	want = "package main\nimport \"fmt\"\n\nfunc f() {\n\tPrintf\n}"
+	if got := te.buf.Text(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if te.cursor != (Cursor{row: 4, col: 7}) {
+		t.Errorf("cursor at %+v, want after Printf", te.cursor)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// ContextMenu is what right clicking w at (x, y) offers, nil if w doesn't have one
+func (g *Editor) ContextMenu(w Widget, x, y int) []MenuItem {
+	switch w := w.(type) {
+	case *TextEditor:
+		return g.editor_context_menu(w)
+	case *Tabs:
+		if i := w.TabAt(x, y); i >= 0 {
+			return g.tab_context_menu(w, w.Tabs[i])
+		}
+	case *FileTree:
+		return g.file_context_menu(w, x, y)
+	case *SettingsEditor:
+		return g.settings_context_menu(w)
+	case *ProblemsPanel:
+		return g.problems_context_menu(w)
+	case *OutputPanel:
+		return g.output_context_menu(w)
+	case *TestExplorer:
+		return g.test_explorer_context_menu(w)
+	case *Terminal:
+		return g.terminal_context_menu(w)
+	case *CallStackPanel, *DebugConsole:
+		return g.debug_context_menu()
+	case *VariablesPanel:
+		return append([]MenuItem{
+			NewActionMenuItem("&Copy Value", KeyShortcut{}, w.CopyValue).WhenEnabled(func() bool { return w.selected >= 0 && w.selected < len(w.vars) }),
+			NewMenuSeparator(),
+		}, g.debug_context_menu()...)
+	}
+	return nil
+}
+
+func (g *Editor) editor_context_menu(te *TextEditor) []MenuItem {
+	writable := func() bool { return !te.ReadOnly }
+	has_word := func() bool { return te.WordAt(te.cursor) != "" }
+	return []MenuItem{
+		NewActionMenuItem("Cu&t", KeyShortcut{mod_ctrl: true, key: ebiten.KeyX}, te.Cut).WhenEnabled(writable),
+		NewActionMenuItem("&Copy", KeyShortcut{mod_ctrl: true, key: ebiten.KeyC}, te.Copy),
+		NewActionMenuItem("&Paste", KeyShortcut{mod_ctrl: true, key: ebiten.KeyV}, te.Paste).WhenEnabled(writable),
+		NewMenuSeparator(),
+		NewActionMenuItem("Go to &Definition", KeyShortcut{key: ebiten.KeyF12}, g.GoToDefinition).WhenEnabled(has_word),
+		NewActionMenuItem("Pee&k Definition", KeyShortcut{mod_alt: true, key: ebiten.KeyF12}, g.PeekDefinition).WhenEnabled(has_word),
+		NewActionMenuItem("Find &References", KeyShortcut{mod_shift: true, key: ebiten.KeyF12}, g.FindReferences).WhenEnabled(has_word),
+		NewMenuSeparator(),
+		NewActionMenuItem("Toggle &Breakpoint", KeyShortcut{key: ebiten.KeyF9}, func() { ToggleBreakpoint(te.buf, te.cursor.row) }),
+		NewActionMenuItem("Breakpoint Co&ndition...", KeyShortcut{}, g.EditBreakpointCondition),
+	}
+}
+
+// the debug panels' menus are the stepping commands
+func (g *Editor) debug_context_menu() []MenuItem {
+	return []MenuItem{
+		NewActionMenuItem("C&ontinue", KeyShortcut{key: ebiten.KeyF5}, with_session((*DebugSession).Continue)).WhenEnabled(DebugIsStopped),
+		NewActionMenuItem("Step &Over", KeyShortcut{key: ebiten.KeyF8}, with_session((*DebugSession).StepOver)).WhenEnabled(DebugIsStopped),
+		NewActionMenuItem("Step &Into", KeyShortcut{key: ebiten.KeyF7}, with_session((*DebugSession).StepIn)).WhenEnabled(DebugIsStopped),
+		NewActionMenuItem("Step O&ut", KeyShortcut{mod_shift: true, key: ebiten.KeyF8}, with_session((*DebugSession).StepOut)).WhenEnabled(DebugIsStopped),
+		NewMenuSeparator(),
+		NewActionMenuItem("&Stop Debugging", KeyShortcut{mod_shift: true, key: ebiten.KeyF5}, StopDebugging).WhenEnabled(Debugging),
+	}
+}
+
+// the tab is looked up again when the item runs, it might have moved while the menu was up
+func (g *Editor) tab_context_menu(tabs *Tabs, tab Widget) []MenuItem {
+	_, is_editor := tab.(*TextEditor)
+	can_split := func() bool { return is_editor || len(tabs.Tabs) > 1 }
+	return []MenuItem{
+		NewActionMenuItem("&Close", KeyShortcut{}, func() { tabs.CloseTab(tabs.IndexOf(tab)) }),
+		NewActionMenuItem("Close &Others", KeyShortcut{}, func() { tabs.CloseOthers(tabs.IndexOf(tab)) }).WhenEnabled(func() bool { return len(tabs.Tabs) > 1 }),
+		NewMenuSeparator(),
+		NewActionMenuItem("Split &Right", KeyShortcut{}, func() { g.SplitTab(tabs, tab, SplitHorizontal) }).WhenEnabled(can_split),
+		NewActionMenuItem("Split &Down", KeyShortcut{}, func() { g.SplitTab(tabs, tab, SplitVertical) }).WhenEnabled(can_split),
+	}
+}
+
+func (g *Editor) file_context_menu(ft *FileTree, x, y int) []MenuItem {
+	path, is_dir := ft.TargetAt(x, y)
+	dir := path
+	if !is_dir {
+		dir = filepath.Dir(path)
+	}
+	not_root := func() bool { return path != ft.Root() }
+
+	items := []MenuItem{}
+	if !is_dir {
+		items = append(items,
+			NewActionMenuItem("&Open", KeyShortcut{}, func() { g.OpenFile(path) }),
+			NewMenuSeparator(),
+		)
+	}
+	return append(items,
+		NewActionMenuItem("New &File", KeyShortcut{}, func() { g.NewFileIn(ft, dir) }),
+		NewActionMenuItem("New Fo&lder", KeyShortcut{}, func() { g.NewFolderIn(ft, dir) }),
+		NewMenuSeparator(),
+		NewActionMenuItem("&Rename", KeyShortcut{}, func() { g.RenamePath(ft, path) }).WhenEnabled(not_root),
+		NewActionMenuItem("&Delete", KeyShortcut{}, func() { g.DeletePath(ft, path) }).WhenEnabled(not_root),
+		NewMenuSeparator(),
+		NewActionMenuItem("Copy &Path", KeyShortcut{}, func() { ClipboardWrite(path) }),
+		NewActionMenuItem("Refre&sh", KeyShortcut{}, ft.Refresh),
+	)
+}
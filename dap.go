@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// The debug adapter protocol, framed like JSON-RPC but with its own messages
+// we send requests and get a response to each, the adapter sends events whenever something happens
+// like RPCConn, responses and events are handed to the UI goroutine through Dispatch
+
+// dap_message is anything the adapter sends, which fields are set depends on Type
+type dap_message struct {
+	Seq        int             `json:"seq"`
+	Type       string          `json:"type"` //request, response or event
+	Command    string          `json:"command,omitempty"`
+	Arguments  json.RawMessage `json:"arguments,omitempty"`
+	RequestSeq int             `json:"request_seq,omitempty"`
+	Success    bool            `json:"success,omitempty"`
+	Message    string          `json:"message,omitempty"`
+	Body       json.RawMessage `json:"body,omitempty"`
+	Event      string          `json:"event,omitempty"`
+}
+
+type dap_request struct {
+	Seq       int         `json:"seq"`
+	Type      string      `json:"type"`
+	Command   string      `json:"command"`
+	Arguments interface{} `json:"arguments,omitempty"`
+}
+
+type dap_response struct {
+	Seq        int    `json:"seq"`
+	Type       string `json:"type"`
+	RequestSeq int    `json:"request_seq"`
+	Success    bool   `json:"success"`
+	Command    string `json:"command"`
+	Message    string `json:"message,omitempty"`
+}
+
+// DAPError is a request the adapter said failed
+type DAPError struct {
+	Command string
+	Message string
+}
+
+func (e *DAPError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Command, e.Message)
+}
+
+// DAPHandler deals with an event from the adapter, on the UI goroutine
+type DAPHandler func(event string, body json.RawMessage)
+
+// DAPConn is a connection to a debug adapter, a socket to dlv dap usually
+// anything that reads and writes framed messages will do, which is how it's tried out against a scripted adapter
+type DAPConn struct {
+	framed_conn
+	handler DAPHandler
+}
+
+func NewDAPConn(rwc io.ReadWriteCloser, handler DAPHandler) *DAPConn {
+	c := &DAPConn{handler: handler}
+	c.init(rwc)
+	go c.read_loop(c.received)
+	return c
+}
+
+// Go sends a request and has reply called with the response's body on the UI goroutine, from Dispatch
+func (c *DAPConn) Go(command string, arguments interface{}, reply func(body json.RawMessage, err error)) {
+	c.request(func(seq int) error {
+		return c.write(dap_request{Seq: seq, Type: "request", Command: command, Arguments: arguments})
+	}, reply)
+}
+
+// received handles one message from the adapter
+func (c *DAPConn) received(bs []byte) error {
+	msg := &dap_message{}
+	if err := json.Unmarshal(bs, msg); err != nil {
+		return err
+	}
+	switch msg.Type {
+	case "response":
+		reply := c.answered(msg.RequestSeq)
+		if reply == nil {
+			return nil
+		}
+		if !msg.Success {
+			reply(nil, &DAPError{Command: msg.Command, Message: msg.Message})
+		} else {
+			reply(msg.Body, nil)
+		}
+	case "event":
+		c.events <- func() { c.handler(msg.Event, msg.Body) }
+	case "request":
+		//reverse requests like runInTerminal, we don't do any of them
+		//answered from another goroutine, the adapter might be busy writing to us and not reading
+		if seq, ok := c.number(nil); ok {
+			go c.write(dap_response{Seq: seq, Type: "response", RequestSeq: msg.Seq, Command: msg.Command, Message: "not supported"})
+		}
+	}
+	return nil
+}
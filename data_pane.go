@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+var _ Widget = &DataPane{}
+
+// DataPane is a read only editor showing live numbers about the IDE itself
+type DataPane struct {
+	*TextEditor
+}
+
+func NewDataPane() *DataPane {
+	te := NewTextEditor(nil)
+	te.ReadOnly = true
+	return &DataPane{TextEditor: te}
+}
+
+// Title implements Widget
+func (dp *DataPane) Title() string {
+	return "data"
+}
+
+// Draw implements Widget
+func (dp *DataPane) Draw(target *ebiten.Image) {
+	dp.SetText(fmt.Sprintf("\nData:\ntime: %v\nTPS: %f\nFPS: %f\nTicks: %d", time.Now().Format(time.Kitchen), ebiten.ActualTPS(), ebiten.ActualFPS(), ticks))
+	dp.TextEditor.Draw(target)
+}
+
+// Describe implements Describable
+func (dp *DataPane) Describe() *WidgetDescriptor {
+	return &WidgetDescriptor{Kind: "data"}
+}
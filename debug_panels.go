@@ -0,0 +1,477 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"path/filepath"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+)
+
+// The debugger's panels, the call stack and variables of where the program is stopped and a console for evaluating things
+// the first two are ResultsPanels that keep themselves up to date from the session, like the test explorer
+
+/*
+Call stack
+*/
+
+// CallStackPanel lists the frames of the stopped thread, picking one shows its variables and jumps to it
+type CallStackPanel struct {
+	*ResultsPanel
+	version uint64 //debug_version the items were built from
+}
+
+var _ Widget = &CallStackPanel{}
+var _ Jumper = &CallStackPanel{}
+
+func NewCallStackPanel() *CallStackPanel {
+	cs := &CallStackPanel{ResultsPanel: NewResultsPanel("Call Stack", nil)}
+	cs.empty = "Not paused"
+	cs.build()
+	return cs
+}
+
+// ShowCallStack shows the call stack panel, switching to it if it's already open
+func (g *Editor) ShowCallStack() {
+	var existing *CallStackPanel
+	Walk(g.MainWidget, func(w Widget) {
+		if cs, ok := w.(*CallStackPanel); ok {
+			existing = cs
+		}
+	})
+	if existing == nil {
+		g.ShowPanel(NewCallStackPanel())
+		return
+	}
+	if tabs, ok := FindParent(g.MainWidget, existing).(*Tabs); ok {
+		g.ShowTab(tabs, existing)
+	}
+}
+
+// Refresh rebuilds the list if the session has changed since
+func (cs *CallStackPanel) Refresh() {
+	if cs.version != debug_version {
+		cs.build()
+	}
+}
+
+func (cs *CallStackPanel) build() {
+	cs.version = debug_version
+	items := []ResultItem{}
+	s := debug_session
+	if s != nil && s.State == DebugStopped {
+		for i, f := range s.Frames {
+			item := ResultItem{Label: f.Name}
+			if f.Source != nil && f.Source.Path != "" {
+				item.Preview = fmt.Sprintf("%s:%d", filepath.Base(f.Source.Path), f.Line)
+			}
+			if i == s.Frame {
+				item.Color = Style.YellowStrong
+			}
+			items = append(items, item)
+		}
+		cs.selected = s.Frame
+	}
+	cs.items = items
+	cs.selected = min(cs.selected, len(items)-1)
+	cs.hovered = -1
+	cs.clamp_scroll()
+}
+
+// pick selects frame i in the session, which jumps to it
+func (cs *CallStackPanel) pick(i int) {
+	if s := debug_session; s != nil && i >= 0 && i < len(cs.items) {
+		cs.selected = i
+		s.SelectFrame(i)
+	}
+}
+
+// TakeKeyboard implements Widget, Enter picks the selected frame
+func (cs *CallStackPanel) TakeKeyboard() {
+	if inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
+		cs.pick(cs.selected)
+		return
+	}
+	cs.ResultsPanel.TakeKeyboard()
+}
+
+// MouseOver implements Widget
+func (cs *CallStackPanel) MouseOver(x int, y int) Widget {
+	cs.ResultsPanel.MouseOver(x, y)
+	return cs
+}
+
+// LMouseDown implements Widget, clicking a frame picks it
+func (cs *CallStackPanel) LMouseDown(x int, y int) Widget {
+	cs.pick(cs.row_at(x, y))
+	return cs
+}
+
+// LMouseUp implements Widget
+func (cs *CallStackPanel) LMouseUp(x int, y int) Widget {
+	return cs
+}
+
+// RMouseDown implements Widget
+func (cs *CallStackPanel) RMouseDown(x int, y int) Widget {
+	return cs
+}
+
+// RMouseUp implements Widget, it has the debug menu's commands as a context menu
+func (cs *CallStackPanel) RMouseUp(x int, y int) Widget {
+	return cs
+}
+
+/*
+Variables
+*/
+
+// VariablesPanel is the scopes of the selected frame as a tree, a variable's children are only fetched when it's expanded
+type VariablesPanel struct {
+	*ResultsPanel
+	vars    []*DebugVar //what each item is
+	version uint64
+}
+
+var _ Widget = &VariablesPanel{}
+
+func NewVariablesPanel() *VariablesPanel {
+	vp := &VariablesPanel{ResultsPanel: NewResultsPanel("Variables", nil)}
+	vp.empty = "Not paused"
+	vp.build()
+	return vp
+}
+
+// ShowVariables shows the variables panel, switching to it if it's already open
+func (g *Editor) ShowVariables() {
+	var existing *VariablesPanel
+	Walk(g.MainWidget, func(w Widget) {
+		if vp, ok := w.(*VariablesPanel); ok {
+			existing = vp
+		}
+	})
+	if existing == nil {
+		g.ShowPanel(NewVariablesPanel())
+		return
+	}
+	if tabs, ok := FindParent(g.MainWidget, existing).(*Tabs); ok {
+		g.ShowTab(tabs, existing)
+	}
+}
+
+// Refresh rebuilds the tree if the session has changed since
+func (vp *VariablesPanel) Refresh() {
+	if vp.version != debug_version {
+		vp.build()
+	}
+}
+
+func (vp *VariablesPanel) build() {
+	vp.version = debug_version
+	items := []ResultItem{}
+	vars := []*DebugVar{}
+	var add func(v *DebugVar)
+	add = func(v *DebugVar) {
+		arrow := "  "
+		if v.HasChildren() {
+			arrow = "> "
+			if v.Expanded {
+				arrow = "v "
+			}
+		}
+		preview := v.Value
+		if v.Type != "" && v.Depth > 0 {
+			preview += "  (" + v.Type + ")"
+		}
+		if v.Expanded && v.loading {
+			preview = "..."
+		}
+		items = append(items, ResultItem{Label: strings.Repeat("    ", v.Depth) + arrow + v.Name, Preview: preview})
+		vars = append(vars, v)
+		if v.Expanded {
+			for _, c := range v.Children {
+				add(c)
+			}
+		}
+	}
+	if s := debug_session; s != nil && s.State == DebugStopped {
+		for _, scope := range s.Scopes {
+			add(scope)
+		}
+	}
+	vp.items, vp.vars = items, vars
+	vp.selected = min(vp.selected, len(items)-1)
+	vp.hovered = -1
+	vp.clamp_scroll()
+}
+
+// Toggle expands or collapses the variable of row i
+func (vp *VariablesPanel) Toggle(i int) {
+	if s := debug_session; s != nil && i >= 0 && i < len(vp.vars) {
+		vp.selected = i
+		s.Expand(vp.vars[i])
+		vp.build()
+	}
+}
+
+// TakeKeyboard implements Widget, Enter or the arrows expand and collapse
+func (vp *VariablesPanel) TakeKeyboard() {
+	if vp.selected >= 0 && vp.selected < len(vp.vars) {
+		v := vp.vars[vp.selected]
+		switch {
+		case inpututil.IsKeyJustPressed(ebiten.KeyEnter),
+			inpututil.IsKeyJustPressed(ebiten.KeyRight) && !v.Expanded,
+			inpututil.IsKeyJustPressed(ebiten.KeyLeft) && v.Expanded:
+			vp.Toggle(vp.selected)
+			return
+		}
+	}
+	vp.ResultsPanel.TakeKeyboard()
+}
+
+// MouseOver implements Widget
+func (vp *VariablesPanel) MouseOver(x int, y int) Widget {
+	vp.ResultsPanel.MouseOver(x, y)
+	return vp
+}
+
+// LMouseDown implements Widget, clicking a variable expands or collapses it
+func (vp *VariablesPanel) LMouseDown(x int, y int) Widget {
+	vp.Toggle(vp.row_at(x, y))
+	return vp
+}
+
+// LMouseUp implements Widget
+func (vp *VariablesPanel) LMouseUp(x int, y int) Widget {
+	return vp
+}
+
+// RMouseDown implements Widget, selects the row so the context menu acts on it
+func (vp *VariablesPanel) RMouseDown(x int, y int) Widget {
+	if i := vp.row_at(x, y); i >= 0 {
+		vp.selected = i
+	}
+	return vp
+}
+
+// RMouseUp implements Widget
+func (vp *VariablesPanel) RMouseUp(x int, y int) Widget {
+	return vp
+}
+
+// CopyValue copies the selected variable's value
+func (vp *VariablesPanel) CopyValue() {
+	if vp.selected >= 0 && vp.selected < len(vp.vars) {
+		ClipboardWrite(vp.vars[vp.selected].Value)
+	}
+}
+
+/*
+Console
+*/
+
+// DebugConsole is the debugger's output with a line under it for typing expressions to evaluate in the selected frame
+type DebugConsole struct {
+	image.Rectangle
+	output  *OutputPanel
+	input   string
+	history []string
+	back    int //how far back through history Up has gone, 0 is the line being typed
+	typed   string
+	focused bool
+}
+
+var _ Widget = &DebugConsole{}
+var _ Jumper = &DebugConsole{}
+
+func NewDebugConsole() *DebugConsole {
+	return &DebugConsole{output: NewOutputPanel("Debug Console", WorkspaceDir())}
+}
+
+// ShowDebugConsole shows the debug console without taking focus, making it if it isn't there
+func (g *Editor) ShowDebugConsole() *DebugConsole {
+	if g.debug_console == nil {
+		g.debug_console = NewDebugConsole()
+	}
+	g.RevealPanel(g.debug_console)
+	return g.debug_console
+}
+
+// Write adds to the output, in the output panel's ANSI colours
+func (dc *DebugConsole) Write(s string) {
+	dc.output.Write(s)
+}
+
+func (dc *DebugConsole) Clear() {
+	dc.output.Clear()
+}
+
+// evaluate runs what's been typed
+func (dc *DebugConsole) evaluate() {
+	expr := strings.TrimSpace(dc.input)
+	dc.input, dc.typed, dc.back = "", "", 0
+	if expr == "" {
+		return
+	}
+	if len(dc.history) == 0 || dc.history[len(dc.history)-1] != expr {
+		dc.history = append(dc.history, expr)
+	}
+	dc.output.scroll_to_end()
+	dc.Write("\x1b[1m> " + expr + "\x1b[0m\n")
+	if debug_session == nil {
+		dc.Write("not debugging\n")
+		return
+	}
+	debug_session.Evaluate(expr)
+}
+
+// recall puts the line by steps further back in history in the input
+func (dc *DebugConsole) recall(by int) {
+	back := max(0, min(dc.back+by, len(dc.history)))
+	if back == dc.back {
+		return
+	}
+	if dc.back == 0 {
+		dc.typed = dc.input
+	}
+	dc.back = back
+	if back == 0 {
+		dc.input = dc.typed
+	} else {
+		dc.input = dc.history[len(dc.history)-back]
+	}
+}
+
+func (dc *DebugConsole) input_height() int {
+	return CodeLineHeight() + 2*Px(output_padding)
+}
+
+// TakeJumpRequest implements Jumper, for locations in the output
+func (dc *DebugConsole) TakeJumpRequest() (NavLocation, bool) {
+	return dc.output.TakeJumpRequest()
+}
+
+// GrabsShortcut implements ShortcutGrabber, pasting goes into the input line rather than the last editor
+func (dc *DebugConsole) GrabsShortcut(ks KeyShortcut) bool {
+	return ks.mod_ctrl && !ks.mod_alt && !ks.mod_shift && ks.key == ebiten.KeyV
+}
+
+/*
+Widget
+*/
+
+// Title implements Widget
+func (dc *DebugConsole) Title() string {
+	return "Debug Console"
+}
+
+// Focus implements Focuser
+func (dc *DebugConsole) Focus() {
+	dc.focused = true
+}
+
+// KeyboardFocusLost implements Widget
+func (dc *DebugConsole) KeyboardFocusLost() {
+	dc.focused = false
+}
+
+// SetRect implements Widget
+func (dc *DebugConsole) SetRect(rect image.Rectangle) {
+	dc.Rectangle = rect
+	r := rect
+	r.Max.Y = max(r.Min.Y, r.Max.Y-dc.input_height())
+	dc.output.SetRect(r)
+}
+
+// Draw implements Widget
+func (dc *DebugConsole) Draw(target *ebiten.Image) {
+	dc.output.Draw(target)
+	r := image.Rect(dc.Min.X, dc.output.Max.Y, dc.Max.X, dc.Max.Y)
+	DrawRect(target, r, Style.BGColorStrong)
+	clipped, ok := target.SubImage(r).(*ebiten.Image)
+	if !ok {
+		return
+	}
+	line, col := "> "+dc.input, Style.FGColorStrong
+	if dc.focused {
+		line += "_"
+	} else if dc.input == "" {
+		line, col = "> evaluate an expression", Style.FGColorMuted
+	}
+	text.Draw(clipped, line, CodeFontFace, r.Min.X+Px(output_padding), r.Min.Y+Px(output_padding)+CodeFontPeriodFromTop, col)
+}
+
+// TakeKeyboard implements Widget
+func (dc *DebugConsole) TakeKeyboard() {
+	dc.input += string(ebiten.AppendInputChars(nil))
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyEnter):
+		dc.evaluate()
+	case KeyJustPressedOrKeyRepeated(ebiten.KeyBackspace):
+		if r := []rune(dc.input); len(r) > 0 {
+			dc.input = string(r[:len(r)-1])
+		}
+	case inpututil.IsKeyJustPressed(ebiten.KeyEscape):
+		dc.input, dc.back = "", 0
+	case KeyJustPressedOrKeyRepeated(ebiten.KeyUp):
+		dc.recall(1)
+	case KeyJustPressedOrKeyRepeated(ebiten.KeyDown):
+		dc.recall(-1)
+	case KeyJustPressedOrKeyRepeated(ebiten.KeyPageUp):
+		dc.output.scroll_by(-dc.output.rows_showing())
+	case KeyJustPressedOrKeyRepeated(ebiten.KeyPageDown):
+		dc.output.scroll_by(dc.output.rows_showing())
+	case ebiten.IsKeyPressed(ebiten.KeyControl) && inpututil.IsKeyJustPressed(ebiten.KeyV):
+		dc.input += strings.SplitN(ClipboardRead(), "\n", 2)[0]
+	}
+}
+
+// MouseOut implements Widget
+func (dc *DebugConsole) MouseOut() {
+	dc.output.MouseOut()
+}
+
+// MouseOver implements Widget
+func (dc *DebugConsole) MouseOver(x int, y int) Widget {
+	if image.Pt(x, y).In(dc.output.Rectangle) {
+		dc.output.MouseOver(x, y)
+	} else {
+		dc.output.MouseOut()
+		ebiten.SetCursorShape(ebiten.CursorShapeText)
+	}
+	return dc
+}
+
+// LMouseDown implements Widget, clicking a link in the output jumps to it
+func (dc *DebugConsole) LMouseDown(x int, y int) Widget {
+	dc.output.LMouseDown(x, y)
+	return dc
+}
+
+// LMouseUp implements Widget
+func (dc *DebugConsole) LMouseUp(x int, y int) Widget {
+	return dc
+}
+
+// RMouseDown implements Widget
+func (dc *DebugConsole) RMouseDown(x int, y int) Widget {
+	return dc
+}
+
+// RMouseUp implements Widget
+func (dc *DebugConsole) RMouseUp(x int, y int) Widget {
+	return dc
+}
+
+// MMouseDown implements Widget
+func (*DebugConsole) MMouseDown(x int, y int) Widget {
+	return nil
+}
+
+// MMouseUp implements Widget
+func (*DebugConsole) MMouseUp(x int, y int) Widget {
+	return nil
+}
@@ -0,0 +1,977 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+)
+
+// Debugging with delve, through its debug adapter protocol server
+// the session lives here, the call stack, variables and console panels show it and editors draw its breakpoints
+
+// dlv_command runs delve's DAP server, it's given --listen, see the debug settings
+var dlv_command = "dlv dap"
+
+// debug_program is what Start Debugging runs when the focused file isn't a test, relative to the workspace
+var debug_program = "."
+
+// how long delve gets to say where it's listening
+const dlv_start_timeout = 10 * time.Second
+
+/*
+Breakpoints, by file and line, kept on marks while the file is open so they move with edits
+*/
+
+type Breakpoint struct {
+	Path      string
+	row       int         //where it is while its file isn't open
+	buf       *TextBuffer //the buffer open on Path that mark is in, nil if there isn't one
+	mark      *Mark
+	Condition string //stops only when this is true, if it's set
+	Verified  bool   //the adapter managed to set it
+	Message   string //why it didn't, if it said
+	id        int    //the adapter's, for its events about it
+}
+
+// Row is the line the breakpoint is on, from 0
+func (bp *Breakpoint) Row() int {
+	if bp.mark != nil {
+		return bp.mark.Cursor.row
+	}
+	return bp.row
+}
+
+// attach marks the breakpoint in tb, which is open on its file
+func (bp *Breakpoint) attach(tb *TextBuffer) {
+	if bp.buf == tb {
+		return
+	}
+	bp.detach()
+	bp.buf, bp.mark = tb, tb.AddMark(Cursor{row: bp.row}, false)
+}
+
+// detach takes the breakpoint's mark out of its buffer, it stays on the line it was on
+func (bp *Breakpoint) detach() {
+	if bp.mark == nil {
+		return
+	}
+	bp.row = bp.mark.Cursor.row
+	bp.buf.RemoveMark(bp.mark)
+	bp.buf, bp.mark = nil, nil
+}
+
+// by file
+var breakpoints = map[string][]*Breakpoint{}
+
+// bumped whenever breakpoints or the session change, for panels to know to refresh
+var debug_version uint64
+
+// BreakpointAt is the breakpoint on row of path, nil if there isn't one
+func BreakpointAt(path string, row int) *Breakpoint {
+	for _, bp := range breakpoints[path] {
+		if bp.Row() == row {
+			return bp
+		}
+	}
+	return nil
+}
+
+// ToggleBreakpoint adds a breakpoint on row of tb's file, or takes away the one that's there
+func ToggleBreakpoint(tb *TextBuffer, row int) {
+	path := tb.filepath
+	if path == "" {
+		return
+	}
+	if bp := BreakpointAt(path, row); bp != nil {
+		remove_breakpoint(bp)
+	} else {
+		add_breakpoint(tb, row, "")
+	}
+	breakpoints_changed(path)
+}
+
+// SetBreakpointCondition sets the condition of the breakpoint on row, adding one if there isn't one
+// "" makes it stop every time
+func SetBreakpointCondition(tb *TextBuffer, row int, condition string) {
+	path := tb.filepath
+	if path == "" {
+		return
+	}
+	bp := BreakpointAt(path, row)
+	switch {
+	case bp == nil && condition == "":
+		return
+	case bp == nil:
+		add_breakpoint(tb, row, condition)
+	default:
+		bp.Condition = condition
+	}
+	breakpoints_changed(path)
+}
+
+func add_breakpoint(tb *TextBuffer, row int, condition string) {
+	bp := &Breakpoint{Path: tb.filepath, row: row, Condition: condition}
+	bp.attach(tb)
+	breakpoints[bp.Path] = append(breakpoints[bp.Path], bp)
+}
+
+func remove_breakpoint(bp *Breakpoint) {
+	bp.detach()
+	bps := breakpoints[bp.Path]
+	for i, b := range bps {
+		if b == bp {
+			breakpoints[bp.Path] = append(bps[:i], bps[i+1:]...)
+			break
+		}
+	}
+	if len(breakpoints[bp.Path]) == 0 {
+		delete(breakpoints, bp.Path)
+	}
+}
+
+// RemoveAllBreakpoints takes away every breakpoint, in editors open on the files or not
+func (g *Editor) RemoveAllBreakpoints() {
+	paths := []string{}
+	for path, bps := range breakpoints {
+		paths = append(paths, path)
+		for _, bp := range bps {
+			bp.detach()
+		}
+	}
+	breakpoints = map[string][]*Breakpoint{}
+	for _, path := range paths {
+		breakpoints_changed(path)
+	}
+}
+
+// attach_breakpoints marks breakpoints in the buffers open on their files, open is those buffers by path
+// a file that's been closed keeps its breakpoints on the lines they were on
+func attach_breakpoints(open map[string]*TextBuffer) {
+	for path, bps := range breakpoints {
+		for _, bp := range bps {
+			if tb := open[path]; tb != nil {
+				bp.attach(tb)
+			} else {
+				bp.detach()
+			}
+		}
+	}
+}
+
+func breakpoints_changed(path string) {
+	debug_version++
+	if s := debug_session; s != nil && s.State != DebugEnded {
+		s.send_breakpoints(path)
+	}
+}
+
+/*
+The session
+*/
+
+const (
+	DebugStarting = iota
+	DebugRunning
+	DebugStopped
+	DebugEnded
+)
+
+// dap_source and the rest are the parts of the protocol's types we use
+type dap_source struct {
+	Name string `json:"name,omitempty"`
+	Path string `json:"path,omitempty"`
+}
+
+type dap_stack_frame struct {
+	ID     int         `json:"id"`
+	Name   string      `json:"name"`
+	Source *dap_source `json:"source,omitempty"`
+	Line   int         `json:"line"`
+	Column int         `json:"column"`
+}
+
+type dap_scope struct {
+	Name               string `json:"name"`
+	VariablesReference int    `json:"variablesReference"`
+	Expensive          bool   `json:"expensive"`
+}
+
+type dap_variable struct {
+	Name               string `json:"name"`
+	Value              string `json:"value"`
+	Type               string `json:"type"`
+	VariablesReference int    `json:"variablesReference"`
+}
+
+type dap_breakpoint struct {
+	ID       int    `json:"id"`
+	Verified bool   `json:"verified"`
+	Message  string `json:"message"`
+	Line     int    `json:"line"`
+}
+
+// DebugVar is a scope or a variable in the variables panel
+// its children are only asked for once it's expanded, ref is how to ask, 0 if it has none
+type DebugVar struct {
+	Name, Value, Type string
+	Depth             int
+	Children          []*DebugVar
+	Expanded          bool
+	ref               int
+	loading           bool
+}
+
+// HasChildren is whether it can be expanded
+func (v *DebugVar) HasChildren() bool {
+	return v.ref != 0
+}
+
+// DebugSession is a program being debugged, through a connection to a debug adapter
+type DebugSession struct {
+	conn    *DAPConn
+	cmd     *exec.Cmd     //delve, nil if we didn't start the adapter
+	output  <-chan string //what delve itself prints, until it exits
+	console func(s string)
+
+	State      int
+	StopReason string
+	Frames     []dap_stack_frame //the stopped thread's call stack
+	Frame      int               //the frame selected, whose variables are showing
+	Scopes     []*DebugVar
+
+	thread       int
+	ending       bool
+	jump_request *NavLocation
+}
+
+// the session there is, nil when not debugging
+var debug_session *DebugSession
+
+// NewDebugSession talks to the debug adapter on rwc, what it and the program print goes to console
+func NewDebugSession(rwc io.ReadWriteCloser, console func(s string)) *DebugSession {
+	s := &DebugSession{console: console}
+	s.conn = NewDAPConn(rwc, s.handle)
+	return s
+}
+
+// Launch starts the program config describes, breakpoints are set once the adapter says it's ready for them
+func (s *DebugSession) Launch(config map[string]interface{}) {
+	s.conn.Go("initialize", map[string]interface{}{
+		"clientID":             "ide",
+		"clientName":           "ide",
+		"adapterID":            "go",
+		"pathFormat":           "path",
+		"linesStartAt1":        true,
+		"columnsStartAt1":      true,
+		"supportsVariableType": true,
+	}, func(body json.RawMessage, err error) {
+		if err != nil {
+			s.console(fmt.Sprintf("couldn't start debugging: %v\n", err))
+			s.end()
+			return
+		}
+		s.conn.Go("launch", config, func(body json.RawMessage, err error) {
+			if err != nil {
+				s.console(fmt.Sprintf("couldn't launch: %v\n", err))
+				s.Stop()
+			}
+		})
+	})
+}
+
+// handle deals with an event from the adapter
+func (s *DebugSession) handle(event string, body json.RawMessage) {
+	debug_version++
+	switch event {
+	case "initialized":
+		for path := range breakpoints {
+			s.send_breakpoints(path)
+		}
+		s.conn.Go("configurationDone", nil, s.log_error)
+		s.State = DebugRunning
+	case "stopped":
+		e := struct {
+			Reason   string `json:"reason"`
+			ThreadID int    `json:"threadId"`
+		}{}
+		json.Unmarshal(body, &e)
+		s.State, s.StopReason = DebugStopped, e.Reason
+		if e.ThreadID != 0 {
+			s.thread = e.ThreadID
+		}
+		s.load_stack()
+	case "continued":
+		s.resumed()
+	case "output":
+		e := struct {
+			Category string `json:"category"`
+			Output   string `json:"output"`
+		}{}
+		json.Unmarshal(body, &e)
+		switch e.Category {
+		case "telemetry":
+		case "stderr":
+			s.console("\x1b[31m" + e.Output + "\x1b[0m")
+		default:
+			s.console(e.Output)
+		}
+	case "breakpoint":
+		e := struct {
+			Breakpoint dap_breakpoint `json:"breakpoint"`
+		}{}
+		json.Unmarshal(body, &e)
+		for _, bps := range breakpoints {
+			for _, bp := range bps {
+				if bp.id != 0 && bp.id == e.Breakpoint.ID {
+					bp.Verified, bp.Message = e.Breakpoint.Verified, e.Breakpoint.Message
+				}
+			}
+		}
+	case "exited":
+		e := struct {
+			ExitCode int `json:"exitCode"`
+		}{}
+		json.Unmarshal(body, &e)
+		s.console(fmt.Sprintf("\x1b[1mprocess exited with status %d\x1b[0m\n", e.ExitCode))
+	case "terminated":
+		s.Stop()
+	}
+}
+
+// send_breakpoints tells the adapter what the breakpoints in path are now, replacing what it had
+func (s *DebugSession) send_breakpoints(path string) {
+	bps := append([]*Breakpoint{}, breakpoints[path]...)
+	sent := []map[string]interface{}{}
+	for _, bp := range bps {
+		b := map[string]interface{}{"line": bp.Row() + 1}
+		if bp.Condition != "" {
+			b["condition"] = bp.Condition
+		}
+		sent = append(sent, b)
+	}
+	args := map[string]interface{}{
+		"source":      dap_source{Name: filepath.Base(path), Path: path},
+		"breakpoints": sent,
+	}
+	s.conn.Go("setBreakpoints", args, func(body json.RawMessage, err error) {
+		debug_version++
+		r := struct {
+			Breakpoints []dap_breakpoint `json:"breakpoints"`
+		}{}
+		if err == nil {
+			err = json.Unmarshal(body, &r)
+		}
+		//the response has one for each one sent, in the same order
+		for i, bp := range bps {
+			if err != nil {
+				bp.Verified, bp.Message = false, err.Error()
+			} else if i < len(r.Breakpoints) {
+				bp.id = r.Breakpoints[i].ID
+				bp.Verified, bp.Message = r.Breakpoints[i].Verified, r.Breakpoints[i].Message
+			}
+		}
+	})
+}
+
+func (s *DebugSession) log_error(body json.RawMessage, err error) {
+	if err != nil && !errors.Is(err, ErrConnClosed) {
+		s.console(fmt.Sprintf("\x1b[31m%v\x1b[0m\n", err))
+	}
+}
+
+func (s *DebugSession) load_stack() {
+	s.conn.Go("stackTrace", map[string]interface{}{"threadId": s.thread, "startFrame": 0, "levels": 50}, func(body json.RawMessage, err error) {
+		if err != nil {
+			s.log_error(body, err)
+			return
+		}
+		r := struct {
+			StackFrames []dap_stack_frame `json:"stackFrames"`
+		}{}
+		json.Unmarshal(body, &r)
+		s.Frames = r.StackFrames
+		s.SelectFrame(0)
+	})
+}
+
+// SelectFrame shows frame i of the call stack, jumping to where it is and listing its variables
+func (s *DebugSession) SelectFrame(i int) {
+	if i < 0 || i >= len(s.Frames) {
+		return
+	}
+	debug_version++
+	s.Frame, s.Scopes = i, nil
+	f := s.Frames[i]
+	if f.Source != nil && f.Source.Path != "" {
+		s.jump_request = &NavLocation{Path: f.Source.Path, Cursor: Cursor{row: max(0, f.Line-1), col: max(0, f.Column-1)}}
+	}
+	s.conn.Go("scopes", map[string]interface{}{"frameId": f.ID}, func(body json.RawMessage, err error) {
+		if err != nil {
+			s.log_error(body, err)
+			return
+		}
+		if s.State != DebugStopped || s.Frame != i {
+			//it's moved on since
+			return
+		}
+		r := struct {
+			Scopes []dap_scope `json:"scopes"`
+		}{}
+		json.Unmarshal(body, &r)
+		debug_version++
+		s.Scopes = nil
+		for _, scope := range r.Scopes {
+			v := &DebugVar{Name: scope.Name, ref: scope.VariablesReference}
+			s.Scopes = append(s.Scopes, v)
+			//the locals are what's wanted most of the time
+			if !scope.Expensive && len(s.Scopes) == 1 {
+				s.Expand(v)
+			}
+		}
+	})
+}
+
+// Expand shows v's children, asking the adapter for them the first time, or hides them if they're showing
+func (s *DebugSession) Expand(v *DebugVar) {
+	if !v.HasChildren() {
+		return
+	}
+	debug_version++
+	v.Expanded = !v.Expanded
+	if !v.Expanded || v.Children != nil || v.loading {
+		return
+	}
+	v.loading = true
+	s.conn.Go("variables", map[string]interface{}{"variablesReference": v.ref}, func(body json.RawMessage, err error) {
+		v.loading = false
+		if err != nil {
+			s.log_error(body, err)
+			return
+		}
+		r := struct {
+			Variables []dap_variable `json:"variables"`
+		}{}
+		json.Unmarshal(body, &r)
+		debug_version++
+		v.Children = []*DebugVar{}
+		for _, c := range r.Variables {
+			v.Children = append(v.Children, &DebugVar{Name: c.Name, Value: c.Value, Type: c.Type, Depth: v.Depth + 1, ref: c.VariablesReference})
+		}
+	})
+}
+
+// ExecutionLine is where the selected frame is, ok is false unless the program is stopped somewhere with source
+func (s *DebugSession) ExecutionLine() (path string, row int, ok bool) {
+	if s == nil || s.State != DebugStopped || s.Frame >= len(s.Frames) {
+		return "", 0, false
+	}
+	f := s.Frames[s.Frame]
+	if f.Source == nil || f.Source.Path == "" {
+		return "", 0, false
+	}
+	return f.Source.Path, f.Line - 1, true
+}
+
+func (s *DebugSession) resumed() {
+	debug_version++
+	s.State, s.StopReason = DebugRunning, ""
+	s.Frames, s.Frame, s.Scopes = nil, 0, nil
+}
+
+// resume continues or steps the stopped thread
+func (s *DebugSession) resume(command string) {
+	if s.State != DebugStopped {
+		return
+	}
+	s.resumed()
+	s.conn.Go(command, map[string]interface{}{"threadId": s.thread}, s.log_error)
+}
+
+func (s *DebugSession) Continue() {
+	s.resume("continue")
+}
+
+func (s *DebugSession) StepOver() {
+	s.resume("next")
+}
+
+func (s *DebugSession) StepIn() {
+	s.resume("stepIn")
+}
+
+func (s *DebugSession) StepOut() {
+	s.resume("stepOut")
+}
+
+func (s *DebugSession) Pause() {
+	if s.State == DebugRunning {
+		s.conn.Go("pause", map[string]interface{}{"threadId": s.thread}, s.log_error)
+	}
+}
+
+// Evaluate works out expression in the selected frame and prints what it is, like typing it at delve's prompt
+func (s *DebugSession) Evaluate(expression string) {
+	args := map[string]interface{}{"expression": expression, "context": "repl"}
+	if s.State == DebugStopped && s.Frame < len(s.Frames) {
+		args["frameId"] = s.Frames[s.Frame].ID
+	}
+	s.conn.Go("evaluate", args, func(body json.RawMessage, err error) {
+		if err != nil {
+			s.log_error(body, err)
+			return
+		}
+		r := struct {
+			Result string `json:"result"`
+		}{}
+		json.Unmarshal(body, &r)
+		s.console(r.Result + "\n")
+		//evaluating can call functions that change things
+		if s.State == DebugStopped {
+			s.SelectFrame(s.Frame)
+			s.jump_request = nil
+		}
+	})
+}
+
+// Stop ends the session, killing the program, asking again doesn't wait for the adapter
+func (s *DebugSession) Stop() {
+	if s.ending {
+		s.end()
+		return
+	}
+	s.ending = true
+	s.conn.Go("disconnect", map[string]interface{}{"terminateDebuggee": true}, func(body json.RawMessage, err error) {
+		s.end()
+	})
+}
+
+// end hangs up on the adapter, killing it if it's ours
+func (s *DebugSession) end() {
+	if s.State == DebugEnded {
+		return
+	}
+	debug_version++
+	s.State = DebugEnded
+	s.Frames, s.Scopes = nil, nil
+	s.conn.Close()
+	kill_dlv(s.cmd, s.output)
+	s.output = nil
+	if debug_session == s {
+		debug_session = nil
+	}
+	for _, bps := range breakpoints {
+		for _, bp := range bps {
+			bp.Verified, bp.Message, bp.id = false, "", 0
+		}
+	}
+}
+
+// update handles what's arrived from the adapter and delve since last frame
+func (s *DebugSession) update() {
+	s.conn.Dispatch()
+	//like a terminal, a flood of output waits for the next frame
+drain:
+	for i := 0; s.output != nil && i < 256; i++ {
+		select {
+		case line, ok := <-s.output:
+			if !ok {
+				s.output = nil
+				break drain
+			}
+			s.console(line)
+		default:
+			break drain
+		}
+	}
+	select {
+	case <-s.conn.Done():
+		//what's left might say why it went
+		s.conn.Dispatch()
+		if s.State != DebugEnded {
+			s.console("\x1b[1mdebug adapter exited\x1b[0m\n")
+			s.end()
+		}
+	default:
+	}
+}
+
+// TakeJumpRequest implements Jumper, it's where the program stopped or the frame picked in the call stack
+func (s *DebugSession) TakeJumpRequest() (NavLocation, bool) {
+	loc := s.jump_request
+	s.jump_request = nil
+	if loc == nil {
+		return NavLocation{}, false
+	}
+	return *loc, true
+}
+
+var dlv_listening = regexp.MustCompile(`DAP server listening at:\s*(\S+)`)
+
+// start_dlv runs delve's DAP server in dir and connects to it, it takes a while so it's run in the background
+// what it prints after it's listening comes through output, the program's output goes through the adapter
+// cancelling ctx kills delve, whether it's listening yet or not
+func start_dlv(ctx context.Context, dir string) (conn net.Conn, cmd *exec.Cmd, output <-chan string, err error) {
+	command := strings.Fields(dlv_command)
+	if len(command) == 0 {
+		return nil, nil, nil, errors.New("debug.dlv_command isn't set")
+	}
+	cmd = exec.CommandContext(ctx, command[0], append(command[1:], "--listen=127.0.0.1:0")...)
+	cmd.Dir = dir
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	cmd.Stdout, cmd.Stderr = w, w
+	if err := cmd.Start(); err != nil {
+		r.Close()
+		w.Close()
+		return nil, nil, nil, err
+	}
+	w.Close()
+
+	lines := make(chan string, 256)
+	listening := make(chan string, 1)
+	go func() {
+		defer r.Close()
+		defer close(lines)
+		scanner := bufio.NewScanner(r)
+		found := false
+		for scanner.Scan() {
+			if m := dlv_listening.FindStringSubmatch(scanner.Text()); m != nil && !found {
+				found = true
+				listening <- m[1]
+				continue
+			}
+			lines <- scanner.Text() + "\n"
+		}
+		if !found {
+			close(listening)
+		}
+	}()
+
+	fail := func(err error) (net.Conn, *exec.Cmd, <-chan string, error) {
+		kill_dlv(cmd, lines)
+		return nil, nil, nil, err
+	}
+	select {
+	case addr, ok := <-listening:
+		if !ok {
+			said := []string{}
+			for line := range lines {
+				said = append(said, strings.TrimSpace(line))
+			}
+			return fail(fmt.Errorf("%s exited: %s", command[0], strings.Join(said, " ")))
+		}
+		dialer := net.Dialer{Timeout: dlv_start_timeout}
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return fail(err)
+		}
+		return conn, cmd, lines, nil
+	case <-time.After(dlv_start_timeout):
+		return fail(fmt.Errorf("%s didn't start listening", command[0]))
+	case <-ctx.Done():
+		return fail(ctx.Err())
+	}
+}
+
+// kill_dlv kills delve without waiting for it, output is drained so its reader can finish
+func kill_dlv(cmd *exec.Cmd, output <-chan string) {
+	if cmd != nil {
+		cmd.Process.Kill()
+		go cmd.Wait()
+	}
+	if output != nil {
+		go func() {
+			for range output {
+			}
+		}()
+	}
+}
+
+// dlv_start is delve being started for a session, see StartDebugging
+type dlv_start struct {
+	cancel  context.CancelFunc
+	started chan func() //what start_dlv came back with, run by UpdateDebugger
+}
+
+// the delve that's starting, nil when there isn't one
+var dlv_starting *dlv_start
+
+// debug_config is how to launch what Start Debugging debugs,
+// the test the cursor is in if the focused file is a test file, otherwise the debug.program setting
+func (g *Editor) debug_config() map[string]interface{} {
+	root := WorkspaceDir()
+	config := map[string]interface{}{
+		"request": "launch",
+		"mode":    "debug",
+		"program": filepath.Join(root, debug_program),
+		"cwd":     root,
+	}
+	te := g.FocusedEditor()
+	if te == nil || !strings.HasSuffix(te.buf.filepath, "_test.go") {
+		return config
+	}
+	config["mode"] = "test"
+	config["program"] = filepath.Dir(te.buf.filepath)
+	for _, t := range te.test_funcs() {
+		if t.Row <= te.cursor.row {
+			config["args"] = []string{"-test.run", "^" + t.Name + "$"}
+		}
+	}
+	return config
+}
+
+/*
+Commands
+*/
+
+// Debugging is whether there's a session, or one's starting
+func Debugging() bool {
+	return debug_session != nil || dlv_starting != nil
+}
+
+// DebugIsStopped is whether the program is stopped at a breakpoint or after a step
+func DebugIsStopped() bool {
+	return debug_session != nil && debug_session.State == DebugStopped
+}
+
+// StartDebugging launches the program under delve, or continues it if it's stopped
+func (g *Editor) StartDebugging() {
+	if s := debug_session; s != nil {
+		s.Continue()
+		return
+	}
+	if dlv_starting != nil {
+		return
+	}
+	console := g.ShowDebugConsole()
+	console.Clear()
+	config := g.debug_config()
+	console.Write(fmt.Sprintf("\x1b[1m> %s (%s %s)\x1b[0m\n", dlv_command, config["mode"], config["program"]))
+	ctx, cancel := context.WithCancel(context.Background())
+	start := &dlv_start{cancel: cancel, started: make(chan func(), 1)}
+	dlv_starting = start
+	debug_version++
+	dir := WorkspaceDir()
+	go func() {
+		conn, cmd, output, err := start_dlv(ctx, dir)
+		start.started <- func() {
+			dlv_starting = nil
+			debug_version++
+			if err == nil && ctx.Err() != nil {
+				//stopped while it was connecting
+				conn.Close()
+				kill_dlv(cmd, output)
+				return
+			}
+			if err != nil {
+				if ctx.Err() == nil {
+					console.Write(fmt.Sprintf("\x1b[31mcouldn't start the debugger: %v\x1b[0m\n", err))
+				}
+				return
+			}
+			s := NewDebugSession(conn, console.Write)
+			s.cmd, s.output = cmd, output
+			debug_session = s
+			s.Launch(config)
+		}
+	}()
+}
+
+func StopDebugging() {
+	if dlv_starting != nil {
+		dlv_starting.cancel()
+	}
+	if debug_session != nil {
+		debug_session.Stop()
+	}
+}
+
+// with_session is f applied to the session, for menu items
+func with_session(f func(s *DebugSession)) func() {
+	return func() {
+		if debug_session != nil {
+			f(debug_session)
+		}
+	}
+}
+
+// ToggleBreakpointAtCursor adds or takes away a breakpoint on the focused editor's line
+func (g *Editor) ToggleBreakpointAtCursor() {
+	if te := g.FocusedEditor(); te != nil {
+		ToggleBreakpoint(te.buf, te.cursor.row)
+	}
+}
+
+// EditBreakpointCondition asks for the condition of the breakpoint on the focused editor's line
+// an empty answer counts as cancelling, so it doesn't change anything, toggling the breakpoint off clears it
+func (g *Editor) EditBreakpointCondition() {
+	te := g.FocusedEditor()
+	if te == nil || te.buf.filepath == "" {
+		return
+	}
+	row := te.cursor.row
+	initial := ""
+	if bp := BreakpointAt(te.buf.filepath, row); bp != nil {
+		initial = bp.Condition
+	}
+	buf := te.buf
+	AskText("Breakpoint Condition", fmt.Sprintf("Stop at line %d when", row+1), initial, func(condition string) {
+		SetBreakpointCondition(buf, row, strings.TrimSpace(condition))
+	})
+}
+
+// UpdateDebugger handles what's come from the debugger, jumps to where it stopped and refreshes the debug panels
+// it's also where breakpoints are marked in files that have been opened since
+func (g *Editor) UpdateDebugger() {
+	if start := dlv_starting; start != nil {
+		select {
+		case f := <-start.started:
+			f()
+		default:
+		}
+	}
+	if s := debug_session; s != nil {
+		s.update()
+		if loc, ok := s.TakeJumpRequest(); ok {
+			g.JumpTo(loc)
+		}
+	}
+	open := map[string]*TextBuffer{}
+	Walk(g.MainWidget, func(w Widget) {
+		switch w := w.(type) {
+		case *TextEditor:
+			if w.buf.filepath != "" {
+				open[w.buf.filepath] = w.buf
+			}
+		case *CallStackPanel:
+			w.Refresh()
+		case *VariablesPanel:
+			w.Refresh()
+		}
+	})
+	attach_breakpoints(open)
+}
+
+// StopDebugger kills the debugger without waiting for it, for quitting
+func StopDebugger() {
+	if dlv_starting != nil {
+		dlv_starting.cancel()
+	}
+	if debug_session != nil {
+		debug_session.end()
+	}
+}
+
+// debug_status is for the status bar, "" when not debugging
+func debug_status() string {
+	s := debug_session
+	if s == nil {
+		if dlv_starting != nil {
+			return "Debugging: starting"
+		}
+		return ""
+	}
+	switch s.State {
+	case DebugStarting:
+		return "Debugging: starting"
+	case DebugRunning:
+		return "Debugging: running"
+	case DebugStopped:
+		if s.StopReason != "" {
+			return "Debugging: paused on " + s.StopReason
+		}
+		return "Debugging: paused"
+	}
+	return ""
+}
+
+/*
+In the editor, breakpoints in the gutter and the line the program is stopped on
+*/
+
+func (te *TextEditor) DrawBreakpoints(target *ebiten.Image) {
+	bps := breakpoints[te.buf.filepath]
+	if len(bps) == 0 {
+		return
+	}
+	for _, bp := range bps {
+		row := bp.Row()
+		y := te.line_top(row)
+		if row < te.first_row() || y >= te.Dy() {
+			continue
+		}
+		col := Style.RedStrong
+		if bp.Condition != "" {
+			col = Style.OrangeStrong
+		}
+		if debug_session != nil && !bp.Verified {
+			col = Translucent(col, 0.4)
+		}
+		radius := float64(min(te.gutter_width(), CodeLineHeight())-Px(4)) / 2
+		cx := float64(te.Min.X) + float64(te.gutter_width())/2
+		cy := float64(te.Min.Y+y) + float64(CodeLineHeight())/2
+		ebitenutil.DrawCircle(target, cx, cy, radius, col)
+	}
+}
+
+// DrawExecutionLine highlights the line the program's stopped on, with an arrow in the gutter
+func (te *TextEditor) DrawExecutionLine(target *ebiten.Image) {
+	path, row, ok := debug_session.ExecutionLine()
+	if !ok || path != te.buf.filepath {
+		return
+	}
+	y := te.line_top(row)
+	if row < te.first_row() || y >= te.Dy() || row >= len(te.buf.lines) {
+		return
+	}
+	origin := te.text_origin()
+	DrawRect(target, image.Rect(origin.X, origin.Y+y, te.Max.X, origin.Y+y+CodeLineHeight()), Translucent(Style.YellowMuted, 0.3))
+	size := min(te.gutter_width(), CodeLineHeight()) - Px(4)
+	arrow := image.Rect(0, 0, size, size).Add(image.Pt(te.Min.X+(te.gutter_width()-size)/2, te.Min.Y+y+(CodeLineHeight()-size)/2))
+	DrawRunButton(target, arrow, Style.YellowStrong)
+}
+
+// breakpoint_click toggles a breakpoint for a click in the gutter
+func (te *TextEditor) breakpoint_click(x, y int) bool {
+	if x >= te.text_origin().X || te.buf.filepath == "" {
+		return false
+	}
+	row := te.row_at(y)
+	if row < 0 || row >= len(te.buf.lines) {
+		return false
+	}
+	ToggleBreakpoint(te.buf, row)
+	return true
+}
+
+// breakpoint_tooltip says what's set on row, for hovering the gutter
+func (te *TextEditor) breakpoint_tooltip(row int) []TooltipLine {
+	bp := BreakpointAt(te.buf.filepath, row)
+	if bp == nil {
+		return nil
+	}
+	s := "Breakpoint"
+	if bp.Condition != "" {
+		s += " when " + bp.Condition
+	}
+	if bp.Message != "" {
+		s += ": " + bp.Message
+	}
+	return TooltipText(s)
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fake_adapter is a scripted debug adapter at the far end of a pipe
+// requests get the body in responses for their command, ones without one are left unanswered
+type fake_adapter struct {
+	conn      net.Conn
+	received  chan *dap_message
+	responses map[string]interface{}
+
+	lock sync.Mutex //guards seq and writing, events come from the test and responses from serve
+	seq  int
+}
+
+func new_fake_adapter(conn net.Conn, responses map[string]interface{}) *fake_adapter {
+	fa := &fake_adapter{conn: conn, received: make(chan *dap_message, 100), responses: responses}
+	go fa.serve()
+	return fa
+}
+
+func (fa *fake_adapter) serve() {
+	defer close(fa.received)
+	reader := bufio.NewReader(fa.conn)
+	for {
+		bs, err := read_frame(reader)
+		if err != nil {
+			return
+		}
+		msg := &dap_message{}
+		if err := json.Unmarshal(bs, msg); err != nil {
+			return
+		}
+		fa.received <- msg
+		if body, ok := fa.responses[msg.Command]; ok && msg.Type == "request" {
+			fa.send(map[string]interface{}{"type": "response", "request_seq": msg.Seq, "command": msg.Command, "success": true, "body": body})
+		}
+	}
+}
+
+func (fa *fake_adapter) send(msg map[string]interface{}) {
+	fa.lock.Lock()
+	defer fa.lock.Unlock()
+	fa.seq++
+	msg["seq"] = fa.seq
+	bs, _ := json.Marshal(msg)
+	write_frame(fa.conn, bs)
+}
+
+func (fa *fake_adapter) event(event string, body interface{}) {
+	fa.send(map[string]interface{}{"type": "event", "event": event, "body": body})
+}
+
+// expect is the next request, which has to be for command, with its arguments read into args if it isn't nil
+func (fa *fake_adapter) expect(t *testing.T, command string, args interface{}) {
+	t.Helper()
+	select {
+	case msg, ok := <-fa.received:
+		if !ok {
+			t.Fatalf("connection closed while waiting for %s", command)
+		}
+		if msg.Command != command {
+			t.Fatalf("got %q, want %q", msg.Command, command)
+		}
+		if args != nil {
+			if err := json.Unmarshal(msg.Arguments, args); err != nil {
+				t.Fatalf("%s arguments: %v", command, err)
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("nothing was sent, wanted %s", command)
+	}
+}
+
+// no_breakpoints keeps the tests' breakpoints and session from leaking into each other
+func no_breakpoints(t *testing.T) {
+	saved, saved_session := breakpoints, debug_session
+	breakpoints, debug_session = map[string][]*Breakpoint{}, nil
+	t.Cleanup(func() { breakpoints, debug_session = saved, saved_session })
+}
+
+func file_buffer(path, text string) *TextBuffer {
+	tb := NewTextBuffer(text)
+	tb.filepath = path
+	return tb
+}
+
+func TestDebugSession(t *testing.T) {
+	no_breakpoints(t)
+	path := filepath.Join(t.TempDir(), "main.go")
+	tb := file_buffer(path, "package main\n\nfunc main() {\n\tx := 1\n}\n")
+	ToggleBreakpoint(tb, 3)
+
+	ours, theirs := net.Pipe()
+	adapter := new_fake_adapter(theirs, map[string]interface{}{
+		"initialize":        map[string]interface{}{},
+		"launch":            nil,
+		"configurationDone": nil,
+		"setBreakpoints":    map[string]interface{}{"breakpoints": []dap_breakpoint{{ID: 1, Verified: true, Line: 4}}},
+		"stackTrace": map[string]interface{}{"stackFrames": []dap_stack_frame{
+			{ID: 1000, Name: "main.main", Source: &dap_source{Path: path}, Line: 4, Column: 2},
+		}},
+		"scopes":     map[string]interface{}{"scopes": []dap_scope{{Name: "Locals", VariablesReference: 5}}},
+		"variables":  map[string]interface{}{"variables": []dap_variable{{Name: "x", Value: "1", Type: "int"}}},
+		"continue":   map[string]interface{}{},
+		"disconnect": nil,
+	})
+	var console []string
+	s := NewDebugSession(ours, func(out string) { console = append(console, out) })
+	debug_session = s
+	s.Launch(map[string]interface{}{"request": "launch", "mode": "debug", "program": filepath.Dir(path)})
+
+	adapter.expect(t, "initialize", nil)
+	until(t, s.update, func() bool { return len(adapter.received) > 0 })
+	var launch map[string]interface{}
+	adapter.expect(t, "launch", &launch)
+	if launch["mode"] != "debug" {
+		t.Errorf("launched with %v", launch)
+	}
+
+	//breakpoints are only sent once the adapter's ready for them
+	adapter.event("initialized", nil)
+	var set struct {
+		Source      dap_source `json:"source"`
+		Breakpoints []struct {
+			Line int `json:"line"`
+		} `json:"breakpoints"`
+	}
+	until(t, s.update, func() bool { return len(adapter.received) > 0 })
+	adapter.expect(t, "setBreakpoints", &set)
+	if set.Source.Path != path || len(set.Breakpoints) != 1 || set.Breakpoints[0].Line != 4 {
+		t.Errorf("setBreakpoints %+v, want line 4 of %s", set, path)
+	}
+	adapter.expect(t, "configurationDone", nil)
+	bp := BreakpointAt(path, 3)
+	until(t, s.update, func() bool { return bp.Verified })
+	if s.State != DebugRunning {
+		t.Errorf("state %d after configuring, want running", s.State)
+	}
+
+	//stopping loads the stack, the top frame's scopes and the first scope's variables
+	adapter.event("stopped", map[string]interface{}{"reason": "breakpoint", "threadId": 7})
+	var stack, scopes, variables map[string]int
+	until(t, s.update, func() bool { return len(adapter.received) > 0 })
+	adapter.expect(t, "stackTrace", &stack)
+	until(t, s.update, func() bool { return len(adapter.received) > 0 })
+	adapter.expect(t, "scopes", &scopes)
+	until(t, s.update, func() bool { return len(adapter.received) > 0 })
+	adapter.expect(t, "variables", &variables)
+	if stack["threadId"] != 7 || scopes["frameId"] != 1000 || variables["variablesReference"] != 5 {
+		t.Errorf("asked for stack %v, scopes %v, variables %v", stack, scopes, variables)
+	}
+	until(t, s.update, func() bool { return len(s.Scopes) == 1 && s.Scopes[0].Children != nil })
+	if s.State != DebugStopped || s.StopReason != "breakpoint" {
+		t.Errorf("state %d %q, want stopped on breakpoint", s.State, s.StopReason)
+	}
+	if x := s.Scopes[0].Children; len(x) != 1 || x[0].Name != "x" || x[0].Value != "1" || x[0].Type != "int" {
+		t.Errorf("locals are %+v", x)
+	}
+	if at, row, ok := s.ExecutionLine(); !ok || at != path || row != 3 {
+		t.Errorf("execution line %s:%d %v, want %s:3", at, row, ok, path)
+	}
+	if loc, ok := s.TakeJumpRequest(); !ok || loc.Path != path || loc.Cursor != (Cursor{row: 3, col: 1}) {
+		t.Errorf("jumped to %+v %v", loc, ok)
+	}
+
+	s.Continue()
+	var cont map[string]int
+	adapter.expect(t, "continue", &cont)
+	if cont["threadId"] != 7 || s.State != DebugRunning || s.Frames != nil {
+		t.Errorf("continued thread %d, state %d", cont["threadId"], s.State)
+	}
+
+	adapter.event("terminated", nil)
+	until(t, s.update, func() bool { return len(adapter.received) > 0 })
+	var disconnect map[string]bool
+	adapter.expect(t, "disconnect", &disconnect)
+	if !disconnect["terminateDebuggee"] {
+		t.Errorf("disconnected with %v", disconnect)
+	}
+	until(t, s.update, func() bool { return s.State == DebugEnded })
+	if debug_session != nil || bp.Verified {
+		t.Errorf("session or breakpoint state left after ending")
+	}
+	select {
+	case <-s.conn.Done():
+	case <-time.After(5 * time.Second):
+		t.Errorf("connection left open")
+	}
+}
+
+func TestDebugAdapterGoesAway(t *testing.T) {
+	no_breakpoints(t)
+	ours, theirs := net.Pipe()
+	adapter := new_fake_adapter(theirs, nil)
+	var console []string
+	s := NewDebugSession(ours, func(out string) { console = append(console, out) })
+	debug_session = s
+	s.Launch(nil)
+	adapter.expect(t, "initialize", nil)
+	theirs.Close()
+	until(t, s.update, func() bool { return s.State == DebugEnded })
+	if debug_session != nil || len(console) == 0 {
+		t.Errorf("session left behind, or nothing said about it, console %q", console)
+	}
+}
+
+func TestBreakpointsFollowBuffers(t *testing.T) {
+	no_breakpoints(t)
+	path := filepath.Join(t.TempDir(), "main.go")
+	text := "package main\n\nfunc main() {\n}\n"
+	tb := file_buffer(path, text)
+	other := NewTextEditor(file_buffer(filepath.Join(t.TempDir(), "other.go"), ""))
+	g := &Editor{MainWidget: NewTabs(NewTextEditor(tb), other)}
+
+	ToggleBreakpoint(tb, 2)
+	tb.Replace(Cursor{}, Cursor{}, "// x\n")
+	if row := breakpoints[path][0].Row(); row != 3 {
+		t.Fatalf("breakpoint on row %d after inserting a line above it, want 3", row)
+	}
+
+	//closed, it stays on its line
+	g.MainWidget = NewTabs(other)
+	g.UpdateDebugger()
+	if len(tb.marks) != 0 || BreakpointAt(path, 3) == nil {
+		t.Fatalf("breakpoint still marked in a closed buffer, or lost")
+	}
+
+	//opened again, it's marked in the new buffer and moves with its edits
+	reopened := file_buffer(path, "// x\n"+text)
+	g.MainWidget = NewTabs(other, NewTextEditor(reopened))
+	g.UpdateDebugger()
+	reopened.Replace(Cursor{}, Cursor{}, "// y\n")
+	if BreakpointAt(path, 4) == nil || len(reopened.marks) != 1 {
+		t.Fatalf("breakpoint didn't follow the reopened buffer")
+	}
+
+	//and taking it away unmarks that buffer, not the one it was made in
+	ToggleBreakpoint(reopened, 4)
+	if len(reopened.marks) != 0 || len(breakpoints) != 0 {
+		t.Errorf("%d marks left, breakpoints %v", len(reopened.marks), breakpoints)
+	}
+
+	//ones in files that aren't open can be removed too
+	ToggleBreakpoint(tb, 1)
+	g.MainWidget = NewTabs(other)
+	g.UpdateDebugger()
+	g.RemoveAllBreakpoints()
+	if len(breakpoints) != 0 || len(tb.marks) != 0 {
+		t.Errorf("breakpoints left after removing them all")
+	}
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+	"golang.org/x/image/font"
+)
+
+// Diagnostics are the errors and warnings tools find in the code
+// language servers publish them as you type, go vet, go build and a highlighter's linter get run for them
+
+// severities, the same numbers the LSP uses
+const (
+	DiagnosticError   = 1
+	DiagnosticWarning = 2
+	DiagnosticInfo    = 3
+	DiagnosticHint    = 4
+)
+
+// Diagnostic is one problem in a file, To can be From when a tool only gave a position
+type Diagnostic struct {
+	Path     string
+	From, To Cursor
+	Severity int
+	Message  string
+	Source   string //the tool that found it
+}
+
+// every diagnostic we know of, by what found them
+// a language server's are per file, since it publishes a file at a time
+var diagnostic_sets = map[string][]Diagnostic{}
+
+// goes up whenever diagnostic_sets changes, so the Problems panel knows to refresh
+var diagnostics_version uint64
+
+// SetDiagnostics replaces what key found with ds
+func SetDiagnostics(key string, ds []Diagnostic) {
+	if len(ds) == 0 {
+		delete(diagnostic_sets, key)
+	} else {
+		diagnostic_sets[key] = ds
+	}
+	diagnostics_version++
+}
+
+// ClearDiagnostics drops every set whose key starts with prefix
+func ClearDiagnostics(prefix string) {
+	for key := range diagnostic_sets {
+		if strings.HasPrefix(key, prefix) {
+			delete(diagnostic_sets, key)
+			diagnostics_version++
+		}
+	}
+}
+
+// DiagnosticsFor is every diagnostic in the file at path
+func DiagnosticsFor(path string) []Diagnostic {
+	if path == "" {
+		return nil
+	}
+	var ds []Diagnostic
+	for _, set := range diagnostic_sets {
+		for _, d := range set {
+			if d.Path == path {
+				ds = append(ds, d)
+			}
+		}
+	}
+	return ds
+}
+
+// AllDiagnostics is every diagnostic in every file
+func AllDiagnostics() []Diagnostic {
+	var ds []Diagnostic
+	for _, set := range diagnostic_sets {
+		ds = append(ds, set...)
+	}
+	return ds
+}
+
+func severity_color(severity int) color.Color {
+	switch severity {
+	case DiagnosticWarning:
+		return Style.YellowStrong
+	case DiagnosticInfo:
+		return Style.BlueStrong
+	case DiagnosticHint:
+		return Style.Gray
+	}
+	return Style.RedStrong
+}
+
+func severity_icon(severity int) string {
+	switch severity {
+	case DiagnosticWarning:
+		return "!"
+	case DiagnosticInfo, DiagnosticHint:
+		return "i"
+	}
+	return "x"
+}
+
+func severity_name(severity int) string {
+	switch severity {
+	case DiagnosticWarning:
+		return "warning"
+	case DiagnosticInfo:
+		return "info"
+	case DiagnosticHint:
+		return "hint"
+	}
+	return "error"
+}
+
+/*
+Running tools, they run in the background and hand what they found back to the UI goroutine
+*/
+
+var diagnostic_results = make(chan func(), 16)
+
+// tool_line matches the file:line:col: message lines compilers and linters print, col and the severity are optional
+var tool_line = regexp.MustCompile(`^(.+?):(\d+)(?::(\d+))?:\s*(?:(error|warning|note|fatal error):\s*)?(.*)$`)
+
+// ParseToolOutput reads diagnostics out of a tool's output, relative paths are from dir
+func ParseToolOutput(output, dir, source string) []Diagnostic {
+	var ds []Diagnostic
+	for _, line := range strings.Split(output, "\n") {
+		//go vet puts vet: in front of the errors it finds type checking
+		line = strings.TrimPrefix(strings.TrimRight(line, "\r"), "vet: ")
+		m := tool_line.FindStringSubmatch(line)
+		if m == nil || strings.HasPrefix(line, "#") {
+			continue
+		}
+		path := m[1]
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		if _, err := os.Stat(path); err != nil {
+			//not a file:line after all, like the time in a log line
+			continue
+		}
+		ds = append(ds, tool_diagnostic(m, path, source))
+	}
+	return ds
+}
+
+// tool_diagnostic is the diagnostic in a match of tool_line, which is in the file at path
+func tool_diagnostic(m []string, path, source string) Diagnostic {
+	row, _ := strconv.Atoi(m[2])
+	col, _ := strconv.Atoi(m[3])
+	severity := DiagnosticError
+	switch m[4] {
+	case "warning":
+		severity = DiagnosticWarning
+	case "note":
+		severity = DiagnosticInfo
+	}
+	at := Cursor{row: max(0, row-1), col: max(0, col-1)}
+	return Diagnostic{Path: path, From: at, To: at, Severity: severity, Message: m[5], Source: source}
+}
+
+// run_tool runs command in dir in the background, what it prints replaces the diagnostics under key
+func run_tool(key, source, dir string, command ...string) {
+	go func() {
+		cmd := exec.Command(command[0], command[1:]...)
+		cmd.Dir = dir
+		var output bytes.Buffer
+		cmd.Stdout = &output
+		cmd.Stderr = &output
+		err := cmd.Run()
+		if _, ok := err.(*exec.ExitError); err != nil && !ok {
+			log.Printf("couldn't run %s: %v", source, err)
+			return
+		}
+		ds := ParseToolOutput(output.String(), dir, source)
+		diagnostic_results <- func() {
+			SetDiagnostics(key, ds)
+			log.Printf("%s: %d problems", source, len(ds))
+		}
+	}()
+}
+
+func (g *Editor) RunGoVet() {
+	run_tool("go vet", "go vet", WorkspaceDir(), "go", "vet", "./...")
+}
+func (g *Editor) RunGoBuild() {
+	run_tool("go build", "go build", WorkspaceDir(), "go", "build", "-o", os.DevNull, "./...")
+}
+
+// RunLinter runs the focused editor's file through its highlighter's linter
+func (g *Editor) RunLinter() {
+	if te := g.FocusedEditor(); te != nil {
+		lint(te.buf.filepath, te.highlighter)
+	}
+}
+
+func (g *Editor) HasLinter() bool {
+	te := g.FocusedEditor()
+	return te != nil && te.buf.filepath != "" && te.highlighter != nil && te.highlighter.linter != ""
+}
+
+// lint runs hl's linter on the file at path, it's given the path last like nano does
+func lint(path string, hl *Highlighter) {
+	if path == "" || hl == nil || hl.linter == "" {
+		return
+	}
+	command := append(strings.Fields(hl.linter), path)
+	run_tool("linter:"+path, command[0], filepath.Dir(path), command...)
+}
+
+// lint_versions is the version of each buffer last linted, files get linted each time they're saved
+var lint_versions = map[*TextBuffer]uint64{}
+
+// UpdateDiagnostics takes in what finished tools found, lints files that were just saved and refreshes the Problems panel
+func (g *Editor) UpdateDiagnostics() {
+	for done := false; !done; {
+		select {
+		case f := <-diagnostic_results:
+			f()
+		default:
+			done = true
+		}
+	}
+	open := map[*TextBuffer]bool{}
+	Walk(g.MainWidget, func(w Widget) {
+		switch w := w.(type) {
+		case *TextEditor:
+			open[w.buf] = true
+			if w.buf.saved && lint_versions[w.buf] != w.buf.version && w.highlighter != nil && w.highlighter.linter != "" {
+				lint_versions[w.buf] = w.buf.version
+				lint(w.buf.filepath, w.highlighter)
+			}
+		case *ProblemsPanel:
+			w.Refresh()
+		}
+	})
+	for tb := range lint_versions {
+		if !open[tb] {
+			delete(lint_versions, tb)
+		}
+	}
+}
+
+/*
+From language servers
+*/
+
+type lsp_diagnostic struct {
+	Range    LSPRange `json:"range"`
+	Severity int      `json:"severity"`
+	Message  string   `json:"message"`
+	Source   string   `json:"source"`
+}
+
+// publish_diagnostics takes a server's textDocument/publishDiagnostics, which replaces everything it said about the file before
+func (ls *LanguageServer) publish_diagnostics(params json.RawMessage) {
+	var p struct {
+		URI         string           `json:"uri"`
+		Diagnostics []lsp_diagnostic `json:"diagnostics"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return
+	}
+	path := URIToPath(p.URI)
+	if path == "" {
+		return
+	}
+	//positions need the text to turn into cursors, the server's copy is ours if it has the file open
+	var tb *TextBuffer
+	for buf, doc := range ls.docs {
+		if doc.path == path {
+			tb = buf
+		}
+	}
+	if tb == nil && len(p.Diagnostics) > 0 {
+		var err error
+		if tb, err = LoadTextBuffer(path); err != nil {
+			return
+		}
+	}
+	ds := make([]Diagnostic, 0, len(p.Diagnostics))
+	for _, d := range p.Diagnostics {
+		source := d.Source
+		if source == "" {
+			source = ls.Language
+		}
+		severity := d.Severity
+		if severity == 0 {
+			severity = DiagnosticError
+		}
+		ds = append(ds, Diagnostic{
+			Path:     path,
+			From:     ls.Cursor(tb, d.Range.Start),
+			To:       ls.Cursor(tb, d.Range.End),
+			Severity: severity,
+			Message:  d.Message,
+			Source:   source,
+		})
+	}
+	SetDiagnostics(ls.diagnostics_key()+path, ds)
+}
+
+func (ls *LanguageServer) diagnostics_key() string {
+	return "lsp:" + ls.Language + ":"
+}
+
+/*
+In the editor, squiggles under the text and icons in the gutter
+*/
+
+// diagnostic_range is the text d underlines, a word or a character if it's only a position
+func (te *TextEditor) diagnostic_range(d Diagnostic) (Cursor, Cursor) {
+	from, to := te.buf.ClampCursor(d.From), te.buf.ClampCursor(d.To)
+	if from != to {
+		return from, to
+	}
+	line := te.buf.lines[from.row]
+	for to.col < len(line) && is_word_byte(line[to.col]) {
+		to.col++
+	}
+	if to == from {
+		if from.col < len(line) {
+			to.col++
+		} else if from.col > 0 {
+			from.col--
+		}
+	}
+	return from, to
+}
+
+// DrawDiagnostics draws the squiggles and gutter icons of te's file
+func (te *TextEditor) DrawDiagnostics(target *ebiten.Image) {
+	ds := DiagnosticsFor(te.buf.filepath)
+	if len(ds) == 0 {
+		return
+	}
+	//worst first so they're drawn last, on top
+	sort.SliceStable(ds, func(i, j int) bool { return ds[i].Severity > ds[j].Severity })
+	origin := te.text_origin()
+	worst := map[int]int{}
+	for _, d := range ds {
+		from, to := te.diagnostic_range(d)
+		for row := from.row; row <= to.row; row++ {
+			y := te.line_top(row)
+			if y < 0 || y >= te.Dy() {
+				continue
+			}
+			line := te.buf.lines[row]
+			start, end := 0, len(line)
+			if row == from.row {
+				start = from.col
+			}
+			if row == to.row {
+				end = to.col
+			}
+			x0 := origin.X + font.MeasureString(CodeFontFace, line[:start]).Round()
+			x1 := origin.X + font.MeasureString(CodeFontFace, line[:end]).Round()
+			draw_squiggle(target, x0, x1, origin.Y+y+CodeLineHeight()-Px(2), severity_color(d.Severity))
+		}
+		worst[from.row] = d.Severity
+	}
+	for row, severity := range worst {
+		y := te.line_top(row)
+		if y < 0 || y >= te.Dy() {
+			continue
+		}
+		size := min(te.gutter_width(), CodeLineHeight()) - Px(2)
+		icon := image.Rect(0, 0, size, size).Add(image.Pt(te.Min.X+(te.gutter_width()-size)/2, te.Min.Y+y+(CodeLineHeight()-size)/2))
+		col := severity_color(severity)
+		DrawRect(target, icon, Translucent(col, 0.3))
+		letter := severity_icon(severity)
+		text.Draw(target, letter, MainFontFace, icon.Min.X+(icon.Dx()-font.MeasureString(MainFontFace, letter).Round())/2, icon.Min.Y+(icon.Dy()-MainLineHeight())/2+MainFontPeriodFromTop, col)
+	}
+}
+
+// draw_squiggle draws a wavy line from x0 to x1 along y
+func draw_squiggle(target *ebiten.Image, x0, x1, y int, col color.Color) {
+	x1 = max(x1, x0+Px(4))
+	step := float64(Px(2))
+	up := true
+	for x := float64(x0); x < float64(x1); x += step {
+		y0, y1 := float64(y), float64(y)-step
+		if !up {
+			y0, y1 = y1, y0
+		}
+		ebitenutil.DrawLine(target, x, y0, x+step, y1, col)
+		up = !up
+	}
+}
+
+// diagnostic_message is what the diagnostics under (x, y) say, every one on the line if it's over the gutter
+func (te *TextEditor) diagnostic_message(x, y int) string {
+	ds := DiagnosticsFor(te.buf.filepath)
+	if len(ds) == 0 {
+		return ""
+	}
+	in_gutter := x < te.text_origin().X
+	c := te.CursorAt(x, y)
+	messages := []string{}
+	for _, d := range ds {
+		from, to := te.diagnostic_range(d)
+		if in_gutter && c.row != from.row {
+			continue
+		}
+		if !in_gutter && (c.Before(from) || to.Before(c)) {
+			continue
+		}
+		messages = append(messages, fmt.Sprintf("%s: %s (%s)", severity_name(d.Severity), d.Message, d.Source))
+	}
+	return strings.Join(messages, "\n")
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseToolOutput(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"main.go", "main.c", filepath.Join("sub", "util.go")} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	main_go, util_go, main_c := filepath.Join(dir, "main.go"), filepath.Join(dir, "sub", "util.go"), filepath.Join(dir, "main.c")
+	type found struct {
+		path     string
+		row, col int
+		severity int
+		message  string
+	}
+	tests := []struct {
+		tool   string
+		output string
+		want   []found
+	}{
+		{"go build", "# example.com/hello\n" +
+			"./main.go:5:2: undefined: fmt.Printn\n" +
+			"sub/util.go:10:15: cannot use x (variable of type int) as string value in return statement\n" +
+			"./main.go:7:1: too many errors\n", []found{
+			{main_go, 4, 1, DiagnosticError, "undefined: fmt.Printn"},
+			{util_go, 9, 14, DiagnosticError, "cannot use x (variable of type int) as string value in return statement"},
+			{main_go, 6, 0, DiagnosticError, "too many errors"},
+		}},
+		{"go vet", "# example.com/hello\n" +
+			"# [example.com/hello]\n" +
+			"./main.go:6:2: fmt.Printf format %d has arg s of wrong type string\n" +
+			"vet: ./sub/util.go:3:8: \"os\" imported and not used\n", []found{
+			{main_go, 5, 1, DiagnosticError, "fmt.Printf format %d has arg s of wrong type string"},
+			{util_go, 2, 7, DiagnosticError, "\"os\" imported and not used"},
+		}},
+		{"gofmt -l -e", "main.go\nmain.go:4:1: expected declaration, found foo\r\n", []found{
+			{main_go, 3, 0, DiagnosticError, "expected declaration, found foo"},
+		}},
+		{"gcc", "main.c: In function 'main':\n" +
+			"main.c:3:9: warning: unused variable 'x' [-Wunused-variable]\n" +
+			"main.c:5:1: note: declared here\n" +
+			"main.c:8:12: error: expected ';' before '}' token\n" +
+			"main.c:9:1: fatal error: stdio.h: No such file or directory\n", []found{
+			{main_c, 2, 8, DiagnosticWarning, "unused variable 'x' [-Wunused-variable]"},
+			{main_c, 4, 0, DiagnosticInfo, "declared here"},
+			{main_c, 7, 11, DiagnosticError, "expected ';' before '}' token"},
+			{main_c, 8, 0, DiagnosticError, "stdio.h: No such file or directory"},
+		}},
+		{"absolute paths without a column", main_go + ":12: something\n", []found{
+			{main_go, 11, 0, DiagnosticError, "something"},
+		}},
+		{"not files", "2024/01/02 15:04:05 building\n" +
+			"missing.go:1:1: not here\n" +
+			"ok  \texample.com/hello\t0.01s\n" +
+			"go: downloading example.com/dep v1.2.3\n", nil},
+	}
+	for _, test := range tests {
+		ds := ParseToolOutput(test.output, dir, test.tool)
+		if len(ds) != len(test.want) {
+			t.Errorf("%s: found %d problems, want %d: %+v", test.tool, len(ds), len(test.want), ds)
+			continue
+		}
+		for i, d := range ds {
+			w := test.want[i]
+			got := found{d.Path, d.From.row, d.From.col, d.Severity, d.Message}
+			if got != w || d.Source != test.tool {
+				t.Errorf("%s: problem %d is %+v from %q, want %+v", test.tool, i, got, d.Source, w)
+			}
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"image"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+)
+
+// Dragging a tab header out of its bar carries it around the window
+// dropping it on another group's bar or body moves it there, dropping it near the edge of a body splits that group
+
+type DropZone int
+
+const (
+	DropNone   DropZone = iota
+	DropInBar           //into the tab bar at Index
+	DropCenter          //onto the body, joins the group at the end
+	DropLeft            //edges of the body make a new group beside the target
+	DropRight
+	DropTop
+	DropBottom
+)
+
+// share of a body's width/height from each edge that counts as that edge
+const drop_edge_fraction = 0.25
+
+// TabDrag is a tab being carried out of its group
+type TabDrag struct {
+	From   *Tabs
+	Widget Widget
+	Title  string
+
+	//where it would go if dropped now
+	Target  *Tabs
+	Zone    DropZone
+	Index   int
+	Preview image.Rectangle
+}
+
+// the tab being dragged between groups, nil most of the time
+var current_tab_drag *TabDrag
+
+func StartTabDrag(from *Tabs, i int) {
+	if i < 0 || i >= len(from.Tabs) {
+		return
+	}
+	current_tab_drag = &TabDrag{
+		From:   from,
+		Widget: from.Tabs[i],
+		Title:  from.Titles[i],
+	}
+}
+
+// Aim works out what dropping at pt would do
+func (d *TabDrag) Aim(root Widget, pt image.Point) {
+	d.Target = TabsAt(root, pt)
+	d.Zone = DropNone
+	if d.Target == nil {
+		return
+	}
+	t := d.Target
+	t.layout_headers()
+	if pt.In(t.bar_rect()) {
+		d.Zone = DropInBar
+		d.Index = len(t.Tabs)
+		line_x := t.headers_rect().Min.X
+		if len(t.TabHeaderRects) > 0 {
+			line_x = t.TabHeaderRects[len(t.TabHeaderRects)-1].Max.X
+		}
+		for i, r := range t.TabHeaderRects {
+			if pt.X < (r.Min.X+r.Max.X)/2 {
+				d.Index = i
+				line_x = r.Min.X
+				break
+			}
+		}
+		bar := t.bar_rect()
+		d.Preview = image.Rect(line_x-2, bar.Min.Y, line_x+2, bar.Max.Y)
+		return
+	}
+
+	body := t.body_rect()
+	edge_w := int(float64(body.Dx()) * drop_edge_fraction)
+	edge_h := int(float64(body.Dy()) * drop_edge_fraction)
+	half_w, half_h := body.Dx()/2, body.Dy()/2
+	d.Preview = body
+	switch {
+	case pt.X < body.Min.X+edge_w:
+		d.Zone = DropLeft
+		d.Preview.Max.X = body.Min.X + half_w
+	case pt.X >= body.Max.X-edge_w:
+		d.Zone = DropRight
+		d.Preview.Min.X = body.Max.X - half_w
+	case pt.Y < body.Min.Y+edge_h:
+		d.Zone = DropTop
+		d.Preview.Max.Y = body.Min.Y + half_h
+	case pt.Y >= body.Max.Y-edge_h:
+		d.Zone = DropBottom
+		d.Preview.Min.Y = body.Max.Y - half_h
+	default:
+		d.Zone = DropCenter
+	}
+	//splitting a group with only this tab in it off from itself doesn't do anything
+	if t == d.From && len(t.Tabs) == 1 && d.Zone != DropInBar {
+		d.Zone = DropNone
+	}
+}
+
+// Drop moves the tab to where it was aimed, returns false if it stayed where it was
+// panels is the results group, which never counts as somewhere for files to go
+func (d *TabDrag) Drop(root Widget, panels *Tabs) bool {
+	if d.Zone == DropNone || d.Target == nil {
+		return false
+	}
+	from_index := d.From.IndexOf(d.Widget)
+	if from_index < 0 {
+		return false
+	}
+	switch d.Zone {
+	case DropInBar, DropCenter:
+		to := d.Index
+		if d.Zone == DropCenter {
+			to = len(d.Target.Tabs)
+		}
+		if d.Target == d.From {
+			if to > from_index {
+				to--
+			}
+			d.From.MoveTab(from_index, min(to, len(d.From.Tabs)-1))
+			return true
+		}
+		d.From.RemoveTab(from_index)
+		d.Target.InsertTab(to, d.Widget)
+	case DropLeft, DropRight, DropTop, DropBottom:
+		d.From.RemoveTab(from_index)
+		group := NewTabs(d.Widget)
+		switch d.Zone {
+		case DropLeft:
+			SplitWidgetBefore(root, d.Target, group, SplitHorizontal)
+		case DropRight:
+			SplitWidget(root, d.Target, group, SplitHorizontal)
+		case DropTop:
+			SplitWidgetBefore(root, d.Target, group, SplitVertical)
+		case DropBottom:
+			SplitWidget(root, d.Target, group, SplitVertical)
+		}
+	}
+	CollapseEmptyTabs(root, panels)
+	return true
+}
+
+// Draw shows where the tab would go and a copy of its header under the mouse
+func (d *TabDrag) Draw(target *ebiten.Image) {
+	if d.Zone != DropNone {
+		DrawRect(target, d.Preview, Translucent(Style.BlueMuted, 0.4))
+		DrawBorders(target, d.Preview, Style.BlueStrong)
+	}
+	x, y := ebiten.CursorPosition()
+	width := text.BoundString(MainFontFace, d.Title).Dx() + 2*tab_x_padding
+	label := image.Rect(x, y, x+width, y+MainLineHeight()+2*tab_y_padding)
+	DrawRect(target, label, Translucent(Style.BGColorStrong, 0.8))
+	text.Draw(target, d.Title, MainFontFace, label.Min.X+tab_x_padding, label.Min.Y+MainFontPeriodFromTop+tab_y_padding, Style.FGColorStrong)
+}
+
+// UpdateTabDrag follows the mouse while a tab is being carried and drops it when the button comes up
+func (g *Editor) UpdateTabDrag(x, y int) {
+	d := current_tab_drag
+	ebiten.SetCursorShape(ebiten.CursorShapeDefault)
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		current_tab_drag = nil
+		return
+	}
+	d.Aim(g.MainWidget, image.Pt(x, y))
+	if ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft) {
+		return
+	}
+	current_tab_drag = nil
+	if d.Drop(g.MainWidget, g.panel_tabs) {
+		g.Rebuild()
+		g.Focus(d.Widget)
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Dialogs borrow the desktop's through zenity or kdialog, and fall back to a prompt drawn in the window, see prompt.go
+// they never block, the answer is passed to a callback on the UI goroutine once the user gives one
+// only one dialog is up at a time, asking while one is up does nothing
+
+var dialog_program_once sync.Once
+var dialog_program_path string
+
+// dialog_program is zenity or kdialog, whichever is installed, "" if neither is
+// it's only looked for once, menus ask every frame
+func dialog_program() string {
+	dialog_program_once.Do(func() {
+		for _, prog := range []string{"zenity", "kdialog"} {
+			if _, err := exec.LookPath(prog); err == nil {
+				dialog_program_path = prog
+				return
+			}
+		}
+	})
+	return dialog_program_path
+}
+
+// HaveFileDialog reports whether the desktop's dialogs get used, without one the in-window prompt is
+func HaveFileDialog() bool {
+	return dialog_program() != ""
+}
+
+// what the dialog programs answered, run by UpdateDialogs
+var dialog_results = make(chan func(), 16)
+
+// a dialog program is running
+var dialog_running bool
+
+// DialogShowing reports whether a dialog is waiting for an answer
+func DialogShowing() bool {
+	return dialog_running || current_prompt != nil
+}
+
+// run_dialog runs the dialog program with args in the background, answer gets what it printed and how it exited
+func run_dialog(args []string, answer func(out string, err error)) {
+	dialog_running = true
+	program := dialog_program()
+	go func() {
+		out, err := exec.Command(program, args...).Output()
+		dialog_results <- func() {
+			dialog_running = false
+			answer(string(out), err)
+		}
+	}()
+}
+
+// UpdateDialogs passes on the answers of dialogs that have closed since the last update
+func UpdateDialogs() {
+	for {
+		select {
+		case f := <-dialog_results:
+			f()
+		default:
+			return
+		}
+	}
+}
+
+// PickFile asks the user for a file, for saving if save is set
+// picked only gets called if they chose one
+func PickFile(title string, save bool, picked func(path string)) {
+	if DialogShowing() {
+		return
+	}
+	var args []string
+	switch dialog_program() {
+	case "zenity":
+		args = []string{"--file-selection", "--title=" + title}
+		if save {
+			args = append(args, "--save", "--confirm-overwrite")
+		}
+	case "kdialog":
+		mode := "--getopenfilename"
+		if save {
+			mode = "--getsavefilename"
+		}
+		args = []string{"--title", title, mode, "."}
+	default:
+		pick_file_in_window(title, save, picked)
+		return
+	}
+	run_dialog(args, func(out string, err error) {
+		//both exit with an error when cancelled
+		path := strings.TrimSpace(out)
+		if err == nil && path != "" {
+			picked(path)
+		}
+	})
+}
+
+// pick_file_in_window is PickFile with the path typed in, relative to the workspace
+func pick_file_in_window(title string, save bool, picked func(path string)) {
+	label := "Open"
+	if save {
+		label = "Save"
+	}
+	NewPrompt(title, "Path of the file", []string{label, "Cancel"}, func(button int, path string) {
+		path = strings.TrimSpace(path)
+		if button != 0 || path == "" {
+			return
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(WorkspaceDir(), path)
+		}
+		if _, err := os.Stat(path); save && err == nil {
+			Confirm(title, filepath.Base(path)+" already exists, replace it?", func() { picked(path) })
+			return
+		}
+		picked(path)
+	}).WithInput(WorkspaceDir() + string(filepath.Separator)).Show()
+}
+
+// AskText asks the user to type something in, starting with initial
+// answered only gets called if they didn't cancel or leave it empty
+func AskText(title, prompt, initial string, answered func(answer string)) {
+	if DialogShowing() {
+		return
+	}
+	var args []string
+	switch dialog_program() {
+	case "zenity":
+		args = []string{"--entry", "--title=" + title, "--text=" + prompt, "--entry-text=" + initial}
+	case "kdialog":
+		args = []string{"--title", title, "--inputbox", prompt, initial}
+	default:
+		NewPrompt(title, prompt, []string{"OK", "Cancel"}, func(button int, answer string) {
+			if button == 0 && answer != "" {
+				answered(answer)
+			}
+		}).WithInput(initial).Show()
+		return
+	}
+	run_dialog(args, func(out string, err error) {
+		answer := strings.TrimRight(out, "\r\n")
+		if err == nil && answer != "" {
+			answered(answer)
+		}
+	})
+}
+
+// Confirm asks a yes or no question, yes only gets called for a yes
+func Confirm(title, question string, yes func()) {
+	if DialogShowing() {
+		return
+	}
+	var args []string
+	switch dialog_program() {
+	case "zenity":
+		args = []string{"--question", "--title=" + title, "--text=" + question}
+	case "kdialog":
+		args = []string{"--title", title, "--yesno", question}
+	default:
+		NewPrompt(title, question, []string{"Yes", "No"}, func(button int, _ string) {
+			if button == 0 {
+				yes()
+			}
+		}).Show()
+		return
+	}
+	run_dialog(args, func(out string, err error) {
+		if err == nil {
+			yes()
+		}
+	})
+}
+
+// SaveChoice is the answer to AskSaveChanges
+type SaveChoice int
+
+const (
+	CancelClose SaveChoice = iota
+	SaveChanges
+	DiscardChanges
+)
+
+// AskSaveChanges asks whether to save name before closing it
+// cancelling or closing the dialog means CancelClose, so nothing gets lost
+func AskSaveChanges(name string, answered func(choice SaveChoice)) {
+	if DialogShowing() {
+		return
+	}
+	title, question := "Unsaved changes", "Save changes to "+name+" before closing?"
+	switch dialog_program() {
+	case "zenity":
+		run_dialog([]string{"--question", "--title=" + title, "--text=" + question,
+			"--ok-label=Save", "--cancel-label=Cancel", "--extra-button=Discard"}, func(out string, err error) {
+			switch {
+			case err == nil:
+				answered(SaveChanges)
+			case strings.TrimSpace(out) == "Discard":
+				//the extra button prints its label and exits like cancel does
+				answered(DiscardChanges)
+			default:
+				answered(CancelClose)
+			}
+		})
+	case "kdialog":
+		run_dialog([]string{"--title", title, "--warningyesnocancel", question,
+			"--yes-label", "Save", "--no-label", "Discard"}, func(out string, err error) {
+			var exit *exec.ExitError
+			switch {
+			case err == nil:
+				answered(SaveChanges)
+			case errors.As(err, &exit) && exit.ExitCode() == 1:
+				//2 is cancel
+				answered(DiscardChanges)
+			default:
+				answered(CancelClose)
+			}
+		})
+	default:
+		NewPrompt(title, question, []string{"Save", "Discard", "Cancel"}, func(button int, _ string) {
+			switch button {
+			case 0:
+				answered(SaveChanges)
+			case 1:
+				answered(DiscardChanges)
+			default:
+				answered(CancelClose)
+			}
+		}).Show()
+	}
+}
@@ -0,0 +1,489 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+)
+
+// logical pixels
+const file_tree_indent = 12
+const file_row_padding = 3
+
+type file_node struct {
+	path     string
+	is_dir   bool
+	expanded bool
+	depth    int
+	kids     []*file_node //read from disk when the directory is expanded
+}
+
+func (n *file_node) name() string {
+	return filepath.Base(n.path)
+}
+
+// load reads the directory's entries, directories first then files, both alphabetical
+// kids that are still there keep whether they were expanded
+func (n *file_node) load() error {
+	entries, err := os.ReadDir(n.path)
+	if err != nil {
+		return err
+	}
+	old := map[string]*file_node{}
+	for _, kid := range n.kids {
+		old[kid.path] = kid
+	}
+	n.kids = make([]*file_node, 0, len(entries))
+	for _, e := range entries {
+		path := filepath.Join(n.path, e.Name())
+		if kid, ok := old[path]; ok && kid.is_dir == e.IsDir() {
+			n.kids = append(n.kids, kid)
+			continue
+		}
+		n.kids = append(n.kids, &file_node{path: path, is_dir: e.IsDir(), depth: n.depth + 1})
+	}
+	sort.SliceStable(n.kids, func(i, j int) bool {
+		if n.kids[i].is_dir != n.kids[j].is_dir {
+			return n.kids[i].is_dir
+		}
+		return strings.ToLower(n.kids[i].name()) < strings.ToLower(n.kids[j].name())
+	})
+	return nil
+}
+
+// refresh rereads n and every expanded directory under it
+func (n *file_node) refresh() {
+	if !n.is_dir || !n.expanded {
+		return
+	}
+	if err := n.load(); err != nil {
+		log.Println("couldn't read directory:", err)
+	}
+	for _, kid := range n.kids {
+		kid.refresh()
+	}
+}
+
+// FileTree shows the files under a directory, clicking a file opens it
+type FileTree struct {
+	image.Rectangle
+	root         *file_node
+	rows         []*file_node //what's showing, in order
+	scroll       int          //rows scrolled off the top
+	hovered      int
+	selected     int
+	focused      bool
+	open_request string //file the editor should open next time it asks
+}
+
+var _ Widget = &FileTree{}
+
+func NewFileTree(dir string) (*FileTree, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s isn't a directory", abs)
+	}
+	ft := &FileTree{
+		//the root itself isn't shown, its contents start at the left edge
+		root:     &file_node{path: abs, is_dir: true, expanded: true, depth: -1},
+		hovered:  -1,
+		selected: -1,
+	}
+	ft.Refresh()
+	return ft, nil
+}
+
+// Root is the directory the tree shows
+func (ft *FileTree) Root() string {
+	return ft.root.path
+}
+
+// Refresh rereads the expanded directories so the tree matches what's on disk
+func (ft *FileTree) Refresh() {
+	ft.root.refresh()
+	ft.build_rows()
+}
+
+func (ft *FileTree) build_rows() {
+	selected_path := ""
+	if ft.selected >= 0 && ft.selected < len(ft.rows) {
+		selected_path = ft.rows[ft.selected].path
+	}
+	ft.rows = ft.rows[:0]
+	var add func(n *file_node)
+	add = func(n *file_node) {
+		for _, kid := range n.kids {
+			ft.rows = append(ft.rows, kid)
+			if kid.is_dir && kid.expanded {
+				add(kid)
+			}
+		}
+	}
+	add(ft.root)
+	ft.selected = min(ft.selected, len(ft.rows)-1)
+	if selected_path != "" {
+		ft.select_path(selected_path)
+	}
+	ft.clamp_scroll()
+}
+
+// select_path selects the row showing path, if it's showing
+func (ft *FileTree) select_path(path string) {
+	for i, n := range ft.rows {
+		if n.path == path {
+			ft.selected = i
+			ft.scroll_to(i)
+			return
+		}
+	}
+}
+
+func (ft *FileTree) row_height() int {
+	return MainLineHeight() + 2*Px(file_row_padding)
+}
+
+func (ft *FileTree) clamp_scroll() {
+	ft.scroll = max(0, min(ft.scroll, len(ft.rows)-ft.Dy()/ft.row_height()))
+}
+
+// scroll_to scrolls just far enough that row i is showing
+func (ft *FileTree) scroll_to(i int) {
+	showing := max(1, ft.Dy()/ft.row_height())
+	if i < ft.scroll {
+		ft.scroll = i
+	} else if i >= ft.scroll+showing {
+		ft.scroll = i - showing + 1
+	}
+	ft.clamp_scroll()
+}
+
+func (ft *FileTree) row_rect(i int) image.Rectangle {
+	y := ft.Min.Y + (i-ft.scroll)*ft.row_height()
+	return image.Rect(ft.Min.X, y, ft.Max.X, y+ft.row_height())
+}
+
+// row_at is the row under (x, y), -1 if there isn't one
+func (ft *FileTree) row_at(x, y int) int {
+	if !image.Pt(x, y).In(ft.Rectangle) {
+		return -1
+	}
+	i := (y-ft.Min.Y)/ft.row_height() + ft.scroll
+	if i >= len(ft.rows) {
+		return -1
+	}
+	return i
+}
+
+// TargetAt is the file or directory under (x, y), the root directory if it's empty space
+func (ft *FileTree) TargetAt(x, y int) (path string, is_dir bool) {
+	if i := ft.row_at(x, y); i >= 0 {
+		return ft.rows[i].path, ft.rows[i].is_dir
+	}
+	return ft.root.path, true
+}
+
+func (ft *FileTree) toggle(n *file_node) {
+	n.expanded = !n.expanded
+	if n.expanded {
+		if err := n.load(); err != nil {
+			log.Println("couldn't read directory:", err)
+		}
+	}
+	ft.build_rows()
+}
+
+// activate opens the file at row i or expands/collapses the directory
+func (ft *FileTree) activate(i int) {
+	if i < 0 || i >= len(ft.rows) {
+		return
+	}
+	if n := ft.rows[i]; n.is_dir {
+		ft.toggle(n)
+	} else {
+		ft.open_request = n.path
+	}
+}
+
+// TakeOpenRequest implements Opener
+func (ft *FileTree) TakeOpenRequest() (string, bool) {
+	path := ft.open_request
+	ft.open_request = ""
+	return path, path != ""
+}
+
+/*
+File operations, the tree refreshes and selects what they made
+*/
+
+// check_name rejects names that would put a file somewhere other than the directory it's made in
+func check_name(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsRune(name, filepath.Separator) {
+		return fmt.Errorf("%q isn't a usable name", name)
+	}
+	return nil
+}
+
+func (ft *FileTree) created(dir, path string) {
+	ft.expand_to(dir)
+	ft.Refresh()
+	ft.select_path(path)
+}
+
+// expand_to expands every directory from the root down to dir
+func (ft *FileTree) expand_to(dir string) {
+	n := ft.root
+	for n.path != dir {
+		var next *file_node
+		for _, kid := range n.kids {
+			if kid.is_dir && (dir == kid.path || strings.HasPrefix(dir, kid.path+string(filepath.Separator))) {
+				next = kid
+				break
+			}
+		}
+		if next == nil {
+			return
+		}
+		if !next.expanded {
+			next.expanded = true
+			if err := next.load(); err != nil {
+				return
+			}
+		}
+		n = next
+	}
+}
+
+// CreateFile makes an empty file called name in dir, returns its path
+func (ft *FileTree) CreateFile(dir, name string) (string, error) {
+	if err := check_name(name); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, name)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+	ft.created(dir, path)
+	return path, nil
+}
+
+// CreateDir makes a directory called name in dir, returns its path
+func (ft *FileTree) CreateDir(dir, name string) (string, error) {
+	if err := check_name(name); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, name)
+	if err := os.Mkdir(path, 0o755); err != nil {
+		return "", err
+	}
+	ft.created(dir, path)
+	return path, nil
+}
+
+// Rename gives the file or directory at path a new name in the same directory, returns its new path
+func (ft *FileTree) Rename(path, name string) (string, error) {
+	if err := check_name(name); err != nil {
+		return "", err
+	}
+	new_path := filepath.Join(filepath.Dir(path), name)
+	if _, err := os.Lstat(new_path); err == nil {
+		return "", fmt.Errorf("%s already exists", new_path)
+	}
+	if err := os.Rename(path, new_path); err != nil {
+		return "", err
+	}
+	ft.created(filepath.Dir(path), new_path)
+	return new_path, nil
+}
+
+// Delete removes the file or directory at path, and everything in it
+func (ft *FileTree) Delete(path string) error {
+	if path == ft.root.path {
+		return errors.New("won't delete the directory the tree shows")
+	}
+	if err := os.RemoveAll(path); err != nil {
+		return err
+	}
+	ft.Refresh()
+	return nil
+}
+
+/*
+Widget
+*/
+
+// Title implements Widget
+func (ft *FileTree) Title() string {
+	return ft.root.name()
+}
+
+// Describe implements Describable
+func (ft *FileTree) Describe() *WidgetDescriptor {
+	return &WidgetDescriptor{Kind: "files", File: ft.root.path}
+}
+
+// Focus implements Focuser
+func (ft *FileTree) Focus() {
+	ft.focused = true
+}
+
+// KeyboardFocusLost implements Widget
+func (ft *FileTree) KeyboardFocusLost() {
+	ft.focused = false
+}
+
+// SetRect implements Widget
+func (ft *FileTree) SetRect(rect image.Rectangle) {
+	ft.Rectangle = rect
+	ft.clamp_scroll()
+}
+
+// Draw implements Widget
+func (ft *FileTree) Draw(target *ebiten.Image) {
+	DrawRect(target, ft.Rectangle, Style.BGColorMuted)
+	//long names get cut off at our edge instead of running into the next pane
+	clipped, ok := target.SubImage(ft.Rectangle).(*ebiten.Image)
+	if !ok {
+		return
+	}
+	for i := ft.scroll; i < len(ft.rows); i++ {
+		r := ft.row_rect(i)
+		if r.Min.Y >= ft.Max.Y {
+			break
+		}
+		n := ft.rows[i]
+		switch {
+		case i == ft.selected && ft.focused:
+			DrawRect(clipped, r, Style.BlueMuted)
+		case i == ft.selected || i == ft.hovered:
+			DrawRect(clipped, r, Style.BGColorStrong)
+		}
+		x := r.Min.X + Px(file_row_padding) + n.depth*Px(file_tree_indent)
+		arrow_size := MainLineHeight() / 2
+		if n.is_dir {
+			arrow := image.Rect(x, r.Min.Y+(r.Dy()-arrow_size)/2, x+arrow_size, r.Min.Y+(r.Dy()+arrow_size)/2)
+			draw_tree_arrow(clipped, arrow, n.expanded)
+		}
+		col := Style.FGColorMuted
+		if n.is_dir {
+			col = Style.FGColorStrong
+		}
+		text.Draw(clipped, n.name(), MainFontFace, x+arrow_size+Px(file_row_padding)*2, r.Min.Y+MainFontPeriodFromTop+Px(file_row_padding), col)
+	}
+}
+
+// draw_tree_arrow draws > for a collapsed directory and v for an expanded one
+func draw_tree_arrow(target *ebiten.Image, r image.Rectangle, expanded bool) {
+	mid_x := float64(r.Min.X+r.Max.X) / 2
+	mid_y := float64(r.Min.Y+r.Max.Y) / 2
+	if expanded {
+		ebitenutil.DrawLine(target, float64(r.Min.X), float64(r.Min.Y), mid_x, float64(r.Max.Y), Style.FGColorMuted)
+		ebitenutil.DrawLine(target, mid_x, float64(r.Max.Y), float64(r.Max.X), float64(r.Min.Y), Style.FGColorMuted)
+		return
+	}
+	ebitenutil.DrawLine(target, float64(r.Min.X), float64(r.Min.Y), float64(r.Max.X), mid_y, Style.FGColorMuted)
+	ebitenutil.DrawLine(target, float64(r.Max.X), mid_y, float64(r.Min.X), float64(r.Max.Y), Style.FGColorMuted)
+}
+
+// TakeKeyboard implements Widget
+func (ft *FileTree) TakeKeyboard() {
+	if len(ft.rows) == 0 {
+		return
+	}
+	switch {
+	case KeyJustPressedOrKeyRepeated(ebiten.KeyDown):
+		ft.selected = min(ft.selected+1, len(ft.rows)-1)
+	case KeyJustPressedOrKeyRepeated(ebiten.KeyUp):
+		ft.selected = max(ft.selected-1, 0)
+	case inpututil.IsKeyJustPressed(ebiten.KeyRight):
+		if ft.selected >= 0 && ft.rows[ft.selected].is_dir && !ft.rows[ft.selected].expanded {
+			ft.toggle(ft.rows[ft.selected])
+		}
+	case inpututil.IsKeyJustPressed(ebiten.KeyLeft):
+		if ft.selected < 0 {
+			break
+		}
+		if n := ft.rows[ft.selected]; n.is_dir && n.expanded {
+			ft.toggle(n)
+		} else {
+			//go up to the directory it's in
+			ft.select_path(filepath.Dir(n.path))
+		}
+	case inpututil.IsKeyJustPressed(ebiten.KeyEnter):
+		ft.activate(ft.selected)
+	default:
+		return
+	}
+	if ft.selected >= 0 {
+		ft.scroll_to(ft.selected)
+	}
+}
+
+// MouseOut implements Widget
+func (ft *FileTree) MouseOut() {
+	ft.hovered = -1
+}
+
+// MouseOver implements Widget
+func (ft *FileTree) MouseOver(x int, y int) Widget {
+	ebiten.SetCursorShape(ebiten.CursorShapeDefault)
+	if _, dy := ebiten.Wheel(); dy != 0 {
+		ft.scroll -= int(dy * 3)
+		ft.clamp_scroll()
+	}
+	ft.hovered = ft.row_at(x, y)
+	return ft
+}
+
+// LMouseDown implements Widget, a click opens a file or expands a directory
+func (ft *FileTree) LMouseDown(x int, y int) Widget {
+	if i := ft.row_at(x, y); i >= 0 {
+		ft.selected = i
+		ft.activate(i)
+	}
+	return ft
+}
+
+// LMouseUp implements Widget
+func (ft *FileTree) LMouseUp(x int, y int) Widget {
+	return ft
+}
+
+// RMouseDown implements Widget, selects what's about to get a context menu
+func (ft *FileTree) RMouseDown(x int, y int) Widget {
+	ft.selected = ft.row_at(x, y)
+	return ft
+}
+
+// RMouseUp implements Widget
+func (ft *FileTree) RMouseUp(x int, y int) Widget {
+	return ft
+}
+
+// MMouseDown implements Widget
+func (*FileTree) MMouseDown(x int, y int) Widget {
+	return nil
+}
+
+// MMouseUp implements Widget
+func (*FileTree) MMouseUp(x int, y int) Widget {
+	return nil
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// Fonts are picked per role with the font.* settings, like everything else the user can change
+//
+//	{
+//		"font.main_family": "Cascadia Code",
+//		"font.menu_style": "light",
+//		"font.code_size": 15,
+//		"font.fallback": "Noto Sans CJK SC, Noto Emoji",
+//		"font.ligatures": true
+//	}
+//
+// families we ship are used first, anything else is looked up with fontconfig
+// characters a role's font doesn't have are drawn with the first fallback font that does
+
+//go:embed Fonts
+var bundled_fonts embed.FS
+
+// the families we ship, style -> file
+// Source Code Pro only comes in light, regular and medium here so medium stands in for bold
+var bundled_families = map[string]map[string]string{
+	"source code pro": {
+		"regular": "Fonts/Source_Code_Pro/SourceCodePro-Regular.ttf",
+		"light":   "Fonts/Source_Code_Pro/SourceCodePro-Light.ttf",
+		"medium":  "Fonts/Source_Code_Pro/SourceCodePro-Medium.ttf",
+		"bold":    "Fonts/Source_Code_Pro/SourceCodePro-Medium.ttf",
+	},
+	"cascadia code": {
+		"regular": "Fonts/CascadiaCode-2111.01/ttf/CascadiaCode.ttf",
+		"italic":  "Fonts/CascadiaCode-2111.01/ttf/CascadiaCodeItalic.ttf",
+	},
+	"cascadia code pl": {
+		"regular": "Fonts/CascadiaCode-2111.01/ttf/CascadiaCodePL.ttf",
+		"italic":  "Fonts/CascadiaCode-2111.01/ttf/CascadiaCodePLItalic.ttf",
+	},
+	"cascadia mono": {
+		"regular": "Fonts/CascadiaCode-2111.01/ttf/CascadiaMono.ttf",
+		"italic":  "Fonts/CascadiaCode-2111.01/ttf/CascadiaMonoItalic.ttf",
+	},
+	"cascadia mono pl": {
+		"regular": "Fonts/CascadiaCode-2111.01/ttf/CascadiaMonoPL.ttf",
+		"italic":  "Fonts/CascadiaCode-2111.01/ttf/CascadiaMonoPLItalic.ttf",
+	},
+}
+
+const default_font_family = "source code pro"
+
+// FontSpec is the font one role uses, its size is a setting of its own
+type FontSpec struct {
+	Family string
+	Style  string //the weight normal text is drawn in, regular if empty
+}
+
+// each role's font, from the font.* settings
+var main_font = FontSpec{Family: "Source Code Pro"}
+var menu_font = FontSpec{Family: "Source Code Pro"}
+var code_font = FontSpec{Family: "Source Code Pro"}
+
+// families characters the role's font doesn't have are looked for in, in order, separated by commas
+// box drawing from Cascadia, then whatever CJK and emoji fonts are installed
+// the freetype rasterizer only reads TrueType outlines, so colour emoji fonts and .ttc collections are no use
+var fallback_families = "Cascadia Mono, DejaVu Sans Mono, Droid Sans Fallback, WenQuanYi Zen Hei, Noto Sans CJK SC, Noto Emoji, Symbola"
+
+// draw programming ligatures in the code font, if it has them, see ligatures.go
+var ligatures bool
+
+// FallbackFamilies is fallback_families as a list
+func FallbackFamilies() []string {
+	families := []string{}
+	for _, family := range strings.Split(fallback_families, ",") {
+		if family = strings.TrimSpace(family); family != "" {
+			families = append(families, family)
+		}
+	}
+	return families
+}
+
+// FontSet is a role's font in each style it comes in, plus the fonts for characters it doesn't have
+type FontSet struct {
+	Regular    *truetype.Font
+	Bold       *truetype.Font //nil if the family doesn't come in this style
+	Italic     *truetype.Font
+	BoldItalic *truetype.Font
+	Fallback   []*truetype.Font
+
+	RegularData []byte //the file Regular was parsed from, for shaping
+}
+
+var ErrFontNotFound = errors.New("font not found")
+
+// LoadFontSet loads spec's family in every style it has, falling back to the bundled font if it can't be found
+func LoadFontSet(spec FontSpec, fallback []*truetype.Font) *FontSet {
+	regular := spec.Style
+	if regular == "" {
+		regular = "regular"
+	}
+	fs := &FontSet{Fallback: fallback}
+	var err error
+	fs.RegularData, err = FontFamilyData(spec.Family, regular)
+	if err == nil {
+		fs.Regular, err = truetype.Parse(fs.RegularData)
+	}
+	if err != nil {
+		log.Printf("couldn't load font %s %s, using the default: %v", spec.Family, regular, err)
+		spec.Family = default_font_family
+		fs.RegularData, err = FontFamilyData(spec.Family, "regular")
+		check(err) //it's built in
+		fs.Regular, err = truetype.Parse(fs.RegularData)
+		check(err)
+	}
+	fs.Bold, _ = LoadFontFamily(spec.Family, "bold")
+	fs.Italic, _ = LoadFontFamily(spec.Family, "italic")
+	fs.BoldItalic, _ = LoadFontFamily(spec.Family, "bold italic")
+	return fs
+}
+
+// LoadFontFamily finds family in style, one of "regular", "bold", "italic", "bold italic" or a weight like "light"
+func LoadFontFamily(family, style string) (*truetype.Font, error) {
+	bs, err := FontFamilyData(family, style)
+	if err != nil {
+		return nil, err
+	}
+	f, err := truetype.Parse(bs)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", family, style, err)
+	}
+	return f, nil
+}
+
+// FontFamilyData is the font file for family in style
+func FontFamilyData(family, style string) ([]byte, error) {
+	if styles, ok := bundled_families[strings.ToLower(family)]; ok {
+		path, ok := styles[style]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s %s", ErrFontNotFound, family, style)
+		}
+		return bundled_fonts.ReadFile(path)
+	}
+	path, err := fontconfig_match(family, style)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+// families fontconfig can satisfy with anything, we can't check the name it gives back against these
+var generic_families = []string{"monospace", "sans-serif", "sans", "serif", "emoji"}
+
+// fontconfig_match asks fc-match for the file with family in style
+// fc-match always answers with something, so the answer only counts if it's the family and style we asked for
+func fontconfig_match(family, style string) (string, error) {
+	if _, err := exec.LookPath("fc-match"); err != nil {
+		return "", fmt.Errorf("%w: %s, and no fontconfig to look for it", ErrFontNotFound, family)
+	}
+	pattern := family
+	if style != "regular" {
+		pattern += ":style=" + style
+	}
+	out, err := exec.Command("fc-match", "--format=%{family}\n%{style}\n%{file}", pattern).Output()
+	if err != nil {
+		return "", fmt.Errorf("fc-match %s: %w", pattern, err)
+	}
+	parts := strings.SplitN(string(out), "\n", 3)
+	if len(parts) != 3 {
+		return "", fmt.Errorf("%w: %s %s", ErrFontNotFound, family, style)
+	}
+	got_families, got_style, path := strings.ToLower(parts[0]), strings.ToLower(parts[1]), strings.TrimSpace(parts[2])
+
+	generic := false
+	for _, g := range generic_families {
+		generic = generic || strings.EqualFold(family, g)
+	}
+	family_ok := generic
+	for _, f := range strings.Split(got_families, ",") {
+		family_ok = family_ok || strings.TrimSpace(f) == strings.ToLower(family)
+	}
+	style_ok := true
+	for _, want := range strings.Fields(style) {
+		if want == "italic" {
+			style_ok = style_ok && (strings.Contains(got_style, "italic") || strings.Contains(got_style, "oblique"))
+		} else if want != "regular" {
+			style_ok = style_ok && strings.Contains(got_style, want)
+		}
+	}
+	if !family_ok || !style_ok || path == "" {
+		return "", fmt.Errorf("%w: %s %s", ErrFontNotFound, family, style)
+	}
+	return path, nil
+}
+
+// LoadFallbackFonts loads the families that can be found, skipping the rest
+func LoadFallbackFonts(families []string) []*truetype.Font {
+	fonts := []*truetype.Font{}
+	for _, family := range families {
+		if f, err := LoadFontFamily(family, "regular"); err == nil {
+			fonts = append(fonts, f)
+		}
+	}
+	return fonts
+}
+
+// MakeFace makes fs's regular style size big, with its fallbacks, and says how far below the top of a line the baseline is
+func MakeFace(fs *FontSet, size int) (font.Face, int) {
+	face := MakeStyledFace(fs.Regular, fs, size)
+	PeriodFromTop := face.Metrics().Height.Round() - face.Metrics().Descent.Round()
+	return face, PeriodFromTop
+}
+
+// MakeStyledFace makes f size big with fs's fallbacks, nil if f is
+// size is in logical pixels, the face is made at the physical size so text is drawn at the screen's own resolution
+func MakeStyledFace(f *truetype.Font, fs *FontSet, size int) font.Face {
+	if f == nil {
+		return nil
+	}
+	opts := &truetype.Options{Size: float64(size) * UIScale}
+	ff := &fallback_face{fonts: []*truetype.Font{f}, faces: []font.Face{truetype.NewFace(f, opts)}}
+	for _, fallback := range fs.Fallback {
+		ff.fonts = append(ff.fonts, fallback)
+		ff.faces = append(ff.faces, truetype.NewFace(fallback, opts))
+	}
+	return ff
+}
+
+// fallback_face draws each character with the first of its fonts that has it
+type fallback_face struct {
+	fonts []*truetype.Font
+	faces []font.Face
+}
+
+var _ font.Face = &fallback_face{}
+
+func (ff *fallback_face) face_for(r rune) font.Face {
+	for i, f := range ff.fonts {
+		if f.Index(r) != 0 {
+			return ff.faces[i]
+		}
+	}
+	//nobody has it, let the main font draw its missing glyph box
+	return ff.faces[0]
+}
+
+// Close implements font.Face
+func (ff *fallback_face) Close() error {
+	return nil
+}
+
+// Glyph implements font.Face
+func (ff *fallback_face) Glyph(dot fixed.Point26_6, r rune) (dr image.Rectangle, mask image.Image, maskp image.Point, advance fixed.Int26_6, ok bool) {
+	return ff.face_for(r).Glyph(dot, r)
+}
+
+// GlyphBounds implements font.Face
+func (ff *fallback_face) GlyphBounds(r rune) (bounds fixed.Rectangle26_6, advance fixed.Int26_6, ok bool) {
+	return ff.face_for(r).GlyphBounds(r)
+}
+
+// GlyphAdvance implements font.Face
+func (ff *fallback_face) GlyphAdvance(r rune) (advance fixed.Int26_6, ok bool) {
+	return ff.face_for(r).GlyphAdvance(r)
+}
+
+// Kern implements font.Face, only pairs from the same font kern
+func (ff *fallback_face) Kern(r0, r1 rune) fixed.Int26_6 {
+	face := ff.face_for(r0)
+	if face != ff.face_for(r1) {
+		return 0
+	}
+	return face.Kern(r0, r1)
+}
+
+// Metrics implements font.Face, lines are spaced for the main font
+func (ff *fallback_face) Metrics() font.Metrics {
+	return ff.faces[0].Metrics()
+}
+
+// MakeFaces remakes every role's faces at the current sizes
+func MakeFaces() {
+	MainFontFace, MainFontPeriodFromTop = MakeFace(MainFont, MainFontSize)
+	MenuFontFace, MenuFontPeriodFromTop = MakeFace(MenuFont, MenuFontSize)
+	CodeFontFace, CodeFontPeriodFromTop = MakeFace(CodeFont, CodeFontSize)
+
+	CodeBoldFontFace = MakeStyledFace(CodeFont.Bold, CodeFont, CodeFontSize)
+	CodeItalicFontFace = MakeStyledFace(CodeFont.Italic, CodeFont, CodeFontSize)
+	CodeBoldItalicFontFace = MakeStyledFace(CodeFont.BoldItalic, CodeFont, CodeFontSize)
+}
+
+// CodeFaceFor is the code face to draw s with, the closest one the font has to s's style
+func CodeFaceFor(s ScopeStyle) font.Face {
+	if s.Bold && s.Italic && CodeBoldItalicFontFace != nil {
+		return CodeBoldItalicFontFace
+	}
+	if s.Italic && CodeItalicFontFace != nil {
+		return CodeItalicFontFace
+	}
+	if s.Bold && CodeBoldFontFace != nil {
+		return CodeBoldFontFace
+	}
+	return CodeFontFace
+}
+
+// LoadFonts loads every role's font as the settings say and remakes the faces
+func LoadFonts() {
+	fallback := LoadFallbackFonts(FallbackFamilies())
+	MainFont = LoadFontSet(main_font, fallback)
+	MenuFont = LoadFontSet(menu_font, fallback)
+	CodeFont = LoadFontSet(code_font, fallback)
+	MakeFaces()
+	SetupShaping()
+}
+
+func init() {
+	LoadFonts()
+	//fonts used to be set in a file of their own
+	if _, err := os.Stat(filepath.Join(ConfigDir(), "fonts.json")); err == nil {
+		log.Println("fonts.json isn't read any more, use the font settings in", UserSettingsPath())
+	}
+}
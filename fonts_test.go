@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestFallbackFamilies(t *testing.T) {
+	saved := fallback_families
+	defer func() { fallback_families = saved }()
+	fallback_families = " Noto Emoji,, Symbola ,"
+	if got, want := FallbackFamilies(), []string{"Noto Emoji", "Symbola"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FallbackFamilies() = %q, want %q", got, want)
+	}
+}
+
+// every font option is a setting, there's nothing else to read them from
+func TestFontSettings(t *testing.T) {
+	register_settings()
+	saved := code_font
+	defer func() {
+		code_font = saved
+		LoadFonts()
+	}()
+	for _, key := range []string{"font.main_family", "font.main_style", "font.menu_family", "font.menu_style",
+		"font.code_family", "font.code_style", "font.code_size", "font.fallback", "font.ligatures"} {
+		if FindSetting(key) == nil {
+			t.Errorf("no %s setting", key)
+		}
+	}
+
+	s := FindSetting("font.code_family")
+	s.set("Cascadia Mono")
+	s.on_change()
+	want, err := FontFamilyData("Cascadia Mono", "regular")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(CodeFont.RegularData, want) {
+		t.Errorf("changing font.code_family didn't load the new font")
+	}
+	if CodeFontFace == nil {
+		t.Errorf("no code face after reloading")
+	}
+}
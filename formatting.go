@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Formatting, a file's text is piped through its language's formatter, on save or from the Code menu
+// only the lines the formatter changed are replaced, so cursors and anything marked elsewhere stay put
+// there's no selection yet, so it's always the whole file that gets formatted
+
+// the formatter for each language, given the text on stdin and printing it formatted, "" for none
+// languages without one here use their highlighter's formatter line
+var go_formatter_command = "gofmt"
+var c_formatter_command = "clang-format"
+
+var formatter_commands = map[string]*string{
+	"go": &go_formatter_command,
+	"c":  &c_formatter_command,
+}
+
+var format_on_save = true
+
+// how long a formatter gets before we give up on it, saving waits for it
+const format_timeout = 5 * time.Second
+
+var ErrNoFormatter = errors.New("no formatter for this language")
+
+// formatter_for is the command that formats te's text
+func formatter_for(te *TextEditor) string {
+	if te.highlighter == nil {
+		return ""
+	}
+	if command, ok := formatter_commands[te.highlighter.Language()]; ok && *command != "" {
+		return *command
+	}
+	return te.highlighter.formatter
+}
+
+func (g *Editor) HasFormatter() bool {
+	te := g.FocusedEditor()
+	return te != nil && !te.ReadOnly && formatter_for(te) != ""
+}
+
+// FormatFocused formats the focused editor's file
+func (g *Editor) FormatFocused() {
+	if te := g.FocusedEditor(); te != nil && !te.ReadOnly {
+		g.Format(te, nil)
+	}
+}
+
+// format_before_save formats te if formatting on save is on and it has a formatter, then calls save
+func (g *Editor) format_before_save(te *TextEditor, save func()) {
+	if !format_on_save || g.Format(te, save) != nil {
+		save()
+	}
+}
+
+// what finished formatters printed, run by UpdateFormatting
+var format_results = make(chan func(), 16)
+
+// Format runs te's text through its formatter in the background and applies what changed, see UpdateFormatting
+// if the formatter fails what it printed becomes diagnostics and the text is left alone,
+// and if the text was edited while it ran its output is out of date and thrown away
+// done gets called after either, if it isn't nil, it isn't when there's no formatter
+func (g *Editor) Format(te *TextEditor, done func()) error {
+	command := strings.Fields(formatter_for(te))
+	if len(command) == 0 {
+		return ErrNoFormatter
+	}
+	tb, path := te.buf, te.buf.filepath
+	key := "formatter:" + path
+	dir := WorkspaceDir()
+	if path != "" {
+		dir = filepath.Dir(path)
+	}
+	text, version := tb.Text(), tb.version
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), format_timeout)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+		cmd.Dir = dir
+		cmd.Stdin = strings.NewReader(text)
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+		err := cmd.Run()
+		format_results <- func() {
+			switch {
+			case err != nil:
+				if path != "" {
+					SetDiagnostics(key, formatter_errors(stderr.String(), err, path, command[0]))
+				}
+			case tb.version == version:
+				ClearDiagnostics(key)
+				g.apply_formatted(tb, stdout.String())
+			}
+			if done != nil {
+				done()
+			}
+		}
+	}()
+	return nil
+}
+
+// UpdateFormatting applies what formatters that have finished since the last update printed
+func UpdateFormatting() {
+	for {
+		select {
+		case f := <-format_results:
+			f()
+		default:
+			return
+		}
+	}
+}
+
+// formatter_errors is what a failed formatter printed, its file:line:col lines say <standard input> for the file
+func formatter_errors(output string, err error, path, source string) []Diagnostic {
+	ds := []Diagnostic{}
+	for _, line := range strings.Split(output, "\n") {
+		m := tool_line.FindStringSubmatch(strings.TrimRight(line, "\r"))
+		if m != nil {
+			ds = append(ds, tool_diagnostic(m, path, source))
+		}
+	}
+	if len(ds) == 0 {
+		message := strings.TrimSpace(output)
+		if message == "" {
+			message = err.Error()
+		}
+		ds = append(ds, Diagnostic{Path: path, Severity: DiagnosticError, Message: message, Source: source})
+	}
+	return ds
+}
+
+// apply_formatted replaces the lines of tb that differ from formatted
+// the cursors and scroll of editors showing tb are marked first so they move with the text around them
+func (g *Editor) apply_formatted(tb *TextBuffer, formatted string) {
+	hunks := DiffLines(tb.lines, strings.Split(formatted, "\n"))
+	if len(hunks) == 0 {
+		return
+	}
+	type view struct {
+		te            *TextEditor
+		cursor, first *Mark
+	}
+	views := []view{}
+	Walk(g.MainWidget, func(w Widget) {
+		if te, ok := w.(*TextEditor); ok && te.buf == tb {
+			views = append(views, view{te, tb.AddMark(te.cursor, false), tb.AddMark(Cursor{row: te.first_row()}, false)})
+		}
+	})
+	//from the bottom up so the rows of the hunks still to do don't move
+	for i := len(hunks) - 1; i >= 0; i-- {
+		h := hunks[i]
+		from, to, s := hunk_replacement(tb, h)
+		tb.Replace(from, to, s)
+	}
+	for _, v := range views {
+		v.te.cursor = tb.ClampCursor(v.cursor.Cursor)
+		v.te.ScrollTo(v.first.Cursor.row)
+		tb.RemoveMark(v.cursor)
+		tb.RemoveMark(v.first)
+		v.te.MarkRedraw()
+	}
+}
+
+// hunk_replacement is the Replace that does h to tb, the last line has no newline after it so hunks reaching it are different
+func hunk_replacement(tb *TextBuffer, h DiffHunk) (Cursor, Cursor, string) {
+	n := len(tb.lines)
+	text := strings.Join(h.New, "\n")
+	switch {
+	case h.OldTo < n:
+		if len(h.New) > 0 {
+			text += "\n"
+		}
+		return Cursor{row: h.OldFrom}, Cursor{row: h.OldTo}, text
+	case h.OldFrom == n:
+		return tb.End(), tb.End(), "\n" + text
+	case len(h.New) > 0:
+		return Cursor{row: h.OldFrom}, tb.End(), text
+	case h.OldFrom == 0:
+		return Cursor{}, tb.End(), ""
+	}
+	//deleting the last lines takes the newline before them too
+	return Cursor{row: h.OldFrom - 1, col: len(tb.lines[h.OldFrom-1])}, tb.End(), ""
+}
+
+/*
+Line diffs
+*/
+
+// DiffHunk says lines OldFrom up to OldTo are replaced with New, OldFrom == OldTo is an insertion before OldFrom
+type DiffHunk struct {
+	OldFrom, OldTo int
+	New            []string
+}
+
+// past this many lines deleted and inserted DiffLines gives up on finding the fewest
+const max_diff_edits = 1000
+
+// DiffLines is the hunks that turn a into b, in order, using Myers' algorithm so they're as few lines as can be
+func DiffLines(a, b []string) []DiffHunk {
+	//the same start and end are common and cheap to skip
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	a, b = a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	//v[k] is the furthest x reached on diagonal k, trace keeps each round's so the path can be walked back
+	//round d only gets as far as diagonals -d to d, so that's all of v it keeps
+	n, m := len(a), len(b)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	trace := [][]int{}
+	d := 0
+search:
+	for ; d <= n+m; d++ {
+		if d > max_diff_edits {
+			//so different that the trace would take more memory than it's worth, replace the lot
+			return []DiffHunk{{OldFrom: prefix, OldTo: prefix + n, New: b}}
+		}
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[offset+k-1] < v[offset+k+1] {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	//walk back from the end, marking which lines of a were deleted and which of b inserted
+	deleted, inserted := make([]bool, n), make([]bool, m)
+	x, y := n, m
+	for ; d > 0; d-- {
+		prev := trace[d] //diagonal k is at k+d
+		k := x - y
+		var prev_k int
+		if k == -d || k != d && prev[d+k-1] < prev[d+k+1] {
+			prev_k = k + 1
+		} else {
+			prev_k = k - 1
+		}
+		prev_x := prev[d+prev_k]
+		prev_y := prev_x - prev_k
+		for x > prev_x && y > prev_y {
+			x, y = x-1, y-1
+		}
+		if x == prev_x {
+			inserted[prev_y] = true
+		} else {
+			deleted[prev_x] = true
+		}
+		x, y = prev_x, prev_y
+	}
+
+	//runs of changes become hunks
+	hunks := []DiffHunk{}
+	i, j := 0, 0
+	for i < n || j < m {
+		if i < n && j < m && !deleted[i] && !inserted[j] {
+			i, j = i+1, j+1
+			continue
+		}
+		h := DiffHunk{OldFrom: prefix + i}
+		for i < n && deleted[i] {
+			i++
+		}
+		from := j
+		for j < m && inserted[j] {
+			j++
+		}
+		h.OldTo, h.New = prefix+i, b[from:j]
+		hunks = append(hunks, h)
+	}
+	return hunks
+}
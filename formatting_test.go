@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// apply_hunks does hunks to a, the way apply_formatted does them to a buffer
+func apply_hunks(a []string, hunks []DiffHunk) []string {
+	out := append([]string(nil), a...)
+	for i := len(hunks) - 1; i >= 0; i-- {
+		h := hunks[i]
+		out = append(out[:h.OldFrom], append(append([]string(nil), h.New...), out[h.OldTo:]...)...)
+	}
+	return out
+}
+
+func split_words(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, " ")
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		hunks int
+	}{
+		{"a b c", "a b c", 0},
+		{"a b c", "a x b c", 1},
+		{"a b c", "a c", 1},
+		{"a b c d", "a x c y", 2},
+		{"a b c", "x y z", 1},
+		{"", "a b", 1},
+		{"a b", "", 1},
+		{"a b c a b b a", "c b a b a c", 4},
+	}
+	for _, test := range tests {
+		a, b := split_words(test.a), split_words(test.b)
+		hunks := DiffLines(a, b)
+		if got := apply_hunks(a, hunks); !reflect.DeepEqual(got, b) {
+			t.Errorf("%q to %q: hunks %+v make %q", test.a, test.b, hunks, got)
+		}
+		if len(hunks) != test.hunks {
+			t.Errorf("%q to %q: %d hunks, want %d", test.a, test.b, len(hunks), test.hunks)
+		}
+		for i := 1; i < len(hunks); i++ {
+			if hunks[i].OldFrom < hunks[i-1].OldTo {
+				t.Errorf("%q to %q: hunks out of order %+v", test.a, test.b, hunks)
+			}
+		}
+	}
+}
+
+func TestDiffLinesTooDifferent(t *testing.T) {
+	var a, b []string
+	for i := 0; i < max_diff_edits; i++ {
+		a = append(a, fmt.Sprint("a", i))
+		b = append(b, fmt.Sprint("b", i))
+	}
+	a = append([]string{"same"}, append(a, "end")...)
+	b = append([]string{"same"}, append(b, "end")...)
+	hunks := DiffLines(a, b)
+	if len(hunks) != 1 || hunks[0].OldFrom != 1 || hunks[0].OldTo != len(a)-1 {
+		t.Fatalf("got %d hunks, want the middle replaced in one", len(hunks))
+	}
+	if got := apply_hunks(a, hunks); !reflect.DeepEqual(got, b) {
+		t.Errorf("replacing everything didn't make b")
+	}
+}
+
+func TestApplyFormatted(t *testing.T) {
+	tests := []struct{ text, formatted string }{
+		{"a\nb\nc", "a\nx\nc"},
+		{"a\nb\nc", "a\nb"},
+		{"a\nb\nc", "a\nb\nc\nd"},
+		{"a\nb", ""},
+		{"", "a\nb"},
+		{"a\n\nb\n", "a\nb\n"},
+	}
+	for _, test := range tests {
+		te := NewTextEditor(NewTextBuffer(test.text))
+		g := &Editor{MainWidget: NewTabs(te)}
+		g.apply_formatted(te.buf, test.formatted)
+		if got := te.buf.Text(); got != test.formatted {
+			t.Errorf("%q formatted as %q became %q", test.text, test.formatted, got)
+		}
+	}
+}
+
+func TestFormatInBackground(t *testing.T) {
+	if _, err := exec.LookPath("tr"); err != nil {
+		t.Skip("no tr to format with")
+	}
+	if len(definitions) == 0 {
+		ParseSyntaxHighlightingDefinitions()
+	}
+	saved := go_formatter_command
+	go_formatter_command = "tr a-z A-Z"
+	defer func() { go_formatter_command = saved }()
+
+	path := filepath.Join(t.TempDir(), "main.go")
+	if err := os.WriteFile(path, []byte("package main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	te, err := OpenTextEditor(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := &Editor{MainWidget: NewTabs(te)}
+
+	done := false
+	if err := g.Format(te, func() { done = true }); err != nil {
+		t.Fatal(err)
+	}
+	if te.buf.Text() != "package main\n" {
+		t.Errorf("formatted before the next update")
+	}
+	until(t, UpdateFormatting, func() bool { return done })
+	if got := te.buf.Text(); got != "PACKAGE MAIN\n" {
+		t.Errorf("formatted text is %q", got)
+	}
+
+	//output for text that's since been edited is thrown away
+	done = false
+	te.buf.SetText("package other\n")
+	g.Format(te, func() { done = true })
+	te.buf.Replace(Cursor{}, Cursor{}, "// x\n")
+	until(t, UpdateFormatting, func() bool { return done })
+	if got := te.buf.Text(); got != "// x\npackage other\n" {
+		t.Errorf("stale formatting was applied, text is %q", got)
+	}
+}
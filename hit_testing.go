@@ -0,0 +1,68 @@
+package main
+
+import "image"
+
+// Every widget gets and gives rectangles in screen space, so containers never translate coordinates
+// they just find which child's Bounds the point is in and hand the event over unchanged
+
+// WidgetAt returns the first widget whose rectangle holds (x, y), nil if none do
+func WidgetAt(widgets []Widget, x, y int) Widget {
+	pt := image.Pt(x, y)
+	for _, w := range widgets {
+		if w != nil && pt.In(w.Bounds()) {
+			return w
+		}
+	}
+	return nil
+}
+
+// DispatchMouseOver sends a mouse over to whichever of widgets is under (x, y)
+// fallback is returned when nothing is there so the caller still counts as the consumer
+func DispatchMouseOver(widgets []Widget, x, y int, fallback Widget) Widget {
+	if w := WidgetAt(widgets, x, y); w != nil {
+		return w.MouseOver(x, y)
+	}
+	return fallback
+}
+
+func DispatchLMouseDown(widgets []Widget, x, y int, fallback Widget) Widget {
+	if w := WidgetAt(widgets, x, y); w != nil {
+		return w.LMouseDown(x, y)
+	}
+	return fallback
+}
+
+func DispatchLMouseUp(widgets []Widget, x, y int, fallback Widget) Widget {
+	if w := WidgetAt(widgets, x, y); w != nil {
+		return w.LMouseUp(x, y)
+	}
+	return fallback
+}
+
+func DispatchRMouseDown(widgets []Widget, x, y int, fallback Widget) Widget {
+	if w := WidgetAt(widgets, x, y); w != nil {
+		return w.RMouseDown(x, y)
+	}
+	return fallback
+}
+
+func DispatchRMouseUp(widgets []Widget, x, y int, fallback Widget) Widget {
+	if w := WidgetAt(widgets, x, y); w != nil {
+		return w.RMouseUp(x, y)
+	}
+	return fallback
+}
+
+func DispatchMMouseDown(widgets []Widget, x, y int, fallback Widget) Widget {
+	if w := WidgetAt(widgets, x, y); w != nil {
+		return w.MMouseDown(x, y)
+	}
+	return fallback
+}
+
+func DispatchMMouseUp(widgets []Widget, x, y int, fallback Widget) Widget {
+	if w := WidgetAt(widgets, x, y); w != nil {
+		return w.MMouseUp(x, y)
+	}
+	return fallback
+}
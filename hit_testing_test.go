@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"testing"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// recording_widget is a leaf that notes every mouse event it gets and takes them all
+type recording_widget struct {
+	image.Rectangle
+	name   string
+	events *[]string
+}
+
+func (rw *recording_widget) record(event string, x, y int) Widget {
+	*rw.events = append(*rw.events, fmt.Sprintf("%s %s %d,%d", rw.name, event, x, y))
+	return rw
+}
+
+func (rw *recording_widget) Title() string                { return rw.name }
+func (rw *recording_widget) Draw(target *ebiten.Image)    {}
+func (rw *recording_widget) SetRect(rect image.Rectangle) { rw.Rectangle = rect }
+func (rw *recording_widget) TakeKeyboard()                {}
+func (rw *recording_widget) KeyboardFocusLost()           {}
+func (rw *recording_widget) MouseOut()                    {}
+func (rw *recording_widget) MouseOver(x, y int) Widget    { return rw.record("over", x, y) }
+func (rw *recording_widget) LMouseDown(x, y int) Widget   { return rw.record("ldown", x, y) }
+func (rw *recording_widget) LMouseUp(x, y int) Widget     { return rw.record("lup", x, y) }
+func (rw *recording_widget) RMouseDown(x, y int) Widget   { return rw.record("rdown", x, y) }
+func (rw *recording_widget) RMouseUp(x, y int) Widget     { return rw.record("rup", x, y) }
+func (rw *recording_widget) MMouseDown(x, y int) Widget   { return rw.record("mdown", x, y) }
+func (rw *recording_widget) MMouseUp(x, y int) Widget     { return rw.record("mup", x, y) }
+
+var _ Widget = &recording_widget{}
+
+// nested_layout is
+//
+//	SplitPane, side by side
+//	├── HorizontalSplitter
+//	│   ├── a
+//	│   └── VerticalSplitter
+//	│       ├── b
+//	│       └── Tabs (c, d)
+//	└── e
+//
+// laid out in a 1000x600 window that starts at (100, 50), so nothing lines up with the origin
+type nested_layout struct {
+	root          *SplitPane
+	hz            *HorizontalSplitter
+	vs            *VerticalSplitter
+	tabs          *Tabs
+	a, b, c, d, e *recording_widget
+	events        []string
+}
+
+func new_nested_layout() *nested_layout {
+	l := &nested_layout{}
+	leaf := func(name string) *recording_widget {
+		return &recording_widget{name: name, events: &l.events}
+	}
+	l.a, l.b, l.c, l.d, l.e = leaf("a"), leaf("b"), leaf("c"), leaf("d"), leaf("e")
+	l.tabs = NewTabs(l.c, l.d)
+	l.vs = &VerticalSplitter{Top: l.b, Bottom: l.tabs, split_y: 300, border_half_width: 2}
+	l.hz = &HorizontalSplitter{Left: l.a, Right: l.vs, split_x: 250, border_half_width: 2}
+	l.root = NewSplitPane(SplitHorizontal, l.hz, l.e)
+	l.root.SetRect(image.Rect(100, 50, 1100, 650))
+	return l
+}
+
+// send gives the root one event, returning what took it and what the leaves recorded
+func (l *nested_layout) send(event string, x, y int) (Widget, []string) {
+	l.events = nil
+	var consumer Widget
+	switch event {
+	case "over":
+		consumer = l.root.MouseOver(x, y)
+	case "ldown":
+		consumer = l.root.LMouseDown(x, y)
+	case "lup":
+		consumer = l.root.LMouseUp(x, y)
+	case "rdown":
+		consumer = l.root.RMouseDown(x, y)
+	case "rup":
+		consumer = l.root.RMouseUp(x, y)
+	case "mdown":
+		consumer = l.root.MMouseDown(x, y)
+	case "mup":
+		consumer = l.root.MMouseUp(x, y)
+	}
+	return consumer, l.events
+}
+
+var mouse_events = []string{"over", "ldown", "lup", "rdown", "rup", "mdown", "mup"}
+
+func TestNestedLayoutRects(t *testing.T) {
+	l := new_nested_layout()
+	body_top := 50 + 300 + l.tabs.TabHeight
+	want := map[*recording_widget]image.Rectangle{
+		l.a: image.Rect(100, 50, 350, 650),
+		l.b: image.Rect(350, 50, 600, 350),
+		l.c: image.Rect(350, body_top, 600, 650),
+		l.e: image.Rect(600, 50, 1100, 650),
+	}
+	for w, r := range want {
+		if w.Rectangle != r {
+			t.Errorf("%s is at %v, want %v", w.name, w.Rectangle, r)
+		}
+	}
+}
+
+func TestNestedLayoutRouting(t *testing.T) {
+	l := new_nested_layout()
+	body_y := 50 + 300 + l.tabs.TabHeight + 20
+	points := []struct {
+		x, y int
+		want *recording_widget
+	}{
+		{120, 60, l.a},
+		{340, 640, l.a},
+		{400, 100, l.b},
+		{595, 340, l.b},
+		{400, body_y, l.c},
+		{595, 649, l.c},
+		{700, 300, l.e},
+		{1099, 649, l.e},
+	}
+	for _, p := range points {
+		for _, event := range mouse_events {
+			consumer, events := l.send(event, p.x, p.y)
+			if consumer != Widget(p.want) {
+				t.Errorf("%s at %d,%d was taken by %v, want %s", event, p.x, p.y, consumer, p.want.name)
+			}
+			want := fmt.Sprintf("%s %s %d,%d", p.want.name, event, p.x, p.y)
+			if len(events) != 1 || events[0] != want {
+				t.Errorf("%s at %d,%d recorded %q, want just %q", event, p.x, p.y, events, want)
+			}
+		}
+	}
+}
+
+func TestNestedLayoutHiddenTab(t *testing.T) {
+	l := new_nested_layout()
+	body_y := 50 + 300 + l.tabs.TabHeight + 20
+	for _, event := range mouse_events {
+		if consumer, _ := l.send(event, 400, body_y); consumer != Widget(l.c) {
+			t.Fatalf("%s went to %v before switching tabs, want c", event, consumer)
+		}
+	}
+	l.tabs.Select(1)
+	for _, event := range mouse_events {
+		consumer, events := l.send(event, 400, body_y)
+		if consumer != Widget(l.d) {
+			t.Errorf("%s went to %v after switching tabs, want d", event, consumer)
+		}
+		for _, e := range events {
+			if e[0] == 'c' {
+				t.Errorf("hidden tab got %q", e)
+			}
+		}
+	}
+}
+
+func TestNestedLayoutNoLeaf(t *testing.T) {
+	l := new_nested_layout()
+	tests := []struct {
+		name  string
+		event string
+		x, y  int
+		want  Widget
+	}{
+		{"splitter divider", "ldown", 350, 300, l.hz},
+		{"vertical divider", "ldown", 450, 350, l.vs},
+		{"split pane divider", "over", 600, 300, l.root},
+		{"tab bar", "rdown", 400, 355, nil},
+		{"tab bar", "mdown", 400, 355, l.tabs},
+		{"outside", "ldown", 50, 20, l.root},
+	}
+	for _, test := range tests {
+		consumer, events := l.send(test.event, test.x, test.y)
+		if consumer != test.want {
+			t.Errorf("%s %s at %d,%d was taken by %v, want %v", test.name, test.event, test.x, test.y, consumer, test.want)
+		}
+		if len(events) != 0 {
+			t.Errorf("%s %s at %d,%d reached a leaf: %q", test.name, test.event, test.x, test.y, events)
+		}
+		l.hz.dragging, l.vs.dragging = false, false
+	}
+}
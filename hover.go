@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"log"
+	"strings"
+
+	"golang.org/x/image/font"
+)
+
+// Hovers, resting the mouse on a symbol shows its signature and documentation in a tooltip
+// the language server is asked if there is one, Go files without one are parsed here instead
+
+// hover_state is what we know about the symbol last hovered, the answer comes in a while after asking
+type hover_state struct {
+	at      Cursor //start of the word
+	version uint64 //of the buffer, it's asked again after edits
+	lines   []TooltipLine
+}
+
+// hover_tooltip shows the diagnostics and the hover of what's under (x, y)
+func (te *TextEditor) hover_tooltip(x, y int) {
+	lines := []TooltipLine{}
+	if x < te.text_origin().X {
+		lines = append(lines, te.breakpoint_tooltip(te.row_at(y))...)
+		lines = append(lines, te.test_tooltip(te.row_at(y))...)
+	}
+	if message := te.diagnostic_message(x, y); message != "" {
+		lines = append(lines, TooltipText(message)...)
+	}
+	if hover := te.hover_at(x, y); len(hover) > 0 {
+		if len(lines) > 0 {
+			lines = append(lines, TooltipLine{})
+		}
+		lines = append(lines, hover...)
+	}
+	ShowTooltipLines(lines, x, y)
+}
+
+// hover_at is the hover of the word under (x, y), asking for it if it's a different word to last time
+func (te *TextEditor) hover_at(x, y int) []TooltipLine {
+	origin := te.text_origin()
+	if x < origin.X || te.peek_showing() && y >= te.peek_rect().Min.Y && y < te.peek_rect().Max.Y {
+		return nil
+	}
+	c := te.CursorAt(x, y)
+	line := te.buf.lines[c.row]
+	//past the end of the line isn't on anything
+	if x-origin.X > font.MeasureString(CodeFontFace, line).Round() || te.row_at(y) != c.row {
+		return nil
+	}
+	start := te.WordStart(c)
+	if te.WordAt(c) == "" || start.col < len(line) && !is_word_byte(line[start.col]) {
+		return nil
+	}
+	if te.hover == nil || te.hover.at != start || te.hover.version != te.buf.version {
+		te.request_hover(start)
+	}
+	return te.hover.lines
+}
+
+func (te *TextEditor) request_hover(at Cursor) {
+	h := &hover_state{at: at, version: te.buf.version}
+	te.hover = h
+	if ls := LanguageServerFor(te.buf); ls != nil && ls.caps.has(ls.caps.HoverProvider) {
+		ls.Request("textDocument/hover", ls.DocumentPosition(te.buf, at), func(result json.RawMessage, err error) {
+			if err != nil {
+				log.Println("hover:", err)
+				return
+			}
+			h.lines = parse_hover(result)
+		})
+		return
+	}
+	if te.is_go() {
+		h.lines = TooltipMarkdown(GoHover(te.buf.Text(), te.buf.Offset(at)))
+	}
+}
+
+func (te *TextEditor) is_go() bool {
+	return strings.HasSuffix(te.buf.filepath, ".go") || te.highlighter != nil && te.highlighter.Language() == "go"
+}
+
+// lsp_marked_string is a hover's contents, a MarkupContent or a MarkedString that's an object
+type lsp_marked_string struct {
+	Kind     string `json:"kind"`
+	Language string `json:"language"`
+	Value    string `json:"value"`
+}
+
+// parse_hover turns a hover result into lines, contents can be a string, an object or a list of either
+func parse_hover(result json.RawMessage) []TooltipLine {
+	var hover struct {
+		Contents json.RawMessage `json:"contents"`
+	}
+	if err := json.Unmarshal(result, &hover); err != nil || len(hover.Contents) == 0 {
+		return nil
+	}
+	var parts []json.RawMessage
+	if json.Unmarshal(hover.Contents, &parts) != nil {
+		parts = []json.RawMessage{hover.Contents}
+	}
+	md := []string{}
+	for _, part := range parts {
+		var s string
+		if json.Unmarshal(part, &s) == nil {
+			md = append(md, s)
+			continue
+		}
+		var ms lsp_marked_string
+		if json.Unmarshal(part, &ms) != nil {
+			continue
+		}
+		switch {
+		case ms.Language != "":
+			md = append(md, "```"+ms.Language+"\n"+ms.Value+"\n```")
+		case ms.Kind == "plaintext":
+			//kept as it is, fenced so none of it is taken for markup
+			md = append(md, "```\n"+ms.Value+"\n```")
+		default:
+			md = append(md, ms.Value)
+		}
+	}
+	return TooltipMarkdown(strings.Join(md, "\n\n"))
+}
+
+/*
+Go files without a language server
+*/
+
+// GoHover is markdown with the declaration and doc comment of the identifier at byte offset of src
+// only what's declared in src is known, names from other files and packages get ""
+func GoHover(src string, offset int) string {
+	fset := token.NewFileSet()
+	//a file that's being edited won't always parse, what did parse is still worth looking through
+	f, _ := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if f == nil {
+		return ""
+	}
+	var ident *ast.Ident
+	ast.Inspect(f, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok {
+			if from, to := fset.Position(id.Pos()).Offset, fset.Position(id.End()).Offset; offset >= from && offset <= to {
+				ident = id
+			}
+		}
+		return ident == nil
+	})
+	if ident == nil {
+		return ""
+	}
+	obj := ident.Obj
+	if obj == nil {
+		//methods and fields after a dot aren't resolved by the parser, a method of the same name in the file is a good guess
+		for _, decl := range f.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && fn.Name.Name == ident.Name {
+				obj = &ast.Object{Kind: ast.Fun, Name: ident.Name, Decl: fn}
+			}
+		}
+	}
+	if obj == nil {
+		return ""
+	}
+	code, doc := go_declaration(fset, f, obj)
+	if code == "" {
+		return ""
+	}
+	md := "```go\n" + code + "\n```"
+	if doc != nil {
+		md += "\n\n" + doc.Text()
+	}
+	return md
+}
+
+// go_declaration is the code declaring obj without any function body, and its doc comment
+func go_declaration(fset *token.FileSet, f *ast.File, obj *ast.Object) (string, *ast.CommentGroup) {
+	print := func(n interface{}) string {
+		var b bytes.Buffer
+		if err := printer.Fprint(&b, fset, n); err != nil {
+			return ""
+		}
+		return b.String()
+	}
+	switch decl := obj.Decl.(type) {
+	case *ast.FuncDecl:
+		d := *decl
+		d.Body, d.Doc = nil, nil
+		return print(&d), decl.Doc
+	case *ast.TypeSpec:
+		doc := decl.Doc
+		if doc == nil {
+			doc = go_gen_doc(f, decl)
+		}
+		spec := *decl
+		spec.Doc, spec.Comment = nil, nil
+		return "type " + print(&spec), doc
+	case *ast.ValueSpec:
+		keyword := "var"
+		if obj.Kind == ast.Con {
+			keyword = "const"
+		}
+		doc := decl.Doc
+		if doc == nil {
+			doc = go_gen_doc(f, decl)
+		}
+		if len(decl.Names) == 1 {
+			spec := *decl
+			spec.Doc, spec.Comment = nil, nil
+			return keyword + " " + print(&spec), doc
+		}
+		code := keyword + " " + obj.Name
+		if decl.Type != nil {
+			code += " " + print(decl.Type)
+		}
+		return code, doc
+	case *ast.Field:
+		if decl.Type == nil {
+			return "", nil
+		}
+		doc := decl.Doc
+		if doc == nil {
+			doc = decl.Comment
+		}
+		return obj.Name + " " + print(decl.Type), doc
+	}
+	return "", nil
+}
+
+// go_gen_doc is the doc comment of the var, const or type block spec is the only thing in
+func go_gen_doc(f *ast.File, spec ast.Spec) *ast.CommentGroup {
+	for _, decl := range f.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && len(gen.Specs) == 1 && gen.Specs[0] == spec {
+			return gen.Doc
+		}
+	}
+	return nil
+}
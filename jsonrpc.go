@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// JSON-RPC 2.0 the way language servers speak it, each message is a Content-Length header then that many bytes of JSON
+// replies to our requests and whatever the other end sends us get handed to the UI goroutine through Dispatch,
+// so the rest of the editor never has to lock anything
+
+type rpc_message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   *RPCError        `json:"error,omitempty"`
+}
+
+// RPCError is an error the other end replied with
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("%s (%d)", e.Message, e.Code)
+}
+
+var ErrConnClosed = errors.New("connection closed")
+var ErrRPCTimeout = errors.New("no reply in time")
+
+/*
+Framed connections, what RPCConn and DAPConn have in common
+*/
+
+// framed_conn reads and writes messages with a Content-Length header, the debug adapter protocol frames its messages the same way
+// replies are matched to requests by number, and everything that arrives is run on the UI goroutine by Dispatch
+type framed_conn struct {
+	rwc    io.ReadWriteCloser
+	reader *bufio.Reader
+
+	write_lock sync.Mutex
+	lock       sync.Mutex //guards the fields below
+	next_id    int
+	pending    map[int]func(result json.RawMessage, err error)
+	closed     bool
+
+	events chan func() //run on the UI goroutine by Dispatch
+	done   chan struct{}
+}
+
+func (c *framed_conn) init(rwc io.ReadWriteCloser) {
+	c.rwc = rwc
+	c.reader = bufio.NewReader(rwc)
+	c.pending = map[int]func(json.RawMessage, error){}
+	c.events = make(chan func(), 256)
+	c.done = make(chan struct{})
+}
+
+// Done is closed once the other end has gone away
+func (c *framed_conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Dispatch runs the replies and incoming messages that have arrived, call it from the UI goroutine
+func (c *framed_conn) Dispatch() {
+	for {
+		select {
+		case f := <-c.events:
+			f()
+		default:
+			return
+		}
+	}
+}
+
+// Close hangs up, anything still waiting for a reply gets ErrConnClosed
+func (c *framed_conn) Close() error {
+	return c.rwc.Close()
+}
+
+// number is the next number for a message, false once the other end has gone
+// reply is called with the reply to it, on the reading goroutine, see answered
+func (c *framed_conn) number(reply func(result json.RawMessage, err error)) (int, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.closed {
+		return 0, false
+	}
+	c.next_id++
+	if reply != nil {
+		c.pending[c.next_id] = reply
+	}
+	return c.next_id, true
+}
+
+// forget drops the reply waiting for id
+func (c *framed_conn) forget(id int) {
+	c.lock.Lock()
+	delete(c.pending, id)
+	c.lock.Unlock()
+}
+
+// answered is what's waiting for the reply to id, nil if nothing is
+func (c *framed_conn) answered(id int) func(result json.RawMessage, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	reply := c.pending[id]
+	delete(c.pending, id)
+	return reply
+}
+
+// request sends a request numbered by send, reply gets the answer on the UI goroutine, from Dispatch
+func (c *framed_conn) request(send func(id int) error, reply func(result json.RawMessage, err error)) {
+	id, ok := c.number(func(result json.RawMessage, err error) {
+		c.events <- func() { reply(result, err) }
+	})
+	if !ok {
+		reply(nil, ErrConnClosed)
+		return
+	}
+	if err := send(id); err != nil {
+		c.forget(id)
+		reply(nil, err)
+	}
+}
+
+func (c *framed_conn) write(msg interface{}) error {
+	bs, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	c.write_lock.Lock()
+	defer c.write_lock.Unlock()
+	return write_frame(c.rwc, bs)
+}
+
+// read_loop passes each message to received until either end hangs up or received fails
+func (c *framed_conn) read_loop(received func(bs []byte) error) {
+	defer c.shut()
+	for {
+		bs, err := read_frame(c.reader)
+		if err != nil {
+			return
+		}
+		if err := received(bs); err != nil {
+			return
+		}
+	}
+}
+
+// shut fails everything still waiting, once the other end has gone
+func (c *framed_conn) shut() {
+	c.lock.Lock()
+	c.closed = true
+	pending := c.pending
+	c.pending = map[int]func(json.RawMessage, error){}
+	c.lock.Unlock()
+	for _, reply := range pending {
+		reply(nil, ErrConnClosed)
+	}
+	close(c.done)
+}
+
+// write_frame writes bs with its Content-Length header
+func write_frame(w io.Writer, bs []byte) error {
+	if _, err := fmt.Fprintf(w, "Content-Length: %d\r\n\r\n", len(bs)); err != nil {
+		return err
+	}
+	_, err := w.Write(bs)
+	return err
+}
+
+// read_frame reads one message's bytes, skipping the headers we don't care about
+func read_frame(r *bufio.Reader) ([]byte, error) {
+	headers, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(headers.Get("Content-Length"))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("bad Content-Length %q", headers.Get("Content-Length"))
+	}
+	bs := make([]byte, length)
+	if _, err := io.ReadFull(r, bs); err != nil {
+		return nil, err
+	}
+	return bs, nil
+}
+
+/*
+JSON-RPC
+*/
+
+// RPCHandler deals with a request or notification from the other end, on the UI goroutine
+// for requests what it returns is the reply, notifications ignore it
+type RPCHandler func(method string, params json.RawMessage) (interface{}, error)
+
+// RPCConn is one JSON-RPC connection, over a server's stdin and stdout usually
+type RPCConn struct {
+	framed_conn
+	handler RPCHandler
+}
+
+func NewRPCConn(rwc io.ReadWriteCloser, handler RPCHandler) *RPCConn {
+	c := &RPCConn{handler: handler}
+	c.init(rwc)
+	go c.read_loop(c.received)
+	return c
+}
+
+// Go sends a request and has reply called with the answer on the UI goroutine, from Dispatch
+func (c *RPCConn) Go(method string, params interface{}, reply func(result json.RawMessage, err error)) {
+	c.request(func(id int) error {
+		raw := json.RawMessage(strconv.Itoa(id))
+		return c.send(method, &raw, params)
+	}, reply)
+}
+
+// Call sends a request and waits for the answer, for the few places that can't carry on without it
+// the answer isn't handed to Dispatch, so it's fine to call from the UI goroutine
+func (c *RPCConn) Call(method string, params interface{}, result interface{}, timeout time.Duration) error {
+	answer := make(chan error, 1)
+	var raw_result json.RawMessage
+	id, ok := c.number(func(r json.RawMessage, err error) {
+		raw_result = r
+		answer <- err
+	})
+	if !ok {
+		return ErrConnClosed
+	}
+	raw := json.RawMessage(strconv.Itoa(id))
+	if err := c.send(method, &raw, params); err != nil {
+		c.forget(id)
+		return err
+	}
+	select {
+	case err := <-answer:
+		if err != nil || result == nil || len(raw_result) == 0 {
+			return err
+		}
+		return json.Unmarshal(raw_result, result)
+	case <-time.After(timeout):
+		c.forget(id)
+		return fmt.Errorf("%s: %w", method, ErrRPCTimeout)
+	}
+}
+
+// Notify sends a notification, which doesn't get a reply
+func (c *RPCConn) Notify(method string, params interface{}) error {
+	return c.send(method, nil, params)
+}
+
+func (c *RPCConn) send(method string, id *json.RawMessage, params interface{}) error {
+	msg := rpc_message{JSONRPC: "2.0", ID: id, Method: method}
+	if params != nil {
+		bs, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		msg.Params = bs
+	}
+	return c.write(msg)
+}
+
+func (c *RPCConn) reply(id *json.RawMessage, result interface{}, err error) error {
+	msg := rpc_message{JSONRPC: "2.0", ID: id}
+	if err != nil {
+		var rpc_err *RPCError
+		if !errors.As(err, &rpc_err) {
+			rpc_err = &RPCError{Code: -32603, Message: err.Error()}
+		}
+		msg.Error = rpc_err
+	} else {
+		bs, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		msg.Result = bs
+	}
+	return c.write(msg)
+}
+
+// received handles one message from the other end
+func (c *RPCConn) received(bs []byte) error {
+	msg := &rpc_message{}
+	if err := json.Unmarshal(bs, msg); err != nil {
+		return err
+	}
+	switch {
+	case msg.Method == "" && msg.ID != nil:
+		//a reply to one of ours
+		id, err := strconv.Atoi(string(*msg.ID))
+		if err != nil {
+			return nil
+		}
+		reply := c.answered(id)
+		if reply == nil {
+			return nil
+		}
+		if msg.Error != nil {
+			reply(nil, msg.Error)
+		} else {
+			reply(msg.Result, nil)
+		}
+	case msg.Method != "":
+		c.events <- func() {
+			result, err := c.handler(msg.Method, msg.Params)
+			if msg.ID != nil {
+				c.reply(msg.ID, result, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// fake_server is the far end of a pipe, it speaks just enough JSON-RPC for the tests
+// everything it reads goes on received, which is closed once we hang up
+type fake_server struct {
+	conn     net.Conn
+	received chan *rpc_message
+	//answer is the reply to a request, ok false leaves it unanswered
+	answer func(msg *rpc_message) (result interface{}, ok bool)
+}
+
+func new_fake_server(conn net.Conn, answer func(msg *rpc_message) (interface{}, bool)) *fake_server {
+	fs := &fake_server{conn: conn, received: make(chan *rpc_message, 100), answer: answer}
+	go fs.serve()
+	return fs
+}
+
+func (fs *fake_server) serve() {
+	defer close(fs.received)
+	reader := bufio.NewReader(fs.conn)
+	for {
+		bs, err := read_frame(reader)
+		if err != nil {
+			return
+		}
+		msg := &rpc_message{}
+		if err := json.Unmarshal(bs, msg); err != nil {
+			return
+		}
+		fs.received <- msg
+		if msg.ID == nil || msg.Method == "" {
+			continue
+		}
+		if result, ok := fs.answer(msg); ok {
+			if err, ok := result.(*RPCError); ok {
+				fs.send(rpc_message{JSONRPC: "2.0", ID: msg.ID, Error: err})
+				continue
+			}
+			bs, _ := json.Marshal(result)
+			fs.send(rpc_message{JSONRPC: "2.0", ID: msg.ID, Result: bs})
+		}
+	}
+}
+
+func (fs *fake_server) send(msg rpc_message) {
+	bs, _ := json.Marshal(msg)
+	write_frame(fs.conn, bs)
+}
+
+// request sends a request of the server's own
+func (fs *fake_server) request(id int, method string, params interface{}) {
+	raw := json.RawMessage(strconv.Itoa(id))
+	bs, _ := json.Marshal(params)
+	fs.send(rpc_message{JSONRPC: "2.0", ID: &raw, Method: method, Params: bs})
+}
+
+// next is the next message the server got, failing the test if nothing comes
+func (fs *fake_server) next(t *testing.T) *rpc_message {
+	t.Helper()
+	select {
+	case msg, ok := <-fs.received:
+		if !ok {
+			t.Fatalf("connection closed while waiting for a message")
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatalf("nothing was sent")
+	}
+	return nil
+}
+
+// expect is the next message, which has to be method
+func (fs *fake_server) expect(t *testing.T, method string) *rpc_message {
+	t.Helper()
+	msg := fs.next(t)
+	if msg.Method != method {
+		t.Fatalf("got %q, want %q", msg.Method, method)
+	}
+	return msg
+}
+
+// hung_up waits for us to close the connection
+func (fs *fake_server) hung_up(t *testing.T) {
+	t.Helper()
+	for {
+		select {
+		case _, ok := <-fs.received:
+			if !ok {
+				return
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("connection wasn't closed")
+		}
+	}
+}
+
+// until runs step until done says so, failing the test if that takes too long
+func until(t *testing.T, step func(), done func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatalf("gave up waiting")
+		}
+		step()
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func echo_server(msg *rpc_message) (interface{}, bool) {
+	switch msg.Method {
+	case "echo":
+		return msg.Params, true
+	case "fail":
+		return &RPCError{Code: -32000, Message: "no"}, true
+	}
+	return nil, false
+}
+
+func TestRPCConnRequests(t *testing.T) {
+	ours, theirs := net.Pipe()
+	server := new_fake_server(theirs, echo_server)
+	c := NewRPCConn(ours, func(method string, params json.RawMessage) (interface{}, error) { return nil, nil })
+	defer c.Close()
+
+	var got string
+	var got_err error
+	answered := 0
+	c.Go("echo", "hello", func(result json.RawMessage, err error) {
+		answered++
+		json.Unmarshal(result, &got)
+	})
+	c.Go("fail", nil, func(result json.RawMessage, err error) {
+		answered++
+		got_err = err
+	})
+	server.expect(t, "echo")
+	server.expect(t, "fail")
+	if answered != 0 {
+		t.Fatalf("replies ran before Dispatch")
+	}
+	until(t, c.Dispatch, func() bool { return answered == 2 })
+	if got != "hello" {
+		t.Errorf("echo answered %q", got)
+	}
+	var rpc_err *RPCError
+	if !errors.As(got_err, &rpc_err) || rpc_err.Code != -32000 {
+		t.Errorf("fail answered %v, want the server's error", got_err)
+	}
+
+	var echoed []int
+	if err := c.Call("echo", []int{1, 2}, &echoed, 5*time.Second); err != nil || len(echoed) != 2 {
+		t.Errorf("Call = %v, %v", echoed, err)
+	}
+	server.expect(t, "echo")
+	if err := c.Call("ignored", nil, nil, 50*time.Millisecond); !errors.Is(err, ErrRPCTimeout) {
+		t.Errorf("unanswered Call = %v, want a timeout", err)
+	}
+	server.expect(t, "ignored")
+
+	if err := c.Notify("note", map[string]int{"n": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if msg := server.expect(t, "note"); msg.ID != nil {
+		t.Errorf("notification has an id")
+	}
+}
+
+func TestRPCConnServerRequests(t *testing.T) {
+	ours, theirs := net.Pipe()
+	server := new_fake_server(theirs, echo_server)
+	var handled []string
+	c := NewRPCConn(ours, func(method string, params json.RawMessage) (interface{}, error) {
+		handled = append(handled, method)
+		if method == "bad" {
+			return nil, errors.New("can't")
+		}
+		return []string{"ok"}, nil
+	})
+	defer c.Close()
+
+	server.request(7, "workspace/configuration", nil)
+	server.request(8, "bad", nil)
+	until(t, c.Dispatch, func() bool { return len(handled) == 2 })
+	reply := server.next(t)
+	if string(*reply.ID) != "7" || string(reply.Result) != `["ok"]` {
+		t.Errorf("reply is %s %s, want 7 [\"ok\"]", *reply.ID, reply.Result)
+	}
+	reply = server.next(t)
+	if string(*reply.ID) != "8" || reply.Error == nil || reply.Error.Message != "can't" {
+		t.Errorf("error reply is %+v", reply)
+	}
+}
+
+func TestRPCConnHangUp(t *testing.T) {
+	ours, theirs := net.Pipe()
+	server := new_fake_server(theirs, func(*rpc_message) (interface{}, bool) { return nil, false })
+	c := NewRPCConn(ours, nil)
+
+	var got_err error
+	c.Go("never", nil, func(result json.RawMessage, err error) { got_err = err })
+	server.expect(t, "never")
+	theirs.Close()
+	select {
+	case <-c.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Done wasn't closed when the other end went away")
+	}
+	c.Dispatch()
+	if !errors.Is(got_err, ErrConnClosed) {
+		t.Errorf("waiting request got %v, want ErrConnClosed", got_err)
+	}
+	c.Go("after", nil, func(result json.RawMessage, err error) { got_err = err })
+	if !errors.Is(got_err, ErrConnClosed) {
+		t.Errorf("request after hanging up got %v, want ErrConnClosed", got_err)
+	}
+}
@@ -1,13 +1,11 @@
 package main
 
 import (
-	"fmt"
 	"image"
 	"image/color"
 	"log"
 
 	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
-	"github.com/hajimehoshi/ebiten/v2/text"
 
 	"github.com/hajimehoshi/ebiten/v2"
 )
@@ -19,17 +17,26 @@ type Widget interface {
 	//Keyboard events get sent to the place that last received mouse input
 	TakeKeyboard()
 	KeyboardFocusLost()
+	//Bounds is where the widget is on screen, widgets get it by embedding image.Rectangle
+	//all mouse coordinates are screen space, containers route events by checking their children's Bounds
+	Bounds() image.Rectangle
 	//Mouse events return a pointer(interfaces are just pointers) to the widget that actually used the input
 	//this is used to tell that widget when a mouse out happens
 	MouseOut()
 	MouseOver(x, y int) Widget
 	LMouseDown(x, y int) Widget
 	LMouseUp(x, y int) Widget
+	//right button is for context menus, middle closes tabs
+	RMouseDown(x, y int) Widget
+	RMouseUp(x, y int) Widget
+	MMouseDown(x, y int) Widget
+	MMouseUp(x, y int) Widget
 }
 
 var _ Widget = &ColorRect{}
 var _ Widget = &Tabs{}
 var _ Widget = &HorizontalSplitter{}
+var _ Widget = &VerticalSplitter{}
 var _ Widget = &MenuBar{}
 
 type BorderShowMode int
@@ -39,158 +46,180 @@ const (
 	ShowOnHover
 )
 
-type Tabs struct {
+type HorizontalSplitter struct {
 	image.Rectangle
-	Titles          []string
-	Tabs            []Widget
-	TabHeaderRects  []image.Rectangle
-	CurrentTab      int
-	TabHeight       int
-	current_hovered int
+	split_x           int
+	Left, Right       Widget
+	dragging          bool
+	border_half_width int
+	border_mode       BorderShowMode
+	border_hovered    bool
 }
 
 // Title implements Widget
-func (t *Tabs) Title() string {
-	return "tabs"
+func (*HorizontalSplitter) Title() string {
+	return "horizontal spliiter"
 }
 
 // KeyboardFocusLost implements Widget
-func (t *Tabs) KeyboardFocusLost() {
-
+func (*HorizontalSplitter) KeyboardFocusLost() {
 }
 
 // TakeKeyboard implements Widget
-func (t *Tabs) TakeKeyboard() {
+func (hz *HorizontalSplitter) TakeKeyboard() {
+	log.Println("TakeKeyboard unimplemented for horizontal splitter")
 }
 
 // MouseOut implements Widget
-func (t *Tabs) MouseOut() {
-	t.current_hovered = -1
+func (*HorizontalSplitter) MouseOut() {
+}
+
+func (hz *HorizontalSplitter) screenspace_divider_x() int {
+	return hz.Rectangle.Min.X + hz.split_x
 }
 
-func (t *Tabs) Draw(target *ebiten.Image) {
-	t.DrawTabs(target)
-	//for a myriad of reasons we can't draw the current tab
-	if t.CurrentTab < 0 || t.CurrentTab > len(t.Tabs) || t.Tabs[t.CurrentTab] == nil {
-		return
+func (hz *HorizontalSplitter) over_divider(x int) bool {
+	divider_x := hz.screenspace_divider_x()
+	return x >= divider_x-Px(hz.border_half_width) && x <= divider_x+Px(hz.border_half_width)
+}
+
+func (hz *HorizontalSplitter) LMouseUp(x, y int) Widget {
+	if hz.dragging {
+		hz.dragging = false //cant be dragging if we let go
+		return hz
 	}
-	t.Tabs[t.CurrentTab].Draw(target)
+	if hz.over_divider(x) {
+		return hz
+	}
+	return DispatchLMouseUp(hz.Children(), x, y, hz)
 }
-func (t *Tabs) DrawTabs(target *ebiten.Image) {
 
-	for i := 0; i < len(t.Tabs); i++ {
+func (hz *HorizontalSplitter) LMouseDown(x, y int) Widget {
+	if hz.over_divider(x) {
+		hz.dragging = true
+		return hz
+	}
+	return DispatchLMouseDown(hz.Children(), x, y, hz)
+}
 
-		my_r := t.TabHeaderRects[i]
-		my_c := Style.BGColorMuted
-		if i == t.current_hovered {
-			my_c = Style.BGColorStrong
-		}
+func (hz *HorizontalSplitter) RMouseDown(x, y int) Widget {
+	return DispatchRMouseDown(hz.Children(), x, y, nil)
+}
 
-		ebitenutil.DrawRect(target, float64(my_r.Min.X), float64(my_r.Min.Y), float64(my_r.Dx()), float64(my_r.Dy()), my_c)
-		text.Draw(target, t.Titles[i], MainFontFace, my_r.Min.X+tab_x_padding, my_r.Min.Y+MainFontPeriodFromTop+tab_y_padding, Style.FGColorStrong)
-		if i == t.CurrentTab {
-			ebitenutil.DrawLine(target, float64(my_r.Min.X), float64(my_r.Max.Y-1), float64(my_r.Max.X), float64(my_r.Max.Y-1), Style.FGColorStrong)
-		}
+func (hz *HorizontalSplitter) RMouseUp(x, y int) Widget {
+	return DispatchRMouseUp(hz.Children(), x, y, nil)
+}
 
-	}
+func (hz *HorizontalSplitter) MMouseDown(x, y int) Widget {
+	return DispatchMMouseDown(hz.Children(), x, y, nil)
 }
 
-func (t *Tabs) LMouseDown(x int, y int) Widget {
-	// over tabs
-	if y < t.Rectangle.Min.Y+t.TabHeight {
-		for i := 0; i < len(t.TabHeaderRects); i++ {
-			if image.Pt(x, y).In(t.TabHeaderRects[i]) {
-				t.CurrentTab = i
-			}
-		}
-		return t
-	}
-	// over body
-	if t.Tabs[t.CurrentTab] != nil {
-		return t.Tabs[t.CurrentTab].LMouseDown(x, y)
-	}
-	return nil
+func (hz *HorizontalSplitter) MMouseUp(x, y int) Widget {
+	return DispatchMMouseUp(hz.Children(), x, y, nil)
 }
 
-func (t *Tabs) LMouseUp(x int, y int) Widget {
-	// over tabs
-	if y < t.Rectangle.Min.Y+t.TabHeight {
-		return t
+func (hz *HorizontalSplitter) MouseOver(x, y int) Widget {
+	if hz.dragging {
+		ebiten.SetCursorShape(ebiten.CursorShapeEWResize)
+		//stop from going too far that you can't reach the handle
+		hz.split_x = max(5, min(x-hz.Min.X, hz.Dx()-5))
+		hz.SetRect(hz.Rectangle)
+		return hz
 	}
-	//over body
-	if t.Tabs[t.CurrentTab] != nil {
-		return t.Tabs[t.CurrentTab].LMouseUp(x, y)
+	hz.border_hovered = hz.over_divider(x)
+	if hz.border_hovered {
+		ebiten.SetCursorShape(ebiten.CursorShapeEWResize)
+		return hz
 	}
-	return nil
+	consumer := DispatchMouseOver(hz.Children(), x, y, nil)
+	if consumer == nil {
+		ebiten.SetCursorShape(ebiten.CursorShapeDefault)
+		consumer = hz
+	}
+	return consumer
 }
 
-func (t *Tabs) MouseOver(x int, y int) Widget {
-	// over tabs
-	if y < t.Rectangle.Min.Y+t.TabHeight {
-		ebiten.SetCursorShape(ebiten.CursorShapeDefault)
-		for i, r := range t.TabHeaderRects {
-			if image.Pt(x, y).In(r) {
-				t.current_hovered = i
-			}
-		}
-		return t
+func (hz *HorizontalSplitter) Draw(target *ebiten.Image) {
+	if hz.Left != nil {
+		hz.Left.Draw(target)
 	}
-	//over body
-	if t.Tabs[t.CurrentTab] != nil {
-		return t.Tabs[t.CurrentTab].MouseOver(x, y)
+	if hz.Right != nil {
+		hz.Right.Draw(target)
+	}
+	//draw divider
+	if hz.border_mode == ShowAlways || hz.border_hovered || hz.dragging {
+		border_min_x := hz.screenspace_divider_x() - Px(hz.border_half_width)
+		ebitenutil.DrawRect(target, float64(border_min_x), float64(hz.Rectangle.Min.Y), float64(Px(hz.border_half_width))*2, float64(hz.Rectangle.Dy()), Style.FGColorMuted)
 	}
-	return nil
-}
 
-// SetRect implements Widget
-func (t *Tabs) SetRect(rect image.Rectangle) {
-	t.Rectangle = rect
-	tabs_rect := rect
-	t.TabHeight = MainFontSize + 2*tab_y_padding
+}
+func (hz *HorizontalSplitter) SetRect(r image.Rectangle) {
+	old_width := hz.Rectangle.Dx()
+	hz.Rectangle = r
+	if old_width != 0 {
+		x_percent := float64(hz.split_x) / float64(old_width)
+		hz.split_x = int(x_percent * float64(r.Dx()))
+	}
+	divider_x := hz.screenspace_divider_x()
 
-	tabs_rect.Max.Y = rect.Min.Y + t.TabHeight
+	leftRect := image.Rect(r.Min.X, r.Min.Y, divider_x, r.Max.Y)
+	rightRect := image.Rect(divider_x, r.Min.Y, r.Max.X, r.Max.Y)
 
-	if len(t.TabHeaderRects) != len(t.Tabs) {
-		t.TabHeaderRects = make([]image.Rectangle, len(t.Tabs))
+	if hz.Left != nil {
+		hz.Left.SetRect(leftRect)
+	}
+	if hz.Right != nil {
+		hz.Right.SetRect(rightRect)
 	}
-	t.make_tab_titles()
-
-	//Generate rects describing tabs
-	start := tabs_rect.Min
-	for i := 0; i < len(t.Tabs); i++ {
-		text_width := text.BoundString(MainFontFace, t.Titles[i]).Dx()
 
-		tab_rect := image.Rect(0, 0, text_width+2*tab_x_padding, MainFontSize+2*tab_y_padding)
-		if i == 0 {
-			fmt.Println(tab_rect.Dy())
-		}
-		t.TabHeaderRects[i] = tab_rect.Add(start)
+}
 
-		start = start.Add(image.Pt(tab_rect.Dx(), 0))
+// Children implements Container
+func (hz *HorizontalSplitter) Children() []Widget {
+	return []Widget{hz.Left, hz.Right}
+}
 
+// ReplaceChild implements Container
+func (hz *HorizontalSplitter) ReplaceChild(old, new Widget) bool {
+	switch old {
+	case hz.Left:
+		hz.Left = new
+	case hz.Right:
+		hz.Right = new
+	default:
+		return false
 	}
-	//rect for content
-	pane_rect := rect
-	pane_rect.Min.Y = rect.Min.Y + t.TabHeight
-	for i := 0; i < len(t.Tabs); i++ {
-		if t.Tabs[i] != nil {
-			t.Tabs[i].SetRect(pane_rect)
+	return true
+}
+
+// describe_two_way_split saves a two child splitter the same way as a SplitPane, that's what it comes back as
+func describe_two_way_split(orientation SplitOrientation, first, second Widget, split, size int) *WidgetDescriptor {
+	d := &WidgetDescriptor{Kind: "split", Orientation: orientation}
+	for i, kid := range []Widget{first, second} {
+		kid_desc := Describe(kid)
+		if kid_desc == nil {
+			continue
 		}
+		fraction := float64(split) / float64(max(size, 1))
+		if i == 1 {
+			fraction = 1 - fraction
+		}
+		d.Children = append(d.Children, kid_desc)
+		d.Fractions = append(d.Fractions, fraction)
 	}
+	return d
 }
-func (t *Tabs) make_tab_titles() {
-	if len(t.Titles) != len(t.Tabs) {
-		t.Titles = make([]string, len(t.Tabs))
-	}
-	for i := range t.Tabs {
-		t.Titles[i] = t.Tabs[i].Title()
-	}
+
+// Describe implements Describable
+func (hz *HorizontalSplitter) Describe() *WidgetDescriptor {
+	return describe_two_way_split(SplitHorizontal, hz.Left, hz.Right, hz.split_x, hz.Dx())
 }
 
-type HorizontalSplitter struct {
+// VerticalSplitter is HorizontalSplitter turned on its side, Top above Bottom
+type VerticalSplitter struct {
 	image.Rectangle
-	split_x           int
-	Left, Right       Widget
+	split_y           int //distance of the divider from the top of the splitter
+	Top, Bottom       Widget
 	dragging          bool
 	border_half_width int
 	border_mode       BorderShowMode
@@ -198,141 +227,138 @@ type HorizontalSplitter struct {
 }
 
 // Title implements Widget
-func (*HorizontalSplitter) Title() string {
-	return "horizontal spliiter"
+func (*VerticalSplitter) Title() string {
+	return "vertical splitter"
 }
 
 // KeyboardFocusLost implements Widget
-func (*HorizontalSplitter) KeyboardFocusLost() {
+func (*VerticalSplitter) KeyboardFocusLost() {
 }
 
 // TakeKeyboard implements Widget
-func (hz *HorizontalSplitter) TakeKeyboard() {
-	log.Println("TakeKeyboard unimplemented for horizontal splitter")
+func (*VerticalSplitter) TakeKeyboard() {
 }
 
 // MouseOut implements Widget
-func (*HorizontalSplitter) MouseOut() {
+func (vs *VerticalSplitter) MouseOut() {
+	vs.border_hovered = false
 }
 
-func (hz *HorizontalSplitter) LMouseUp(x, y int) Widget {
-	if hz.dragging {
-		hz.dragging = false //cant be dragging if we let go
-	} else if x < hz.split_x-hz.border_half_width {
-		if hz.Left != nil {
-			return hz.Left.LMouseUp(x, y)
-		}
-	} else if x > hz.split_x+hz.border_half_width {
-		if hz.Right != nil {
-			return hz.Right.LMouseUp(x-hz.split_x, y)
-		}
-	}
-	return hz
+// Children implements Container
+func (vs *VerticalSplitter) Children() []Widget {
+	return []Widget{vs.Top, vs.Bottom}
 }
 
-func (hz *HorizontalSplitter) LMouseDown(x, y int) Widget {
-	if x > hz.split_x-hz.border_half_width && x < hz.split_x+hz.border_half_width {
-		hz.dragging = true
-
+// ReplaceChild implements Container
+func (vs *VerticalSplitter) ReplaceChild(old, new Widget) bool {
+	switch old {
+	case vs.Top:
+		vs.Top = new
+	case vs.Bottom:
+		vs.Bottom = new
+	default:
+		return false
 	}
-	if x < hz.split_x-hz.border_half_width {
-		//left
-		if hz.Left != nil {
-			return hz.Left.LMouseDown(x, y)
-		}
-	}
-	if x > hz.split_x+hz.border_half_width {
-		//left
-		if hz.Right != nil {
-			return hz.Right.LMouseDown(x, y)
-		}
-	}
-	return hz
+	return true
 }
 
-func (hz *HorizontalSplitter) MouseOver(x, y int) Widget {
-	screenspaceDividerX := hz.split_x + hz.Rectangle.Min.X
-	var consumer Widget = nil
-	//pass mouse down to the left
-	if x < screenspaceDividerX-hz.border_half_width {
-		hz.border_hovered = false
-		if hz.Left != nil {
-			consumer = hz.Left.MouseOver(x, y)
-		} else {
-			ebiten.SetCursorShape(ebiten.CursorShapeDefault)
-		}
-	} else if x > screenspaceDividerX+hz.border_half_width {
-		//pass mouse down to the right
-		hz.border_hovered = false
-		if hz.Right != nil {
-			consumer = hz.Right.MouseOver(x, y)
-		} else {
-			ebiten.SetCursorShape(ebiten.CursorShapeDefault)
-		}
-	} else {
-		ebiten.SetCursorShape(ebiten.CursorShapeEWResize)
-		hz.border_hovered = true
-		consumer = hz
+// Describe implements Describable
+func (vs *VerticalSplitter) Describe() *WidgetDescriptor {
+	return describe_two_way_split(SplitVertical, vs.Top, vs.Bottom, vs.split_y, vs.Dy())
+}
 
-	}
-	if hz.dragging {
-		ebiten.SetCursorShape(ebiten.CursorShapeEWResize)
-		hz.split_x = x
-		//stop from going too far that you can't reach the handle
-		if hz.split_x < hz.Min.X+5 {
-			hz.split_x = hz.Min.X + 5
-		} else if hz.split_x > hz.Max.X-5 {
-			hz.split_x = hz.Max.X - 5
-		}
-		hz.SetRect(hz.Rectangle)
-		consumer = hz
+func (vs *VerticalSplitter) screenspace_divider_y() int {
+	return vs.Rectangle.Min.Y + vs.split_y
+}
+
+func (vs *VerticalSplitter) over_divider(y int) bool {
+	divider_y := vs.screenspace_divider_y()
+	return y >= divider_y-Px(vs.border_half_width) && y <= divider_y+Px(vs.border_half_width)
+}
 
+func (vs *VerticalSplitter) LMouseDown(x, y int) Widget {
+	if vs.over_divider(y) {
+		vs.dragging = true
+		return vs
 	}
-	return consumer
+	return DispatchLMouseDown(vs.Children(), x, y, vs)
 }
 
-func (hz *HorizontalSplitter) Draw(target *ebiten.Image) {
-	if hz.Left != nil {
-		hz.Left.Draw(target)
+func (vs *VerticalSplitter) LMouseUp(x, y int) Widget {
+	if vs.dragging {
+		vs.dragging = false
+		return vs
 	}
-	if hz.Right != nil {
-		hz.Right.Draw(target)
-	} else {
-		println("no right")
+	if vs.over_divider(y) {
+		return vs
 	}
-	//draw divider
+	return DispatchLMouseUp(vs.Children(), x, y, vs)
+}
 
-	if hz.border_mode == ShowAlways || hz.border_hovered || hz.dragging {
-		border_min_x := hz.Rectangle.Min.X + hz.split_x - hz.border_half_width
-		ebitenutil.DrawRect(target, float64(border_min_x), float64(hz.Rectangle.Min.Y), float64(hz.border_half_width)*2, float64(hz.Rectangle.Dy()), Style.FGColorMuted)
-	}
+func (vs *VerticalSplitter) RMouseDown(x, y int) Widget {
+	return DispatchRMouseDown(vs.Children(), x, y, nil)
+}
 
+func (vs *VerticalSplitter) RMouseUp(x, y int) Widget {
+	return DispatchRMouseUp(vs.Children(), x, y, nil)
 }
-func (hz *HorizontalSplitter) SetRect(r image.Rectangle) {
-	old_width := hz.Rectangle.Dx()
-	hz.Rectangle = r
-	if old_width == 0 {
-		return
-	}
-	x_percent := float64(hz.split_x) / float64(old_width)
 
-	hz.split_x = int(x_percent * float64(r.Dx()))
+func (vs *VerticalSplitter) MMouseDown(x, y int) Widget {
+	return DispatchMMouseDown(vs.Children(), x, y, nil)
+}
 
-	left_rect_min_x := hz.Rectangle.Min.X
-	left_rect_max_x := hz.Rectangle.Min.X + hz.split_x  // - hz.border_half_width
-	right_rect_min_x := hz.Rectangle.Min.X + hz.split_x // + hz.border_half_width
-	right_rect_max_x := hz.Rectangle.Max.X
+func (vs *VerticalSplitter) MMouseUp(x, y int) Widget {
+	return DispatchMMouseUp(vs.Children(), x, y, nil)
+}
 
-	leftRect := image.Rect(left_rect_min_x, hz.Min.Y, left_rect_max_x, hz.Max.Y)
-	rightRect := image.Rect(right_rect_min_x, hz.Min.Y, right_rect_max_x, hz.Max.Y)
+func (vs *VerticalSplitter) MouseOver(x, y int) Widget {
+	if vs.dragging {
+		ebiten.SetCursorShape(ebiten.CursorShapeNSResize)
+		//stop from going too far that you can't reach the handle
+		vs.split_y = max(5, min(y-vs.Min.Y, vs.Dy()-5))
+		vs.SetRect(vs.Rectangle)
+		return vs
+	}
+	vs.border_hovered = vs.over_divider(y)
+	if vs.border_hovered {
+		ebiten.SetCursorShape(ebiten.CursorShapeNSResize)
+		return vs
+	}
+	consumer := DispatchMouseOver(vs.Children(), x, y, nil)
+	if consumer == nil {
+		ebiten.SetCursorShape(ebiten.CursorShapeDefault)
+		consumer = vs
+	}
+	return consumer
+}
 
-	if hz.Left != nil {
-		hz.Left.SetRect(leftRect)
+func (vs *VerticalSplitter) Draw(target *ebiten.Image) {
+	if vs.Top != nil {
+		vs.Top.Draw(target)
 	}
-	if hz.Right != nil {
-		hz.Right.SetRect(rightRect)
+	if vs.Bottom != nil {
+		vs.Bottom.Draw(target)
 	}
+	if vs.border_mode == ShowAlways || vs.border_hovered || vs.dragging {
+		divider := image.Rect(vs.Min.X, vs.screenspace_divider_y()-Px(vs.border_half_width), vs.Max.X, vs.screenspace_divider_y()+Px(vs.border_half_width))
+		DrawRect(target, divider, Style.FGColorMuted)
+	}
+}
 
+func (vs *VerticalSplitter) SetRect(r image.Rectangle) {
+	old_height := vs.Rectangle.Dy()
+	vs.Rectangle = r
+	if old_height != 0 {
+		y_percent := float64(vs.split_y) / float64(old_height)
+		vs.split_y = int(y_percent * float64(r.Dy()))
+	}
+	divider_y := vs.screenspace_divider_y()
+	if vs.Top != nil {
+		vs.Top.SetRect(image.Rect(r.Min.X, r.Min.Y, r.Max.X, divider_y))
+	}
+	if vs.Bottom != nil {
+		vs.Bottom.SetRect(image.Rect(r.Min.X, divider_y, r.Max.X, r.Max.Y))
+	}
 }
 
 func NewColorRect(col color.Color) *ColorRect {
@@ -378,6 +404,26 @@ func (cr *ColorRect) LMouseUp(x int, y int) Widget {
 	return cr
 }
 
+// RMouseDown implements Widget
+func (cr *ColorRect) RMouseDown(x int, y int) Widget {
+	return nil
+}
+
+// RMouseUp implements Widget
+func (cr *ColorRect) RMouseUp(x int, y int) Widget {
+	return nil
+}
+
+// MMouseDown implements Widget
+func (cr *ColorRect) MMouseDown(x int, y int) Widget {
+	return nil
+}
+
+// MMouseUp implements Widget
+func (cr *ColorRect) MMouseUp(x int, y int) Widget {
+	return nil
+}
+
 // MouseOver implements Widget
 func (cr *ColorRect) MouseOver(x int, y int) Widget {
 	ebiten.SetCursorShape(ebiten.CursorShapeDefault)
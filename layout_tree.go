@@ -0,0 +1,215 @@
+package main
+
+import "image"
+
+// Container is a widget that holds other widgets
+// the layout tree is walked and reshaped through this (splitting editors, moving tabs around)
+type Container interface {
+	Widget
+	Children() []Widget
+	//swap old for new in place, returns false if old isn't a direct child
+	ReplaceChild(old, new Widget) bool
+}
+
+var _ Container = &Tabs{}
+var _ Container = &HorizontalSplitter{}
+var _ Container = &VerticalSplitter{}
+var _ Container = &MenuBar{}
+
+// FindParent returns the container directly holding target, nil if target isn't in the tree under root
+func FindParent(root Widget, target Widget) Container {
+	c, ok := root.(Container)
+	if !ok {
+		return nil
+	}
+	for _, kid := range c.Children() {
+		if kid == nil {
+			continue
+		}
+		if kid == target {
+			return c
+		}
+		if p := FindParent(kid, target); p != nil {
+			return p
+		}
+	}
+	return nil
+}
+
+// InTree reports whether w is root or somewhere under it
+func InTree(root Widget, w Widget) bool {
+	return root == w || FindParent(root, w) != nil
+}
+
+// SplitWidget puts w next to target, to the right for SplitHorizontal and below for SplitVertical
+// if target already lives in a split going the same way w just becomes another pane of it
+func SplitWidget(root Widget, target Widget, w Widget, orientation SplitOrientation) bool {
+	return split_widget(root, target, w, orientation, false)
+}
+
+// SplitWidgetBefore is SplitWidget but w goes to the left of or above target
+func SplitWidgetBefore(root Widget, target Widget, w Widget, orientation SplitOrientation) bool {
+	return split_widget(root, target, w, orientation, true)
+}
+
+func split_widget(root Widget, target Widget, w Widget, orientation SplitOrientation, before bool) bool {
+	parent := FindParent(root, target)
+	if parent == nil {
+		return false
+	}
+	if sp, ok := parent.(*SplitPane); ok && sp.Orientation == orientation {
+		if before {
+			return sp.InsertBefore(target, w)
+		}
+		return sp.InsertAfter(target, w)
+	}
+	split := NewSplitPane(orientation, target, w)
+	if before {
+		split = NewSplitPane(orientation, w, target)
+	}
+	return parent.ReplaceChild(target, split)
+}
+
+// RemoveFromLayout takes w out of the tree and closes up the gap
+// a split left holding one widget is replaced by that widget
+func RemoveFromLayout(root Widget, w Widget) bool {
+	var lone Widget //what's left of a split that only had two children
+	parent := FindParent(root, w)
+	switch p := parent.(type) {
+	case *SplitPane:
+		if !p.RemoveChild(w) {
+			return false
+		}
+		if len(p.Panes) != 1 {
+			return true
+		}
+		lone = p.Panes[0].Widget
+	case *HorizontalSplitter:
+		lone = p.Left
+		if w == p.Left {
+			lone = p.Right
+		}
+	case *VerticalSplitter:
+		lone = p.Top
+		if w == p.Top {
+			lone = p.Bottom
+		}
+	default:
+		return false
+	}
+	grandparent := FindParent(root, parent)
+	if grandparent == nil || !grandparent.ReplaceChild(parent, lone) {
+		return false
+	}
+	//a split inside a split going the same way is just one bigger split
+	if outer, ok := grandparent.(*SplitPane); ok {
+		if inner, ok := lone.(*SplitPane); ok && inner.Orientation == outer.Orientation {
+			outer.Flatten(inner)
+		}
+	}
+	return true
+}
+
+// CollapseEmptyTabs removes every tab group with no tabs left, returns whether the tree changed
+// a group that can't go anywhere (the only thing in the window) stays, and so does the last group
+// that isn't panels so there's always somewhere for files to open
+func CollapseEmptyTabs(root Widget, panels *Tabs) bool {
+	editor_groups := 0
+	Walk(root, func(w Widget) {
+		if tabs, ok := w.(*Tabs); ok && tabs != panels {
+			editor_groups++
+		}
+	})
+	changed := false
+	for _, tabs := range find_empty_tabs(root) {
+		if tabs != panels && editor_groups == 1 {
+			continue
+		}
+		if RemoveFromLayout(root, tabs) {
+			changed = true
+			if tabs != panels {
+				editor_groups--
+			}
+		}
+	}
+	return changed
+}
+
+func find_empty_tabs(w Widget) []*Tabs {
+	if tabs, ok := w.(*Tabs); ok && len(tabs.Tabs) == 0 {
+		return []*Tabs{tabs}
+	}
+	c, ok := w.(Container)
+	if !ok {
+		return nil
+	}
+	empties := []*Tabs{}
+	for _, kid := range c.Children() {
+		if kid != nil {
+			empties = append(empties, find_empty_tabs(kid)...)
+		}
+	}
+	return empties
+}
+
+// FirstTabs finds a tab group anywhere under root, nil if there are none
+func FirstTabs(root Widget) *Tabs {
+	if tabs, ok := root.(*Tabs); ok {
+		return tabs
+	}
+	c, ok := root.(Container)
+	if !ok {
+		return nil
+	}
+	for _, kid := range c.Children() {
+		if kid == nil {
+			continue
+		}
+		if tabs := FirstTabs(kid); tabs != nil {
+			return tabs
+		}
+	}
+	return nil
+}
+
+// visible_children is the part of c's children that are on screen right now
+func visible_children(c Container) []Widget {
+	switch c := c.(type) {
+	case *Tabs:
+		return c.body()
+	case *SplitPane:
+		return c.visible()
+	}
+	return c.Children()
+}
+
+// TabsAt finds the innermost tab group on screen at pt
+func TabsAt(root Widget, pt image.Point) *Tabs {
+	var found *Tabs
+	if tabs, ok := root.(*Tabs); ok {
+		found = tabs
+	}
+	c, ok := root.(Container)
+	if !ok {
+		return found
+	}
+	if kid := WidgetAt(visible_children(c), pt.X, pt.Y); kid != nil {
+		if deeper := TabsAt(kid, pt); deeper != nil {
+			return deeper
+		}
+	}
+	return found
+}
+
+// Walk calls fn on root and everything under it
+func Walk(root Widget, fn func(Widget)) {
+	if root == nil {
+		return
+	}
+	fn(root)
+	if c, ok := root.(Container); ok {
+		for _, kid := range c.Children() {
+			Walk(kid, fn)
+		}
+	}
+}
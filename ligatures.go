@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"log"
+	"math"
+
+	"github.com/go-text/typesetting/di"
+	tsfont "github.com/go-text/typesetting/font"
+	ot "github.com/go-text/typesetting/font/opentype"
+	"github.com/go-text/typesetting/language"
+	"github.com/go-text/typesetting/shaping"
+	"github.com/hajimehoshi/ebiten/v2"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+)
+
+// Programming ligatures, fonts like Cascadia Code swap sequences like := and => for joined up glyphs with OpenType substitutions
+// freetype only draws a character's usual glyph, so when ligatures are on each line is run through a shaper
+// and the glyphs it swapped in get rasterized from their outlines here
+// everything else is still drawn a character at a time, so the cursor and clicking still go one character at a time
+
+var shaper shaping.HarfbuzzShaper
+
+// the code font as the shaper sees it, nil if it couldn't be parsed
+var code_shaping_face *tsfont.Face
+
+// SetupShaping parses the code font for the shaper, call it after CodeFont changes
+func SetupShaping() {
+	code_shaping_face = nil
+	glyph_images = map[glyph_key]glyph_image{}
+	if CodeFont == nil || CodeFont.RegularData == nil {
+		return
+	}
+	face, err := tsfont.ParseTTF(bytes.NewReader(CodeFont.RegularData))
+	if err != nil {
+		log.Println("can't shape the code font:", err)
+		return
+	}
+	//when a variable font has feature variations for the default weight, like Cascadia Code does,
+	//the shaper only runs the features the variation swaps and skips every other one, calt included
+	//we only draw the default instance anyway so do without them
+	face.GSUB.FeatureVariations = nil
+	face.GPOS.FeatureVariations = nil
+	code_shaping_face = face
+}
+
+// LigaturesOn reports whether lines get shaped
+func LigaturesOn() bool {
+	return ligatures && code_shaping_face != nil
+}
+
+// ToggleLigatures turns ligatures on or off and remembers it in the settings
+func (g *Editor) ToggleLigatures() {
+	ChangeSetting("font.ligatures", !ligatures)
+}
+
+// ShapedGlyph is a glyph the shaper put in place of a character's usual one
+type ShapedGlyph struct {
+	Offset int //byte offset in the line of the first character it covers
+	Runes  int //how many characters it covers, a ligature covers more than one
+	GID    tsfont.GID
+	X      int //where it goes relative to the first character it covers
+}
+
+// SubstitutedGlyphs shapes line with the code font and returns the clusters of glyphs that aren't just the usual glyph for their character
+// clusters come back whole, drawing them replaces drawing every character they cover
+func SubstitutedGlyphs(line string) []ShapedGlyph {
+	if !LigaturesOn() || line == "" {
+		return nil
+	}
+	runes := []rune(line)
+	out := shaper.Shape(shaping.Input{
+		Text:      runes,
+		RunStart:  0,
+		RunEnd:    len(runes),
+		Direction: di.DirectionLTR,
+		Face:      code_shaping_face,
+		Size:      code_pixel_size(),
+		Script:    language.Latin,
+		Language:  language.NewLanguage("en"),
+	})
+
+	//rune index -> byte offset
+	offsets := make([]int, 0, len(runes)+1)
+	for i := range line {
+		offsets = append(offsets, i)
+	}
+	offsets = append(offsets, len(line))
+
+	substituted := map[int]bool{} //cluster -> whether any of its glyphs were swapped
+	for _, glyph := range out.Glyphs {
+		nominal, _ := code_shaping_face.NominalGlyph(runes[glyph.ClusterIndex])
+		if glyph.RuneCount != 1 || glyph.GlyphCount != 1 || glyph.GlyphID != nominal {
+			substituted[glyph.ClusterIndex] = true
+		}
+	}
+	glyphs := []ShapedGlyph{}
+	cluster, pen := -1, fixed.Int26_6(0)
+	for _, glyph := range out.Glyphs {
+		if glyph.ClusterIndex != cluster {
+			cluster, pen = glyph.ClusterIndex, 0
+		}
+		if substituted[cluster] {
+			glyphs = append(glyphs, ShapedGlyph{
+				Offset: offsets[cluster],
+				Runes:  glyph.RuneCount,
+				GID:    glyph.GlyphID,
+				X:      (pen + glyph.XOffset).Round(),
+			})
+		}
+		pen += glyph.XAdvance
+	}
+	return glyphs
+}
+
+/*
+Glyph images, rasterized once per size and scale
+*/
+
+type glyph_key struct {
+	gid  tsfont.GID
+	size fixed.Int26_6
+}
+
+// code_pixel_size is how many physical pixels an em of the code font is
+func code_pixel_size() fixed.Int26_6 {
+	return fixed.Int26_6(math.Round(float64(CodeFontSize) * UIScale * 64))
+}
+
+type glyph_image struct {
+	img    *ebiten.Image //white, nil for glyphs with nothing to draw like spaces
+	offset image.Point   //from the dot to the image's top left
+}
+
+var glyph_images = map[glyph_key]glyph_image{}
+
+// DrawShapedGlyph draws the code font's glyph gid with its dot at (x, baseline)
+func DrawShapedGlyph(target *ebiten.Image, gid tsfont.GID, x, baseline int, col color.Color) {
+	key := glyph_key{gid: gid, size: code_pixel_size()}
+	gi, ok := glyph_images[key]
+	if !ok {
+		gi = rasterize_glyph(code_shaping_face, gid, key.size)
+		glyph_images[key] = gi
+	}
+	if gi.img == nil {
+		return
+	}
+	opts := &ebiten.DrawImageOptions{}
+	opts.ColorM.ScaleWithColor(col)
+	opts.GeoM.Translate(float64(x+gi.offset.X), float64(baseline+gi.offset.Y))
+	target.DrawImage(gi.img, opts)
+}
+
+func rasterize_glyph(face *tsfont.Face, gid tsfont.GID, size fixed.Int26_6) glyph_image {
+	outline, ok := face.GlyphData(gid).(tsfont.GlyphOutline)
+	if !ok || len(outline.Segments) == 0 {
+		return glyph_image{}
+	}
+	//font units have y going up, the screen has it going down
+	scale := float32(size) / 64 / float32(face.Upem())
+	min_x, min_y := math.Inf(1), math.Inf(1)
+	max_x, max_y := math.Inf(-1), math.Inf(-1)
+	for i := range outline.Segments {
+		for _, p := range outline.Segments[i].ArgsSlice() {
+			x, y := float64(p.X*scale), float64(-p.Y*scale)
+			min_x, max_x = math.Min(min_x, x), math.Max(max_x, x)
+			min_y, max_y = math.Min(min_y, y), math.Max(max_y, y)
+		}
+	}
+	bounds := image.Rect(int(math.Floor(min_x)), int(math.Floor(min_y)), int(math.Ceil(max_x)), int(math.Ceil(max_y)))
+	if bounds.Empty() {
+		return glyph_image{}
+	}
+
+	ox, oy := float32(bounds.Min.X), float32(bounds.Min.Y)
+	pt := func(p tsfont.SegmentPoint) (float32, float32) {
+		return p.X*scale - ox, -p.Y*scale - oy
+	}
+	r := vector.NewRasterizer(bounds.Dx(), bounds.Dy())
+	for i, seg := range outline.Segments {
+		switch seg.Op {
+		case ot.SegmentOpMoveTo:
+			if i > 0 {
+				r.ClosePath()
+			}
+			r.MoveTo(pt(seg.Args[0]))
+		case ot.SegmentOpLineTo:
+			r.LineTo(pt(seg.Args[0]))
+		case ot.SegmentOpQuadTo:
+			x1, y1 := pt(seg.Args[0])
+			x2, y2 := pt(seg.Args[1])
+			r.QuadTo(x1, y1, x2, y2)
+		case ot.SegmentOpCubeTo:
+			x1, y1 := pt(seg.Args[0])
+			x2, y2 := pt(seg.Args[1])
+			x3, y3 := pt(seg.Args[2])
+			r.CubeTo(x1, y1, x2, y2, x3, y3)
+		}
+	}
+	r.ClosePath()
+	mask := image.NewAlpha(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	r.Draw(mask, mask.Bounds(), image.Opaque, image.Point{})
+	return glyph_image{img: ebiten.NewImageFromImage(mask), offset: bounds.Min}
+}
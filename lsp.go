@@ -0,0 +1,746 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Language servers, the code intelligence behind go to definition and the rest comes from a server per language
+// spoken to over its stdin and stdout, see jsonrpc.go
+// servers are started when the first file they handle is open and kept told about every edit to it,
+// a server that crashes gets restarted a few times before we give up on it
+
+// the command for each highlighter's files, "" for no server, see the lsp settings
+var go_server_command = "gopls"
+var c_server_command = "clangd"
+
+var server_commands = map[string]*string{
+	"go": &go_server_command,
+	"c":  &c_server_command,
+}
+
+// the ids the protocol uses for each language, by file extension
+var lsp_language_ids = map[string]string{
+	".go":  "go",
+	".c":   "c",
+	".h":   "c",
+	".cc":  "cpp",
+	".cpp": "cpp",
+	".cxx": "cpp",
+	".C":   "cpp",
+	".hh":  "cpp",
+	".hpp": "cpp",
+	".hxx": "cpp",
+	".H":   "cpp",
+}
+
+// a server that crashes more than this often in restart_window is left down
+const max_restarts = 3
+const restart_window = time.Minute
+
+const lsp_shutdown_timeout = 2 * time.Second
+
+/*
+The bits of the protocol we use
+*/
+
+type LSPPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type LSPRange struct {
+	Start LSPPosition `json:"start"`
+	End   LSPPosition `json:"end"`
+}
+
+type LSPLocation struct {
+	URI   string   `json:"uri"`
+	Range LSPRange `json:"range"`
+}
+
+// LSPTextEdit is a change a server wants made, the text in Range swapped for NewText
+type LSPTextEdit struct {
+	Range   LSPRange `json:"range"`
+	NewText string   `json:"newText"`
+}
+
+type lsp_document_id struct {
+	URI     string `json:"uri"`
+	Version int    `json:"version,omitempty"`
+}
+
+type lsp_content_change struct {
+	Range *LSPRange `json:"range,omitempty"` //nil for the whole text
+	Text  string    `json:"text"`
+}
+
+// LSPTextDocumentPosition is the params of most requests about a spot in a file
+type LSPTextDocumentPosition struct {
+	TextDocument lsp_document_id `json:"textDocument"`
+	Position     LSPPosition     `json:"position"`
+}
+
+// how a server wants edits sent, from its textDocumentSync capability
+const (
+	sync_none        = 0
+	sync_full        = 1
+	sync_incremental = 2
+)
+
+type lsp_server_capabilities struct {
+	PositionEncoding   string          `json:"positionEncoding"`
+	TextDocumentSync   json.RawMessage `json:"textDocumentSync"` //a number or an object with change in it
+	CompletionProvider *struct {
+		TriggerCharacters []string `json:"triggerCharacters"`
+	} `json:"completionProvider"`
+	HoverProvider json.RawMessage `json:"hoverProvider"` //true or an object of options
+}
+
+// has is whether a provider capability that's a bool or options is there and not false
+func (lsp_server_capabilities) has(provider json.RawMessage) bool {
+	s := string(provider)
+	return s != "" && s != "null" && s != "false"
+}
+
+// client_capabilities is what we tell servers we can do
+func client_capabilities() interface{} {
+	return map[string]interface{}{
+		"general": map[string]interface{}{
+			"positionEncodings": []string{"utf-8", "utf-16"},
+		},
+		"textDocument": map[string]interface{}{
+			"synchronization":    map[string]interface{}{"didSave": true},
+			"definition":         map[string]interface{}{"linkSupport": true},
+			"references":         map[string]interface{}{},
+			"publishDiagnostics": map[string]interface{}{},
+			"hover":              map[string]interface{}{"contentFormat": []string{"markdown", "plaintext"}},
+			"completion": map[string]interface{}{
+				"contextSupport": true,
+				"completionItem": map[string]interface{}{"snippetSupport": true},
+			},
+		},
+		"workspace": map[string]interface{}{
+			"workspaceFolders": true,
+			"configuration":    true,
+		},
+	}
+}
+
+// PathToURI is the file:// URI for path
+func PathToURI(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	path = filepath.ToSlash(path)
+	if !strings.HasPrefix(path, "/") {
+		//windows drive letters
+		path = "/" + path
+	}
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
+
+// URIToPath is the file a file:// URI is for, "" if it isn't one
+func URIToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return ""
+	}
+	path := u.Path
+	if runtime.GOOS == "windows" {
+		path = strings.TrimPrefix(path, "/")
+	}
+	return filepath.FromSlash(path)
+}
+
+/*
+Servers
+*/
+
+// LanguageServer is one running server and the documents it's been told about
+type LanguageServer struct {
+	Language string //the highlighter whose files it handles
+
+	cmd      *exec.Cmd //nil for servers launch made that aren't processes
+	log      *os.File  //where the server's stderr goes
+	conn     *RPCConn
+	ready    bool   //initialize has been answered
+	encoding string //"utf-8" or "utf-16", how it counts characters in a line
+	sync     int
+	caps     lsp_server_capabilities
+
+	docs     map[*TextBuffer]*lsp_document
+	restarts []time.Time
+	gave_up  bool
+
+	//launch starts the server, running the language's command when it's nil
+	launch func() (io.ReadWriteCloser, *exec.Cmd, error)
+}
+
+type lsp_document struct {
+	buf     *TextBuffer
+	path    string
+	version int
+	changes []lsp_content_change //since the server was last told
+	saved   bool
+}
+
+// every running server, by language
+var language_servers = map[string]*LanguageServer{}
+
+// buffers that have a watcher sending their edits to the servers
+var lsp_watched = map[*TextBuffer]bool{}
+
+// pipe_rwc is a process's stdout and stdin as one connection
+type pipe_rwc struct {
+	io.ReadCloser
+	in io.WriteCloser
+}
+
+func (p pipe_rwc) Write(bs []byte) (int, error) {
+	return p.in.Write(bs)
+}
+
+func (p pipe_rwc) Close() error {
+	p.in.Close()
+	return p.ReadCloser.Close()
+}
+
+// run_command runs the language's server command, its stdin and stdout are the connection
+func (ls *LanguageServer) run_command() (io.ReadWriteCloser, *exec.Cmd, error) {
+	command := strings.Fields(*server_commands[ls.Language])
+	if len(command) == 0 {
+		return nil, nil, fmt.Errorf("no language server set for %s", ls.Language)
+	}
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Dir = WorkspaceDir()
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	//what the server says about itself goes in a log, handy when it crashes
+	if err := os.MkdirAll(StateDir(), 0o755); err == nil {
+		if f, err := os.Create(filepath.Join(StateDir(), "lsp-"+ls.Language+".log")); err == nil {
+			cmd.Stderr = f
+			ls.log = f
+		}
+	}
+	if err := cmd.Start(); err != nil {
+		ls.close_log()
+		return nil, nil, err
+	}
+	return pipe_rwc{ReadCloser: stdout, in: stdin}, cmd, nil
+}
+
+// start runs the server and sends initialize, it's ready once the answer comes back
+func (ls *LanguageServer) start() error {
+	launch := ls.launch
+	if launch == nil {
+		launch = ls.run_command
+	}
+	rwc, cmd, err := launch()
+	if err != nil {
+		return err
+	}
+	ls.cmd = cmd
+	ls.ready = false
+	ls.docs = map[*TextBuffer]*lsp_document{}
+	ls.conn = NewRPCConn(rwc, ls.handle)
+
+	root := WorkspaceDir()
+	params := map[string]interface{}{
+		"processId":        os.Getpid(),
+		"clientInfo":       map[string]string{"name": "ide"},
+		"rootUri":          PathToURI(root),
+		"workspaceFolders": []map[string]string{{"uri": PathToURI(root), "name": filepath.Base(root)}},
+		"capabilities":     client_capabilities(),
+	}
+	conn := ls.conn
+	conn.Go("initialize", params, func(result json.RawMessage, err error) {
+		if conn != ls.conn {
+			return
+		}
+		if err != nil {
+			log.Printf("%s language server didn't start: %v", ls.Language, err)
+			ls.stop()
+			ls.gave_up = true
+			return
+		}
+		var answer struct {
+			Capabilities lsp_server_capabilities `json:"capabilities"`
+		}
+		if err := json.Unmarshal(result, &answer); err != nil {
+			log.Printf("%s language server didn't start: %v", ls.Language, err)
+			ls.stop()
+			ls.gave_up = true
+			return
+		}
+		ls.encoding = "utf-16"
+		if answer.Capabilities.PositionEncoding == "utf-8" {
+			ls.encoding = "utf-8"
+		}
+		ls.sync = parse_sync_kind(answer.Capabilities.TextDocumentSync)
+		ls.caps = answer.Capabilities
+		ls.ready = true
+		conn.Notify("initialized", struct{}{})
+	})
+	return nil
+}
+
+func parse_sync_kind(raw json.RawMessage) int {
+	var kind int
+	if err := json.Unmarshal(raw, &kind); err == nil {
+		return kind
+	}
+	var options struct {
+		Change int `json:"change"`
+	}
+	if err := json.Unmarshal(raw, &options); err == nil {
+		return options.Change
+	}
+	return sync_full
+}
+
+// handle answers requests and notifications the server sends us
+func (ls *LanguageServer) handle(method string, params json.RawMessage) (interface{}, error) {
+	switch method {
+	case "workspace/configuration":
+		//we've no settings for servers, a null for each one asked for means use your defaults
+		var p struct {
+			Items []json.RawMessage `json:"items"`
+		}
+		json.Unmarshal(params, &p)
+		return make([]interface{}, len(p.Items)), nil
+	case "window/logMessage", "window/showMessage":
+		var p struct {
+			Type    int    `json:"type"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(params, &p) == nil && p.Type == 1 {
+			log.Printf("%s language server: %s", ls.Language, p.Message)
+		}
+		return nil, nil
+	case "textDocument/publishDiagnostics":
+		ls.publish_diagnostics(params)
+		return nil, nil
+	case "window/workDoneProgress/create", "client/registerCapability", "client/unregisterCapability", "window/showMessageRequest":
+		return nil, nil
+	}
+	return nil, &RPCError{Code: -32601, Message: "method not found: " + method}
+}
+
+// stopping_server is a server that's been asked to stop, still read from until it's gone
+type stopping_server struct {
+	conn     *RPCConn
+	cmd      *exec.Cmd
+	deadline time.Time //when it gets killed if it's still there
+}
+
+var stopping_servers []*stopping_server
+
+// stop asks the server to shut down and exit without waiting for it to, see reap_servers
+// ls is ready to start again straight away
+func (ls *LanguageServer) stop() {
+	if ls.conn == nil {
+		return
+	}
+	ClearDiagnostics(ls.diagnostics_key())
+	s := &stopping_server{conn: ls.conn, cmd: ls.cmd, deadline: time.Now().Add(lsp_shutdown_timeout)}
+	//what it says on the way out is about documents we've forgotten
+	s.conn.handler = func(method string, params json.RawMessage) (interface{}, error) {
+		return nil, nil
+	}
+	if ls.ready {
+		s.conn.Go("shutdown", nil, func(result json.RawMessage, err error) {
+			if err == nil {
+				s.conn.Notify("exit", nil)
+			}
+			s.conn.Close()
+		})
+	} else {
+		s.conn.Close()
+	}
+	stopping_servers = append(stopping_servers, s)
+	ls.conn = nil
+	ls.cmd = nil
+	ls.ready = false
+	ls.docs = nil
+	ls.close_log()
+}
+
+// reap_servers passes on the replies of servers that are stopping and forgets the ones that have gone,
+// killing any that have taken longer than lsp_shutdown_timeout
+func reap_servers() {
+	kept := stopping_servers[:0]
+	for _, s := range stopping_servers {
+		s.conn.Dispatch()
+		select {
+		case <-s.conn.Done():
+		default:
+			if time.Now().Before(s.deadline) {
+				kept = append(kept, s)
+				continue
+			}
+			if s.cmd != nil {
+				s.cmd.Process.Kill()
+			}
+			s.conn.Close()
+		}
+		if s.cmd != nil {
+			go wait_or_kill(s.cmd, s.deadline)
+		}
+	}
+	stopping_servers = kept
+}
+
+// wait_or_kill waits for cmd to exit, killing it if it's still going at deadline
+func wait_or_kill(cmd *exec.Cmd, deadline time.Time) {
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+	select {
+	case <-exited:
+	case <-time.After(time.Until(deadline)):
+		cmd.Process.Kill()
+	}
+}
+
+func (ls *LanguageServer) close_log() {
+	if ls.log != nil {
+		ls.log.Close()
+		ls.log = nil
+	}
+}
+
+// crashed is when the server went away without being asked, it gets restarted unless it's been doing that a lot
+func (ls *LanguageServer) crashed() {
+	log.Printf("%s language server stopped unexpectedly, see %s", ls.Language, filepath.Join(StateDir(), "lsp-"+ls.Language+".log"))
+	conn, cmd := ls.conn, ls.cmd
+	ls.conn = nil
+	ls.cmd = nil
+	ls.ready = false
+	ls.docs = nil
+	conn.Dispatch() //replies failed by the hang up, they see the server's gone
+	if cmd != nil {
+		go wait_or_kill(cmd, time.Now().Add(lsp_shutdown_timeout))
+	}
+	ls.close_log()
+
+	now := time.Now()
+	recent := ls.restarts[:0]
+	for _, t := range ls.restarts {
+		if now.Sub(t) < restart_window {
+			recent = append(recent, t)
+		}
+	}
+	ls.restarts = recent
+	if len(ls.restarts) >= max_restarts {
+		log.Printf("%s language server keeps crashing, leaving it off", ls.Language)
+		ls.gave_up = true
+	}
+}
+
+func (ls *LanguageServer) running() bool {
+	return ls.conn != nil
+}
+
+/*
+Positions, we count bytes in a line and servers count UTF-16 code units unless they said they'd do UTF-8
+*/
+
+// Position is where c in tb is for the server
+func (ls *LanguageServer) Position(tb *TextBuffer, c Cursor) LSPPosition {
+	c = tb.ClampCursor(c)
+	return LSPPosition{Line: c.row, Character: ls.character(tb.lines[c.row], c.col)}
+}
+
+// Cursor is where a position the server gave us is in tb
+func (ls *LanguageServer) Cursor(tb *TextBuffer, p LSPPosition) Cursor {
+	if p.Line >= len(tb.lines) {
+		return tb.End()
+	}
+	if p.Line < 0 {
+		return Cursor{}
+	}
+	return Cursor{row: p.Line, col: ls.byte_col(tb.lines[p.Line], p.Character)}
+}
+
+// Edit is a server's edit in our terms
+func (ls *LanguageServer) Edit(tb *TextBuffer, e LSPTextEdit) TextEdit {
+	return TextEdit{From: ls.Cursor(tb, e.Range.Start), To: ls.Cursor(tb, e.Range.End), Text: e.NewText}
+}
+
+func (ls *LanguageServer) character(line string, col int) int {
+	col = max(0, min(col, len(line)))
+	if ls.encoding == "utf-8" {
+		return col
+	}
+	units := 0
+	for _, r := range line[:col] {
+		units += utf16_len(r)
+	}
+	return units
+}
+
+func (ls *LanguageServer) byte_col(line string, character int) int {
+	if ls.encoding == "utf-8" {
+		return max(0, min(character, len(line)))
+	}
+	units := 0
+	for i, r := range line {
+		if units >= character {
+			return i
+		}
+		units += utf16_len(r)
+	}
+	return len(line)
+}
+
+func utf16_len(r rune) int {
+	if r >= 0x10000 && r <= utf8.MaxRune {
+		return 2
+	}
+	return 1
+}
+
+/*
+Keeping documents in sync
+*/
+
+func (ls *LanguageServer) open(tb *TextBuffer) *lsp_document {
+	doc := &lsp_document{buf: tb, path: tb.filepath, version: 1, saved: tb.saved}
+	ls.docs[tb] = doc
+	language := lsp_language_ids[filepath.Ext(tb.filepath)]
+	if language == "" {
+		language = ls.Language
+	}
+	ls.conn.Notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{
+			"uri":        PathToURI(doc.path),
+			"languageId": language,
+			"version":    doc.version,
+			"text":       tb.Text(),
+		},
+	})
+	return doc
+}
+
+func (ls *LanguageServer) close(doc *lsp_document) {
+	delete(ls.docs, doc.buf)
+	ls.conn.Notify("textDocument/didClose", map[string]interface{}{
+		"textDocument": lsp_document_id{URI: PathToURI(doc.path)},
+	})
+}
+
+// edited records an edit for the next didChange, called before the edit is made so positions are still right
+func (ls *LanguageServer) edited(doc *lsp_document, e TextEdit) {
+	switch ls.sync {
+	case sync_none:
+		return
+	case sync_full:
+		//the whole text gets sent, after the edit, see flush
+		doc.changes = append(doc.changes[:0], lsp_content_change{})
+		return
+	}
+	r := LSPRange{Start: ls.Position(doc.buf, e.From), End: ls.Position(doc.buf, e.To)}
+	doc.changes = append(doc.changes, lsp_content_change{Range: &r, Text: e.Text})
+}
+
+// flush tells the server about edits it hasn't heard about yet
+func (ls *LanguageServer) flush(doc *lsp_document) {
+	if len(doc.changes) == 0 {
+		return
+	}
+	if ls.sync == sync_full {
+		doc.changes = []lsp_content_change{{Text: doc.buf.Text()}}
+	}
+	doc.version++
+	ls.conn.Notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   lsp_document_id{URI: PathToURI(doc.path), Version: doc.version},
+		"contentChanges": doc.changes,
+	})
+	doc.changes = nil
+}
+
+// lsp_watch sends tb's edits to whichever servers have it open
+func lsp_watch(tb *TextBuffer) {
+	if lsp_watched[tb] {
+		return
+	}
+	lsp_watched[tb] = true
+	tb.Watch(func(tb *TextBuffer, e TextEdit) {
+		for _, ls := range language_servers {
+			if doc := ls.docs[tb]; doc != nil && ls.ready {
+				ls.edited(doc, e)
+			}
+		}
+	})
+}
+
+// LanguageServerFor is the running server that has tb open, nil if there isn't one
+// anything tb's server hasn't been told yet is sent first so what's asked about matches what's on screen
+func LanguageServerFor(tb *TextBuffer) *LanguageServer {
+	if tb == nil {
+		return nil
+	}
+	for _, ls := range language_servers {
+		if doc := ls.docs[tb]; doc != nil && ls.ready {
+			ls.flush(doc)
+			return ls
+		}
+	}
+	return nil
+}
+
+// DocumentPosition is the params for a request about c in tb
+func (ls *LanguageServer) DocumentPosition(tb *TextBuffer, c Cursor) LSPTextDocumentPosition {
+	return LSPTextDocumentPosition{
+		TextDocument: lsp_document_id{URI: PathToURI(tb.filepath)},
+		Position:     ls.Position(tb, c),
+	}
+}
+
+// Request sends a request, reply gets the answer on the UI goroutine
+func (ls *LanguageServer) Request(method string, params interface{}, reply func(result json.RawMessage, err error)) {
+	ls.conn.Go(method, params, reply)
+}
+
+/*
+Running them all
+*/
+
+// UpdateLanguageServers starts servers for the files that are open, keeps them in sync and handles what they've sent
+func (g *Editor) UpdateLanguageServers() {
+	//what's open now and which server it wants
+	open := map[*TextBuffer]string{}
+	Walk(g.MainWidget, func(w Widget) {
+		te, ok := w.(*TextEditor)
+		if !ok || te.buf.filepath == "" || te.highlighter == nil {
+			return
+		}
+		if command, ok := server_commands[te.highlighter.Language()]; ok && *command != "" {
+			open[te.buf] = te.highlighter.Language()
+		}
+	})
+
+	for tb, language := range open {
+		ls := language_servers[language]
+		if ls == nil {
+			ls = &LanguageServer{Language: language}
+			language_servers[language] = ls
+		}
+		if !ls.running() && !ls.gave_up {
+			if err := ls.start(); err != nil {
+				log.Printf("couldn't start %s language server: %v", language, err)
+				ls.gave_up = true
+				continue
+			}
+			ls.restarts = append(ls.restarts, time.Now())
+		}
+		if !ls.ready {
+			continue
+		}
+		lsp_watch(tb)
+		doc := ls.docs[tb]
+		if doc != nil && doc.path != tb.filepath {
+			//saved somewhere else or renamed
+			ls.close(doc)
+			doc = nil
+		}
+		if doc == nil {
+			doc = ls.open(tb)
+		}
+		ls.flush(doc)
+		if tb.saved && !doc.saved {
+			ls.conn.Notify("textDocument/didSave", map[string]interface{}{
+				"textDocument": lsp_document_id{URI: PathToURI(doc.path)},
+			})
+		}
+		doc.saved = tb.saved
+	}
+
+	for _, ls := range language_servers {
+		if !ls.running() {
+			continue
+		}
+		select {
+		case <-ls.conn.Done():
+			ls.crashed()
+			continue
+		default:
+		}
+		if ls.ready {
+			for tb, doc := range ls.docs {
+				if open[tb] != ls.Language {
+					ls.close(doc)
+				}
+			}
+		}
+		ls.conn.Dispatch()
+	}
+	reap_servers()
+}
+
+// RestartLanguageServer restarts the server for the focused editor's language, even one we'd given up on
+func (g *Editor) RestartLanguageServer() {
+	te := g.FocusedEditor()
+	if te == nil || te.highlighter == nil {
+		return
+	}
+	ls := language_servers[te.highlighter.Language()]
+	if ls == nil {
+		return
+	}
+	ls.stop()
+	ls.gave_up = false
+	ls.restarts = nil
+}
+
+// HasLanguageServer reports whether the focused editor's language has a server set
+func (g *Editor) HasLanguageServer() bool {
+	te := g.FocusedEditor()
+	if te == nil || te.highlighter == nil {
+		return false
+	}
+	command, ok := server_commands[te.highlighter.Language()]
+	return ok && *command != ""
+}
+
+// StopLanguageServers shuts every server down, for when the editor closes
+// it waits for them to go, the editor isn't drawing anything any more
+func StopLanguageServers() {
+	for _, ls := range language_servers {
+		ls.stop()
+	}
+	for len(stopping_servers) > 0 {
+		reap_servers()
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// restart_server is for when a server's command changes, the next update starts it with the new one
+func restart_server(language string) func() {
+	return func() {
+		if ls := language_servers[language]; ls != nil {
+			ls.stop()
+			ls.gave_up = false
+			ls.restarts = nil
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// lsp_test_server is a go server whose launches are fake servers answering with answer
+// the editor has one go file open, with text in it
+type lsp_test_server struct {
+	g       *Editor
+	te      *TextEditor
+	ls      *LanguageServer
+	servers []*fake_server //one per launch
+}
+
+func new_lsp_test_server(t *testing.T, text string, answer func(msg *rpc_message) (interface{}, bool)) *lsp_test_server {
+	if len(definitions) == 0 {
+		ParseSyntaxHighlightingDefinitions()
+	}
+	saved_servers, saved_stopping, saved_watched := language_servers, stopping_servers, lsp_watched
+	language_servers, stopping_servers, lsp_watched = map[string]*LanguageServer{}, nil, map[*TextBuffer]bool{}
+	t.Cleanup(func() {
+		for _, ls := range language_servers {
+			ls.stop()
+		}
+		reap_servers()
+		language_servers, stopping_servers, lsp_watched = saved_servers, saved_stopping, saved_watched
+	})
+
+	path := filepath.Join(t.TempDir(), "main.go")
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	te, err := OpenTextEditor(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &lsp_test_server{g: &Editor{MainWidget: NewTabs(te)}, te: te}
+	s.ls = &LanguageServer{Language: "go", launch: func() (io.ReadWriteCloser, *exec.Cmd, error) {
+		ours, theirs := net.Pipe()
+		s.servers = append(s.servers, new_fake_server(theirs, answer))
+		return ours, nil, nil
+	}}
+	language_servers["go"] = s.ls
+	return s
+}
+
+func (s *lsp_test_server) update() {
+	s.g.UpdateLanguageServers()
+}
+
+// started waits for the latest launch to be initialized with te open in it, returning its fake
+func (s *lsp_test_server) started(t *testing.T) *fake_server {
+	t.Helper()
+	until(t, s.update, func() bool { return s.ls.ready && s.ls.docs[s.te.buf] != nil })
+	server := s.servers[len(s.servers)-1]
+	server.expect(t, "initialize")
+	server.expect(t, "initialized")
+	server.expect(t, "textDocument/didOpen")
+	return server
+}
+
+// incremental_server answers initialize asking for edits a change at a time, in UTF-16 unless told otherwise
+func incremental_server(msg *rpc_message) (interface{}, bool) {
+	switch msg.Method {
+	case "initialize":
+		return map[string]interface{}{"capabilities": map[string]interface{}{"textDocumentSync": sync_incremental}}, true
+	case "shutdown":
+		return nil, true
+	}
+	return nil, false
+}
+
+type did_change_params struct {
+	TextDocument   lsp_document_id      `json:"textDocument"`
+	ContentChanges []lsp_content_change `json:"contentChanges"`
+}
+
+func TestLanguageServerSync(t *testing.T) {
+	text := "package main\n\nvar s = \"😀b\"\n"
+	s := new_lsp_test_server(t, text, incremental_server)
+	until(t, s.update, func() bool { return s.ls.ready })
+
+	server := s.servers[0]
+	var initialize struct {
+		RootURI      string `json:"rootUri"`
+		Capabilities struct {
+			General struct {
+				PositionEncodings []string `json:"positionEncodings"`
+			} `json:"general"`
+		} `json:"capabilities"`
+	}
+	if err := json.Unmarshal(server.expect(t, "initialize").Params, &initialize); err != nil {
+		t.Fatal(err)
+	}
+	if initialize.RootURI != PathToURI(WorkspaceDir()) || len(initialize.Capabilities.General.PositionEncodings) == 0 {
+		t.Errorf("initialize params %+v", initialize)
+	}
+	server.expect(t, "initialized")
+	if s.ls.encoding != "utf-16" || s.ls.sync != sync_incremental {
+		t.Errorf("encoding %q sync %d, want utf-16 and incremental", s.ls.encoding, s.ls.sync)
+	}
+
+	s.update()
+	var open struct {
+		TextDocument struct {
+			URI        string `json:"uri"`
+			LanguageID string `json:"languageId"`
+			Version    int    `json:"version"`
+			Text       string `json:"text"`
+		} `json:"textDocument"`
+	}
+	json.Unmarshal(server.expect(t, "textDocument/didOpen").Params, &open)
+	if open.TextDocument.URI != PathToURI(s.te.buf.filepath) || open.TextDocument.LanguageID != "go" ||
+		open.TextDocument.Version != 1 || open.TextDocument.Text != text {
+		t.Errorf("didOpen params %+v", open.TextDocument)
+	}
+
+	//b is byte 13 on its line, but 11 UTF-16 units in, the emoji is 4 bytes and 2 units
+	s.te.buf.Replace(Cursor{row: 2, col: 13}, Cursor{row: 2, col: 14}, "c")
+	//the first change's range is from before this one moved it down a line
+	s.te.buf.Replace(Cursor{}, Cursor{}, "// x\n")
+	s.update()
+	var change did_change_params
+	json.Unmarshal(server.expect(t, "textDocument/didChange").Params, &change)
+	if change.TextDocument.Version != 2 {
+		t.Errorf("didChange version %d, want 2", change.TextDocument.Version)
+	}
+	want := []lsp_content_change{
+		{Range: &LSPRange{Start: LSPPosition{Line: 2, Character: 11}, End: LSPPosition{Line: 2, Character: 12}}, Text: "c"},
+		{Range: &LSPRange{}, Text: "// x\n"},
+	}
+	if len(change.ContentChanges) != len(want) {
+		t.Fatalf("%d changes sent, want %d", len(change.ContentChanges), len(want))
+	}
+	for i, c := range change.ContentChanges {
+		if c.Range == nil || *c.Range != *want[i].Range || c.Text != want[i].Text {
+			t.Errorf("change %d is %+v %q, want %+v %q", i, c.Range, c.Text, want[i].Range, want[i].Text)
+		}
+	}
+
+	s.update()
+	select {
+	case msg := <-server.received:
+		t.Errorf("sent %q with nothing changed", msg.Method)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestLanguageServerUTF8(t *testing.T) {
+	s := new_lsp_test_server(t, "var s = \"😀b\"\n", func(msg *rpc_message) (interface{}, bool) {
+		if msg.Method == "initialize" {
+			return map[string]interface{}{"capabilities": map[string]interface{}{
+				"positionEncoding": "utf-8", "textDocumentSync": map[string]int{"change": sync_incremental},
+			}}, true
+		}
+		return nil, false
+	})
+	server := s.started(t)
+	s.te.buf.Replace(Cursor{row: 0, col: 13}, Cursor{row: 0, col: 14}, "c")
+	s.update()
+	var change did_change_params
+	json.Unmarshal(server.expect(t, "textDocument/didChange").Params, &change)
+	if len(change.ContentChanges) != 1 || change.ContentChanges[0].Range == nil || change.ContentChanges[0].Range.Start.Character != 13 {
+		t.Errorf("changes %+v, want one starting at byte 13", change.ContentChanges)
+	}
+}
+
+func TestLanguageServerRestarts(t *testing.T) {
+	s := new_lsp_test_server(t, "package main\n", incremental_server)
+	for i := 0; i < max_restarts; i++ {
+		server := s.started(t)
+		if len(s.servers) != i+1 {
+			t.Fatalf("launched %d times, want %d", len(s.servers), i+1)
+		}
+		server.conn.Close()
+		until(t, s.update, func() bool { return len(s.servers) > i+1 || s.ls.gave_up })
+	}
+	if !s.ls.gave_up {
+		t.Fatalf("still restarting after %d crashes", max_restarts)
+	}
+	for i := 0; i < 10; i++ {
+		s.update()
+	}
+	if len(s.servers) != max_restarts || s.ls.running() {
+		t.Errorf("launched %d times after giving up, want %d", len(s.servers), max_restarts)
+	}
+
+	//asking for a restart starts over
+	s.g.last_editor = s.te
+	s.g.RestartLanguageServer()
+	s.started(t)
+}
+
+func TestLanguageServerShutdown(t *testing.T) {
+	s := new_lsp_test_server(t, "package main\n", incremental_server)
+	server := s.started(t)
+
+	s.ls.stop()
+	if s.ls.running() || len(stopping_servers) != 1 {
+		t.Fatalf("stop left the server running or forgot it")
+	}
+	//stop doesn't wait for the reply, only the updates after it see it
+	server.expect(t, "shutdown")
+	until(t, s.update, func() bool { return len(stopping_servers) == 0 })
+	server.expect(t, "exit")
+	server.hung_up(t)
+
+	//a new one starts straight away
+	s.started(t)
+	if len(s.servers) != 2 {
+		t.Errorf("launched %d times, want 2", len(s.servers))
+	}
+}
+
+func TestLanguageServerShutdownTimeout(t *testing.T) {
+	s := new_lsp_test_server(t, "package main\n", func(msg *rpc_message) (interface{}, bool) {
+		if msg.Method == "shutdown" {
+			return nil, false
+		}
+		return incremental_server(msg)
+	})
+	server := s.started(t)
+
+	s.ls.stop()
+	server.expect(t, "shutdown")
+	reap_servers()
+	if len(stopping_servers) != 1 {
+		t.Fatalf("forgot the server before it answered or timed out")
+	}
+	stopping_servers[0].deadline = time.Now()
+	reap_servers()
+	if len(stopping_servers) != 0 {
+		t.Errorf("kept the server past its deadline")
+	}
+	server.hung_up(t)
+}
@@ -2,14 +2,11 @@ package main
 
 import (
 	"errors"
-	"fmt"
 	"image"
 	_ "image/png"
 	"log"
 	"os"
 	"runtime/pprof"
-	"strings"
-	"time"
 
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
@@ -18,43 +15,150 @@ import (
 
 var ticks uint64
 
+// Focuser widgets want to know when they start getting keyboard input
+type Focuser interface {
+	Focus()
+}
+
 type Editor struct {
 	screenWidth  int
 	screenHeight int
 
 	should_close bool
+	quitting     bool //unsaved changes have been saved or let go, this update is the last
 
 	MainWidget             Widget
-	last_mouse_consumer    Widget //widget to send mouseout to
-	last_keyboard_consumer Widget //Widget to send keyboard inputs to
+	last_mouse_consumer    Widget      //widget to send mouseout to
+	last_keyboard_consumer Widget      //Widget to send keyboard inputs to
+	last_editor            *TextEditor //editor that last had keyboard focus, what menu commands act on
+
+	alt_alone         bool   //alt is down and nothing else has been pressed with it
+	focus_before_menu Widget //what gets the keyboard back when the menu bar is done with it
+
+	nav_back    []NavLocation //where jumps came from, for going back
+	nav_forward []NavLocation
+	panel_tabs  *Tabs //the group under the editors that results panels open in
+
+	task   *TaskRun     //the task running or that ran last
+	output *OutputPanel //where tasks' output goes
+
+	debug_console *DebugConsole
 }
 
 func (g *Editor) Rebuild() {
-	rect := image.Rect(0, 0, g.screenWidth, g.screenHeight)
-	g.MainWidget.SetRect(rect)
+	g.MainWidget.SetRect(g.main_rect())
 
 }
 func (g *Editor) IncreaseFontSize() {
-	MainFontSize += 2
-	CodeFontSize += 2
-
-	MainFontFace, MainFontPeriodFromTop = MakeFace(MainFont, MainFontSize)
-	CodeFontFace, CodeFontPeriodFromTop = MakeFace(CodeFont, CodeFontSize)
-	g.Rebuild()
+	g.ResizeText(2)
 }
 func (g *Editor) DecreaseFontSize() {
-	MainFontSize -= 2
-	CodeFontSize -= 2
-	if MainFontSize < MinFontSize {
-		MainFontSize = MinFontSize
+	g.ResizeText(-2)
+}
+
+// ResizeText makes the main and code text by bigger, it sticks through the settings
+func (g *Editor) ResizeText(by int) {
+	ChangeSetting("font.main_size", max(MinFontSize, min(MaxFontSize, MainFontSize+by)))
+	ChangeSetting("font.code_size", max(MinFontSize, min(MaxFontSize, CodeFontSize+by)))
+}
+
+// SplitFocused shows the focused editor again next to itself, to the right or below depending on orientation
+// editors in a tab group split the whole group so the new view gets its own tabs
+func (g *Editor) SplitFocused(orientation SplitOrientation) {
+	te := g.FocusedEditor()
+	if te == nil {
+		return
+	}
+	view := te.NewView()
+	var target Widget = te
+	var new_pane Widget = view
+	if tabs, ok := FindParent(g.MainWidget, te).(*Tabs); ok {
+		target = tabs
+		new_pane = NewTabs(view)
 	}
-	if CodeFontSize < MinFontSize {
-		CodeFontSize = MinFontSize
+	if !SplitWidget(g.MainWidget, target, new_pane, orientation) {
+		return
 	}
+	g.Rebuild()
+	g.Focus(view)
+}
 
-	MainFontFace, MainFontPeriodFromTop = MakeFace(MainFont, MainFontSize)
-	CodeFontFace, CodeFontPeriodFromTop = MakeFace(CodeFont, CodeFontSize)
+// SplitTab shows tab w of tabs in a new group next to them
+// editors get a second view, anything else moves over as long as it isn't the group's only tab
+func (g *Editor) SplitTab(tabs *Tabs, w Widget, orientation SplitOrientation) {
+	var moved Widget
+	if te, ok := w.(*TextEditor); ok {
+		moved = te.NewView()
+	} else {
+		if len(tabs.Tabs) < 2 {
+			return
+		}
+		tabs.RemoveTab(tabs.IndexOf(w))
+		moved = w
+	}
+	if !SplitWidget(g.MainWidget, tabs, NewTabs(moved), orientation) {
+		return
+	}
 	g.Rebuild()
+	g.Focus(moved)
+}
+func (g *Editor) SplitRight() {
+	g.SplitFocused(SplitHorizontal)
+}
+func (g *Editor) SplitDown() {
+	g.SplitFocused(SplitVertical)
+}
+
+// Focus sends keyboard input to w from now on
+func (g *Editor) Focus(w Widget) {
+	if w == g.last_keyboard_consumer {
+		return
+	}
+	if g.last_keyboard_consumer != nil {
+		g.last_keyboard_consumer.KeyboardFocusLost()
+	}
+	if f, ok := w.(Focuser); ok {
+		f.Focus()
+	}
+	if te, ok := w.(*TextEditor); ok {
+		g.last_editor = te
+	}
+	g.last_keyboard_consumer = w
+}
+
+// Focused is what has the keyboard, or had it before the menu bar took it
+func (g *Editor) Focused() Widget {
+	if _, ok := g.last_keyboard_consumer.(*MenuBar); ok {
+		return g.focus_before_menu
+	}
+	return g.last_keyboard_consumer
+}
+
+// FocusedTabs is the tab group holding whatever has keyboard focus, nil if it isn't in one
+func (g *Editor) FocusedTabs() *Tabs {
+	if tabs, ok := g.last_keyboard_consumer.(*Tabs); ok {
+		return tabs
+	}
+	tabs, _ := FindParent(g.MainWidget, g.last_keyboard_consumer).(*Tabs)
+	return tabs
+}
+
+// CycleTabs switches the focused tab group dir tabs over and focuses what's in the new tab
+func (g *Editor) CycleTabs(dir int) {
+	tabs := g.FocusedTabs()
+	if tabs == nil {
+		return
+	}
+	tabs.CycleTab(dir)
+	if current := tabs.current(); current != nil {
+		g.Focus(current)
+	}
+}
+func (g *Editor) NextTab() {
+	g.CycleTabs(1)
+}
+func (g *Editor) PreviousTab() {
+	g.CycleTabs(-1)
 }
 
 func ToggleFullscreen() {
@@ -65,15 +169,50 @@ func (g *Editor) SetShouldClose() {
 }
 func (g *Editor) Update() error {
 	ticks++
+	if ebiten.IsWindowBeingClosed() {
+		g.should_close = true
+	}
 	if g.should_close {
+		g.should_close = false
+		g.ConfirmQuit(func() { g.quitting = true })
+	}
+	if g.quitting {
+		if err := SaveSession(g.Snapshot()); err != nil {
+			log.Println("couldn't save session:", err)
+		}
+		StopLanguageServers()
+		StopTerminals()
+		StopDebugger()
 		return errors.New("editor closed by user")
 	}
+	g.UpdateLanguageServers()
+	g.UpdateDiagnostics()
+	g.UpdateTasks()
+	UpdateDialogs()
+	UpdateFormatting()
+	g.UpdateTests()
+	UpdateTerminals()
+	g.UpdateDebugger()
 	if !ebiten.IsFocused() {
 		return nil
 	}
 
 	//mouse handling
 	x, y := ebiten.CursorPosition()
+	track_mouse(x, y)
+	if current_tab_drag != nil {
+		g.UpdateTabDrag(x, y)
+		return nil
+	}
+	if current_prompt != nil {
+		g.UpdatePrompt(x, y)
+		return nil
+	}
+	if current_popup != nil {
+		g.UpdatePopup(x, y)
+		return nil
+	}
+	g.StatusBarMouse(x, y)
 	mouse_consumer := g.MainWidget.MouseOver(x, y)
 	if mouse_consumer != g.last_mouse_consumer {
 		if g.last_mouse_consumer != nil {
@@ -82,43 +221,58 @@ func (g *Editor) Update() error {
 	}
 	g.last_mouse_consumer = mouse_consumer
 
-	key_consumer := g.last_keyboard_consumer
+	//whatever had focus might have been closed since
+	if g.last_keyboard_consumer != nil && !InTree(g.MainWidget, g.last_keyboard_consumer) {
+		g.last_keyboard_consumer = nil
+	}
+	//menu clicks return nil and might have moved focus themselves, so only focus what was clicked
 	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
-		consumer := g.MainWidget.LMouseDown(x, y)
-		if consumer != nil {
-			key_consumer = consumer
+		if consumer := g.MainWidget.LMouseDown(x, y); consumer != nil {
+			g.Focus(consumer)
 		}
 	} else if inpututil.IsMouseButtonJustReleased(ebiten.MouseButtonLeft) {
-		consumer := g.MainWidget.LMouseUp(x, y)
-		if consumer != nil {
-			key_consumer = consumer
+		if consumer := g.MainWidget.LMouseUp(x, y); consumer != nil {
+			g.Focus(consumer)
+		}
+	}
+	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonRight) {
+		if consumer := g.MainWidget.RMouseDown(x, y); consumer != nil {
+			g.Focus(consumer)
 		}
+	} else if inpututil.IsMouseButtonJustReleased(ebiten.MouseButtonRight) {
+		if consumer := g.MainWidget.RMouseUp(x, y); consumer != nil {
+			ShowPopup(g.ContextMenu(consumer, x, y), x, y)
+		}
+	}
+	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonMiddle) {
+		g.MainWidget.MMouseDown(x, y)
+	} else if inpututil.IsMouseButtonJustReleased(ebiten.MouseButtonMiddle) {
+		g.MainWidget.MMouseUp(x, y)
+	}
+	g.ReturnFromMenuBar()
 
+	//alt and F10 move focus to the menu bar, that frame's keys are all the menu's
+	if g.MenuBarKeys() {
+		return nil
 	}
 
 	global_shortcuts := map[KeyShortcut]func(){
-		{
-			mod_shift: false,
-			mod_ctrl:  false,
-			mod_alt:   false,
-			mod_meta:  false,
-			key:       ebiten.KeyF11,
-		}: ToggleFullscreen,
-		{
-			mod_shift: false,
-			mod_ctrl:  true,
-			mod_alt:   false,
-			mod_meta:  false,
-			key:       ebiten.KeyQ,
-		}: g.SetShouldClose,
-		{mod_ctrl: true, mod_shift: true, key: ebiten.KeyEqual}:  g.IncreaseFontSize,
-		{mod_ctrl: true, mod_shift: false, key: ebiten.KeyMinus}: g.DecreaseFontSize,
+		{mod_ctrl: true, key: ebiten.KeyTab}:                  g.NextTab,
+		{mod_ctrl: true, mod_shift: true, key: ebiten.KeyTab}: g.PreviousTab,
+		{mod_ctrl: true, key: ebiten.KeyPageDown}:             g.NextTab,
+		{mod_ctrl: true, key: ebiten.KeyPageUp}:               g.PreviousTab,
+	}
+	if mb, ok := g.MainWidget.(*MenuBar); ok {
+		for shortcut, action := range mb.Shortcuts() {
+			global_shortcuts[shortcut] = action
+		}
 	}
 	//special function keys
 	ctrl_down := ebiten.IsKeyPressed(ebiten.KeyControl)
 	alt_down := ebiten.IsKeyPressed(ebiten.KeyAlt)
 	meta_down := ebiten.IsKeyPressed(ebiten.KeyMeta)
 	shift_down := ebiten.IsKeyPressed(ebiten.KeyShift)
+	grabber, _ := g.last_keyboard_consumer.(ShortcutGrabber)
 
 	for shortcut := range global_shortcuts {
 		switch shortcut.key {
@@ -126,13 +280,17 @@ func (g *Editor) Update() error {
 			continue
 		default:
 			if inpututil.IsKeyJustReleased(shortcut.key) {
-				executable := global_shortcuts[KeyShortcut{
+				pressed := KeyShortcut{
 					mod_shift: shift_down,
 					mod_ctrl:  ctrl_down,
 					mod_alt:   alt_down,
 					mod_meta:  meta_down,
 					key:       shortcut.key,
-				}]
+				}
+				executable := global_shortcuts[pressed]
+				if grabber != nil && grabber.GrabsShortcut(pressed) {
+					continue
+				}
 				if executable != nil {
 					executable()
 				}
@@ -140,99 +298,115 @@ func (g *Editor) Update() error {
 		}
 	}
 
-	if key_consumer != g.last_keyboard_consumer {
-		if g.last_keyboard_consumer != nil {
-			g.last_keyboard_consumer.KeyboardFocusLost()
-		}
-	}
-	g.last_keyboard_consumer = key_consumer
-
 	//Keyboard handling
 	if g.last_keyboard_consumer != nil {
 		g.last_keyboard_consumer.TakeKeyboard()
 	}
+	g.ReturnFromMenuBar()
+	g.HandleOpenRequests()
+	g.HandleCloseRequests()
+	g.HandleJumpRequests()
+	g.HandleCompletionRequests()
+	g.ReloadThemeIfChanged()
+	g.ApplySettingChanges()
+
+	//closing the last tab of a group leaves a hole in the layout
+	if CollapseEmptyTabs(g.MainWidget, g.panel_tabs) {
+		g.Rebuild()
+	}
 	return nil
 }
 
 func (g *Editor) Draw(screen *ebiten.Image) {
 	ebitenutil.DrawRect(screen, 0, 0, float64(screen.Bounds().Dx()), float64(screen.Bounds().Dy()), Style.BGColorMuted)
+	g.DrawStatusBar(screen)
 	g.MainWidget.Draw(screen)
+	if te := g.FocusedEditor(); te != nil {
+		te.DrawCompletion(screen)
+	}
+	DrawTooltip(screen)
+	if current_tab_drag != nil {
+		current_tab_drag.Draw(screen)
+	}
+	if current_popup != nil {
+		current_popup.Draw(screen)
+	}
+	if current_prompt != nil {
+		current_prompt.Draw(screen)
+	}
 
 }
 
+// the screen is in physical pixels, outsideWidth and outsideHeight are logical ones, see scale.go
 func (g *Editor) Layout(outsideWidth, outsideHeight int) (int, int) {
-	if outsideHeight == g.screenWidth && outsideWidth == g.screenWidth {
+	rescaled := SetUIScale(ebiten.DeviceScaleFactor())
+	width, height := Px(outsideWidth), Px(outsideHeight)
+	menu_bounds = image.Rect(0, 0, width, height)
+	if !rescaled && width == g.screenWidth && height == g.screenHeight {
 		//nothing changed
-		return outsideWidth, outsideHeight
+		return width, height
+	}
+	if rescaled {
+		//moved to a monitor with a different scale, every cached texture is the wrong resolution
+		g.Restyle()
 	}
-	r := image.Rect(0, 0, outsideWidth, outsideHeight)
-	g.screenWidth = outsideWidth
-	g.screenHeight = outsideHeight
+	g.screenWidth = width
+	g.screenHeight = height
 
-	g.MainWidget.SetRect(r)
+	g.MainWidget.SetRect(g.main_rect())
 	return g.screenWidth, g.screenHeight
 }
 
-/*
-[]MenuItem{
-	&DummyMenuItem{txt: "File", kids: []MenuItem{&DummyMenuItem{txt: "Open"}, &DummyMenuItem{txt: "Close"}, &DummyMenuItem{txt: "Quit"}}},
-	&DummyMenuItem{txt: "Edit", kids: []MenuItem{&DummyMenuItem{txt: "Copy", kids: []MenuItem{&DummyMenuItem{txt: "Cut"}, &DummyMenuItem{txt: "Pasta"}}}}},
-	&DummyMenuItem{txt: "Code", kids: []MenuItem{}},
-},
-*/
+// the file tree side of the default layout doesn't get dragged narrower than this, in logical pixels
+const side_min_width = 120
+
+// DefaultLayout is what we start with when there's no session to restore
+func DefaultLayout() Widget {
+	te := NewTextEditor(nil)
+	if len(definitions) > 0 {
+		te.highlighter = &definitions[0]
+	}
+	var side Widget = NewDataPane()
+	if ft, err := NewFileTree("."); err == nil {
+		side_split := NewSplitPane(SplitVertical, ft, side)
+		side_split.Panes[0].Fraction = 0.7
+		side_split.Panes[1].Fraction = 0.3
+		side = side_split
+	}
+	layout := NewSplitPane(SplitHorizontal, side, NewTabs(te))
+	layout.Panes[0].Fraction = 0.25
+	layout.Panes[0].MinSize = side_min_width
+	layout.Panes[1].Fraction = 0.75
+	return layout
+}
 
 func main() {
 	ParseSyntaxHighlightingDefinitions()
+	LoadSettings()
 
-	menu_items := []MenuItem{
-		NewMenuItem("File", []MenuItem{NewMenuItem("Save", nil), NewMenuItem("Save as", nil), NewMenuItem("Open", nil), NewMenuItem("Close", nil), NewMenuItem("Quit", nil)}),
-		NewMenuItem("Edit", []MenuItem{NewMenuItem("Copy", nil), NewMenuItem("Cut", nil), NewMenuItem("Pasta", nil)}),
-		NewMenuItem("Code", []MenuItem{NewMenuItem("Go To", []MenuItem{NewMenuItem("Symbol Definition", nil)})}),
-	}
-	te1 := &TextEditor{text: strings.Split("", "\n")}
-	te1.highlighter = &definitions[0]
-	var data_pane *TextEditor = &TextEditor{
-		ReadOnly: true,
+	window_width, window_height := 800, 800
+	session, err := LoadSession()
+	if err != nil && !os.IsNotExist(err) {
+		log.Println("couldn't read session:", err)
 	}
-	ticker := time.NewTicker(time.Second / 60)
-	go func() {
-		for t := range ticker.C {
-			data_pane.SetText(fmt.Sprintf("\nData:\ntime: %v\nTPS: %f\nFPS: %f\nTicks: %d\nTETick: %d", t.Format(time.Kitchen), ebiten.ActualTPS(), ebiten.ActualFPS(), ticks, te1.last_interact_time))
-		}
-	}()
-	/*
-		mutlitline
-	*/
-
-	main_view := &HorizontalSplitter{
-		split_x: 200,
-		Left:    data_pane,
-		Right: &Tabs{
-			current_hovered: -1,
-			Titles:          []string{"Text editor", "Blue", "Green", "Red"},
-			Tabs: []Widget{
-				te1,
-				NewColorRect(Style.BlueMuted),
-				NewColorRect(Style.GreenMuted),
-				NewColorRect(Style.RedMuted),
-			},
-			CurrentTab: 0,
-			TabHeight:  2*tab_y_padding + MainFontSize,
-		},
-		border_half_width: 2,
-		border_mode:       ShowOnHover,
-	}
-	g := &Editor{
-		MainWidget: NewMenuBar(menu_items, main_view),
+	main_view := session.RestoreLayout(DefaultLayout)
+	if session.WindowWidth > 0 && session.WindowHeight > 0 {
+		window_width, window_height = session.WindowWidth, session.WindowHeight
 	}
 
+	g := &Editor{}
+	g.MainWidget = NewMenuBar(g.Menus(), main_view)
+
 	//
 	//ebiten.SetFPSMode(ebiten.FPSModeVsyncOffMaximum)
 	ebiten.SetWindowResizingMode(ebiten.WindowResizingModeEnabled)
+	//we save the session before the window goes away
+	ebiten.SetWindowClosingHandled(true)
 
-	g.MainWidget.SetRect(image.Rect(0, 0, 800, 700))
-	g.Layout(800, 800)
-	ebiten.SetWindowSize(800, 800)
+	g.MainWidget.SetRect(image.Rect(0, 0, window_width, window_height))
+	g.Layout(window_width, window_height)
+	ebiten.SetWindowSize(window_width, window_height)
+	ebiten.SetFullscreen(session.Fullscreen)
 
 	ebiten.SetWindowTitle("IDE")
 	if err := ebiten.RunGame(g); err != nil {
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"unicode"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+	"golang.org/x/image/font"
+)
+
+// Menu text marks its mnemonic with &, "&File" is drawn as File with the F underlined and opens with alt+F
+// "&&" is a literal &
+
+// ParseMnemonic splits menu text into what gets drawn and its mnemonic
+// index is the byte offset of the mnemonic in label, -1 (and mnemonic 0) if there isn't one
+func ParseMnemonic(s string) (label string, mnemonic rune, index int) {
+	var b strings.Builder
+	index = -1
+	for i := 0; i < len(s); i++ {
+		if s[i] != '&' || i+1 >= len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		if s[i] != '&' && index < 0 {
+			index = b.Len()
+			mnemonic = unicode.ToLower(rune(s[i]))
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String(), mnemonic, index
+}
+
+// EscapeMnemonic makes s show up as it is in a menu, for text that isn't ours like file names
+func EscapeMnemonic(s string) string {
+	return strings.ReplaceAll(s, "&", "&&")
+}
+
+// DrawMenuLabel draws menu text with its mnemonic underlined, baseline_left is where text.Draw would put it
+func DrawMenuLabel(target *ebiten.Image, s string, baseline_left image.Point, col color.Color) {
+	label, _, index := ParseMnemonic(s)
+	text.Draw(target, label, MenuFontFace, baseline_left.X, baseline_left.Y, col)
+	if index < 0 || index >= len(label) {
+		return
+	}
+	start := font.MeasureString(MenuFontFace, label[:index]).Round()
+	width := font.MeasureString(MenuFontFace, label[index:index+1]).Round()
+	y := float64(baseline_left.Y + 2)
+	ebitenutil.DrawLine(target, float64(baseline_left.X+start), y, float64(baseline_left.X+start+width), y, col)
+}
+
+// KeyForRune is the key that types r, for the letters and digits mnemonics use
+func KeyForRune(r rune) (ebiten.Key, bool) {
+	r = unicode.ToLower(r)
+	switch {
+	case r >= 'a' && r <= 'z':
+		return ebiten.KeyA + ebiten.Key(r-'a'), true
+	case r >= '0' && r <= '9':
+		return ebiten.Key0 + ebiten.Key(r-'0'), true
+	}
+	return 0, false
+}
+
+// mnemonic_just_pressed finds which of items has its mnemonic key just pressed, -1 if none
+func mnemonic_just_pressed(items []MenuItem) int {
+	for i, item := range items {
+		_, mnemonic, _ := ParseMnemonic(item.Text())
+		if key, ok := KeyForRune(mnemonic); ok && inpututil.IsKeyJustPressed(key) {
+			return i
+		}
+	}
+	return -1
+}
+
+func selectable(mi MenuItem) bool {
+	if _, ok := mi.(*MenuSeparator); ok {
+		return false
+	}
+	return mi.Enabled()
+}
+
+// move_hover steps the highlighted item by dir, skipping separators and disabled items and wrapping at the ends
+func (dmi *DummyMenuItem) move_hover(dir int) {
+	dmi.sub_open = false
+	n := len(dmi.kids)
+	i := dmi.currently_hovered
+	if i < 0 && dir < 0 {
+		i = n
+	}
+	for step := 0; step < n; step++ {
+		i = ((i+dir)%n + n) % n
+		if selectable(dmi.kids[i]) {
+			dmi.currently_hovered = i
+			return
+		}
+	}
+}
+
+func (dmi *DummyMenuItem) hovered_item() MenuItem {
+	if dmi.currently_hovered < 0 || dmi.currently_hovered >= len(dmi.kids) {
+		return nil
+	}
+	return dmi.kids[dmi.currently_hovered]
+}
+
+// open_submenu shows the hovered item's submenu with its first item highlighted
+func (dmi *DummyMenuItem) open_submenu() {
+	dmi.sub_open = true
+	if sub, ok := dmi.hovered_item().(*DummyMenuItem); ok {
+		sub.currently_hovered = -1
+		sub.move_hover(1)
+	}
+}
+
+// menu_levels is top and each submenu opened from it, outermost first
+func menu_levels(top *DummyMenuItem) []*DummyMenuItem {
+	levels := []*DummyMenuItem{top}
+	for {
+		kid, ok := levels[len(levels)-1].open_child().(*DummyMenuItem)
+		if !ok {
+			return levels
+		}
+		levels = append(levels, kid)
+	}
+}
+
+// open_levels is the open menu and each submenu opened from it, outermost first
+func (mb *MenuBar) open_levels() []*DummyMenuItem {
+	if mb.currently_open < 0 {
+		return nil
+	}
+	top, ok := mb.TopLevelItems[mb.currently_open].(*DummyMenuItem)
+	if !ok {
+		return nil
+	}
+	return menu_levels(top)
+}
+
+// Activate gives the menu bar keyboard control, highlighting the first menu
+func (mb *MenuBar) Activate() {
+	mb.keyboard_active = true
+	if mb.currently_hovered < 0 && len(mb.TopLevelItems) > 0 {
+		mb.currently_hovered = 0
+	}
+}
+
+// Deactivate hands the keyboard back, the editor notices and refocuses what had it before
+func (mb *MenuBar) Deactivate() {
+	mb.keyboard_active = false
+	mb.currently_hovered = -1
+}
+
+func (mb *MenuBar) IsActive() bool {
+	return mb.keyboard_active
+}
+
+// OpenFromKeyboard opens top level menu i with its first item highlighted
+func (mb *MenuBar) OpenFromKeyboard(i int) {
+	if len(mb.TopLevelItems) == 0 {
+		return
+	}
+	i = (i%len(mb.TopLevelItems) + len(mb.TopLevelItems)) % len(mb.TopLevelItems)
+	mb.Activate()
+	mb.currently_hovered = i
+	mb.Open(i)
+	if top, ok := mb.TopLevelItems[i].(*DummyMenuItem); ok {
+		top.move_hover(1)
+	}
+}
+
+// OpenMnemonic opens whichever top level menu has its mnemonic just pressed, returns false if none did
+func (mb *MenuBar) OpenMnemonic() bool {
+	i := mnemonic_just_pressed(mb.TopLevelItems)
+	if i < 0 {
+		return false
+	}
+	mb.OpenFromKeyboard(i)
+	return true
+}
+
+// activate_item runs item, or opens its submenu if it has one
+func (mb *MenuBar) activate_item(level *DummyMenuItem, item MenuItem) {
+	if item == nil || !selectable(item) {
+		return
+	}
+	if len(item.Children()) > 0 {
+		level.open_submenu()
+		return
+	}
+	mb.Deactivate()
+	mb.Close()
+	item.Execute()
+}
+
+// TakeKeyboard implements Widget
+func (mb *MenuBar) TakeKeyboard() {
+	if !mb.keyboard_active {
+		return
+	}
+	levels := mb.open_levels()
+	if len(levels) == 0 {
+		//just the bar is highlighted
+		switch {
+		case KeyJustPressedOrKeyRepeated(ebiten.KeyLeft):
+			mb.currently_hovered = (mb.currently_hovered - 1 + len(mb.TopLevelItems)) % len(mb.TopLevelItems)
+		case KeyJustPressedOrKeyRepeated(ebiten.KeyRight):
+			mb.currently_hovered = (mb.currently_hovered + 1) % len(mb.TopLevelItems)
+		case inpututil.IsKeyJustPressed(ebiten.KeyDown), inpututil.IsKeyJustPressed(ebiten.KeyEnter), inpututil.IsKeyJustPressed(ebiten.KeySpace):
+			mb.OpenFromKeyboard(mb.currently_hovered)
+		case inpututil.IsKeyJustPressed(ebiten.KeyEscape):
+			mb.Deactivate()
+		default:
+			mb.OpenMnemonic()
+		}
+		return
+	}
+
+	deepest := levels[len(levels)-1]
+	switch {
+	case KeyJustPressedOrKeyRepeated(ebiten.KeyDown):
+		deepest.move_hover(1)
+	case KeyJustPressedOrKeyRepeated(ebiten.KeyUp):
+		deepest.move_hover(-1)
+	case inpututil.IsKeyJustPressed(ebiten.KeyRight):
+		if item := deepest.hovered_item(); item != nil && len(item.Children()) > 0 {
+			mb.activate_item(deepest, item)
+		} else {
+			mb.OpenFromKeyboard(mb.currently_open + 1)
+		}
+	case inpututil.IsKeyJustPressed(ebiten.KeyLeft):
+		if len(levels) > 1 {
+			levels[len(levels)-2].sub_open = false
+		} else {
+			mb.OpenFromKeyboard(mb.currently_open - 1)
+		}
+	case inpututil.IsKeyJustPressed(ebiten.KeyEnter), inpututil.IsKeyJustPressed(ebiten.KeySpace):
+		mb.activate_item(deepest, deepest.hovered_item())
+	case inpututil.IsKeyJustPressed(ebiten.KeyEscape):
+		//one level at a time
+		if len(levels) > 1 {
+			levels[len(levels)-2].sub_open = false
+		} else {
+			mb.Close()
+		}
+	default:
+		if i := mnemonic_just_pressed(deepest.kids); i >= 0 {
+			deepest.currently_hovered = i
+			mb.activate_item(deepest, deepest.kids[i])
+		}
+	}
+}
+
+// MenuBarKeys moves keyboard focus to the menu bar on a lone alt, F10 or alt+mnemonic
+// returns true if it used this frame's keys, nothing else should see them then
+func (g *Editor) MenuBarKeys() bool {
+	mb, ok := g.MainWidget.(*MenuBar)
+	if !ok {
+		return false
+	}
+	//alt on its own toggles the menu bar, alt as part of anything else doesn't
+	if inpututil.IsKeyJustPressed(ebiten.KeyAlt) {
+		g.alt_alone = true
+	}
+	for _, k := range inpututil.AppendPressedKeys(nil) {
+		switch k {
+		case ebiten.KeyAlt, ebiten.KeyAltLeft, ebiten.KeyAltRight:
+		default:
+			g.alt_alone = false
+		}
+	}
+	if ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft) || ebiten.IsMouseButtonPressed(ebiten.MouseButtonRight) {
+		g.alt_alone = false
+	}
+	if inpututil.IsKeyJustReleased(ebiten.KeyAlt) && g.alt_alone {
+		g.alt_alone = false
+		g.ToggleMenuBar(mb)
+		return true
+	}
+
+	no_mods := !ebiten.IsKeyPressed(ebiten.KeyControl) && !ebiten.IsKeyPressed(ebiten.KeyShift) && !ebiten.IsKeyPressed(ebiten.KeyMeta)
+	if no_mods && !ebiten.IsKeyPressed(ebiten.KeyAlt) && inpututil.IsKeyJustPressed(ebiten.KeyF10) {
+		g.ToggleMenuBar(mb)
+		return true
+	}
+	if no_mods && ebiten.IsKeyPressed(ebiten.KeyAlt) && mnemonic_just_pressed(mb.TopLevelItems) >= 0 {
+		g.alt_alone = false
+		g.focus_menu_bar(mb)
+		mb.OpenMnemonic()
+		return true
+	}
+	return false
+}
+
+// ToggleMenuBar gives the menu bar keyboard focus, or hands it back if it already has it
+func (g *Editor) ToggleMenuBar(mb *MenuBar) {
+	if mb.IsActive() {
+		mb.Deactivate()
+		mb.Close()
+		g.ReturnFromMenuBar()
+		return
+	}
+	g.focus_menu_bar(mb)
+	mb.Activate()
+}
+
+func (g *Editor) focus_menu_bar(mb *MenuBar) {
+	if g.last_keyboard_consumer != mb {
+		g.focus_before_menu = g.last_keyboard_consumer
+	}
+	g.Focus(mb)
+}
+
+// ReturnFromMenuBar refocuses whatever had the keyboard before the menu bar took it, once the menu bar is done
+func (g *Editor) ReturnFromMenuBar() {
+	mb, ok := g.last_keyboard_consumer.(*MenuBar)
+	if !ok || mb.IsActive() {
+		return
+	}
+	back := g.focus_before_menu
+	g.focus_before_menu = nil
+	if back != nil && !InTree(g.MainWidget, back) {
+		back = nil
+	}
+	g.Focus(back)
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"image"
+	"image/color"
 
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
@@ -22,6 +23,9 @@ func (ks *KeyShortcut) String() string {
 	if ks.mod_alt {
 		s += "alt + "
 	}
+	if ks.mod_meta {
+		s += "meta + "
+	}
 	if ks.mod_shift {
 		s += "shift + "
 	}
@@ -29,18 +33,38 @@ func (ks *KeyShortcut) String() string {
 	return s
 }
 
+// IsZero is true for the empty shortcut that items without one have
+// (the zero key is A, nobody binds a bare A to a menu item)
+func (ks KeyShortcut) IsZero() bool {
+	return ks == KeyShortcut{}
+}
+
 type MenuItem interface {
 	Text() string
 	Children() []MenuItem
 	Execute()
 	Shortcut() KeyShortcut
+	//disabled items are drawn greyed out and can't be clicked
+	Enabled() bool
 	DrawOpen(target *ebiten.Image, topleft image.Point)
 	SpaceUsed(topleft image.Point) []image.Rectangle
 	MouseOver(x, y int)
+	//ItemAt finds the item under (x, y) in this menu or whichever submenu of it is open
+	ItemAt(x, y int) MenuItem
+}
+
+// Checkable items are toggles, they get a tick drawn next to them when Checked
+type Checkable interface {
+	Checked() bool
 }
 
 var _ MenuItem = &DummyMenuItem{txt: "File"}
+var _ MenuItem = &ActionMenuItem{}
+var _ MenuItem = &ToggleMenuItem{}
+var _ MenuItem = &MenuSeparator{}
+var _ Checkable = &ToggleMenuItem{}
 
+// NewMenuItem makes an item that opens a submenu of children
 func NewMenuItem(name string, children []MenuItem) *DummyMenuItem {
 	return &DummyMenuItem{
 		txt:               name,
@@ -51,10 +75,23 @@ func NewMenuItem(name string, children []MenuItem) *DummyMenuItem {
 	}
 }
 
+// NewDynamicMenuItem makes a submenu whose children are asked for from provider every time it opens
+// for menus listing things that change, like recent files or open tabs
+func NewDynamicMenuItem(name string, provider func() []MenuItem) *DummyMenuItem {
+	dmi := NewMenuItem(name, nil)
+	dmi.provider = provider
+	dmi.Refresh()
+	return dmi
+}
+
 type DummyMenuItem struct {
 	txt               string
 	currently_hovered int
 	width             int
+	check_width       int         //room on the left for ticks, 0 when none of the children can be ticked
+	sub_open          bool        //the hovered child's submenu is showing, the keyboard can highlight an item without opening it
+	sub_topleft       image.Point //where the open submenu goes, worked out in SpaceUsed
+	provider          func() []MenuItem
 	kids              []MenuItem
 	itemrects         []image.Rectangle
 	ks                KeyShortcut
@@ -64,9 +101,10 @@ func (dmi *DummyMenuItem) MouseOver(x, y int) {
 	for i, r := range dmi.itemrects {
 		if image.Pt(x, y).In(r) {
 			dmi.currently_hovered = i
+			dmi.sub_open = true
 		}
 	}
-	if dmi.currently_hovered != -1 {
+	if dmi.currently_hovered >= 0 && dmi.currently_hovered < len(dmi.kids) {
 		dmi.kids[dmi.currently_hovered].MouseOver(x, y)
 	}
 }
@@ -74,7 +112,53 @@ func (dmi *DummyMenuItem) Shortcut() KeyShortcut {
 	return dmi.ks
 }
 func (dmi *DummyMenuItem) Children() []MenuItem {
-	return []MenuItem{}
+	return dmi.kids
+}
+
+// Enabled implements MenuItem
+func (dmi *DummyMenuItem) Enabled() bool {
+	return true
+}
+
+// Refresh asks a dynamic menu's provider for its children again
+// SpaceUsed lays out whatever the children are when it's called, so nothing else needs redoing
+func (dmi *DummyMenuItem) Refresh() {
+	if dmi.provider == nil {
+		return
+	}
+	dmi.kids = dmi.provider()
+	dmi.itemrects = nil
+}
+
+// ResetHover forgets what was hovered so the menu opens fresh next time, dynamic menus get new children
+func (dmi *DummyMenuItem) ResetHover() {
+	dmi.Refresh()
+	dmi.currently_hovered = -1
+	dmi.sub_open = false
+	for _, kid := range dmi.kids {
+		if r, ok := kid.(interface{ ResetHover() }); ok {
+			r.ResetHover()
+		}
+	}
+}
+
+// open_child is the hovered child if it has a submenu to show
+func (dmi *DummyMenuItem) open_child() MenuItem {
+	if !dmi.sub_open || dmi.currently_hovered < 0 || dmi.currently_hovered >= len(dmi.kids) || dmi.currently_hovered >= len(dmi.itemrects) {
+		return nil
+	}
+	kid := dmi.kids[dmi.currently_hovered]
+	if kid == nil || len(kid.Children()) == 0 {
+		return nil
+	}
+	return kid
+}
+
+func menu_row_height(mi MenuItem) int {
+	if _, ok := mi.(*MenuSeparator); ok {
+		return menu_y_padding
+	}
+	return MenuLineHeight() + menu_y_padding*2
 }
 
 // Calculates the size of this menu if it were drawn
@@ -83,30 +167,46 @@ func (dmi *DummyMenuItem) SpaceUsed(topleft image.Point) []image.Rectangle {
 		return []image.Rectangle{}
 	}
 	//Build space used by me (and calculate the boxes used for hovering)
-	text_rect_tops := make([]int, len(dmi.kids))
 	dmi.itemrects = make([]image.Rectangle, len(dmi.kids))
 
-	biggest_width := 0
-	height_needed := 0
-
-	for i := range dmi.kids {
-		text_rect_tops[i] = height_needed
-		text_r := text.BoundString(MenuFontFace, dmi.kids[i].Text())
-		biggest_width = max(biggest_width, text_r.Dx())
-		height_needed += text_r.Dy() + menu_y_padding*2
+	widest_text := 0
+	widest_shortcut := 0
+	has_submenus := false
+	dmi.check_width = 0
+	for _, kid := range dmi.kids {
+		label, _, _ := ParseMnemonic(kid.Text())
+		widest_text = max(widest_text, text.BoundString(MenuFontFace, label).Dx())
+		if ks := kid.Shortcut(); !ks.IsZero() {
+			widest_shortcut = max(widest_shortcut, text.BoundString(MenuFontFace, ks.String()).Dx())
+		}
+		if len(kid.Children()) > 0 {
+			has_submenus = true
+		}
+		if _, ok := kid.(Checkable); ok {
+			dmi.check_width = MenuLineHeight()
+		}
+	}
+	biggest_width := dmi.check_width + widest_text + menu_bar_x_padding*2
+	if widest_shortcut > 0 {
+		biggest_width += menu_x_padding*2 + widest_shortcut
+	}
+	if has_submenus {
+		biggest_width += MenuLineHeight()
 	}
-	biggest_width += menu_bar_x_padding * 2
 	dmi.width = biggest_width
-	box_h := MenuFontSize + menu_y_padding*2
 
-	for i, y := range text_rect_tops {
-		dmi.itemrects[i] = image.Rect(topleft.X, y+topleft.Y, topleft.X+biggest_width, y+box_h+topleft.Y)
+	height_needed := 0
+	for i, kid := range dmi.kids {
+		row_h := menu_row_height(kid)
+		dmi.itemrects[i] = image.Rect(topleft.X, topleft.Y+height_needed, topleft.X+biggest_width, topleft.Y+height_needed+row_h)
+		height_needed += row_h
 	}
 
 	//collect space used by open children
 	var child_rects = []image.Rectangle{}
-	if dmi.currently_hovered >= 0 && dmi.currently_hovered < len(dmi.kids) && dmi.kids[dmi.currently_hovered] != nil {
-		child_rects = dmi.kids[dmi.currently_hovered].SpaceUsed(image.Pt(biggest_width-1, dmi.currently_hovered*(MenuFontSize+menu_y_padding)).Add(topleft))
+	if kid := dmi.open_child(); kid != nil {
+		dmi.sub_topleft = submenu_topleft(kid, dmi.itemrects[dmi.currently_hovered])
+		child_rects = kid.SpaceUsed(dmi.sub_topleft)
 	}
 	my_space := append(child_rects, image.Rect(topleft.X, topleft.Y, topleft.X+biggest_width, topleft.Y+height_needed))
 	return my_space
@@ -114,35 +214,204 @@ func (dmi *DummyMenuItem) SpaceUsed(topleft image.Point) []image.Rectangle {
 
 // just draws the text/content of the menu, drawing the background box is taken care of in menubar.Draw
 func (dmi *DummyMenuItem) DrawOpen(target *ebiten.Image, topleft image.Point) {
-	if len(dmi.kids) == 0 {
+	if len(dmi.kids) == 0 || len(dmi.itemrects) != len(dmi.kids) {
 		return
 	}
 
-	start := topleft
 	for i, mi := range dmi.kids {
-
-		if dmi.currently_hovered == i {
+		r := dmi.itemrects[i]
+		if _, ok := mi.(*MenuSeparator); ok {
+			mid_y := float64(r.Min.Y + r.Dy()/2)
+			ebitenutil.DrawLine(target, float64(r.Min.X+menu_x_padding), mid_y, float64(r.Max.X-menu_x_padding), mid_y, Style.FGColorMuted)
+			continue
+		}
+		enabled := mi.Enabled()
+		text_col := Style.FGColorStrong
+		if !enabled {
+			text_col = Style.Gray
+		}
+		if dmi.currently_hovered == i && enabled {
 			//draw this one brighter
-			DrawRect(target, dmi.itemrects[i].Inset(1), Style.BGColorStrong)
-			dmi.kids[dmi.currently_hovered].DrawOpen(target, image.Pt(start.X+dmi.width, start.Y))
+			DrawRect(target, r.Inset(1), Style.BGColorStrong)
 		}
-		text.Draw(target, mi.Text(), MenuFontFace, start.X+menu_x_padding, start.Y+MenuFontPeriodFromTop+tab_y_padding, Style.FGColorStrong)
-
-		start.Y += MenuFontSize + menu_y_padding*2
+		if c, ok := mi.(Checkable); ok && c.Checked() {
+			draw_tick(target, image.Rect(r.Min.X+menu_x_padding/2, r.Min.Y+menu_y_padding, r.Min.X+menu_x_padding/2+dmi.check_width, r.Max.Y-menu_y_padding), text_col)
+		}
+		DrawMenuLabel(target, mi.Text(), image.Pt(r.Min.X+menu_x_padding+dmi.check_width, r.Min.Y+MenuFontPeriodFromTop+menu_y_padding), text_col)
 
+		if ks := mi.Shortcut(); !ks.IsZero() {
+			label := ks.String()
+			label_width := text.BoundString(MenuFontFace, label).Dx()
+			text.Draw(target, label, MenuFontFace, r.Max.X-menu_x_padding-label_width, r.Min.Y+MenuFontPeriodFromTop+menu_y_padding, Style.FGColorMuted)
+		}
+		if len(mi.Children()) > 0 {
+			//arrow pointing at the submenu
+			arrow := image.Rect(r.Max.X-menu_x_padding-MenuLineHeight()/2, r.Min.Y+menu_y_padding+MenuLineHeight()/4, r.Max.X-menu_x_padding, r.Max.Y-menu_y_padding-MenuLineHeight()/4)
+			ebitenutil.DrawLine(target, float64(arrow.Min.X), float64(arrow.Min.Y), float64(arrow.Max.X), float64(arrow.Min.Y+arrow.Dy()/2), text_col)
+			ebitenutil.DrawLine(target, float64(arrow.Max.X), float64(arrow.Min.Y+arrow.Dy()/2), float64(arrow.Min.X), float64(arrow.Max.Y), text_col)
+		}
 	}
+	//open submenu goes over the top of everything else
+	if kid := dmi.open_child(); kid != nil {
+		kid.DrawOpen(target, dmi.sub_topleft)
+	}
+}
 
+// ItemAt implements MenuItem
+func (dmi *DummyMenuItem) ItemAt(x, y int) MenuItem {
+	if kid := dmi.open_child(); kid != nil {
+		if item := kid.ItemAt(x, y); item != nil {
+			return item
+		}
+	}
+	for i, r := range dmi.itemrects {
+		if i < len(dmi.kids) && image.Pt(x, y).In(r) {
+			return dmi.kids[i]
+		}
+	}
+	return nil
 }
 
-// Execute implements MenuItem
+// Execute implements MenuItem, items with a submenu open it on hover instead
 func (dmi *DummyMenuItem) Execute() {
-	panic("unimplemented")
 }
 
 // Text implements MenuItem
 func (dmi *DummyMenuItem) Text() string {
 	return dmi.txt
 }
+
+func draw_tick(target *ebiten.Image, r image.Rectangle, col color.Color) {
+	mid_x := float64(r.Min.X + r.Dx()/3)
+	ebitenutil.DrawLine(target, float64(r.Min.X), float64(r.Min.Y+r.Dy()/2), mid_x, float64(r.Max.Y), col)
+	ebitenutil.DrawLine(target, mid_x, float64(r.Max.Y), float64(r.Max.X), float64(r.Min.Y), col)
+}
+
+// NewActionMenuItem makes an item that runs action when clicked or when ks is pressed
+// a nil action makes an item that's always disabled, for things that aren't hooked up yet
+func NewActionMenuItem(name string, ks KeyShortcut, action func()) *ActionMenuItem {
+	return &ActionMenuItem{
+		txt:    name,
+		ks:     ks,
+		action: action,
+	}
+}
+
+// ActionMenuItem is a leaf of the menu that does something
+type ActionMenuItem struct {
+	txt     string
+	ks      KeyShortcut
+	action  func()
+	enabled func() bool //nil means enabled whenever there's an action
+}
+
+// WhenEnabled makes the item only clickable while pred is true
+func (ami *ActionMenuItem) WhenEnabled(pred func() bool) *ActionMenuItem {
+	ami.enabled = pred
+	return ami
+}
+
+// Text implements MenuItem
+func (ami *ActionMenuItem) Text() string {
+	return ami.txt
+}
+
+// Children implements MenuItem
+func (*ActionMenuItem) Children() []MenuItem {
+	return nil
+}
+
+// Execute implements MenuItem
+func (ami *ActionMenuItem) Execute() {
+	if ami.Enabled() {
+		ami.action()
+	}
+}
+
+// Shortcut implements MenuItem
+func (ami *ActionMenuItem) Shortcut() KeyShortcut {
+	return ami.ks
+}
+
+// Enabled implements MenuItem
+func (ami *ActionMenuItem) Enabled() bool {
+	if ami.action == nil {
+		return false
+	}
+	return ami.enabled == nil || ami.enabled()
+}
+
+// DrawOpen implements MenuItem, there's nothing to open
+func (*ActionMenuItem) DrawOpen(target *ebiten.Image, topleft image.Point) {
+}
+
+// SpaceUsed implements MenuItem
+func (*ActionMenuItem) SpaceUsed(topleft image.Point) []image.Rectangle {
+	return []image.Rectangle{}
+}
+
+// MouseOver implements MenuItem
+func (*ActionMenuItem) MouseOver(x, y int) {
+}
+
+// ItemAt implements MenuItem, our row belongs to the parent menu
+func (*ActionMenuItem) ItemAt(x, y int) MenuItem {
+	return nil
+}
+
+// NewToggleMenuItem makes an item with a tick next to it while checked is true, clicking it runs toggle
+func NewToggleMenuItem(name string, ks KeyShortcut, checked func() bool, toggle func()) *ToggleMenuItem {
+	return &ToggleMenuItem{
+		ActionMenuItem: ActionMenuItem{txt: name, ks: ks, action: toggle},
+		checked:        checked,
+	}
+}
+
+type ToggleMenuItem struct {
+	ActionMenuItem
+	checked func() bool
+}
+
+// WhenEnabled is ActionMenuItem's, returning the toggle so it keeps its tick
+func (tmi *ToggleMenuItem) WhenEnabled(pred func() bool) *ToggleMenuItem {
+	tmi.enabled = pred
+	return tmi
+}
+
+// Checked implements Checkable
+func (tmi *ToggleMenuItem) Checked() bool {
+	return tmi.checked != nil && tmi.checked()
+}
+
+// MenuSeparator is the line between groups of items
+type MenuSeparator struct {
+	ActionMenuItem
+}
+
+func NewMenuSeparator() *MenuSeparator {
+	return &MenuSeparator{}
+}
+
+// CollectShortcuts adds the shortcut of every item under items to shortcuts
+// ShortcutGrabber is a widget that wants some keys for itself while it has focus, even ones that are shortcuts
+type ShortcutGrabber interface {
+	GrabsShortcut(ks KeyShortcut) bool
+}
+
+func CollectShortcuts(items []MenuItem, shortcuts map[KeyShortcut]func()) {
+	for _, item := range items {
+		item := item
+		if ks := item.Shortcut(); !ks.IsZero() && len(item.Children()) == 0 {
+			shortcuts[ks] = func() {
+				if item.Enabled() {
+					item.Execute()
+				}
+			}
+		}
+		CollectShortcuts(item.Children(), shortcuts)
+	}
+}
+
 func NewMenuBar(Items []MenuItem, SubWidget Widget) *MenuBar {
 	return &MenuBar{
 		currently_hovered: -1,
@@ -158,28 +427,33 @@ type MenuBar struct {
 	currently_open    int
 	TopLevelRects     []image.Rectangle
 	TopLevelItems     []MenuItem
+	keyboard_active   bool //the menu bar has keyboard focus, from alt or F10
 
 	WidgetIApplyTo Widget
 }
 
 // Title implements Widget
 func (*MenuBar) Title() string {
-	panic("unimplemented")
+	return "menu bar"
 }
 
 // KeyboardFocusLost implements Widget
-func (te *MenuBar) KeyboardFocusLost() {
-
-}
-
-// TakeKeyboard implements Widget
-func (mb *MenuBar) TakeKeyboard() {
+func (mb *MenuBar) KeyboardFocusLost() {
+	if mb.keyboard_active {
+		mb.keyboard_active = false
+		mb.currently_hovered = -1
+		mb.Close()
+	}
 }
 
 // MouseOut implements Widget
 func (mb *MenuBar) MouseOut() {
+	//menus opened from the keyboard stay open when the mouse wanders off
+	if mb.keyboard_active {
+		return
+	}
 	mb.currently_hovered = -1
-	mb.currently_open = -1
+	mb.Close()
 }
 
 // Draw implements Widget
@@ -210,7 +484,7 @@ func (mb *MenuBar) Draw(target *ebiten.Image) {
 		}
 		ebitenutil.DrawRect(target, float64(my_r.Min.X), float64(my_r.Min.Y), float64(my_r.Dx()), float64(my_r.Dy()), my_c)
 
-		text.Draw(target, mb.TopLevelItems[i].Text(), MenuFontFace, my_r.Min.X+menu_bar_x_padding, my_r.Min.Y+MenuFontPeriodFromTop+menu_bar_y_padding, Style.FGColorStrong)
+		DrawMenuLabel(target, mb.TopLevelItems[i].Text(), image.Pt(my_r.Min.X+menu_bar_x_padding, my_r.Min.Y+MenuFontPeriodFromTop+menu_bar_y_padding), Style.FGColorStrong)
 
 		if i == mb.currently_open {
 			mb.TopLevelItems[i].DrawOpen(target, BottomLeft(my_r))
@@ -220,77 +494,180 @@ func (mb *MenuBar) Draw(target *ebiten.Image) {
 
 }
 
+// Open shows top level menu i, -1 closes whatever is open
+func (mb *MenuBar) Open(i int) {
+	if i >= 0 && i < len(mb.TopLevelItems) {
+		if r, ok := mb.TopLevelItems[i].(interface{ ResetHover() }); ok {
+			r.ResetHover()
+		}
+	} else {
+		i = -1
+	}
+	mb.currently_open = i
+}
+
+// Close shuts any open menu
+func (mb *MenuBar) Close() {
+	mb.Open(-1)
+}
+
+// menu_space is the area covered by the open menu and its open submenus
+func (mb *MenuBar) menu_space() []image.Rectangle {
+	if mb.currently_open < 0 {
+		return []image.Rectangle{}
+	}
+	return mb.TopLevelItems[mb.currently_open].SpaceUsed(BottomLeft(mb.TopLevelRects[mb.currently_open]))
+}
+
+func (mb *MenuBar) in_menu_space(x, y int) bool {
+	for _, r := range mb.menu_space() {
+		if image.Pt(x, y).In(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// Menu clicks return nil so keyboard focus stays with whatever the menu action is going to act on
+
 // LMouseDown implements Widget
 func (mb *MenuBar) LMouseDown(x int, y int) Widget {
-	split_y_ss := mb.Rectangle.Min.Y + MenuFontSize + 2*menu_bar_y_padding
+	split_y_ss := mb.Rectangle.Min.Y + MenuLineHeight() + 2*menu_bar_y_padding
 	if y < split_y_ss { // captured by the menu
 		for i, r := range mb.TopLevelRects {
-			if image.Pt(x, y).In(r) { //clicked onto menu item, open it
-				mb.currently_open = i
+			if image.Pt(x, y).In(r) { //clicked onto menu item, open it (or close it if it's open)
+				if mb.currently_open == i {
+					mb.Close()
+				} else {
+					mb.Open(i)
+				}
 			}
 		}
-		return mb
+		return nil
 	}
-	if mb.WidgetIApplyTo != nil {
-		return mb.WidgetIApplyTo.LMouseDown(x, y)
+	if mb.in_menu_space(x, y) {
+		//wait for the button to come up to do anything
+		return nil
 	}
-	return nil
+	//clicking anywhere else closes the menu
+	mb.Close()
+	return DispatchLMouseDown(mb.Children(), x, y, nil)
 }
 
 // LMouseUp implements Widget
 func (mb *MenuBar) LMouseUp(x int, y int) Widget {
-	split_y_ss := mb.Rectangle.Min.Y + MenuFontSize + 2*menu_bar_y_padding
+	split_y_ss := mb.Rectangle.Min.Y + MenuLineHeight() + 2*menu_bar_y_padding
 	if y < split_y_ss {
-		return mb
+		return nil
 	}
-	if mb.WidgetIApplyTo != nil {
-		return mb.WidgetIApplyTo.LMouseUp(x, y)
+	if mb.in_menu_space(x, y) {
+		item := mb.TopLevelItems[mb.currently_open].ItemAt(x, y)
+		if item != nil && len(item.Children()) == 0 && item.Enabled() {
+			mb.Deactivate()
+			mb.Close()
+			item.Execute()
+		}
+		return nil
 	}
-	return nil
+	return DispatchLMouseUp(mb.Children(), x, y, nil)
+}
+
+// over_menus is true when (x, y) is on the bar or an open menu, where only the left button does anything
+func (mb *MenuBar) over_menus(x, y int) bool {
+	split_y_ss := mb.Rectangle.Min.Y + MenuLineHeight() + 2*menu_bar_y_padding
+	return y < split_y_ss || mb.in_menu_space(x, y)
+}
+
+// RMouseDown implements Widget
+func (mb *MenuBar) RMouseDown(x int, y int) Widget {
+	if mb.over_menus(x, y) {
+		return nil
+	}
+	mb.Close()
+	return DispatchRMouseDown(mb.Children(), x, y, nil)
+}
+
+// RMouseUp implements Widget
+func (mb *MenuBar) RMouseUp(x int, y int) Widget {
+	if mb.over_menus(x, y) {
+		return nil
+	}
+	return DispatchRMouseUp(mb.Children(), x, y, nil)
+}
+
+// MMouseDown implements Widget
+func (mb *MenuBar) MMouseDown(x int, y int) Widget {
+	if mb.over_menus(x, y) {
+		return nil
+	}
+	return DispatchMMouseDown(mb.Children(), x, y, nil)
+}
+
+// MMouseUp implements Widget
+func (mb *MenuBar) MMouseUp(x int, y int) Widget {
+	if mb.over_menus(x, y) {
+		return nil
+	}
+	return DispatchMMouseUp(mb.Children(), x, y, nil)
 }
 
 // MouseOver implements Widget
 func (mb *MenuBar) MouseOver(x int, y int) Widget {
 	ebiten.SetCursorShape(ebiten.CursorShapeDefault)
-	split_y_ss := mb.Rectangle.Min.Y + MenuFontSize + 2*menu_bar_y_padding
+	split_y_ss := mb.Rectangle.Min.Y + MenuLineHeight() + 2*menu_bar_y_padding
 	if y < split_y_ss {
 		for i, r := range mb.TopLevelRects {
 			if image.Pt(x, y).In(r) {
 				mb.currently_hovered = i
 				//If we have a menu item open and move our mouse to the next menu item, show that one
 				if mb.currently_open != -1 && mb.currently_hovered != mb.currently_open {
-					mb.currently_open = mb.currently_hovered
+					mb.Open(mb.currently_hovered)
 				}
 			}
 		}
 		return mb
 	}
 	//mouse in an open menu
-	sub_menu_space := []image.Rectangle{}
-	if mb.currently_open >= 0 {
-		top_level_rect := mb.TopLevelRects[mb.currently_open]
-		top_left_of_open_menu := image.Pt(top_level_rect.Min.X, top_level_rect.Max.Y)
-		sub_menu_space = mb.TopLevelItems[mb.currently_open].SpaceUsed(top_left_of_open_menu)
+	if mb.in_menu_space(x, y) {
+		mb.TopLevelItems[mb.currently_open].MouseOver(x, y)
+		return mb
 	}
-	for i := range sub_menu_space {
-		if image.Pt(x, y).In(sub_menu_space[i]) {
-			mb.TopLevelItems[mb.currently_open].MouseOver(x, y)
+	return DispatchMouseOver(mb.Children(), x, y, nil)
+}
 
-			return mb
-		}
-		//if we got here, mouse is out
+// Shortcuts is every key shortcut in the menus mapped to what it does
+func (mb *MenuBar) Shortcuts() map[KeyShortcut]func() {
+	shortcuts := map[KeyShortcut]func(){}
+	CollectShortcuts(mb.TopLevelItems, shortcuts)
+	return shortcuts
+}
 
+// Bounds implements Widget, the embedded Rectangle is only the bar itself so add the widget under it
+func (mb *MenuBar) Bounds() image.Rectangle {
+	if mb.WidgetIApplyTo == nil {
+		return mb.Rectangle
 	}
-	if mb.WidgetIApplyTo != nil {
-		return mb.WidgetIApplyTo.MouseOver(x, y)
+	return mb.Rectangle.Union(mb.WidgetIApplyTo.Bounds())
+}
+
+// Children implements Container
+func (mb *MenuBar) Children() []Widget {
+	return []Widget{mb.WidgetIApplyTo}
+}
+
+// ReplaceChild implements Container
+func (mb *MenuBar) ReplaceChild(old, new Widget) bool {
+	if mb.WidgetIApplyTo != old {
+		return false
 	}
-	return nil
+	mb.WidgetIApplyTo = new
+	return true
 }
 
 // SetRect implements Widget
 func (mb *MenuBar) SetRect(rect image.Rectangle) {
 	//consume the top bit for me
-	split_y := rect.Min.Y + MenuFontSize + 2*menu_bar_y_padding
+	split_y := rect.Min.Y + MenuLineHeight() + 2*menu_bar_y_padding
 	mb.Rectangle = image.Rectangle{
 		Min: rect.Min,
 		Max: image.Point{rect.Max.X, split_y},
@@ -303,7 +680,8 @@ func (mb *MenuBar) SetRect(rect image.Rectangle) {
 	y_start := mb.Min.Y
 	y_end := mb.Max.Y
 	for i, item := range mb.TopLevelItems {
-		width_needed := text.BoundString(MenuFontFace, item.Text()).Dx() + 2*menu_bar_x_padding
+		label, _, _ := ParseMnemonic(item.Text())
+		width_needed := text.BoundString(MenuFontFace, label).Dx() + 2*menu_bar_x_padding
 
 		mb.TopLevelRects[i] = image.Rect(start_x, y_start, start_x+width_needed, y_end)
 		start_x += width_needed
@@ -0,0 +1,18 @@
+package main
+
+import "testing"
+
+func TestToggleWhenEnabledKeepsTick(t *testing.T) {
+	on, enabled := true, false
+	var item MenuItem = NewToggleMenuItem("&Thing", KeyShortcut{}, func() bool { return on }, func() { on = !on }).WhenEnabled(func() bool { return enabled })
+	c, ok := item.(Checkable)
+	if !ok {
+		t.Fatalf("toggle with WhenEnabled isn't Checkable any more")
+	}
+	if !c.Checked() {
+		t.Errorf("toggle isn't checked while its state is on")
+	}
+	if item.(*ToggleMenuItem).enabled() {
+		t.Errorf("predicate wasn't kept")
+	}
+}
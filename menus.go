@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// Menus builds the menu bar's contents, the shortcuts shown here are the ones that work everywhere
+func (g *Editor) Menus() []MenuItem {
+	has_editor := g.HasFocusedEditor
+	has_tabs := func() bool { return g.TargetTabs() != nil }
+	not_running := func() bool { return !g.TaskRunning() }
+
+	return []MenuItem{
+		NewMenuItem("&File", []MenuItem{
+			NewActionMenuItem("&Save", KeyShortcut{mod_ctrl: true, key: ebiten.KeyS}, g.SaveFocused).WhenEnabled(has_editor),
+			NewActionMenuItem("Save &as", KeyShortcut{mod_ctrl: true, mod_shift: true, key: ebiten.KeyS}, g.SaveFocusedAs).WhenEnabled(has_editor),
+			NewActionMenuItem("&Open", KeyShortcut{mod_ctrl: true, key: ebiten.KeyO}, g.OpenFileDialog),
+			NewDynamicMenuItem("Open &Recent", g.recent_files_menu),
+			NewActionMenuItem("&Close", KeyShortcut{mod_ctrl: true, key: ebiten.KeyW}, g.CloseFocusedTab).WhenEnabled(has_tabs),
+			NewMenuSeparator(),
+			NewActionMenuItem("Se&ttings", KeyShortcut{mod_ctrl: true, key: ebiten.KeyComma}, g.OpenSettings).WhenEnabled(has_tabs),
+			NewMenuSeparator(),
+			NewActionMenuItem("&Quit", KeyShortcut{mod_ctrl: true, key: ebiten.KeyQ}, g.SetShouldClose),
+		}),
+		NewMenuItem("&Edit", []MenuItem{
+			NewActionMenuItem("&Copy", KeyShortcut{mod_ctrl: true, key: ebiten.KeyC}, g.EditorCommand((*TextEditor).Copy)).WhenEnabled(has_editor),
+			NewActionMenuItem("Cu&t", KeyShortcut{mod_ctrl: true, key: ebiten.KeyX}, g.EditorCommand((*TextEditor).Cut)).WhenEnabled(has_editor),
+			NewActionMenuItem("&Paste", KeyShortcut{mod_ctrl: true, key: ebiten.KeyV}, g.EditorCommand((*TextEditor).Paste)).WhenEnabled(has_editor),
+		}),
+		NewMenuItem("&View", []MenuItem{
+			NewToggleMenuItem("&Fullscreen", KeyShortcut{key: ebiten.KeyF11}, ebiten.IsFullscreen, ToggleFullscreen),
+			NewMenuSeparator(),
+			NewActionMenuItem("&Problems", KeyShortcut{mod_ctrl: true, mod_shift: true, key: ebiten.KeyM}, g.ShowProblems),
+			NewActionMenuItem("Ter&minal", KeyShortcut{mod_ctrl: true, key: ebiten.KeyGraveAccent}, g.ShowTerminal),
+			NewActionMenuItem("&New Terminal", KeyShortcut{mod_ctrl: true, mod_shift: true, key: ebiten.KeyGraveAccent}, g.OpenTerminal),
+			NewMenuSeparator(),
+			NewActionMenuItem("Split &Right", KeyShortcut{mod_ctrl: true, key: ebiten.KeyBackslash}, g.SplitRight).WhenEnabled(has_editor),
+			NewActionMenuItem("Split &Down", KeyShortcut{mod_ctrl: true, mod_shift: true, key: ebiten.KeyBackslash}, g.SplitDown).WhenEnabled(has_editor),
+			NewMenuSeparator(),
+			NewDynamicMenuItem("S&yntax", g.syntax_menu),
+			NewDynamicMenuItem("&Theme", g.theme_menu),
+			NewToggleMenuItem("&Ligatures", KeyShortcut{}, func() bool { return ligatures }, g.ToggleLigatures).WhenEnabled(func() bool { return code_shaping_face != nil }),
+			NewMenuSeparator(),
+			NewActionMenuItem("&Bigger Text", KeyShortcut{mod_ctrl: true, mod_shift: true, key: ebiten.KeyEqual}, g.IncreaseFontSize),
+			NewActionMenuItem("&Smaller Text", KeyShortcut{mod_ctrl: true, key: ebiten.KeyMinus}, g.DecreaseFontSize),
+		}),
+		NewMenuItem("&Run", []MenuItem{
+			NewActionMenuItem("&Build", KeyShortcut{mod_ctrl: true, mod_shift: true, key: ebiten.KeyB}, func() { g.RunTask("Build") }).WhenEnabled(not_running),
+			NewActionMenuItem("&Test", KeyShortcut{}, func() { g.RunTask("Test") }).WhenEnabled(not_running),
+			NewActionMenuItem("&Run", KeyShortcut{mod_ctrl: true, key: ebiten.KeyF5}, func() { g.RunTask("Run") }).WhenEnabled(not_running),
+			NewDynamicMenuItem("Ta&sks", g.tasks_menu),
+			NewMenuSeparator(),
+			NewActionMenuItem("Test E&xplorer", KeyShortcut{}, g.ShowTestExplorer),
+			NewActionMenuItem("Run &All Tests", KeyShortcut{}, g.RunAllTests).WhenEnabled(not_running),
+			NewActionMenuItem("Run Test at C&ursor", KeyShortcut{mod_ctrl: true, mod_shift: true, key: ebiten.KeyT}, g.RunTestAtCursor).WhenEnabled(func() bool { return has_editor() && not_running() }),
+			NewToggleMenuItem("Show Co&verage", KeyShortcut{}, func() bool { return show_coverage }, ToggleCoverage),
+			NewMenuSeparator(),
+			NewActionMenuItem("R&e-run", KeyShortcut{mod_ctrl: true, mod_shift: true, key: ebiten.KeyR}, g.RerunTask).WhenEnabled(g.HasTask),
+			NewActionMenuItem("&Cancel", KeyShortcut{mod_ctrl: true, key: ebiten.KeyPause}, g.CancelTask).WhenEnabled(g.TaskRunning),
+			NewMenuSeparator(),
+			NewActionMenuItem("Show &Output", KeyShortcut{}, func() { g.Focus(g.ShowOutput()) }),
+		}),
+		NewMenuItem("&Debug", []MenuItem{
+			NewActionMenuItem("&Start or Continue", KeyShortcut{key: ebiten.KeyF5}, g.StartDebugging).WhenEnabled(func() bool { return !Debugging() || DebugIsStopped() }),
+			NewActionMenuItem("S&top", KeyShortcut{mod_shift: true, key: ebiten.KeyF5}, StopDebugging).WhenEnabled(Debugging),
+			NewActionMenuItem("&Pause", KeyShortcut{key: ebiten.KeyF6}, with_session((*DebugSession).Pause)).WhenEnabled(func() bool { return Debugging() && !DebugIsStopped() }),
+			NewMenuSeparator(),
+			NewActionMenuItem("Step &Into", KeyShortcut{key: ebiten.KeyF7}, with_session((*DebugSession).StepIn)).WhenEnabled(DebugIsStopped),
+			NewActionMenuItem("Step &Over", KeyShortcut{key: ebiten.KeyF8}, with_session((*DebugSession).StepOver)).WhenEnabled(DebugIsStopped),
+			NewActionMenuItem("Step O&ut", KeyShortcut{mod_shift: true, key: ebiten.KeyF8}, with_session((*DebugSession).StepOut)).WhenEnabled(DebugIsStopped),
+			NewMenuSeparator(),
+			NewActionMenuItem("Toggle &Breakpoint", KeyShortcut{key: ebiten.KeyF9}, g.ToggleBreakpointAtCursor).WhenEnabled(has_editor),
+			NewActionMenuItem("Breakpoint Co&ndition...", KeyShortcut{}, g.EditBreakpointCondition).WhenEnabled(has_editor),
+			NewActionMenuItem("&Remove All Breakpoints", KeyShortcut{}, g.RemoveAllBreakpoints).WhenEnabled(func() bool { return len(breakpoints) > 0 }),
+			NewMenuSeparator(),
+			NewActionMenuItem("&Call Stack", KeyShortcut{}, g.ShowCallStack),
+			NewActionMenuItem("&Variables", KeyShortcut{}, g.ShowVariables),
+			NewActionMenuItem("Debug Conso&le", KeyShortcut{}, func() { g.Focus(g.ShowDebugConsole()) }),
+		}),
+		NewDynamicMenuItem("&Window", g.window_menu),
+		NewMenuItem("&Code", []MenuItem{
+			NewMenuItem("&Go To", []MenuItem{
+				NewActionMenuItem("Symbol &Definition", KeyShortcut{key: ebiten.KeyF12}, g.GoToDefinition).WhenEnabled(has_editor),
+				NewActionMenuItem("&Peek Definition", KeyShortcut{mod_alt: true, key: ebiten.KeyF12}, g.PeekDefinition).WhenEnabled(has_editor),
+				NewActionMenuItem("&References", KeyShortcut{mod_shift: true, key: ebiten.KeyF12}, g.FindReferences).WhenEnabled(has_editor),
+				NewMenuSeparator(),
+				NewActionMenuItem("&Back", KeyShortcut{mod_alt: true, key: ebiten.KeyLeft}, g.GoBack).WhenEnabled(g.CanGoBack),
+				NewActionMenuItem("&Forward", KeyShortcut{mod_alt: true, key: ebiten.KeyRight}, g.GoForward).WhenEnabled(g.CanGoForward),
+			}),
+			NewMenuSeparator(),
+			NewActionMenuItem("&Format Document", KeyShortcut{mod_shift: true, mod_alt: true, key: ebiten.KeyF}, g.FormatFocused).WhenEnabled(g.HasFormatter),
+			NewMenuSeparator(),
+			NewActionMenuItem("Run go &vet", KeyShortcut{}, g.RunGoVet),
+			NewActionMenuItem("Run go &build", KeyShortcut{}, g.RunGoBuild),
+			NewActionMenuItem("Run &Linter", KeyShortcut{}, g.RunLinter).WhenEnabled(g.HasLinter),
+			NewMenuSeparator(),
+			NewActionMenuItem("&Restart Language Server", KeyShortcut{}, g.RestartLanguageServer).WhenEnabled(g.HasLanguageServer),
+		}),
+	}
+}
+
+// The dynamic menus, these get asked for their items every time they open
+
+func (g *Editor) recent_files_menu() []MenuItem {
+	items := []MenuItem{}
+	for i, path := range LoadRecentFiles() {
+		path := path
+		label := EscapeMnemonic(filepath.Base(path)) + "  " + EscapeMnemonic(filepath.Dir(path))
+		if i < 9 {
+			label = fmt.Sprintf("&%d ", i+1) + label
+		}
+		items = append(items, NewActionMenuItem(label, KeyShortcut{}, func() { g.OpenRecent(path) }))
+	}
+	if len(items) == 0 {
+		return []MenuItem{NewActionMenuItem("No Recent Files", KeyShortcut{}, nil)}
+	}
+	clear := func() { SaveRecentFiles(nil) }
+	return append(items, NewMenuSeparator(), NewActionMenuItem("&Clear Recent", KeyShortcut{}, clear))
+}
+
+// window_menu lists every open tab, group by group
+func (g *Editor) window_menu() []MenuItem {
+	items := []MenuItem{}
+	Walk(g.MainWidget, func(w Widget) {
+		tabs, ok := w.(*Tabs)
+		if !ok || len(tabs.Tabs) == 0 {
+			return
+		}
+		if len(items) > 0 {
+			items = append(items, NewMenuSeparator())
+		}
+		for _, tab := range tabs.Tabs {
+			tab := tab
+			focused := func() bool { return g.Focused() == tab }
+			items = append(items, NewToggleMenuItem(EscapeMnemonic(tab.Title()), KeyShortcut{}, focused, func() { g.ShowTab(tabs, tab) }))
+		}
+	})
+	if len(items) == 0 {
+		return []MenuItem{NewActionMenuItem("No Open Tabs", KeyShortcut{}, nil)}
+	}
+	return items
+}
+
+// syntax_menu switches the focused editor between every highlighter we parsed
+func (g *Editor) syntax_menu() []MenuItem {
+	te := g.FocusedEditor()
+	if te == nil {
+		return []MenuItem{NewActionMenuItem("No Editor Focused", KeyShortcut{}, nil)}
+	}
+	items := []MenuItem{
+		NewToggleMenuItem("&Plain Text", KeyShortcut{}, func() bool { return te.highlighter == nil }, func() { te.SetHighlighter(nil) }),
+		NewMenuSeparator(),
+	}
+	for i := range definitions {
+		hl := &definitions[i]
+		if hl.name == "" {
+			continue
+		}
+		using := func() bool { return te.highlighter == hl }
+		items = append(items, NewToggleMenuItem(EscapeMnemonic(hl.name), KeyShortcut{}, using, func() { te.SetHighlighter(hl) }))
+	}
+	return items
+}
+
+// theme_menu switches between the built in themes and the ones in ThemeDir
+func (g *Editor) theme_menu() []MenuItem {
+	items := []MenuItem{}
+	for _, info := range AvailableThemes() {
+		id := info.ID
+		using := func() bool { return CurrentThemeID() == id }
+		items = append(items, NewToggleMenuItem(EscapeMnemonic(info.Name), KeyShortcut{}, using, func() { g.SetTheme(id) }))
+	}
+	return append(items,
+		NewMenuSeparator(),
+		NewActionMenuItem("&Customize Current Theme", KeyShortcut{}, g.CustomizeTheme),
+		NewActionMenuItem("&Import .tmTheme", KeyShortcut{}, g.ImportThemeDialog),
+		NewActionMenuItem("&Reload", KeyShortcut{}, func() { g.SetTheme(CurrentThemeID()) }),
+	)
+}
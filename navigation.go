@@ -0,0 +1,372 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Jumping around the code, to definitions and references, with a history to go back and forward through
+// a language server answers when there's one for the file, otherwise we make do with searching the file
+
+// how many jumps back are remembered
+const nav_history_limit = 100
+
+// NavLocation is a spot in a file, buf is only set for buffers that have no file
+type NavLocation struct {
+	Path   string
+	buf    *TextBuffer
+	Cursor Cursor
+}
+
+func (loc NavLocation) String() string {
+	name := loc.Path
+	if name == "" {
+		name = "untitled"
+	}
+	return fmt.Sprintf("%s:%d", name, loc.Cursor.row+1)
+}
+
+// Jumper widgets ask the editor to jump somewhere, like a results panel does when a result is clicked
+type Jumper interface {
+	//TakeJumpRequest returns where the widget wants to go since it was last asked, if anywhere
+	TakeJumpRequest() (loc NavLocation, ok bool)
+}
+
+// here is where the focused editor's cursor is
+func (g *Editor) here() (NavLocation, bool) {
+	te := g.FocusedEditor()
+	if te == nil {
+		return NavLocation{}, false
+	}
+	return location_in(te.buf, te.cursor), true
+}
+
+func location_in(tb *TextBuffer, c Cursor) NavLocation {
+	if tb.filepath == "" {
+		return NavLocation{buf: tb, Cursor: c}
+	}
+	return NavLocation{Path: tb.filepath, Cursor: c}
+}
+
+func push_location(stack []NavLocation, loc NavLocation) []NavLocation {
+	stack = append(stack, loc)
+	if len(stack) > nav_history_limit {
+		stack = stack[len(stack)-nav_history_limit:]
+	}
+	return stack
+}
+
+// JumpTo shows loc in an editor, remembering where we were so GoBack can return there
+func (g *Editor) JumpTo(loc NavLocation) {
+	from, ok := g.here()
+	if !g.show_location(loc) {
+		return
+	}
+	if ok && from != loc {
+		g.nav_back = push_location(g.nav_back, from)
+		g.nav_forward = nil
+	}
+}
+
+// show_location moves the cursor to loc, in the focused editor if it has the file or in a tab for it if not
+func (g *Editor) show_location(loc NavLocation) bool {
+	te := g.FocusedEditor()
+	if te == nil || !loc.in(te.buf) {
+		te = nil
+		Walk(g.MainWidget, func(w Widget) {
+			if found, ok := w.(*TextEditor); ok && te == nil && loc.in(found.buf) {
+				te = found
+			}
+		})
+		if te != nil {
+			if tabs, ok := FindParent(g.MainWidget, te).(*Tabs); ok {
+				tabs.Select(tabs.IndexOf(te))
+			}
+			g.Focus(te)
+		}
+	}
+	if te == nil {
+		if loc.Path == "" {
+			return false
+		}
+		if err := g.OpenFile(loc.Path); err != nil {
+			log.Println("couldn't open:", err)
+			return false
+		}
+		if te = g.FocusedEditor(); te == nil {
+			return false
+		}
+	}
+	te.JumpCursor(loc.Cursor)
+	return true
+}
+
+func (loc NavLocation) in(tb *TextBuffer) bool {
+	if loc.buf != nil {
+		return loc.buf == tb
+	}
+	return loc.Path != "" && tb.filepath == loc.Path
+}
+
+func (g *Editor) GoBack() {
+	g.go_through_history(&g.nav_back, &g.nav_forward)
+}
+func (g *Editor) GoForward() {
+	g.go_through_history(&g.nav_forward, &g.nav_back)
+}
+
+// go_through_history goes to the last location of from, putting where we are on to
+// locations that can't be shown any more, like closed untitled buffers, are skipped
+func (g *Editor) go_through_history(from, to *[]NavLocation) {
+	here, ok := g.here()
+	for len(*from) > 0 {
+		loc := (*from)[len(*from)-1]
+		*from = (*from)[:len(*from)-1]
+		if g.show_location(loc) {
+			if ok {
+				*to = push_location(*to, here)
+			}
+			return
+		}
+	}
+}
+
+func (g *Editor) CanGoBack() bool {
+	return len(g.nav_back) > 0
+}
+func (g *Editor) CanGoForward() bool {
+	return len(g.nav_forward) > 0
+}
+
+// HandleJumpRequests goes wherever the focused widget asked to
+func (g *Editor) HandleJumpRequests() {
+	j, ok := g.last_keyboard_consumer.(Jumper)
+	if !ok {
+		return
+	}
+	if loc, ok := j.TakeJumpRequest(); ok {
+		g.JumpTo(loc)
+	}
+}
+
+/*
+Asking the language server
+*/
+
+// lsp_location_link is a Location or a LocationLink, servers can answer with either
+type lsp_location_link struct {
+	LSPLocation
+	TargetURI            string    `json:"targetUri"`
+	TargetSelectionRange *LSPRange `json:"targetSelectionRange"`
+}
+
+// ParseLocations reads the answer to a definition or references request, which can be null, one Location or a list of Locations or LocationLinks
+func ParseLocations(raw json.RawMessage) ([]LSPLocation, error) {
+	s := strings.TrimSpace(string(raw))
+	if s == "" || s == "null" {
+		return nil, nil
+	}
+	var links []lsp_location_link
+	if strings.HasPrefix(s, "[") {
+		if err := json.Unmarshal(raw, &links); err != nil {
+			return nil, err
+		}
+	} else {
+		var link lsp_location_link
+		if err := json.Unmarshal(raw, &link); err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	locs := make([]LSPLocation, 0, len(links))
+	for _, link := range links {
+		if link.TargetURI != "" && link.TargetSelectionRange != nil {
+			locs = append(locs, LSPLocation{URI: link.TargetURI, Range: *link.TargetSelectionRange})
+		} else if link.URI != "" {
+			locs = append(locs, link.LSPLocation)
+		}
+	}
+	return locs, nil
+}
+
+// OpenBuffer is the buffer of an editor that has path open, nil if none does
+func (g *Editor) OpenBuffer(path string) *TextBuffer {
+	var found *TextBuffer
+	Walk(g.MainWidget, func(w Widget) {
+		if te, ok := w.(*TextEditor); ok && found == nil && te.buf.filepath == path {
+			found = te.buf
+		}
+	})
+	return found
+}
+
+// buffer_for is the text of path for turning positions into cursors and showing previews
+// files that aren't open are read from disk, at most once per loaded map
+func (g *Editor) buffer_for(path string, loaded map[string]*TextBuffer) *TextBuffer {
+	if tb := g.OpenBuffer(path); tb != nil {
+		return tb
+	}
+	if tb, ok := loaded[path]; ok {
+		return tb
+	}
+	tb, err := LoadTextBuffer(path)
+	if err != nil {
+		log.Println("couldn't read:", err)
+	}
+	loaded[path] = tb
+	return tb
+}
+
+// lsp_result is one location a server gave us, in our terms
+type lsp_result struct {
+	NavLocation
+	buf *TextBuffer //the file's text, open or not
+}
+
+func (g *Editor) resolve_locations(ls *LanguageServer, locs []LSPLocation) []lsp_result {
+	loaded := map[string]*TextBuffer{}
+	results := make([]lsp_result, 0, len(locs))
+	for _, loc := range locs {
+		path := URIToPath(loc.URI)
+		if path == "" {
+			continue
+		}
+		tb := g.buffer_for(path, loaded)
+		if tb == nil {
+			continue
+		}
+		results = append(results, lsp_result{NavLocation{Path: path, Cursor: ls.Cursor(tb, loc.Range.Start)}, tb})
+	}
+	return results
+}
+
+// ask_server sends a request about te's cursor, reply gets the locations in the answer
+// it returns false if there's no server to ask
+func (g *Editor) ask_server(te *TextEditor, method string, params func(ls *LanguageServer) interface{}, reply func(results []lsp_result)) bool {
+	ls := LanguageServerFor(te.buf)
+	if ls == nil {
+		return false
+	}
+	ls.Request(method, params(ls), func(result json.RawMessage, err error) {
+		if err != nil {
+			log.Printf("%s: %v", method, err)
+			return
+		}
+		locs, err := ParseLocations(result)
+		if err != nil {
+			log.Printf("%s: %v", method, err)
+			return
+		}
+		//the user has moved on to another editor since asking
+		if g.FocusedEditor() != te {
+			return
+		}
+		results := g.resolve_locations(ls, locs)
+		if len(results) == 0 {
+			log.Println("nothing found for", te.WordAt(te.cursor))
+			return
+		}
+		reply(results)
+	})
+	return true
+}
+
+// GoToDefinition jumps to where the symbol under the cursor is defined, which can be in another file
+func (g *Editor) GoToDefinition() {
+	te := g.FocusedEditor()
+	if te == nil {
+		return
+	}
+	asked := g.ask_server(te, "textDocument/definition", te.position_params, func(results []lsp_result) {
+		g.JumpTo(results[0].NavLocation)
+		if len(results) > 1 {
+			g.ShowResults("Definitions of "+te.WordAt(te.cursor), results_items(results))
+		}
+	})
+	if asked {
+		return
+	}
+	if c, ok := te.FindDeclaration(te.WordAt(te.cursor)); ok {
+		g.JumpTo(location_in(te.buf, c))
+	}
+}
+
+// PeekDefinition shows the definition of the symbol under the cursor in a peek view under its line
+func (g *Editor) PeekDefinition() {
+	te := g.FocusedEditor()
+	if te == nil {
+		return
+	}
+	asked := g.ask_server(te, "textDocument/definition", te.position_params, func(results []lsp_result) {
+		r := results[0]
+		te.ShowPeek(r.buf, r.Cursor, r.NavLocation.String(), g.OpenBuffer(r.Path) != nil)
+	})
+	if asked {
+		return
+	}
+	if c, ok := te.FindDeclaration(te.WordAt(te.cursor)); ok {
+		te.ShowPeek(te.buf, c, location_in(te.buf, c).String(), true)
+	}
+}
+
+type lsp_reference_params struct {
+	LSPTextDocumentPosition
+	Context struct {
+		IncludeDeclaration bool `json:"includeDeclaration"`
+	} `json:"context"`
+}
+
+// FindReferences lists everywhere the symbol under the cursor is used in a results panel
+// without a language server it's every whole word match in the file
+func (g *Editor) FindReferences() {
+	te := g.FocusedEditor()
+	if te == nil {
+		return
+	}
+	word := te.WordAt(te.cursor)
+	if word == "" {
+		return
+	}
+	title := "References to " + word
+	params := func(ls *LanguageServer) interface{} {
+		params := lsp_reference_params{LSPTextDocumentPosition: ls.DocumentPosition(te.buf, te.cursor)}
+		params.Context.IncludeDeclaration = true
+		return params
+	}
+	asked := g.ask_server(te, "textDocument/references", params, func(results []lsp_result) {
+		g.ShowResults(title, results_items(results))
+	})
+	if asked {
+		return
+	}
+	whole_word := regexp.MustCompile(`\b` + regexp.QuoteMeta(word) + `\b`)
+	items := []ResultItem{}
+	for row, line := range te.buf.lines {
+		for _, loc := range whole_word.FindAllStringIndex(line, -1) {
+			at := location_in(te.buf, Cursor{row: row, col: loc[0]})
+			items = append(items, ResultItem{Location: at, Label: at.String(), Preview: line})
+		}
+	}
+	g.ShowResults(title, items)
+}
+
+// position_params is the params of a request about te's cursor
+func (te *TextEditor) position_params(ls *LanguageServer) interface{} {
+	return ls.DocumentPosition(te.buf, te.cursor)
+}
+
+func results_items(results []lsp_result) []ResultItem {
+	items := make([]ResultItem, 0, len(results))
+	for _, r := range results {
+		label := r.NavLocation.String()
+		if rel, err := filepath.Rel(WorkspaceDir(), r.Path); err == nil && !strings.HasPrefix(rel, "..") {
+			label = fmt.Sprintf("%s:%d", rel, r.Cursor.row+1)
+		}
+		items = append(items, ResultItem{Location: r.NavLocation, Label: label, Preview: r.buf.lines[r.Cursor.row]})
+	}
+	return items
+}
@@ -0,0 +1,461 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+	"golang.org/x/image/font"
+)
+
+// logical pixels
+const output_padding = 4
+
+// lines kept before the oldest are dropped
+const output_max_lines = 10000
+
+// OutputPanel shows what a running command prints, in its ANSI colours
+// file:line:col in the output are links that jump there
+type OutputPanel struct {
+	image.Rectangle
+	title   string
+	dir     string //relative paths in the output are from here
+	lines   []output_line
+	pending string //the start of an escape sequence cut off at the end of the last write
+	style   output_span
+	scroll  int  //rows scrolled off the top
+	follow  bool //scrolled to the bottom, new output keeps it there
+	hovered *output_link
+	focused bool
+
+	jump_request *NavLocation
+}
+
+var _ Widget = &OutputPanel{}
+var _ Jumper = &OutputPanel{}
+
+// output_span is a run of text in one style, a nil colour is the default one
+type output_span struct {
+	text string
+	col  color.Color
+	bold bool
+}
+
+type output_line struct {
+	spans []output_span
+	links []output_link
+}
+
+// output_link is a location mentioned in a line, from and to are byte offsets in the line's text
+type output_link struct {
+	from, to int
+	loc      NavLocation
+}
+
+func NewOutputPanel(title, dir string) *OutputPanel {
+	op := &OutputPanel{title: title, dir: dir, follow: true}
+	op.Clear()
+	return op
+}
+
+// Clear empties the panel for the output of something new
+func (op *OutputPanel) Clear() {
+	op.lines = []output_line{{}}
+	op.pending, op.style = "", output_span{}
+	op.scroll, op.follow, op.hovered = 0, true, nil
+}
+
+func (op *OutputPanel) SetTitle(title string) {
+	op.title = title
+}
+
+func (op *OutputPanel) SetDir(dir string) {
+	op.dir = dir
+}
+
+func (l output_line) text() string {
+	var b strings.Builder
+	for _, span := range l.spans {
+		b.WriteString(span.text)
+	}
+	return b.String()
+}
+
+// Write adds output to the end, escape sequences change the style of what comes after them
+func (op *OutputPanel) Write(s string) {
+	s = op.pending + s
+	op.pending = ""
+	var run strings.Builder
+	flush := func() {
+		if run.Len() > 0 {
+			op.add_text(run.String())
+			run.Reset()
+		}
+	}
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\n':
+			flush()
+			op.end_line()
+		case '\r':
+			flush()
+			if i+1 < len(s) && s[i+1] == '\n' {
+				continue
+			}
+			if i+1 == len(s) {
+				//might be the first half of \r\n
+				op.pending = "\r"
+				return
+			}
+			//progress meters go back to the start of the line to redraw it
+			op.lines[len(op.lines)-1] = output_line{}
+		case 0x1b:
+			flush()
+			end := ansi_sequence_end(s[i:])
+			if end < 0 {
+				op.pending = s[i:]
+				return
+			}
+			if seq := s[i : i+end]; strings.HasPrefix(seq, "\x1b[") && strings.HasSuffix(seq, "m") {
+				op.style = apply_sgr(op.style, seq[2:len(seq)-1])
+			}
+			i += end - 1
+		case '\t':
+			run.WriteString("    ")
+		default:
+			if c >= 0x20 {
+				run.WriteByte(c)
+			}
+		}
+	}
+	flush()
+}
+
+// ansi_sequence_end is the length of the escape sequence s starts with, -1 if s ends before it does
+func ansi_sequence_end(s string) int {
+	if len(s) < 2 {
+		return -1
+	}
+	if s[1] != '[' {
+		return 2
+	}
+	for i := 2; i < len(s); i++ {
+		if s[i] >= 0x40 && s[i] <= 0x7e {
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// the eight ANSI colours in our theme's, bright ones look the same
+func ansi_color(n int) color.Color {
+	switch n {
+	case 0:
+		return Style.Gray
+	case 1:
+		return Style.RedStrong
+	case 2:
+		return Style.GreenStrong
+	case 3:
+		return Style.YellowStrong
+	case 4:
+		return Style.BlueStrong
+	case 5:
+		return Style.PurpleStrong
+	case 6:
+		return Style.AquaStrong
+	}
+	return Style.FGColorStrong
+}
+
+// apply_sgr changes style by the parameters of a select graphic rendition sequence, backgrounds are left out
+func apply_sgr(style output_span, params string) output_span {
+	codes := []int{}
+	for _, p := range strings.Split(params, ";") {
+		n, _ := strconv.Atoi(p)
+		codes = append(codes, n)
+	}
+	for i := 0; i < len(codes); i++ {
+		switch n := codes[i]; {
+		case n == 0:
+			style = output_span{}
+		case n == 1:
+			style.bold = true
+		case n == 22:
+			style.bold = false
+		case n >= 30 && n <= 37:
+			style.col = ansi_color(n - 30)
+		case n >= 90 && n <= 97:
+			style.col = ansi_color(n - 90)
+		case n == 39:
+			style.col = nil
+		case n == 38 || n == 48:
+			//256 colour and true colour, which take more parameters
+			if i+2 < len(codes) && codes[i+1] == 5 {
+				if n == 38 {
+					style.col = ansi_color(codes[i+2] % 8)
+				}
+				i += 2
+			} else if i+4 < len(codes) && codes[i+1] == 2 {
+				if n == 38 {
+					style.col = color.RGBA{uint8(codes[i+2]), uint8(codes[i+3]), uint8(codes[i+4]), 0xff}
+				}
+				i += 4
+			}
+		}
+	}
+	return style
+}
+
+func (op *OutputPanel) add_text(s string) {
+	line := &op.lines[len(op.lines)-1]
+	span := op.style
+	span.text = s
+	line.spans = append(line.spans, span)
+}
+
+// end_line finishes the last line, finding the locations in it
+func (op *OutputPanel) end_line() {
+	line := &op.lines[len(op.lines)-1]
+	line.links = find_links(line.text(), op.dir)
+	op.lines = append(op.lines, output_line{})
+	if extra := len(op.lines) - output_max_lines; extra > 0 {
+		op.lines = op.lines[extra:]
+		op.scroll = max(0, op.scroll-extra)
+		op.hovered = nil
+	}
+	if op.follow {
+		op.scroll_to_end()
+	}
+}
+
+var output_location = regexp.MustCompile(`([^\s:"'()\[\]]+):(\d+)(?::(\d+))?`)
+
+// find_links is the file:line:col locations in s of files that exist
+func find_links(s, dir string) []output_link {
+	links := []output_link{}
+	for _, m := range output_location.FindAllStringSubmatchIndex(s, -1) {
+		path := s[m[2]:m[3]]
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			continue
+		}
+		row, _ := strconv.Atoi(s[m[4]:m[5]])
+		col := 0
+		if m[6] >= 0 {
+			col, _ = strconv.Atoi(s[m[6]:m[7]])
+		}
+		loc := NavLocation{Path: path, Cursor: Cursor{row: max(0, row-1), col: max(0, col-1)}}
+		links = append(links, output_link{from: m[0], to: m[1], loc: loc})
+	}
+	return links
+}
+
+func (op *OutputPanel) row_height() int {
+	return CodeLineHeight()
+}
+
+func (op *OutputPanel) rows_showing() int {
+	return max(1, (op.Dy()-2*Px(output_padding))/op.row_height())
+}
+
+func (op *OutputPanel) max_scroll() int {
+	//the last line is empty until something's written to it
+	n := len(op.lines)
+	if len(op.lines[n-1].spans) == 0 {
+		n--
+	}
+	return max(0, n-op.rows_showing())
+}
+
+func (op *OutputPanel) scroll_by(rows int) {
+	op.scroll = max(0, min(op.scroll+rows, op.max_scroll()))
+	op.follow = op.scroll == op.max_scroll()
+}
+
+func (op *OutputPanel) scroll_to_end() {
+	op.scroll = op.max_scroll()
+	op.follow = true
+}
+
+// link_at is the link under (x, y), nil if there isn't one
+func (op *OutputPanel) link_at(x, y int) *output_link {
+	if !image.Pt(x, y).In(op.Rectangle) {
+		return nil
+	}
+	row := (y-op.Min.Y-Px(output_padding))/op.row_height() + op.scroll
+	if row < 0 || row >= len(op.lines) {
+		return nil
+	}
+	line := op.lines[row]
+	s := line.text()
+	x -= op.Min.X + Px(output_padding)
+	for i := range line.links {
+		l := &line.links[i]
+		if x >= font.MeasureString(CodeFontFace, s[:l.from]).Round() && x < font.MeasureString(CodeFontFace, s[:l.to]).Round() {
+			return l
+		}
+	}
+	return nil
+}
+
+// TakeJumpRequest implements Jumper
+func (op *OutputPanel) TakeJumpRequest() (NavLocation, bool) {
+	loc := op.jump_request
+	op.jump_request = nil
+	if loc == nil {
+		return NavLocation{}, false
+	}
+	return *loc, true
+}
+
+/*
+Widget
+*/
+
+// Title implements Widget
+func (op *OutputPanel) Title() string {
+	return op.title
+}
+
+// Focus implements Focuser
+func (op *OutputPanel) Focus() {
+	op.focused = true
+}
+
+// KeyboardFocusLost implements Widget
+func (op *OutputPanel) KeyboardFocusLost() {
+	op.focused = false
+}
+
+// SetRect implements Widget
+func (op *OutputPanel) SetRect(rect image.Rectangle) {
+	op.Rectangle = rect
+	if op.follow {
+		op.scroll_to_end()
+	} else {
+		op.scroll_by(0)
+	}
+}
+
+// Draw implements Widget
+func (op *OutputPanel) Draw(target *ebiten.Image) {
+	DrawRect(target, op.Rectangle, Style.BGColorMuted)
+	clipped, ok := target.SubImage(op.Rectangle).(*ebiten.Image)
+	if !ok {
+		return
+	}
+	pad := Px(output_padding)
+	for row := op.scroll; row < len(op.lines); row++ {
+		top := op.Min.Y + pad + (row-op.scroll)*op.row_height()
+		if top >= op.Max.Y {
+			break
+		}
+		line := op.lines[row]
+		x := op.Min.X + pad
+		baseline := top + CodeFontPeriodFromTop
+		s := ""
+		for _, span := range line.spans {
+			col := span.col
+			if col == nil {
+				col = Style.FGColorMuted
+				if span.bold {
+					col = Style.FGColorStrong
+				}
+			}
+			text.Draw(clipped, span.text, CodeFaceFor(ScopeStyle{Bold: span.bold}), x+font.MeasureString(CodeFontFace, s).Round(), baseline, col)
+			s += span.text
+		}
+		for i := range line.links {
+			l := &line.links[i]
+			x0 := x + font.MeasureString(CodeFontFace, s[:l.from]).Round()
+			x1 := x + font.MeasureString(CodeFontFace, s[:l.to]).Round()
+			var col color.Color = Translucent(Style.FGColorMuted, 0.5)
+			if l == op.hovered {
+				col = Style.BlueStrong
+			}
+			ebitenutil.DrawLine(clipped, float64(x0), float64(baseline+2), float64(x1), float64(baseline+2), col)
+		}
+	}
+}
+
+// TakeKeyboard implements Widget
+func (op *OutputPanel) TakeKeyboard() {
+	switch {
+	case KeyJustPressedOrKeyRepeated(ebiten.KeyDown):
+		op.scroll_by(1)
+	case KeyJustPressedOrKeyRepeated(ebiten.KeyUp):
+		op.scroll_by(-1)
+	case KeyJustPressedOrKeyRepeated(ebiten.KeyPageDown):
+		op.scroll_by(op.rows_showing())
+	case KeyJustPressedOrKeyRepeated(ebiten.KeyPageUp):
+		op.scroll_by(-op.rows_showing())
+	case inpututil.IsKeyJustPressed(ebiten.KeyHome):
+		op.scroll_by(-len(op.lines))
+	case inpututil.IsKeyJustPressed(ebiten.KeyEnd):
+		op.scroll_to_end()
+	}
+}
+
+// MouseOut implements Widget
+func (op *OutputPanel) MouseOut() {
+	op.hovered = nil
+}
+
+// MouseOver implements Widget
+func (op *OutputPanel) MouseOver(x int, y int) Widget {
+	if _, dy := ebiten.Wheel(); dy != 0 {
+		op.scroll_by(-int(dy * 3))
+	}
+	op.hovered = op.link_at(x, y)
+	if op.hovered != nil {
+		ebiten.SetCursorShape(ebiten.CursorShapePointer)
+	} else {
+		ebiten.SetCursorShape(ebiten.CursorShapeText)
+	}
+	return op
+}
+
+// LMouseDown implements Widget, clicking a link jumps to it
+func (op *OutputPanel) LMouseDown(x int, y int) Widget {
+	if l := op.link_at(x, y); l != nil {
+		loc := l.loc
+		op.jump_request = &loc
+	}
+	return op
+}
+
+// LMouseUp implements Widget
+func (op *OutputPanel) LMouseUp(x int, y int) Widget {
+	return op
+}
+
+// RMouseDown implements Widget
+func (op *OutputPanel) RMouseDown(x int, y int) Widget {
+	return op
+}
+
+// RMouseUp implements Widget, the panel's context menu has the task's commands
+func (op *OutputPanel) RMouseUp(x int, y int) Widget {
+	return op
+}
+
+// MMouseDown implements Widget
+func (*OutputPanel) MMouseDown(x int, y int) Widget {
+	return nil
+}
+
+// MMouseUp implements Widget
+func (*OutputPanel) MMouseUp(x int, y int) Widget {
+	return nil
+}
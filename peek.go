@@ -0,0 +1,144 @@
+package main
+
+import (
+	"image"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+)
+
+// how many lines of code a peek view shows
+const peek_lines = 10
+
+// PeekView is a small editor opened inline under a line of a TextEditor, for looking at a definition without leaving
+// the lines under it get pushed down to make room
+type PeekView struct {
+	editor  *TextEditor
+	row     int //the line of the outer editor it's opened under
+	title   string
+	focused bool //keyboard input goes to the peek instead of the outer editor
+}
+
+// height is the header plus the code
+func (pv *PeekView) height() int {
+	return (peek_lines + 1) * CodeLineHeight()
+}
+
+// Blur gives the keyboard back to the outer editor
+func (pv *PeekView) Blur() {
+	pv.focused = false
+	pv.editor.focused = false
+}
+
+// ShowPeek opens a peek view of buf at c under the cursor's line, replacing any that's open
+// buffers that aren't open in a tab are only for looking at, they'd have nowhere to be saved from
+func (te *TextEditor) ShowPeek(buf *TextBuffer, c Cursor, title string, editable bool) {
+	inner := NewTextEditor(buf)
+	inner.highlighter = HighlighterFor(buf.filepath)
+	inner.ReadOnly = !editable
+	inner.cursor = buf.ClampCursor(c)
+	inner.ScrollTo(c.row - 2)
+	te.peek = &PeekView{editor: inner, row: te.cursor.row, title: title}
+
+	//make room for it if it would hang off the bottom
+	showing := te.Dy() / CodeLineHeight()
+	if need := te.peek.row + peek_lines + 2 - showing; te.first_row() < need {
+		te.ScrollTo(min(te.peek.row, need))
+	}
+	te.MarkRedraw()
+}
+
+// ClosePeek closes the peek view, if there is one
+func (te *TextEditor) ClosePeek() {
+	if te.peek == nil {
+		return
+	}
+	te.peek = nil
+	te.focused = true
+	te.MarkRedraw()
+}
+
+// peek_showing is whether there's a peek view and its line isn't scrolled off the top
+func (te *TextEditor) peek_showing() bool {
+	return te.peek != nil && te.peek.row >= te.first_row()
+}
+
+// peek_rect is where the peek view is on screen, header included
+func (te *TextEditor) peek_rect() image.Rectangle {
+	top := te.Min.Y + te.line_top(te.peek.row) + CodeLineHeight()
+	return image.Rect(te.Min.X, top, te.Max.X, top+te.peek.height()).Intersect(te.Rectangle)
+}
+
+func (te *TextEditor) peek_header_rect() image.Rectangle {
+	r := te.peek_rect()
+	r.Max.Y = min(r.Max.Y, r.Min.Y+CodeLineHeight())
+	return r
+}
+
+func (te *TextEditor) peek_body_rect() image.Rectangle {
+	r := te.peek_rect()
+	r.Min.Y = min(r.Max.Y, r.Min.Y+CodeLineHeight())
+	return r
+}
+
+// DrawPeek draws the peek view over the gap left for it in the text
+func (te *TextEditor) DrawPeek(target *ebiten.Image) {
+	if !te.peek_showing() {
+		return
+	}
+	r := te.peek_rect()
+	if r.Empty() {
+		return
+	}
+	header := te.peek_header_rect()
+	DrawRect(target, header, Style.BGColorStrong)
+	if clipped, ok := target.SubImage(header).(*ebiten.Image); ok {
+		text.Draw(clipped, te.peek.title+"   (Esc to close)", MainFontFace, header.Min.X+Px(4), header.Min.Y+(header.Dy()-MainLineHeight())/2+MainFontPeriodFromTop, Style.FGColorMuted)
+	}
+	inner := te.peek.editor
+	if body := te.peek_body_rect(); !body.Empty() {
+		if inner.Rectangle != body {
+			inner.SetRect(body)
+		}
+		inner.focused = te.peek.focused && te.focused
+		inner.Draw(target)
+	}
+	border := Style.BGColorStrong
+	if te.peek.focused && te.focused {
+		border = Style.BlueMuted
+	}
+	DrawBorders(target, r, border)
+}
+
+// PeekKeyboard handles the keyboard for the peek view, returns true if the outer editor shouldn't
+func (te *TextEditor) PeekKeyboard() bool {
+	if te.peek == nil {
+		return false
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		te.ClosePeek()
+		return true
+	}
+	if !te.peek.focused {
+		return false
+	}
+	te.peek.editor.TakeKeyboard()
+	return true
+}
+
+// PeekClick focuses the peek view if (x, y) is in it, clicks anywhere else give the keyboard back to the outer editor
+func (te *TextEditor) PeekClick(x, y int) bool {
+	if te.peek == nil {
+		return false
+	}
+	if !te.peek_showing() || !image.Pt(x, y).In(te.peek_rect()) {
+		te.peek.Blur()
+		return false
+	}
+	te.peek.focused = true
+	if image.Pt(x, y).In(te.peek_body_rect()) {
+		te.peek.editor.LMouseDown(x, y)
+	}
+	return true
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"image"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+// Popup menus float over everything else at the mouse, for right click context menus
+// they're built from the same MenuItem trees as the menu bar and drawn the same way
+
+// menus are kept inside this, the window
+var menu_bounds image.Rectangle
+
+// the popup menu that's showing, nil most of the time
+var current_popup *PopupMenu
+
+// keep_inside moves the top left of something size big so all of it is inside the window
+func keep_inside(pt image.Point, size image.Point) image.Point {
+	if menu_bounds.Empty() {
+		return pt
+	}
+	pt.X = max(menu_bounds.Min.X, min(pt.X, menu_bounds.Max.X-size.X))
+	pt.Y = max(menu_bounds.Min.Y, min(pt.Y, menu_bounds.Max.Y-size.Y))
+	return pt
+}
+
+// submenu_topleft is where the submenu kid opened from row goes
+// to the right of its row unless that runs off the window, then to the left
+func submenu_topleft(kid MenuItem, row image.Rectangle) image.Point {
+	pt := image.Pt(row.Max.X-1, row.Min.Y)
+	rects := kid.SpaceUsed(pt)
+	if len(rects) == 0 || menu_bounds.Empty() {
+		return pt
+	}
+	panel := rects[len(rects)-1] //the submenu's own panel comes after its open children
+	if panel.Max.X > menu_bounds.Max.X {
+		pt.X = row.Min.X - panel.Dx() + 1
+	}
+	return keep_inside(pt, panel.Size())
+}
+
+// PopupMenu is a menu that isn't hanging off the menu bar
+type PopupMenu struct {
+	image.Rectangle //the top level panel, submenus hang off it
+	root            *DummyMenuItem
+}
+
+var _ Widget = &PopupMenu{}
+
+func NewPopupMenu(items []MenuItem, at image.Point) *PopupMenu {
+	pm := &PopupMenu{root: NewMenuItem("", items)}
+	pm.root.ResetHover()
+	pm.SetRect(image.Rectangle{Min: at, Max: at})
+	return pm
+}
+
+// ShowPopup puts up a menu of items at (x, y), replacing any that's already up
+func ShowPopup(items []MenuItem, x, y int) {
+	if len(items) == 0 {
+		return
+	}
+	current_popup = NewPopupMenu(items, image.Pt(x, y))
+}
+
+// Close takes the popup down
+func (pm *PopupMenu) Close() {
+	if current_popup == pm {
+		current_popup = nil
+	}
+}
+
+// Title implements Widget
+func (*PopupMenu) Title() string {
+	return "popup menu"
+}
+
+// SetRect implements Widget, the menu goes at rect.Min, moved over to fit in the window
+func (pm *PopupMenu) SetRect(rect image.Rectangle) {
+	at := rect.Min
+	rects := pm.root.SpaceUsed(at)
+	if len(rects) == 0 {
+		pm.Rectangle = image.Rectangle{Min: at, Max: at}
+		return
+	}
+	size := rects[len(rects)-1].Size()
+	at = keep_inside(at, size)
+	pm.Rectangle = image.Rectangle{Min: at, Max: at.Add(size)}
+}
+
+func (pm *PopupMenu) space() []image.Rectangle {
+	return pm.root.SpaceUsed(pm.Min)
+}
+
+func (pm *PopupMenu) contains(x, y int) bool {
+	for _, r := range pm.space() {
+		if image.Pt(x, y).In(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// Bounds implements Widget, it covers the open submenus too
+func (pm *PopupMenu) Bounds() image.Rectangle {
+	bounds := pm.Rectangle
+	for _, r := range pm.space() {
+		bounds = bounds.Union(r)
+	}
+	return bounds
+}
+
+// Draw implements Widget
+func (pm *PopupMenu) Draw(target *ebiten.Image) {
+	for _, r := range pm.space() {
+		DrawRect(target, r, Style.BGColorMuted)
+		DrawBorders(target, r, Style.FGColorMuted)
+	}
+	pm.root.DrawOpen(target, pm.Min)
+}
+
+// activate runs item and takes the popup down, or opens item's submenu
+func (pm *PopupMenu) activate(level *DummyMenuItem, item MenuItem) {
+	if item == nil || !selectable(item) {
+		return
+	}
+	if len(item.Children()) > 0 {
+		level.open_submenu()
+		return
+	}
+	pm.Close()
+	item.Execute()
+}
+
+// TakeKeyboard implements Widget
+func (pm *PopupMenu) TakeKeyboard() {
+	levels := menu_levels(pm.root)
+	deepest := levels[len(levels)-1]
+	switch {
+	case KeyJustPressedOrKeyRepeated(ebiten.KeyDown):
+		deepest.move_hover(1)
+	case KeyJustPressedOrKeyRepeated(ebiten.KeyUp):
+		deepest.move_hover(-1)
+	case inpututil.IsKeyJustPressed(ebiten.KeyRight):
+		if item := deepest.hovered_item(); item != nil && len(item.Children()) > 0 {
+			pm.activate(deepest, item)
+		}
+	case inpututil.IsKeyJustPressed(ebiten.KeyLeft):
+		if len(levels) > 1 {
+			levels[len(levels)-2].sub_open = false
+		}
+	case inpututil.IsKeyJustPressed(ebiten.KeyEnter), inpututil.IsKeyJustPressed(ebiten.KeySpace):
+		pm.activate(deepest, deepest.hovered_item())
+	case inpututil.IsKeyJustPressed(ebiten.KeyEscape):
+		if len(levels) > 1 {
+			levels[len(levels)-2].sub_open = false
+		} else {
+			pm.Close()
+		}
+	default:
+		if i := mnemonic_just_pressed(deepest.kids); i >= 0 {
+			deepest.currently_hovered = i
+			pm.activate(deepest, deepest.kids[i])
+		}
+	}
+}
+
+// KeyboardFocusLost implements Widget
+func (pm *PopupMenu) KeyboardFocusLost() {
+	pm.Close()
+}
+
+// MouseOut implements Widget
+func (*PopupMenu) MouseOut() {
+}
+
+// MouseOver implements Widget
+func (pm *PopupMenu) MouseOver(x int, y int) Widget {
+	if !pm.contains(x, y) {
+		return nil
+	}
+	ebiten.SetCursorShape(ebiten.CursorShapeDefault)
+	pm.root.MouseOver(x, y)
+	return pm
+}
+
+// LMouseDown implements Widget, items run when the button comes back up
+func (pm *PopupMenu) LMouseDown(x int, y int) Widget {
+	if !pm.contains(x, y) {
+		pm.Close()
+		return nil
+	}
+	return pm
+}
+
+// LMouseUp implements Widget
+func (pm *PopupMenu) LMouseUp(x int, y int) Widget {
+	if !pm.contains(x, y) {
+		return nil
+	}
+	if item := pm.root.ItemAt(x, y); item != nil && len(item.Children()) == 0 && item.Enabled() {
+		pm.Close()
+		item.Execute()
+	}
+	return pm
+}
+
+// RMouseDown implements Widget
+func (pm *PopupMenu) RMouseDown(x int, y int) Widget {
+	return pm.LMouseDown(x, y)
+}
+
+// RMouseUp implements Widget, releasing the right button over an item picks it like the left does
+func (pm *PopupMenu) RMouseUp(x int, y int) Widget {
+	return pm.LMouseUp(x, y)
+}
+
+// MMouseDown implements Widget
+func (pm *PopupMenu) MMouseDown(x int, y int) Widget {
+	return pm.LMouseDown(x, y)
+}
+
+// MMouseUp implements Widget
+func (pm *PopupMenu) MMouseUp(x int, y int) Widget {
+	if !pm.contains(x, y) {
+		return nil
+	}
+	return pm
+}
+
+// UpdatePopup gives the popup all the input while it's up, clicking anywhere else takes it down
+func (g *Editor) UpdatePopup(x, y int) {
+	pm := current_popup
+	if g.last_mouse_consumer != nil {
+		g.last_mouse_consumer.MouseOut()
+		g.last_mouse_consumer = nil
+	}
+	pm.MouseOver(x, y)
+	switch {
+	case inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft):
+		pm.LMouseDown(x, y)
+	case inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonRight):
+		pm.RMouseDown(x, y)
+	case inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonMiddle):
+		pm.MMouseDown(x, y)
+	case inpututil.IsMouseButtonJustReleased(ebiten.MouseButtonLeft):
+		pm.LMouseUp(x, y)
+	case inpututil.IsMouseButtonJustReleased(ebiten.MouseButtonRight):
+		pm.RMouseUp(x, y)
+	}
+	if current_popup == pm {
+		pm.TakeKeyboard()
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ProblemsPanel lists every diagnostic we know of, worst first or file by file
+// it's a ResultsPanel that keeps itself up to date
+type ProblemsPanel struct {
+	*ResultsPanel
+	by_file bool   //sorted by file and line instead of by severity
+	version uint64 //diagnostics_version the items were built from
+}
+
+var _ Widget = &ProblemsPanel{}
+var _ Jumper = &ProblemsPanel{}
+
+func NewProblemsPanel() *ProblemsPanel {
+	pp := &ProblemsPanel{ResultsPanel: NewResultsPanel("Problems", nil)}
+	pp.build()
+	return pp
+}
+
+// ShowProblems shows the problems panel, switching to it if it's already open
+func (g *Editor) ShowProblems() {
+	var existing *ProblemsPanel
+	Walk(g.MainWidget, func(w Widget) {
+		if pp, ok := w.(*ProblemsPanel); ok {
+			existing = pp
+		}
+	})
+	if existing == nil {
+		g.ShowPanel(NewProblemsPanel())
+		return
+	}
+	if tabs, ok := FindParent(g.MainWidget, existing).(*Tabs); ok {
+		g.ShowTab(tabs, existing)
+	}
+}
+
+// Refresh rebuilds the list if the diagnostics have changed since
+func (pp *ProblemsPanel) Refresh() {
+	if pp.version != diagnostics_version {
+		pp.build()
+	}
+}
+
+// SortByFile switches between listing problems file by file and worst first
+func (pp *ProblemsPanel) SortByFile(by_file bool) {
+	pp.by_file = by_file
+	pp.build()
+}
+
+func (pp *ProblemsPanel) build() {
+	pp.version = diagnostics_version
+	ds := AllDiagnostics()
+	by_position := func(a, b Diagnostic) bool {
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.From.Before(b.From)
+	}
+	sort.SliceStable(ds, func(i, j int) bool {
+		a, b := ds[i], ds[j]
+		if !pp.by_file && a.Severity != b.Severity {
+			return a.Severity < b.Severity
+		}
+		return by_position(a, b)
+	})
+	items := make([]ResultItem, 0, len(ds))
+	for _, d := range ds {
+		path := d.Path
+		if rel, err := filepath.Rel(WorkspaceDir(), path); err == nil && !strings.HasPrefix(rel, "..") {
+			path = rel
+		}
+		items = append(items, ResultItem{
+			Location: NavLocation{Path: d.Path, Cursor: d.From},
+			Label:    fmt.Sprintf("%s:%d:%d", path, d.From.row+1, d.From.col+1),
+			Preview:  fmt.Sprintf("%s (%s)", d.Message, d.Source),
+			Color:    severity_color(d.Severity),
+		})
+	}
+	pp.items = items
+	pp.title = fmt.Sprintf("Problems (%d)", len(items))
+	pp.selected = min(pp.selected, len(items)-1)
+	pp.hovered = -1
+	pp.clamp_scroll()
+}
+
+/*
+Widget, the mouse methods hand back the panel and not the ResultsPanel in it so it's what gets focus
+*/
+
+// MouseOver implements Widget
+func (pp *ProblemsPanel) MouseOver(x int, y int) Widget {
+	pp.ResultsPanel.MouseOver(x, y)
+	return pp
+}
+
+// LMouseDown implements Widget
+func (pp *ProblemsPanel) LMouseDown(x int, y int) Widget {
+	pp.ResultsPanel.LMouseDown(x, y)
+	return pp
+}
+
+// LMouseUp implements Widget
+func (pp *ProblemsPanel) LMouseUp(x int, y int) Widget {
+	return pp
+}
+
+// RMouseDown implements Widget
+func (pp *ProblemsPanel) RMouseDown(x int, y int) Widget {
+	return pp
+}
+
+// RMouseUp implements Widget, it has a context menu for the sort order
+func (pp *ProblemsPanel) RMouseUp(x int, y int) Widget {
+	return pp
+}
+
+func (g *Editor) problems_context_menu(pp *ProblemsPanel) []MenuItem {
+	return []MenuItem{
+		NewToggleMenuItem("Sort by &Severity", KeyShortcut{}, func() bool { return !pp.by_file }, func() { pp.SortByFile(false) }),
+		NewToggleMenuItem("Sort by &File", KeyShortcut{}, func() bool { return pp.by_file }, func() { pp.SortByFile(true) }),
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !unix && !windows
+
+package main
+
+import "os/exec"
+
+// elsewhere only the task itself gets killed
+
+func own_process_group(cmd *exec.Cmd) {}
+
+func kill_process_group(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
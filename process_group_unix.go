@@ -0,0 +1,21 @@
+//go:build unix
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// Tasks run in a process group of their own, so cancelling one stops whatever it started too,
+// like the program go run builds and runs
+
+func own_process_group(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// kill_process_group kills cmd and everything else in its group
+func kill_process_group(cmd *exec.Cmd) error {
+	//a negative pid is the whole group
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// there are no process groups to kill at once on windows, taskkill finds a task's children for us instead
+
+func own_process_group(cmd *exec.Cmd) {}
+
+// kill_process_group kills cmd and everything it started
+func kill_process_group(cmd *exec.Cmd) error {
+	taskkill := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid))
+	//no console window flashing up
+	taskkill.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
+	if err := taskkill.Run(); err != nil {
+		return cmd.Process.Kill()
+	}
+	return nil
+}
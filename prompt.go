@@ -0,0 +1,262 @@
+package main
+
+import (
+	"image"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+	"golang.org/x/image/font"
+)
+
+// Prompts are dialogs drawn in the middle of the window, for when there's no desktop dialog program to borrow
+// while one is up it gets all the input, like a popup menu does
+
+// logical pixels
+const prompt_padding = 12
+const prompt_width = 480
+
+// the prompt that's up, nil most of the time
+var current_prompt *Prompt
+
+// Prompt is a question with a row of buttons and maybe a line to type in
+type Prompt struct {
+	image.Rectangle
+	title     string
+	question  string
+	input     string
+	has_input bool
+	buttons   []string
+	answer    func(button int, input string)
+
+	lines        []string //question wrapped to fit
+	input_rect   image.Rectangle
+	button_rects []image.Rectangle
+	selected     int //button Enter presses
+	hovered      int
+	pressed      int //button the left mouse went down on, -1 when not held
+}
+
+var _ Widget = &Prompt{}
+
+// NewPrompt makes a prompt, answer gets the index of the button that was pressed and what was typed
+// escape answers -1
+func NewPrompt(title, question string, buttons []string, answer func(button int, input string)) *Prompt {
+	return &Prompt{title: title, question: question, buttons: buttons, answer: answer, hovered: -1, pressed: -1}
+}
+
+// WithInput gives the prompt a line to type in, starting with initial
+func (p *Prompt) WithInput(initial string) *Prompt {
+	p.has_input = true
+	p.input = initial
+	return p
+}
+
+// Show puts the prompt up in the middle of the window
+func (p *Prompt) Show() {
+	current_prompt = p
+	p.SetRect(menu_bounds)
+}
+
+// finish takes the prompt down and answers with button
+func (p *Prompt) finish(button int) {
+	if current_prompt == p {
+		current_prompt = nil
+	}
+	p.answer(button, p.input)
+}
+
+func (p *Prompt) button_width(label string) int {
+	return font.MeasureString(MainFontFace, label).Round() + 4*Px(prompt_padding)
+}
+
+// Title implements Widget
+func (p *Prompt) Title() string {
+	return p.title
+}
+
+// SetRect implements Widget, rect is the window, the prompt centres itself in it
+func (p *Prompt) SetRect(rect image.Rectangle) {
+	pad := Px(prompt_padding)
+	width := Px(prompt_width)
+	if !rect.Empty() {
+		width = min(width, rect.Dx())
+	}
+	p.lines = wrap_text(p.question, MainFontFace, width-2*pad)
+	height := pad + MainLineHeight() + pad/2 + len(p.lines)*MainLineHeight() + pad
+	if p.has_input {
+		height += CodeLineHeight() + pad
+	}
+	button_height := MainLineHeight() + pad
+	height += button_height + pad
+
+	at := rect.Min.Add(image.Pt((rect.Dx()-width)/2, (rect.Dy()-height)/2))
+	p.Rectangle = image.Rectangle{Min: at, Max: at.Add(image.Pt(width, height))}
+
+	y := p.Min.Y + pad + MainLineHeight() + pad/2 + len(p.lines)*MainLineHeight() + pad
+	if p.has_input {
+		p.input_rect = image.Rect(p.Min.X+pad, y-pad/2, p.Max.X-pad, y+CodeLineHeight()+pad/2)
+		y += CodeLineHeight() + pad
+	}
+	//right aligned, first button on the left
+	p.button_rects = make([]image.Rectangle, len(p.buttons))
+	x := p.Max.X - pad
+	for i := len(p.buttons) - 1; i >= 0; i-- {
+		w := p.button_width(p.buttons[i])
+		p.button_rects[i] = image.Rect(x-w, y, x, y+button_height)
+		x -= w + pad/2
+	}
+}
+
+// Draw implements Widget
+func (p *Prompt) Draw(target *ebiten.Image) {
+	pad := Px(prompt_padding)
+	DrawRect(target, p.Rectangle, Style.BGColorMuted)
+	DrawBorders(target, p.Rectangle, Style.FGColorMuted)
+	clipped, ok := target.SubImage(p.Rectangle).(*ebiten.Image)
+	if !ok {
+		return
+	}
+	y := p.Min.Y + pad
+	text.Draw(clipped, p.title, MainFontFace, p.Min.X+pad, y+MainFontPeriodFromTop, Style.FGColorMuted)
+	y += MainLineHeight() + pad/2
+	for _, line := range p.lines {
+		text.Draw(clipped, line, MainFontFace, p.Min.X+pad, y+MainFontPeriodFromTop, Style.FGColorStrong)
+		y += MainLineHeight()
+	}
+	if p.has_input {
+		DrawRect(target, p.input_rect, Style.BGColorStrong)
+		DrawBorders(target, p.input_rect, Style.FGColorMuted)
+		//the end of a long path is the part that matters
+		shown, room := p.input+"_", p.input_rect.Dx()-pad
+		for font.MeasureString(CodeFontFace, shown).Round() > room && len(shown) > 1 {
+			_, size := utf8.DecodeRuneInString(shown)
+			shown = shown[size:]
+		}
+		if input_clip, ok := target.SubImage(p.input_rect).(*ebiten.Image); ok {
+			text.Draw(input_clip, shown, CodeFontFace, p.input_rect.Min.X+pad/2, p.input_rect.Min.Y+pad/2+CodeFontPeriodFromTop, Style.FGColorStrong)
+		}
+	}
+	for i, r := range p.button_rects {
+		if i == p.selected || i == p.hovered {
+			DrawRect(target, r, Style.BGColorStrong)
+		}
+		DrawBorders(target, r, Style.FGColorMuted)
+		label_width := font.MeasureString(MainFontFace, p.buttons[i]).Round()
+		text.Draw(clipped, p.buttons[i], MainFontFace, r.Min.X+(r.Dx()-label_width)/2, r.Min.Y+pad/2+MainFontPeriodFromTop, Style.FGColorStrong)
+	}
+}
+
+// TakeKeyboard implements Widget, Enter presses the selected button and Escape cancels
+func (p *Prompt) TakeKeyboard() {
+	if p.has_input {
+		p.input += string(ebiten.AppendInputChars(nil))
+	}
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyEnter), inpututil.IsKeyJustPressed(ebiten.KeyNumpadEnter):
+		p.finish(p.selected)
+	case inpututil.IsKeyJustPressed(ebiten.KeyEscape):
+		p.finish(-1)
+	case KeyJustPressedOrKeyRepeated(ebiten.KeyTab):
+		step := 1
+		if ebiten.IsKeyPressed(ebiten.KeyShift) {
+			step = -1
+		}
+		p.selected = (p.selected + step + len(p.buttons)) % len(p.buttons)
+	case !p.has_input && KeyJustPressedOrKeyRepeated(ebiten.KeyRight):
+		p.selected = min(p.selected+1, len(p.buttons)-1)
+	case !p.has_input && KeyJustPressedOrKeyRepeated(ebiten.KeyLeft):
+		p.selected = max(p.selected-1, 0)
+	case p.has_input && KeyJustPressedOrKeyRepeated(ebiten.KeyBackspace):
+		if r := []rune(p.input); len(r) > 0 {
+			p.input = string(r[:len(r)-1])
+		}
+	case p.has_input && ebiten.IsKeyPressed(ebiten.KeyControl) && inpututil.IsKeyJustPressed(ebiten.KeyV):
+		p.input += strings.SplitN(ClipboardRead(), "\n", 2)[0]
+	}
+}
+
+// KeyboardFocusLost implements Widget
+func (p *Prompt) KeyboardFocusLost() {}
+
+func (p *Prompt) button_at(x, y int) int {
+	for i, r := range p.button_rects {
+		if image.Pt(x, y).In(r) {
+			return i
+		}
+	}
+	return -1
+}
+
+// MouseOut implements Widget
+func (p *Prompt) MouseOut() {
+	p.hovered = -1
+}
+
+// MouseOver implements Widget
+func (p *Prompt) MouseOver(x int, y int) Widget {
+	p.hovered = p.button_at(x, y)
+	if !image.Pt(x, y).In(p.Rectangle) {
+		return nil
+	}
+	return p
+}
+
+// LMouseDown implements Widget
+func (p *Prompt) LMouseDown(x int, y int) Widget {
+	p.pressed = p.button_at(x, y)
+	return p
+}
+
+// LMouseUp implements Widget, a button is pressed when the mouse goes down and up on it
+// so letting go of the click that put the prompt up can't answer it
+func (p *Prompt) LMouseUp(x int, y int) Widget {
+	pressed := p.pressed
+	p.pressed = -1
+	if pressed >= 0 && pressed == p.button_at(x, y) {
+		p.finish(pressed)
+	}
+	return p
+}
+
+// RMouseDown implements Widget
+func (p *Prompt) RMouseDown(x int, y int) Widget {
+	return p
+}
+
+// RMouseUp implements Widget
+func (p *Prompt) RMouseUp(x int, y int) Widget {
+	return p
+}
+
+// MMouseDown implements Widget
+func (p *Prompt) MMouseDown(x int, y int) Widget {
+	return p
+}
+
+// MMouseUp implements Widget
+func (p *Prompt) MMouseUp(x int, y int) Widget {
+	return p
+}
+
+// UpdatePrompt gives the prompt all the input while it's up, clicks outside it do nothing
+func (g *Editor) UpdatePrompt(x, y int) {
+	p := current_prompt
+	p.SetRect(menu_bounds)
+	if g.last_mouse_consumer != nil {
+		g.last_mouse_consumer.MouseOut()
+		g.last_mouse_consumer = nil
+	}
+	p.MouseOver(x, y)
+	switch {
+	case inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft):
+		p.LMouseDown(x, y)
+	case inpututil.IsMouseButtonJustReleased(ebiten.MouseButtonLeft):
+		p.LMouseUp(x, y)
+	}
+	if current_prompt == p {
+		p.TakeKeyboard()
+	}
+}
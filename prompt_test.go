@@ -0,0 +1,68 @@
+package main
+
+import (
+	"image"
+	"testing"
+)
+
+func TestPromptLayout(t *testing.T) {
+	window := image.Rect(0, 0, 1000, 700)
+	p := NewPrompt("Unsaved changes", "Save changes to main.go before closing?", []string{"Save", "Discard", "Cancel"}, func(int, string) {})
+	p.SetRect(window)
+	if !p.Rectangle.In(window) {
+		t.Fatalf("prompt at %v isn't inside the window", p.Rectangle)
+	}
+	if left, right := p.Min.X-window.Min.X, window.Max.X-p.Max.X; left-right > 1 || right-left > 1 {
+		t.Errorf("prompt at %v isn't centred", p.Rectangle)
+	}
+	for i, r := range p.button_rects {
+		if !r.In(p.Rectangle) {
+			t.Errorf("%s button at %v is outside the prompt", p.buttons[i], r)
+		}
+		if i > 0 && r.Min.X <= p.button_rects[i-1].Max.X {
+			t.Errorf("%s button overlaps %s", p.buttons[i], p.buttons[i-1])
+		}
+	}
+	if !p.input_rect.Empty() {
+		t.Errorf("prompt without input has an input box")
+	}
+
+	p.WithInput("main.go").SetRect(window)
+	if p.input_rect.Empty() || !p.input_rect.In(p.Rectangle) {
+		t.Errorf("input box at %v isn't inside the prompt at %v", p.input_rect, p.Rectangle)
+	}
+	if p.input_rect.Max.Y > p.button_rects[0].Min.Y {
+		t.Errorf("input box runs into the buttons")
+	}
+}
+
+func TestPromptAnswers(t *testing.T) {
+	button, input := -2, ""
+	p := NewPrompt("Rename", "New name", []string{"OK", "Cancel"}, func(b int, s string) { button, input = b, s }).WithInput("old.go")
+	p.Show()
+	defer func() { current_prompt = nil }()
+	if current_prompt != p || !DialogShowing() {
+		t.Fatalf("prompt isn't showing")
+	}
+	p.SetRect(image.Rect(0, 0, 1000, 700))
+	ok := p.button_rects[0].Min.Add(image.Pt(2, 2))
+	cancel := p.button_rects[1].Min.Add(image.Pt(2, 2))
+
+	//letting go over a button it wasn't pressed on does nothing
+	p.LMouseUp(ok.X, ok.Y)
+	p.LMouseDown(cancel.X, cancel.Y)
+	p.LMouseUp(ok.X, ok.Y)
+	if button != -2 || current_prompt != p {
+		t.Fatalf("prompt answered %d to a click that wasn't one", button)
+	}
+
+	p.input = "new.go"
+	p.LMouseDown(ok.X, ok.Y)
+	p.LMouseUp(ok.X, ok.Y)
+	if button != 0 || input != "new.go" {
+		t.Errorf("answered %d %q, want 0 %q", button, input, "new.go")
+	}
+	if current_prompt != nil || DialogShowing() {
+		t.Errorf("prompt is still up after answering")
+	}
+}
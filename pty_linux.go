@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"unsafe"
+)
+
+// Pseudo terminals for the terminal widget, the shell gets the pty's other end as its controlling terminal
+
+// start_pty runs command on a new pty of the given size, returning our end of it
+func start_pty(command []string, dir string, cols, rows int) (*os.File, *exec.Cmd, error) {
+	ptmx, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	var unlock int32
+	var n uint32
+	if err := pty_ioctl(ptmx, syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)); err != nil {
+		ptmx.Close()
+		return nil, nil, err
+	}
+	if err := pty_ioctl(ptmx, syscall.TIOCGPTN, unsafe.Pointer(&n)); err != nil {
+		ptmx.Close()
+		return nil, nil, err
+	}
+	tty, err := os.OpenFile("/dev/pts/"+strconv.Itoa(int(n)), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		ptmx.Close()
+		return nil, nil, err
+	}
+	//the child has its own copy once it's started, ours would keep reads from ending when it exits
+	defer tty.Close()
+	resize_pty(ptmx, cols, rows)
+
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "TERM=xterm-256color", "COLORTERM=truecolor")
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = tty, tty, tty
+	//a session of its own with the pty as its terminal, so ctrl+c and job control work
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true, Ctty: 0}
+	if err := cmd.Start(); err != nil {
+		ptmx.Close()
+		return nil, nil, err
+	}
+	return ptmx, cmd, nil
+}
+
+// resize_pty tells the pty, and so the program on it, how big the terminal is
+func resize_pty(ptmx *os.File, cols, rows int) error {
+	size := struct{ rows, cols, x, y uint16 }{rows: uint16(rows), cols: uint16(cols)}
+	return pty_ioctl(ptmx, syscall.TIOCSWINSZ, unsafe.Pointer(&size))
+}
+
+// pty_ioctl goes through SyscallConn rather than Fd so the file stays non-blocking and Close can end a Read
+func pty_ioctl(f *os.File, request uintptr, arg unsafe.Pointer) error {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var errno syscall.Errno
+	err = conn.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, request, uintptr(arg))
+	})
+	if err != nil {
+		return err
+	}
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
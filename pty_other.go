@@ -0,0 +1,21 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// there's only a pty implementation for linux, terminals elsewhere say so instead of running a shell
+
+var ErrNoPty = errors.New("terminals are only supported on linux")
+
+func start_pty(command []string, dir string, cols, rows int) (*os.File, *exec.Cmd, error) {
+	return nil, nil, ErrNoPty
+}
+
+func resize_pty(ptmx *os.File, cols, rows int) error {
+	return ErrNoPty
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// File → Open Recent, most recently opened first, kept next to the session
+
+const max_recent_files = 10
+
+func RecentFilesPath() string {
+	return filepath.Join(StateDir(), "recent.json")
+}
+
+// LoadRecentFiles returns the recent files list, empty if there isn't one yet
+func LoadRecentFiles() []string {
+	var recent []string
+	bs, err := os.ReadFile(RecentFilesPath())
+	if err != nil {
+		return recent
+	}
+	if err := json.Unmarshal(bs, &recent); err != nil {
+		return nil
+	}
+	return recent
+}
+
+func SaveRecentFiles(recent []string) error {
+	bs, err := json.MarshalIndent(recent, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(StateDir(), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(RecentFilesPath(), bs, 0o644)
+}
+
+// AddRecentFile moves path to the front of the recent files list
+func AddRecentFile(path string) error {
+	recent := []string{path}
+	for _, p := range LoadRecentFiles() {
+		if p != path && len(recent) < max_recent_files {
+			recent = append(recent, p)
+		}
+	}
+	return SaveRecentFiles(recent)
+}
+
+// RemoveRecentFile takes path off the list, for files that have gone away
+func RemoveRecentFile(path string) error {
+	recent := []string{}
+	for _, p := range LoadRecentFiles() {
+		if p != path {
+			recent = append(recent, p)
+		}
+	}
+	return SaveRecentFiles(recent)
+}
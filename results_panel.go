@@ -0,0 +1,294 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+)
+
+// logical pixels
+const result_row_padding = 3
+
+// the panel group doesn't get dragged shorter than this, in logical pixels
+const panel_min_height = 60
+
+// ResultItem is one line of a ResultsPanel, activating it jumps to Location
+type ResultItem struct {
+	Location NavLocation
+	Label    string      //where it is, like main.go:12
+	Preview  string      //the line of code there
+	Color    color.Color //drawn as a square before the label if set, like a problem's severity
+}
+
+// ResultsPanel lists places in the code, like the references to a symbol
+// it lives in the panel group under the editors and isn't saved with the session
+type ResultsPanel struct {
+	image.Rectangle
+	title        string
+	items        []ResultItem
+	scroll       int //rows scrolled off the top
+	hovered      int
+	selected     int
+	focused      bool
+	empty        string       //what it says when there are no items
+	jump_request *NavLocation //where the editor should jump next time it asks
+}
+
+var _ Widget = &ResultsPanel{}
+var _ Jumper = &ResultsPanel{}
+
+func NewResultsPanel(title string, items []ResultItem) *ResultsPanel {
+	return &ResultsPanel{title: title, items: items, hovered: -1, selected: -1, empty: "Nothing found"}
+}
+
+// ShowResults lists items in a results panel under the editors, replacing one with the same title
+func (g *Editor) ShowResults(title string, items []ResultItem) {
+	g.ShowPanel(NewResultsPanel(fmt.Sprintf("%s (%d)", title, len(items)), items))
+}
+
+// ShowPanel shows w in the panel group under the editors, making the group if it isn't there
+// a panel whose title starts the same way as w's is replaced, so asking again doesn't pile up tabs
+func (g *Editor) ShowPanel(w Widget) {
+	if g.panel_tabs == nil || !InTree(g.MainWidget, g.panel_tabs) {
+		g.panel_tabs = NewTabs()
+		root := g.MainWidget
+		if mb, ok := root.(*MenuBar); ok {
+			root = mb.WidgetIApplyTo
+		}
+		sp := NewSplitPane(SplitVertical, root, g.panel_tabs)
+		sp.Panes[0].Fraction, sp.Panes[1].Fraction = 0.7, 0.3
+		sp.Panes[1].MinSize = panel_min_height
+		if mb, ok := g.MainWidget.(*MenuBar); ok {
+			mb.WidgetIApplyTo = sp
+		} else {
+			g.MainWidget = sp
+		}
+	}
+	kind := panel_kind(w.Title())
+	for i, tab := range g.panel_tabs.Tabs {
+		if panel_kind(tab.Title()) == kind {
+			g.panel_tabs.Tabs[i] = w
+			g.panel_tabs.Select(i)
+			g.Rebuild()
+			g.Focus(w)
+			return
+		}
+	}
+	g.panel_tabs.AddTab(w)
+	g.Rebuild()
+	g.Focus(w)
+}
+
+// RevealPanel shows w in the panel group like ShowPanel, switching to its tab if it's already there,
+// but leaves focus with whatever has it
+func (g *Editor) RevealPanel(w Widget) {
+	if !InTree(g.MainWidget, w) {
+		focused := g.last_keyboard_consumer
+		g.ShowPanel(w)
+		if focused != nil && InTree(g.MainWidget, focused) {
+			g.Focus(focused)
+		}
+	} else if tabs, ok := FindParent(g.MainWidget, w).(*Tabs); ok {
+		tabs.Select(tabs.IndexOf(w))
+	}
+}
+
+// panel_kind is the first word of a panel's title, "References to x" and "References to y" share a tab
+func panel_kind(title string) string {
+	if i := strings.IndexByte(title, ' '); i >= 0 {
+		return title[:i]
+	}
+	return title
+}
+
+func (rp *ResultsPanel) row_height() int {
+	return MainLineHeight() + 2*Px(result_row_padding)
+}
+
+func (rp *ResultsPanel) clamp_scroll() {
+	rp.scroll = max(0, min(rp.scroll, len(rp.items)-rp.Dy()/rp.row_height()))
+}
+
+// scroll_to scrolls just far enough that row i is showing
+func (rp *ResultsPanel) scroll_to(i int) {
+	showing := max(1, rp.Dy()/rp.row_height())
+	if i < rp.scroll {
+		rp.scroll = i
+	} else if i >= rp.scroll+showing {
+		rp.scroll = i - showing + 1
+	}
+	rp.clamp_scroll()
+}
+
+func (rp *ResultsPanel) row_rect(i int) image.Rectangle {
+	y := rp.Min.Y + (i-rp.scroll)*rp.row_height()
+	return image.Rect(rp.Min.X, y, rp.Max.X, y+rp.row_height())
+}
+
+// row_at is the row under (x, y), -1 if there isn't one
+func (rp *ResultsPanel) row_at(x, y int) int {
+	if !image.Pt(x, y).In(rp.Rectangle) {
+		return -1
+	}
+	i := (y-rp.Min.Y)/rp.row_height() + rp.scroll
+	if i >= len(rp.items) {
+		return -1
+	}
+	return i
+}
+
+func (rp *ResultsPanel) activate(i int) {
+	if i < 0 || i >= len(rp.items) {
+		return
+	}
+	loc := rp.items[i].Location
+	rp.jump_request = &loc
+}
+
+// TakeJumpRequest implements Jumper
+func (rp *ResultsPanel) TakeJumpRequest() (NavLocation, bool) {
+	loc := rp.jump_request
+	rp.jump_request = nil
+	if loc == nil {
+		return NavLocation{}, false
+	}
+	return *loc, true
+}
+
+/*
+Widget
+*/
+
+// Title implements Widget
+func (rp *ResultsPanel) Title() string {
+	return rp.title
+}
+
+// Focus implements Focuser
+func (rp *ResultsPanel) Focus() {
+	rp.focused = true
+}
+
+// KeyboardFocusLost implements Widget
+func (rp *ResultsPanel) KeyboardFocusLost() {
+	rp.focused = false
+}
+
+// SetRect implements Widget
+func (rp *ResultsPanel) SetRect(rect image.Rectangle) {
+	rp.Rectangle = rect
+	rp.clamp_scroll()
+}
+
+// Draw implements Widget
+func (rp *ResultsPanel) Draw(target *ebiten.Image) {
+	DrawRect(target, rp.Rectangle, Style.BGColorMuted)
+	clipped, ok := target.SubImage(rp.Rectangle).(*ebiten.Image)
+	if !ok {
+		return
+	}
+	if len(rp.items) == 0 {
+		text.Draw(clipped, rp.empty, MainFontFace, rp.Min.X+Px(result_row_padding), rp.Min.Y+MainFontPeriodFromTop+Px(result_row_padding), Style.FGColorMuted)
+		return
+	}
+	label_width := 0
+	for _, item := range rp.items {
+		label_width = max(label_width, text.BoundString(MainFontFace, item.Label).Dx())
+	}
+	for i := rp.scroll; i < len(rp.items); i++ {
+		r := rp.row_rect(i)
+		if r.Min.Y >= rp.Max.Y {
+			break
+		}
+		switch {
+		case i == rp.selected && rp.focused:
+			DrawRect(clipped, r, Style.BlueMuted)
+		case i == rp.selected || i == rp.hovered:
+			DrawRect(clipped, r, Style.BGColorStrong)
+		}
+		x := r.Min.X + Px(result_row_padding)
+		baseline := r.Min.Y + MainFontPeriodFromTop + Px(result_row_padding)
+		if col := rp.items[i].Color; col != nil {
+			size := MainLineHeight() / 2
+			DrawRect(clipped, image.Rect(0, 0, size, size).Add(image.Pt(x, r.Min.Y+(r.Dy()-size)/2)), col)
+			x += size + Px(result_row_padding)*2
+		}
+		text.Draw(clipped, rp.items[i].Label, MainFontFace, x, baseline, Style.FGColorStrong)
+		text.Draw(clipped, strings.TrimSpace(rp.items[i].Preview), CodeFontFace, x+label_width+Px(result_row_padding)*4, baseline, Style.FGColorMuted)
+	}
+}
+
+// TakeKeyboard implements Widget
+func (rp *ResultsPanel) TakeKeyboard() {
+	if len(rp.items) == 0 {
+		return
+	}
+	switch {
+	case KeyJustPressedOrKeyRepeated(ebiten.KeyDown):
+		rp.selected = min(rp.selected+1, len(rp.items)-1)
+	case KeyJustPressedOrKeyRepeated(ebiten.KeyUp):
+		rp.selected = max(rp.selected-1, 0)
+	case inpututil.IsKeyJustPressed(ebiten.KeyEnter):
+		rp.activate(rp.selected)
+	default:
+		return
+	}
+	if rp.selected >= 0 {
+		rp.scroll_to(rp.selected)
+	}
+}
+
+// MouseOut implements Widget
+func (rp *ResultsPanel) MouseOut() {
+	rp.hovered = -1
+}
+
+// MouseOver implements Widget
+func (rp *ResultsPanel) MouseOver(x int, y int) Widget {
+	ebiten.SetCursorShape(ebiten.CursorShapeDefault)
+	if _, dy := ebiten.Wheel(); dy != 0 {
+		rp.scroll -= int(dy * 3)
+		rp.clamp_scroll()
+	}
+	rp.hovered = rp.row_at(x, y)
+	return rp
+}
+
+// LMouseDown implements Widget, a click jumps to the result
+func (rp *ResultsPanel) LMouseDown(x int, y int) Widget {
+	if i := rp.row_at(x, y); i >= 0 {
+		rp.selected = i
+		rp.activate(i)
+	}
+	return rp
+}
+
+// LMouseUp implements Widget
+func (rp *ResultsPanel) LMouseUp(x int, y int) Widget {
+	return rp
+}
+
+// RMouseDown implements Widget
+func (rp *ResultsPanel) RMouseDown(x int, y int) Widget {
+	return rp
+}
+
+// RMouseUp implements Widget
+func (rp *ResultsPanel) RMouseUp(x int, y int) Widget {
+	return nil
+}
+
+// MMouseDown implements Widget
+func (*ResultsPanel) MMouseDown(x int, y int) Widget {
+	return nil
+}
+
+// MMouseUp implements Widget
+func (*ResultsPanel) MMouseUp(x int, y int) Widget {
+	return nil
+}
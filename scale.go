@@ -0,0 +1,87 @@
+package main
+
+import (
+	"math"
+)
+
+// HiDPI, the screen we draw on is in physical pixels so text is as sharp as the monitor allows
+// sizes are given in logical pixels, font sizes and the paddings in style.go, and Px turns them physical
+// the scale is the monitor's, so a window dragged to a monitor with a different scale gets redone at the new one
+
+// UIScale is physical pixels per logical pixel
+var UIScale = 1.0
+
+// Px is how many physical pixels the given number of logical pixels comes to
+func Px(logical int) int {
+	return int(math.Round(float64(logical) * UIScale))
+}
+
+// the paddings style.go sets in logical pixels, scaled in place by SetUIScale
+var scaled_metrics = []*int{
+	&text_edit_top_padding,
+	&tab_x_padding,
+	&tab_y_padding,
+	&menu_bar_x_padding,
+	&menu_bar_y_padding,
+	&menu_x_padding,
+	&menu_y_padding,
+}
+
+// what scaled_metrics were before anything scaled them
+var logical_metrics []int
+
+func init() {
+	for _, m := range scaled_metrics {
+		logical_metrics = append(logical_metrics, *m)
+	}
+}
+
+// LogicalMetric is what one of scaled_metrics is in logical pixels
+func LogicalMetric(m *int) int {
+	for i, sm := range scaled_metrics {
+		if sm == m {
+			return logical_metrics[i]
+		}
+	}
+	return *m
+}
+
+// SetLogicalMetric sets one of scaled_metrics, given in logical pixels
+func SetLogicalMetric(m *int, logical int) {
+	for i, sm := range scaled_metrics {
+		if sm == m {
+			logical_metrics[i] = logical
+			*m = Px(logical)
+			return
+		}
+	}
+}
+
+// MainLineHeight is how tall a line of MainFont is on screen
+func MainLineHeight() int {
+	return Px(MainFontSize)
+}
+
+// MenuLineHeight is how tall a line of MenuFont is on screen
+func MenuLineHeight() int {
+	return Px(MenuFontSize)
+}
+
+// CodeLineHeight is how tall a line of code is on screen
+func CodeLineHeight() int {
+	return Px(CodeFontSize)
+}
+
+// SetUIScale switches to scale physical pixels per logical one, remaking the fonts at the new resolution
+// it reports whether anything changed
+func SetUIScale(scale float64) bool {
+	if scale <= 0 || scale == UIScale {
+		return false
+	}
+	UIScale = scale
+	for i, m := range scaled_metrics {
+		*m = Px(logical_metrics[i])
+	}
+	MakeFaces()
+	return true
+}
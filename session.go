@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// WidgetDescriptor is the saveable form of a widget in the layout tree
+// only the fields that matter for Kind are filled in
+type WidgetDescriptor struct {
+	Kind string `json:"kind"`
+
+	//splits
+	Orientation SplitOrientation    `json:"orientation,omitempty"`
+	Fractions   []float64           `json:"fractions,omitempty"`
+	Collapsed   []bool              `json:"collapsed,omitempty"`
+	MinSizes    []int               `json:"min_sizes,omitempty"`
+	MaxSizes    []int               `json:"max_sizes,omitempty"`
+	Children    []*WidgetDescriptor `json:"children,omitempty"`
+
+	//tabs
+	ActiveTab int `json:"active_tab,omitempty"`
+
+	//editors
+	File      string  `json:"file,omitempty"`
+	CursorRow int     `json:"cursor_row,omitempty"`
+	CursorCol int     `json:"cursor_col,omitempty"`
+	Scroll    float64 `json:"scroll,omitempty"`
+}
+
+// Describable widgets can be written to the session file and rebuilt with BuildWidget
+type Describable interface {
+	Describe() *WidgetDescriptor
+}
+
+var _ Describable = &Tabs{}
+var _ Describable = &SplitPane{}
+var _ Describable = &HorizontalSplitter{}
+var _ Describable = &VerticalSplitter{}
+var _ Describable = &TextEditor{}
+var _ Describable = &DataPane{}
+var _ Describable = &FileTree{}
+var _ Describable = &SettingsEditor{}
+
+// Session is everything that gets restored on the next launch
+type Session struct {
+	WindowWidth  int               `json:"window_width"`
+	WindowHeight int               `json:"window_height"`
+	Fullscreen   bool              `json:"fullscreen"`
+	Layout       *WidgetDescriptor `json:"layout"`
+}
+
+// StateDir is where we keep things between runs, following the XDG base directory spec
+func StateDir() string {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "ide")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".ide-state"
+	}
+	return filepath.Join(home, ".local", "state", "ide")
+}
+
+// ConfigDir is where the user's own settings, themes and so on go
+func ConfigDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return filepath.Join(StateDir(), "config")
+	}
+	return filepath.Join(dir, "ide")
+}
+
+func SessionPath() string {
+	return filepath.Join(StateDir(), "session.json")
+}
+
+// Describe returns w's descriptor, nil for widgets that don't get saved
+func Describe(w Widget) *WidgetDescriptor {
+	if d, ok := w.(Describable); ok {
+		return d.Describe()
+	}
+	return nil
+}
+
+var ErrNothingToRestore = errors.New("nothing left to restore")
+
+// BuildWidget makes the widget tree d describes
+// parts that can't be rebuilt (files that were deleted since) are dropped and the tree closes up around them
+func BuildWidget(d *WidgetDescriptor) (Widget, error) {
+	return build_widget(d, map[string]*TextBuffer{})
+}
+
+// build_widget is BuildWidget, with the buffers loaded so far so a file in several places is only loaded once
+func build_widget(d *WidgetDescriptor, loaded map[string]*TextBuffer) (Widget, error) {
+	if d == nil {
+		return nil, ErrNothingToRestore
+	}
+	switch d.Kind {
+	case "editor":
+		if d.File == "" {
+			return NewTextEditor(nil), nil
+		}
+		var te *TextEditor
+		if buf, ok := loaded[d.File]; ok {
+			te = BufferEditor(buf)
+		} else {
+			var err error
+			if te, err = OpenTextEditor(d.File); err != nil {
+				return nil, err
+			}
+			loaded[d.File] = te.buf
+		}
+		te.cursor = te.buf.ClampCursor(Cursor{row: d.CursorRow, col: d.CursorCol})
+		te.scroll = d.Scroll
+		return te, nil
+	case "data":
+		return NewDataPane(), nil
+	case "files":
+		return NewFileTree(d.File)
+	case "settings":
+		return NewSettingsEditor(), nil
+	case "tabs":
+		tabs := NewTabs()
+		for i, kid_desc := range d.Children {
+			kid, err := build_widget(kid_desc, loaded)
+			if err != nil {
+				log.Println("dropping tab from session:", err)
+				continue
+			}
+			if i == d.ActiveTab {
+				tabs.CurrentTab = len(tabs.Tabs)
+			}
+			tabs.Tabs = append(tabs.Tabs, kid)
+		}
+		if len(tabs.Tabs) == 0 {
+			tabs.Tabs = append(tabs.Tabs, NewTextEditor(nil))
+		}
+		return tabs, nil
+	case "split":
+		sp := NewSplitPane(d.Orientation)
+		for i, kid_desc := range d.Children {
+			kid, err := build_widget(kid_desc, loaded)
+			if err != nil {
+				log.Println("dropping pane from session:", err)
+				continue
+			}
+			pane := &Pane{Widget: kid, Fraction: 1}
+			if i < len(d.Fractions) && d.Fractions[i] > 0 {
+				pane.Fraction = d.Fractions[i]
+			}
+			if i < len(d.MinSizes) {
+				pane.MinSize = d.MinSizes[i]
+			}
+			if i < len(d.MaxSizes) {
+				pane.MaxSize = d.MaxSizes[i]
+			}
+			if i < len(d.Collapsed) && d.Collapsed[i] {
+				pane.collapsed = true
+				pane.fraction_before_collapse = pane.Fraction
+			}
+			sp.Panes = append(sp.Panes, pane)
+		}
+		switch len(sp.Panes) {
+		case 0:
+			return nil, ErrNothingToRestore
+		case 1:
+			return sp.Panes[0].Widget, nil
+		}
+		return sp, nil
+	}
+	return nil, fmt.Errorf("unknown widget kind %q", d.Kind)
+}
+
+// Snapshot describes the editor as it is right now
+func (g *Editor) Snapshot() Session {
+	w, h := ebiten.WindowSize()
+	var layout *WidgetDescriptor
+	if mb, ok := g.MainWidget.(*MenuBar); ok {
+		layout = Describe(mb.WidgetIApplyTo)
+	} else {
+		layout = Describe(g.MainWidget)
+	}
+	return Session{
+		WindowWidth:  w,
+		WindowHeight: h,
+		Fullscreen:   ebiten.IsFullscreen(),
+		Layout:       layout,
+	}
+}
+
+func SaveSession(s Session) error {
+	bs, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(StateDir(), 0o755); err != nil {
+		return err
+	}
+	//write then rename so a crash halfway through doesn't lose the old session
+	tmp := SessionPath() + ".tmp"
+	if err := os.WriteFile(tmp, bs, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, SessionPath())
+}
+
+func LoadSession() (Session, error) {
+	var s Session
+	bs, err := os.ReadFile(SessionPath())
+	if err != nil {
+		return s, err
+	}
+	err = json.Unmarshal(bs, &s)
+	return s, err
+}
+
+// RestoreLayout builds the saved layout, falling back to the default one if there's nothing usable
+func (s Session) RestoreLayout(fallback func() Widget) Widget {
+	w, err := BuildWidget(s.Layout)
+	if err != nil {
+		log.Println("couldn't restore layout:", err)
+		return fallback()
+	}
+	return w
+}
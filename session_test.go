@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuildWidgetSharesBuffers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.go")
+	if err := os.WriteFile(path, []byte("package main\n\nfunc main() {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	other := filepath.Join(t.TempDir(), "other.go")
+	if err := os.WriteFile(other, []byte("package other\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	editor := func(file string, row int) *WidgetDescriptor {
+		return &WidgetDescriptor{Kind: "editor", File: file, CursorRow: row}
+	}
+	w, err := BuildWidget(&WidgetDescriptor{
+		Kind:        "split",
+		Orientation: SplitHorizontal,
+		Children: []*WidgetDescriptor{
+			{Kind: "tabs", Children: []*WidgetDescriptor{editor(path, 0), editor(other, 0)}},
+			{Kind: "tabs", Children: []*WidgetDescriptor{editor(path, 2)}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var editors []*TextEditor
+	Walk(w, func(w Widget) {
+		if te, ok := w.(*TextEditor); ok {
+			editors = append(editors, te)
+		}
+	})
+	if len(editors) != 3 {
+		t.Fatalf("restored %d editors, want 3", len(editors))
+	}
+	left, right := editors[0], editors[2]
+	if left.buf != right.buf {
+		t.Errorf("%s was loaded twice", path)
+	}
+	if left.buf == editors[1].buf {
+		t.Errorf("different files share a buffer")
+	}
+	if left.cursor.row != 0 || right.cursor.row != 2 {
+		t.Errorf("cursors are on rows %d and %d, want 0 and 2", left.cursor.row, right.cursor.row)
+	}
+}
+
+func TestBuildWidgetDeletedFile(t *testing.T) {
+	dir := t.TempDir()
+	kept := filepath.Join(dir, "kept.go")
+	if err := os.WriteFile(kept, []byte("package kept\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	gone := filepath.Join(dir, "gone.go")
+	if err := os.WriteFile(gone, []byte("package gone\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	d := &WidgetDescriptor{
+		Kind:        "split",
+		Orientation: SplitHorizontal,
+		Children: []*WidgetDescriptor{
+			{Kind: "tabs", ActiveTab: 2, Children: []*WidgetDescriptor{
+				{Kind: "editor", File: gone}, {Kind: "editor", File: kept}, {Kind: "editor", File: gone},
+			}},
+			{Kind: "tabs", Children: []*WidgetDescriptor{{Kind: "editor", File: gone}}},
+			{Kind: "editor", File: gone},
+		},
+	}
+	//saved while the file was there, restored after it was deleted
+	if err := os.Remove(gone); err != nil {
+		t.Fatal(err)
+	}
+	w, err := BuildWidget(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sp, ok := w.(*SplitPane)
+	if !ok || len(sp.Panes) != 2 {
+		t.Fatalf("restored %T, want a split of the two tab groups", w)
+	}
+	first, second := sp.Panes[0].Widget.(*Tabs), sp.Panes[1].Widget.(*Tabs)
+	if len(first.Tabs) != 1 || first.Tabs[0].(*TextEditor).buf.filepath != kept {
+		t.Errorf("first group has %d tabs, want just %s", len(first.Tabs), kept)
+	}
+	if first.CurrentTab != 0 {
+		t.Errorf("active tab %d is out of range", first.CurrentTab)
+	}
+	if len(second.Tabs) != 1 {
+		t.Fatalf("emptied group has %d tabs, want an untitled editor", len(second.Tabs))
+	}
+	if te, ok := second.Tabs[0].(*TextEditor); !ok || te.buf.filepath != "" || te.Dirty() {
+		t.Errorf("emptied group got %T instead of an untouched untitled editor", second.Tabs[0])
+	}
+}
@@ -0,0 +1,506 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Settings, every option the user can change lives in the registry below
+// each one is a package global with a key, the value it starts with is its default
+// the user's settings.json in ConfigDir overrides the defaults and the workspace's .ide/settings.json overrides both
+//
+//	{
+//		"editor.tab_width": 2,
+//		"theme": "solarized-dark"
+//	}
+//
+// changes apply straight away, the files are watched like the theme is so editing them by hand works too
+
+type SettingKind int
+
+const (
+	SettingInt SettingKind = iota
+	SettingBool
+	SettingChoice
+	SettingString
+)
+
+// SettingsLayer is where a setting's value comes from, later layers win
+type SettingsLayer int
+
+const (
+	DefaultSettings SettingsLayer = iota
+	UserSettings
+	WorkspaceSettings
+)
+
+func (l SettingsLayer) String() string {
+	switch l {
+	case UserSettings:
+		return "user"
+	case WorkspaceSettings:
+		return "workspace"
+	}
+	return "default"
+}
+
+// what has to be redone once a setting changes, on top of its own on_change
+type setting_effect int
+
+const (
+	effect_none     setting_effect = 0
+	effect_relayout setting_effect = 1 << iota //sizes changed, everything gets SetRect again
+	effect_restyle                             //cached drawings are stale
+)
+
+// Setting is one option, values are int for SettingInt, bool for SettingBool and string for SettingChoice and SettingString
+type Setting struct {
+	Key         string
+	Description string
+	Kind        SettingKind
+	Default     interface{}
+	Min, Max    int             //SettingInt only, inclusive
+	Choices     func() []string //SettingChoice only
+
+	get       func() interface{}
+	set       func(v interface{})
+	on_change func()
+	effect    setting_effect
+}
+
+// Then runs f after the setting changes, and redoes what effect says
+func (s *Setting) Then(f func(), effect setting_effect) *Setting {
+	s.on_change = f
+	s.effect = effect
+	return s
+}
+
+// Value is the setting's current value
+func (s *Setting) Value() interface{} {
+	return s.get()
+}
+
+// Source is the layer the setting's current value comes from
+func (s *Setting) Source() SettingsLayer {
+	for l := WorkspaceSettings; l > DefaultSettings; l-- {
+		if _, ok := settings_files[l].values[s.Key]; ok {
+			return l
+		}
+	}
+	return DefaultSettings
+}
+
+// Format is v the way the settings editor shows it and Parse reads it
+func (s *Setting) Format(v interface{}) string {
+	switch v := v.(type) {
+	case int:
+		return strconv.Itoa(v)
+	case bool:
+		if v {
+			return "on"
+		}
+		return "off"
+	case string:
+		return v
+	}
+	return fmt.Sprint(v)
+}
+
+var ErrBadSetting = errors.New("invalid setting")
+
+// Parse reads a value for s typed into the settings editor
+func (s *Setting) Parse(text string) (interface{}, error) {
+	text = strings.TrimSpace(text)
+	var v interface{}
+	switch s.Kind {
+	case SettingInt:
+		n, err := strconv.Atoi(text)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s wants a whole number", ErrBadSetting, s.Key)
+		}
+		v = n
+	case SettingBool:
+		switch strings.ToLower(text) {
+		case "on", "true", "yes", "1":
+			v = true
+		case "off", "false", "no", "0":
+			v = false
+		default:
+			return nil, fmt.Errorf("%w: %s is on or off", ErrBadSetting, s.Key)
+		}
+	case SettingChoice, SettingString:
+		v = text
+	}
+	return v, s.Check(v)
+}
+
+// Check says whether v is something s can be set to
+func (s *Setting) Check(v interface{}) error {
+	switch s.Kind {
+	case SettingInt:
+		n, ok := v.(int)
+		if !ok {
+			return fmt.Errorf("%w: %s wants a whole number", ErrBadSetting, s.Key)
+		}
+		if n < s.Min || n > s.Max {
+			return fmt.Errorf("%w: %s goes from %d to %d", ErrBadSetting, s.Key, s.Min, s.Max)
+		}
+	case SettingBool:
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%w: %s is on or off", ErrBadSetting, s.Key)
+		}
+	case SettingChoice:
+		str, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%w: %s wants a name", ErrBadSetting, s.Key)
+		}
+		for _, c := range s.Choices() {
+			if c == str {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: %s can't be %q", ErrBadSetting, s.Key, str)
+	case SettingString:
+		if _, ok := v.(string); !ok {
+			return fmt.Errorf("%w: %s wants some text", ErrBadSetting, s.Key)
+		}
+	}
+	return nil
+}
+
+// decode reads s's value out of a settings file
+func (s *Setting) decode(raw json.RawMessage) (interface{}, error) {
+	var v interface{}
+	var err error
+	switch s.Kind {
+	case SettingInt:
+		var n int
+		err = json.Unmarshal(raw, &n)
+		v = n
+	case SettingBool:
+		var b bool
+		err = json.Unmarshal(raw, &b)
+		v = b
+	case SettingChoice, SettingString:
+		var str string
+		err = json.Unmarshal(raw, &str)
+		v = str
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrBadSetting, s.Key, err)
+	}
+	return v, s.Check(v)
+}
+
+/*
+The registry
+*/
+
+func int_setting(key, description string, v *int, lo, hi int) *Setting {
+	return int_setting_func(key, description, func() int { return *v }, func(n int) { *v = n }, lo, hi)
+}
+
+func int_setting_func(key, description string, get func() int, set func(int), lo, hi int) *Setting {
+	return &Setting{
+		Key: key, Description: description, Kind: SettingInt, Min: lo, Max: hi,
+		get: func() interface{} { return get() },
+		set: func(v interface{}) { set(v.(int)) },
+	}
+}
+
+func bool_setting(key, description string, v *bool) *Setting {
+	return &Setting{
+		Key: key, Description: description, Kind: SettingBool,
+		get: func() interface{} { return *v },
+		set: func(b interface{}) { *v = b.(bool) },
+	}
+}
+
+func choice_setting(key, description string, get func() string, set func(string), choices func() []string) *Setting {
+	return &Setting{
+		Key: key, Description: description, Kind: SettingChoice, Choices: choices,
+		get: func() interface{} { return get() },
+		set: func(v interface{}) { set(v.(string)) },
+	}
+}
+
+func string_setting(key, description string, v *string) *Setting {
+	return &Setting{
+		Key: key, Description: description, Kind: SettingString,
+		get: func() interface{} { return *v },
+		set: func(str interface{}) { *v = str.(string) },
+	}
+}
+
+// padding_setting is a setting for one of the paddings scale.go scales, in logical pixels
+func padding_setting(key, description string, v *int) *Setting {
+	return int_setting_func(key, description, func() int { return LogicalMetric(v) }, func(n int) { SetLogicalMetric(v, n) }, 0, 40)
+}
+
+// every setting, in the order the settings editor lists them
+var settings []*Setting
+
+func register_settings() {
+	remake_faces := func() { MakeFaces() }
+	settings = []*Setting{
+		choice_setting("theme", "colour scheme, from the built in themes and the ones in "+ThemeDir(), CurrentThemeID, use_theme, theme_ids).Then(nil, effect_restyle),
+		int_setting("font.main_size", "size of the text in tabs, the file tree and other panels", &MainFontSize, MinFontSize, MaxFontSize).Then(remake_faces, effect_relayout),
+		int_setting("font.menu_size", "size of the text in menus", &MenuFontSize, MinFontSize, MaxFontSize).Then(remake_faces, effect_relayout),
+		int_setting("font.code_size", "size of the text in editors", &CodeFontSize, MinFontSize, MaxFontSize).Then(remake_faces, effect_relayout),
+		string_setting("font.main_family", "font of the text in tabs, the file tree and other panels", &main_font.Family).Then(LoadFonts, effect_relayout|effect_restyle),
+		string_setting("font.main_style", "weight of the main font, like light or medium, empty for regular", &main_font.Style).Then(LoadFonts, effect_relayout|effect_restyle),
+		string_setting("font.menu_family", "font of the text in menus", &menu_font.Family).Then(LoadFonts, effect_relayout|effect_restyle),
+		string_setting("font.menu_style", "weight of the menu font, empty for regular", &menu_font.Style).Then(LoadFonts, effect_relayout|effect_restyle),
+		string_setting("font.code_family", "font of the text in editors", &code_font.Family).Then(LoadFonts, effect_relayout|effect_restyle),
+		string_setting("font.code_style", "weight of the code font, empty for regular", &code_font.Style).Then(LoadFonts, effect_relayout|effect_restyle),
+		string_setting("font.fallback", "fonts for characters the others don't have, separated by commas, first one that has it wins", &fallback_families).Then(LoadFonts, effect_relayout|effect_restyle),
+		bool_setting("font.ligatures", "draw programming ligatures, if the code font has them", &ligatures).Then(nil, effect_restyle),
+		int_setting("editor.tab_width", "how many spaces Tab inserts", &tab_width, 1, 16),
+		padding_setting("editor.top_padding", "space above the first line of an editor", &text_edit_top_padding).Then(nil, effect_restyle),
+		padding_setting("tabs.x_padding", "space either side of a tab's title", &tab_x_padding).Then(nil, effect_relayout),
+		padding_setting("tabs.y_padding", "space above and below a tab's title", &tab_y_padding).Then(nil, effect_relayout),
+		padding_setting("menu_bar.x_padding", "space either side of a menu bar title", &menu_bar_x_padding).Then(nil, effect_relayout),
+		padding_setting("menu_bar.y_padding", "space above and below a menu bar title", &menu_bar_y_padding).Then(nil, effect_relayout),
+		padding_setting("menu.x_padding", "space either side of a menu item", &menu_x_padding),
+		padding_setting("menu.y_padding", "space above and below a menu item", &menu_y_padding),
+		string_setting("lsp.go_server", "command that runs the Go language server, empty for none", &go_server_command).Then(restart_server("go"), effect_none),
+		string_setting("lsp.c_server", "command that runs the C language server, empty for none", &c_server_command).Then(restart_server("c"), effect_none),
+		bool_setting("format.on_save", "run files through their formatter when they're saved", &format_on_save),
+		string_setting("format.go_formatter", "command that formats Go code on stdin, like gofmt or goimports, empty for none", &go_formatter_command),
+		string_setting("format.c_formatter", "command that formats C code on stdin, empty for none", &c_formatter_command),
+		string_setting("terminal.shell", "shell new terminals run, empty for $SHELL", &terminal_shell),
+		int_setting("terminal.scrollback", "how many lines scrolled off the top of a terminal are kept", &terminal_scrollback, 0, 100000),
+		string_setting("debug.dlv_command", "command that runs delve's debug adapter, it's given --listen", &dlv_command),
+		string_setting("debug.program", "package Start Debugging runs when the focused file isn't a test, relative to the workspace", &debug_program),
+		string_setting("run.command", "command the Run menu's Run runs in the workspace", &run_command),
+		int_setting("keyboard.repeat_delay", "how long a key is held before it repeats, in 60ths of a second", &key_repeat_delay, 1, 120),
+		int_setting("keyboard.repeat_interval", "time between repeats of a held key, in 60ths of a second", &key_repeat_interval, 1, 60),
+	}
+	for _, s := range settings {
+		s.Default = s.get()
+	}
+}
+
+var ErrNoSuchSetting = errors.New("no such setting")
+
+// FindSetting is the setting called key, nil if there isn't one
+func FindSetting(key string) *Setting {
+	for _, s := range settings {
+		if s.Key == key {
+			return s
+		}
+	}
+	return nil
+}
+
+func theme_ids() []string {
+	ids := []string{}
+	for _, info := range AvailableThemes() {
+		ids = append(ids, info.ID)
+	}
+	return ids
+}
+
+func use_theme(id string) {
+	t, err := LoadTheme(id)
+	if err != nil {
+		log.Println("couldn't load theme:", err)
+		return
+	}
+	UseTheme(t)
+}
+
+/*
+The files
+*/
+
+type settings_file struct {
+	path       func() string
+	values     map[string]json.RawMessage //everything in the file, keys we don't know included so saving keeps them
+	checked_at time.Time
+}
+
+var settings_files = map[SettingsLayer]*settings_file{
+	UserSettings:      {path: UserSettingsPath},
+	WorkspaceSettings: {path: WorkspaceSettingsPath},
+}
+
+func UserSettingsPath() string {
+	return filepath.Join(ConfigDir(), "settings.json")
+}
+
+// WorkspaceDir is the project we're working on, the directory we were started in
+func WorkspaceDir() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "."
+	}
+	return dir
+}
+
+func WorkspaceSettingsPath() string {
+	return filepath.Join(WorkspaceDir(), ".ide", "settings.json")
+}
+
+// load rereads the file, keeping what it had if the file can't be read
+func (f *settings_file) load() error {
+	f.checked_at = time.Now()
+	if f.values == nil {
+		f.values = map[string]json.RawMessage{}
+	}
+	bs, err := os.ReadFile(f.path())
+	if os.IsNotExist(err) {
+		f.values = map[string]json.RawMessage{}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	values := map[string]json.RawMessage{}
+	if err := json.Unmarshal(bs, &values); err != nil {
+		return fmt.Errorf("%s: %w", f.path(), err)
+	}
+	f.values = values
+	return nil
+}
+
+func (f *settings_file) save() error {
+	bs, err := json.MarshalIndent(f.values, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(f.path()), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(f.path(), bs, 0o644); err != nil {
+		return err
+	}
+	f.checked_at = time.Now()
+	return nil
+}
+
+// LoadSettings fills the registry and applies both settings files, call it once everything else is set up
+func LoadSettings() {
+	register_settings()
+	for _, f := range settings_files {
+		if err := f.load(); err != nil {
+			log.Println("couldn't read settings:", err)
+		}
+	}
+	apply_settings()
+}
+
+// the effects of changes that haven't been carried out yet, see ApplySettingChanges
+var pending_effects setting_effect
+
+// apply_settings sets every setting to the value its layers give it
+// bad values in the files are logged and skipped, the layer under them wins instead
+func apply_settings() {
+	for _, s := range settings {
+		v := s.Default
+		for l := UserSettings; l <= WorkspaceSettings; l++ {
+			raw, ok := settings_files[l].values[s.Key]
+			if !ok {
+				continue
+			}
+			decoded, err := s.decode(raw)
+			if err != nil {
+				log.Printf("ignoring %s setting: %v", l, err)
+				continue
+			}
+			v = decoded
+		}
+		if v == s.get() {
+			continue
+		}
+		s.set(v)
+		if s.on_change != nil {
+			s.on_change()
+		}
+		pending_effects |= s.effect
+	}
+}
+
+// SetSetting sets key to v in layer's file and applies it
+func SetSetting(layer SettingsLayer, key string, v interface{}) error {
+	s := FindSetting(key)
+	f := settings_files[layer]
+	if s == nil || f == nil {
+		return fmt.Errorf("%w: %s", ErrNoSuchSetting, key)
+	}
+	if err := s.Check(v); err != nil {
+		return err
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	f.values[key] = raw
+	apply_settings()
+	return f.save()
+}
+
+// ResetSetting takes key out of layer's file, so the layer under it decides
+func ResetSetting(layer SettingsLayer, key string) error {
+	f := settings_files[layer]
+	if f == nil {
+		return fmt.Errorf("%w: %s", ErrNoSuchSetting, key)
+	}
+	if _, ok := f.values[key]; !ok {
+		return nil
+	}
+	delete(f.values, key)
+	apply_settings()
+	return f.save()
+}
+
+// ChangeSetting sets key in whichever file it currently comes from, the user's if neither has it
+// for menu commands like switching theme, so they stick without the user having to pick a layer
+func ChangeSetting(key string, v interface{}) {
+	layer := UserSettings
+	if s := FindSetting(key); s != nil && s.Source() == WorkspaceSettings {
+		layer = WorkspaceSettings
+	}
+	if err := SetSetting(layer, key, v); err != nil {
+		log.Println("couldn't change setting:", err)
+	}
+}
+
+const settings_check_interval = time.Second
+
+// ApplySettingChanges relays out and redraws for settings that changed since it was last called,
+// rereading the settings files first if they've been edited
+func (g *Editor) ApplySettingChanges() {
+	for _, f := range settings_files {
+		if time.Since(f.checked_at) < settings_check_interval {
+			continue
+		}
+		last_check := f.checked_at
+		f.checked_at = time.Now()
+		info, err := os.Stat(f.path())
+		if err != nil || !info.ModTime().After(last_check) {
+			continue
+		}
+		if err := f.load(); err != nil {
+			//probably saved halfway through an edit
+			log.Println("couldn't reload settings:", err)
+			continue
+		}
+		apply_settings()
+	}
+	effects := pending_effects
+	pending_effects = effect_none
+	if effects&effect_restyle != 0 {
+		g.Restyle()
+	}
+	if effects&effect_relayout != 0 {
+		g.Rebuild()
+	}
+}
@@ -0,0 +1,450 @@
+package main
+
+import (
+	"image"
+	"log"
+	"os"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+	"golang.org/x/image/font"
+)
+
+// logical pixels
+const settings_padding = 6
+
+// SettingsEditor lists every setting with its value and lets you change them
+// changes go into the user's settings file or the workspace's, whichever tab at the top is picked
+// on/off settings flip when clicked, choices pop up a menu and numbers and text get typed in
+type SettingsEditor struct {
+	image.Rectangle
+	layer    SettingsLayer //which file changes go into
+	scroll   int           //rows scrolled off the top
+	hovered  int
+	selected int
+	focused  bool
+
+	editing   bool //typing a new value into the selected row
+	edit_text string
+
+	err     error //why the last change to err_row didn't take
+	err_row int
+}
+
+var _ Widget = &SettingsEditor{}
+
+func NewSettingsEditor() *SettingsEditor {
+	return &SettingsEditor{layer: UserSettings, hovered: -1, err_row: -1}
+}
+
+func (se *SettingsEditor) row_height() int {
+	return 2*MainLineHeight() + 3*Px(settings_padding)
+}
+
+func (se *SettingsEditor) header_height() int {
+	return MainLineHeight() + 2*Px(settings_padding)
+}
+
+// layer_tabs are where the user and workspace tabs at the top are
+func (se *SettingsEditor) layer_tabs() map[SettingsLayer]image.Rectangle {
+	tabs := map[SettingsLayer]image.Rectangle{}
+	x := se.Min.X
+	for _, l := range []SettingsLayer{UserSettings, WorkspaceSettings} {
+		w := font.MeasureString(MainFontFace, l.String()).Round() + 4*Px(settings_padding)
+		tabs[l] = image.Rect(x, se.Min.Y, x+w, se.Min.Y+se.header_height())
+		x += w
+	}
+	return tabs
+}
+
+func (se *SettingsEditor) rows_rect() image.Rectangle {
+	r := se.Rectangle
+	r.Min.Y = min(r.Max.Y, r.Min.Y+se.header_height())
+	return r
+}
+
+func (se *SettingsEditor) clamp_scroll() {
+	se.scroll = max(0, min(se.scroll, len(settings)-se.rows_rect().Dy()/se.row_height()))
+}
+
+// scroll_to scrolls just far enough that row i is showing
+func (se *SettingsEditor) scroll_to(i int) {
+	showing := max(1, se.rows_rect().Dy()/se.row_height())
+	if i < se.scroll {
+		se.scroll = i
+	} else if i >= se.scroll+showing {
+		se.scroll = i - showing + 1
+	}
+	se.clamp_scroll()
+}
+
+func (se *SettingsEditor) row_rect(i int) image.Rectangle {
+	rows := se.rows_rect()
+	y := rows.Min.Y + (i-se.scroll)*se.row_height()
+	return image.Rect(rows.Min.X, y, rows.Max.X, y+se.row_height())
+}
+
+// row_at is the setting under (x, y), -1 if there isn't one
+func (se *SettingsEditor) row_at(x, y int) int {
+	rows := se.rows_rect()
+	if !image.Pt(x, y).In(rows) {
+		return -1
+	}
+	i := (y-rows.Min.Y)/se.row_height() + se.scroll
+	if i >= len(settings) {
+		return -1
+	}
+	return i
+}
+
+// value_x is where values start, lined up after the longest key
+func (se *SettingsEditor) value_x() int {
+	widest := 0
+	for _, s := range settings {
+		widest = max(widest, font.MeasureString(MainFontFace, s.Key).Round())
+	}
+	return se.Min.X + widest + 4*Px(settings_padding)
+}
+
+// set changes setting i in the layer being edited, remembering why if it couldn't
+func (se *SettingsEditor) set(i int, v interface{}) {
+	se.err, se.err_row = SetSetting(se.layer, settings[i].Key, v), i
+}
+
+func (se *SettingsEditor) reset(i int) {
+	se.err, se.err_row = ResetSetting(se.layer, settings[i].Key), i
+}
+
+// activate changes setting i the way suits its kind, (x, y) is where a choice menu goes
+func (se *SettingsEditor) activate(i, x, y int) {
+	if i < 0 || i >= len(settings) {
+		return
+	}
+	s := settings[i]
+	switch s.Kind {
+	case SettingBool:
+		se.set(i, !s.Value().(bool))
+	case SettingChoice:
+		items := []MenuItem{}
+		for _, c := range s.Choices() {
+			c := c
+			chosen := func() bool { return s.Value() == c }
+			items = append(items, NewToggleMenuItem(EscapeMnemonic(c), KeyShortcut{}, chosen, func() { se.set(i, c) }))
+		}
+		ShowPopup(items, x, y)
+	case SettingInt, SettingString:
+		se.editing = true
+		se.edit_text = s.Format(s.Value())
+	}
+}
+
+// step moves setting i dir along, up or down for numbers and through the list for choices
+func (se *SettingsEditor) step(i, dir int) {
+	if i < 0 || i >= len(settings) {
+		return
+	}
+	s := settings[i]
+	switch s.Kind {
+	case SettingBool:
+		se.set(i, !s.Value().(bool))
+	case SettingChoice:
+		choices := s.Choices()
+		if len(choices) == 0 {
+			return
+		}
+		at := 0
+		for j, c := range choices {
+			if c == s.Value() {
+				at = j
+			}
+		}
+		se.set(i, choices[(at+dir+len(choices))%len(choices)])
+	case SettingInt:
+		se.set(i, max(s.Min, min(s.Max, s.Value().(int)+dir)))
+	}
+}
+
+func (se *SettingsEditor) finish_edit() {
+	se.editing = false
+	s := settings[se.selected]
+	v, err := s.Parse(se.edit_text)
+	if err != nil {
+		se.err, se.err_row = err, se.selected
+		return
+	}
+	se.set(se.selected, v)
+}
+
+// SettingsFile is the path of the file for the layer being edited, made empty if it isn't there yet so it can be opened
+func (se *SettingsEditor) SettingsFile() (string, error) {
+	f := settings_files[se.layer]
+	if _, err := os.Stat(f.path()); os.IsNotExist(err) {
+		if err := f.save(); err != nil {
+			return "", err
+		}
+	}
+	return f.path(), nil
+}
+
+/*
+Widget
+*/
+
+// Title implements Widget
+func (se *SettingsEditor) Title() string {
+	return "settings"
+}
+
+// Describe implements Describable
+func (se *SettingsEditor) Describe() *WidgetDescriptor {
+	return &WidgetDescriptor{Kind: "settings"}
+}
+
+// Focus implements Focuser
+func (se *SettingsEditor) Focus() {
+	se.focused = true
+}
+
+// KeyboardFocusLost implements Widget
+func (se *SettingsEditor) KeyboardFocusLost() {
+	se.focused = false
+	se.editing = false
+}
+
+// SetRect implements Widget
+func (se *SettingsEditor) SetRect(rect image.Rectangle) {
+	se.Rectangle = rect
+	se.clamp_scroll()
+}
+
+// Draw implements Widget
+func (se *SettingsEditor) Draw(target *ebiten.Image) {
+	DrawRect(target, se.Rectangle, Style.BGColorMuted)
+	clipped, ok := target.SubImage(se.Rectangle).(*ebiten.Image)
+	if !ok {
+		return
+	}
+	pad := Px(settings_padding)
+
+	//which file changes go into, and where it is
+	tabs := se.layer_tabs()
+	right := se.Min.X
+	for l, r := range tabs {
+		col := Style.FGColorMuted
+		if l == se.layer {
+			DrawRect(clipped, r, Style.BGColorStrong)
+			col = Style.FGColorStrong
+		}
+		text.Draw(clipped, l.String(), MainFontFace, r.Min.X+2*pad, r.Min.Y+MainFontPeriodFromTop+pad, col)
+		right = max(right, r.Max.X)
+	}
+	text.Draw(clipped, settings_files[se.layer].path(), MainFontFace, right+2*pad, se.Min.Y+MainFontPeriodFromTop+pad, Style.Gray)
+
+	value_x := se.value_x()
+	for i := se.scroll; i < len(settings); i++ {
+		r := se.row_rect(i)
+		if r.Min.Y >= se.Max.Y {
+			break
+		}
+		s := settings[i]
+		switch {
+		case i == se.selected && se.focused:
+			DrawRect(clipped, r, Style.BlueMuted)
+		case i == se.selected || i == se.hovered:
+			DrawRect(clipped, r, Style.BGColorStrong)
+		}
+		first := r.Min.Y + pad + MainFontPeriodFromTop
+		second := first + MainLineHeight() + pad
+		text.Draw(clipped, s.Key, MainFontFace, r.Min.X+2*pad, first, Style.FGColorStrong)
+
+		value := s.Format(s.Value())
+		value_col := Style.FGColorMuted
+		if se.editing && i == se.selected {
+			value, value_col = se.edit_text+"_", Style.YellowStrong
+		} else if source := s.Source(); source != DefaultSettings {
+			value_col = Style.AquaStrong
+			value += "  (" + source.String() + ")"
+		}
+		text.Draw(clipped, value, MainFontFace, value_x, first, value_col)
+
+		if se.err != nil && i == se.err_row {
+			text.Draw(clipped, se.err.Error(), MainFontFace, r.Min.X+2*pad, second, Style.RedStrong)
+		} else {
+			text.Draw(clipped, s.Description, MainFontFace, r.Min.X+2*pad, second, Style.Gray)
+		}
+	}
+}
+
+// TakeKeyboard implements Widget
+func (se *SettingsEditor) TakeKeyboard() {
+	if len(settings) == 0 {
+		return
+	}
+	if se.editing {
+		var b []rune
+		b = ebiten.AppendInputChars(b)
+		se.edit_text += string(b)
+		switch {
+		case KeyJustPressedOrKeyRepeated(ebiten.KeyBackspace):
+			if r := []rune(se.edit_text); len(r) > 0 {
+				se.edit_text = string(r[:len(r)-1])
+			}
+		case inpututil.IsKeyJustPressed(ebiten.KeyEnter):
+			se.finish_edit()
+		case inpututil.IsKeyJustPressed(ebiten.KeyEscape):
+			se.editing = false
+		}
+		return
+	}
+	switch {
+	case KeyJustPressedOrKeyRepeated(ebiten.KeyDown):
+		se.selected = min(se.selected+1, len(settings)-1)
+	case KeyJustPressedOrKeyRepeated(ebiten.KeyUp):
+		se.selected = max(se.selected-1, 0)
+	case KeyJustPressedOrKeyRepeated(ebiten.KeyRight):
+		se.step(se.selected, 1)
+	case KeyJustPressedOrKeyRepeated(ebiten.KeyLeft):
+		se.step(se.selected, -1)
+	case inpututil.IsKeyJustPressed(ebiten.KeyEnter), inpututil.IsKeyJustPressed(ebiten.KeySpace):
+		r := se.row_rect(se.selected)
+		se.activate(se.selected, se.value_x(), r.Min.Y+MainLineHeight())
+	case inpututil.IsKeyJustPressed(ebiten.KeyDelete):
+		if se.selected >= 0 {
+			se.reset(se.selected)
+		}
+	case inpututil.IsKeyJustPressed(ebiten.KeyTab):
+		if se.layer == UserSettings {
+			se.layer = WorkspaceSettings
+		} else {
+			se.layer = UserSettings
+		}
+	default:
+		return
+	}
+	if se.selected >= 0 {
+		se.scroll_to(se.selected)
+	}
+}
+
+// MouseOut implements Widget
+func (se *SettingsEditor) MouseOut() {
+	se.hovered = -1
+}
+
+// MouseOver implements Widget
+func (se *SettingsEditor) MouseOver(x int, y int) Widget {
+	ebiten.SetCursorShape(ebiten.CursorShapeDefault)
+	if _, dy := ebiten.Wheel(); dy != 0 {
+		se.scroll -= int(dy * 3)
+		se.clamp_scroll()
+	}
+	se.hovered = se.row_at(x, y)
+	return se
+}
+
+// LMouseDown implements Widget, clicking a value changes it
+func (se *SettingsEditor) LMouseDown(x int, y int) Widget {
+	for l, r := range se.layer_tabs() {
+		if image.Pt(x, y).In(r) {
+			se.layer = l
+			return se
+		}
+	}
+	if se.editing {
+		se.finish_edit()
+	}
+	i := se.row_at(x, y)
+	if i < 0 {
+		return se
+	}
+	se.selected = i
+	if x >= se.value_x() {
+		se.activate(i, x, y)
+	}
+	return se
+}
+
+// LMouseUp implements Widget
+func (se *SettingsEditor) LMouseUp(x int, y int) Widget {
+	return se
+}
+
+// RMouseDown implements Widget, selects what's about to get a context menu
+func (se *SettingsEditor) RMouseDown(x int, y int) Widget {
+	if i := se.row_at(x, y); i >= 0 {
+		se.selected = i
+	}
+	return se
+}
+
+// RMouseUp implements Widget
+func (se *SettingsEditor) RMouseUp(x int, y int) Widget {
+	return se
+}
+
+// MMouseDown implements Widget
+func (*SettingsEditor) MMouseDown(x int, y int) Widget {
+	return nil
+}
+
+// MMouseUp implements Widget
+func (*SettingsEditor) MMouseUp(x int, y int) Widget {
+	return nil
+}
+
+/*
+Commands
+*/
+
+// OpenSettings shows the settings editor, switching to it if it's open already
+func (g *Editor) OpenSettings() {
+	var open *SettingsEditor
+	Walk(g.MainWidget, func(w Widget) {
+		if se, ok := w.(*SettingsEditor); ok && open == nil {
+			open = se
+		}
+	})
+	if open != nil {
+		if tabs, ok := FindParent(g.MainWidget, open).(*Tabs); ok {
+			g.ShowTab(tabs, open)
+			return
+		}
+	}
+	tabs := g.TargetTabs()
+	if tabs == nil {
+		log.Println("couldn't open settings:", ErrNoTabs)
+		return
+	}
+	se := NewSettingsEditor()
+	tabs.AddTab(se)
+	g.Focus(se)
+}
+
+// OpenSettingsFile opens the settings file se is editing as text
+func (g *Editor) OpenSettingsFile(se *SettingsEditor) {
+	path, err := se.SettingsFile()
+	if err != nil {
+		log.Println("couldn't open settings file:", err)
+		return
+	}
+	if err := g.OpenFile(path); err != nil {
+		log.Println("couldn't open settings file:", err)
+	}
+}
+
+func (g *Editor) settings_context_menu(se *SettingsEditor) []MenuItem {
+	i := se.selected
+	set_here := func() bool {
+		if i < 0 || i >= len(settings) {
+			return false
+		}
+		_, ok := settings_files[se.layer].values[settings[i].Key]
+		return ok
+	}
+	return []MenuItem{
+		NewActionMenuItem("&Reset", KeyShortcut{key: ebiten.KeyDelete}, func() { se.reset(i) }).WhenEnabled(set_here),
+		NewMenuSeparator(),
+		NewActionMenuItem("&Open "+se.layer.String()+" settings.json", KeyShortcut{}, func() { g.OpenSettingsFile(se) }),
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"image"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"golang.org/x/image/font"
+)
+
+// Snippets are completions with tab stops in them, in the syntax language servers use
+// $1 and ${1:placeholder} are where Tab goes next, $0 is where the cursor ends up
+
+// SnippetStop is a tab stop in a snippet's text, From and To are byte offsets
+type SnippetStop struct {
+	Index    int
+	From, To int
+}
+
+// ParseSnippet is the text a snippet inserts and where its tab stops are in it
+// choices insert their first option and variables their default, we don't know any variables' values
+func ParseSnippet(s string) (string, []SnippetStop) {
+	p := snippet_parser{src: s}
+	p.parse(false)
+	return p.out.String(), p.stops
+}
+
+type snippet_parser struct {
+	src    string
+	i      int
+	out    strings.Builder
+	stops  []SnippetStop
+	values map[int]string //placeholder text by index, stops with the same index repeat it
+}
+
+// parse copies text to out up to the end of src, or the } closing the placeholder it's in if nested
+func (p *snippet_parser) parse(nested bool) {
+	for p.i < len(p.src) {
+		c := p.src[p.i]
+		switch {
+		case c == '\\' && p.i+1 < len(p.src) && strings.IndexByte(`$}\,|`, p.src[p.i+1]) >= 0:
+			p.out.WriteByte(p.src[p.i+1])
+			p.i += 2
+		case c == '}' && nested:
+			return
+		case c == '$':
+			p.i++
+			p.dollar()
+		default:
+			p.out.WriteByte(c)
+			p.i++
+		}
+	}
+}
+
+func (p *snippet_parser) number() (int, bool) {
+	start := p.i
+	for p.i < len(p.src) && p.src[p.i] >= '0' && p.src[p.i] <= '9' {
+		p.i++
+	}
+	n, err := strconv.Atoi(p.src[start:p.i])
+	return n, err == nil
+}
+
+func (p *snippet_parser) name() string {
+	start := p.i
+	for p.i < len(p.src) && is_word_byte(p.src[p.i]) {
+		p.i++
+	}
+	return p.src[start:p.i]
+}
+
+// dollar reads what comes after a $, a tab stop, a placeholder, a choice or a variable
+func (p *snippet_parser) dollar() {
+	if n, ok := p.number(); ok {
+		from := p.out.Len()
+		p.out.WriteString(p.values[n])
+		p.stops = append(p.stops, SnippetStop{Index: n, From: from, To: p.out.Len()})
+		return
+	}
+	if p.i >= len(p.src) || p.src[p.i] != '{' {
+		if p.name() == "" {
+			p.out.WriteByte('$')
+		}
+		return
+	}
+	p.i++
+	n, is_stop := p.number()
+	if !is_stop {
+		p.name()
+	}
+	from := p.out.Len()
+	if p.i < len(p.src) && p.src[p.i] == '}' && is_stop {
+		p.out.WriteString(p.values[n])
+	}
+	if p.i < len(p.src) {
+		switch p.src[p.i] {
+		case ':':
+			p.i++
+			p.parse(true)
+		case '|':
+			p.i++
+			p.choice()
+		case '/':
+			//a transform, we can't run those so the variable stays empty
+			for p.i < len(p.src) && p.src[p.i] != '}' {
+				if p.src[p.i] == '\\' {
+					p.i++
+				}
+				p.i++
+			}
+		}
+	}
+	if p.i < len(p.src) && p.src[p.i] == '}' {
+		p.i++
+	}
+	if is_stop {
+		if _, ok := p.values[n]; !ok {
+			if p.values == nil {
+				p.values = map[int]string{}
+			}
+			p.values[n] = p.out.String()[from:]
+		}
+		p.stops = append(p.stops, SnippetStop{Index: n, From: from, To: p.out.Len()})
+	}
+}
+
+// choice writes the first of ${1|one,two|}'s options
+func (p *snippet_parser) choice() {
+	first := true
+	for p.i < len(p.src) && p.src[p.i] != '|' {
+		c := p.src[p.i]
+		switch {
+		case c == '\\' && p.i+1 < len(p.src):
+			if first {
+				p.out.WriteByte(p.src[p.i+1])
+			}
+			p.i += 2
+			continue
+		case c == ',':
+			first = false
+		case first:
+			p.out.WriteByte(c)
+		}
+		p.i++
+	}
+	p.i++
+}
+
+// offset_cursor is where byte off of s is, if s was inserted at base
+func offset_cursor(base Cursor, s string, off int) Cursor {
+	s = s[:off]
+	newlines := strings.Count(s, "\n")
+	if newlines == 0 {
+		return Cursor{row: base.row, col: base.col + len(s)}
+	}
+	return Cursor{row: base.row + newlines, col: len(s) - strings.LastIndexByte(s, '\n') - 1}
+}
+
+/*
+Tabbing through an inserted snippet
+*/
+
+type snippet_stop struct {
+	index      int
+	start, end *Mark
+}
+
+type snippet_session struct {
+	stops   []snippet_stop //in the order Tab visits them, $0 last
+	current int
+	arrived uint64 //interaction tick we got to the current stop, typing straight away replaces its placeholder
+}
+
+// StartSnippet tabs through the stops of text, which has just been inserted at base
+func (te *TextEditor) StartSnippet(base Cursor, text string, stops []SnippetStop) {
+	te.EndSnippet()
+	sort.SliceStable(stops, func(i, j int) bool {
+		//$0 comes last
+		a, b := stops[i].Index, stops[j].Index
+		return a != 0 && (b == 0 || a < b)
+	})
+	s := &snippet_session{}
+	seen := map[int]bool{}
+	for _, stop := range stops {
+		//the same index twice would mirror the first, we just visit the first
+		if seen[stop.Index] {
+			continue
+		}
+		seen[stop.Index] = true
+		s.stops = append(s.stops, snippet_stop{
+			index: stop.Index,
+			start: te.buf.AddMark(offset_cursor(base, text, stop.From), false),
+			end:   te.buf.AddMark(offset_cursor(base, text, stop.To), true),
+		})
+	}
+	if !seen[0] {
+		end := offset_cursor(base, text, len(text))
+		s.stops = append(s.stops, snippet_stop{start: te.buf.AddMark(end, false), end: te.buf.AddMark(end, true)})
+	}
+	te.snippet = s
+	te.go_to_stop(0)
+}
+
+func (te *TextEditor) go_to_stop(i int) {
+	s := te.snippet
+	s.current = i
+	stop := s.stops[i]
+	te.cursor = stop.end.Cursor
+	te.Interacted()
+	s.arrived = te.last_interact_time
+	if stop.index == 0 {
+		te.EndSnippet()
+	}
+	te.MarkRedraw()
+}
+
+// NextSnippetStop moves to the snippet's next tab stop
+func (te *TextEditor) NextSnippetStop() {
+	if te.snippet != nil {
+		te.go_to_stop(te.snippet.current + 1)
+	}
+}
+
+// EndSnippet stops tabbing through the snippet, the cursor stays where it is
+func (te *TextEditor) EndSnippet() {
+	if te.snippet == nil {
+		return
+	}
+	for _, stop := range te.snippet.stops {
+		te.buf.RemoveMark(stop.start)
+		te.buf.RemoveMark(stop.end)
+	}
+	te.snippet = nil
+}
+
+// type_over_placeholder deletes the current stop's placeholder if nothing's happened since we got to it
+// so typing replaces it, returns true if there was one
+func (te *TextEditor) type_over_placeholder() bool {
+	s := te.snippet
+	if s == nil || s.arrived != te.last_interact_time {
+		return false
+	}
+	stop := s.stops[s.current]
+	if stop.start.Cursor == stop.end.Cursor || te.cursor != stop.end.Cursor {
+		return false
+	}
+	te.cursor = te.buf.Replace(stop.start.Cursor, stop.end.Cursor, "")
+	return true
+}
+
+// DrawSnippet outlines the tab stops still to come
+func (te *TextEditor) DrawSnippet(target *ebiten.Image) {
+	if te.snippet == nil {
+		return
+	}
+	for i, stop := range te.snippet.stops {
+		from, to := stop.start.Cursor, stop.end.Cursor
+		if stop.index == 0 || i < te.snippet.current || from.row != to.row {
+			continue
+		}
+		y := te.line_top(from.row)
+		if y < 0 || y >= te.Dy() {
+			continue
+		}
+		line := te.buf.lines[from.row]
+		x0 := font.MeasureString(CodeFontFace, line[:from.col]).Round()
+		x1 := max(x0+Px(2), font.MeasureString(CodeFontFace, line[:to.col]).Round())
+		col := Style.FGColorMuted
+		if i == te.snippet.current {
+			col = Style.BlueStrong
+		}
+		DrawBorders(target, image.Rect(x0, y, x1+1, y+CodeLineHeight()).Add(te.text_origin()), col)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSnippet(t *testing.T) {
+	tests := []struct {
+		snippet string
+		text    string
+		stops   []SnippetStop
+	}{
+		{"plain", "plain", nil},
+		{"foo($1)", "foo()", []SnippetStop{{1, 4, 4}}},
+		{"Println(${1:a}, ${2:b})$0", "Println(a, b)", []SnippetStop{{1, 8, 9}, {2, 11, 12}, {0, 13, 13}}},
+		{"${1:outer ${2:inner}}", "outer inner", []SnippetStop{{2, 6, 11}, {1, 0, 11}}},
+		{"${1:x} = $1", "x = x", []SnippetStop{{1, 0, 1}, {1, 4, 5}}},
+		{"${1|one,two|} ${2|a\\,b,c|}", "one a,b", []SnippetStop{{1, 0, 3}, {2, 4, 7}}},
+		{"$TM_FILENAME x ${TM_SELECTED_TEXT:def}", " x def", nil},
+		{"${1/(.*)/x/}", "", []SnippetStop{{1, 0, 0}}},
+		{`\$1 \} \\`, `$1 } \`, nil},
+		{"a $ b", "a $ b", nil},
+		{"if ${1:cond} {\n\t$0\n}", "if cond {\n\t\n}", []SnippetStop{{1, 3, 7}, {0, 11, 11}}},
+	}
+	for _, test := range tests {
+		text, stops := ParseSnippet(test.snippet)
+		if text != test.text || !reflect.DeepEqual(stops, test.stops) {
+			t.Errorf("%q: got %q %v, want %q %v", test.snippet, text, stops, test.text, test.stops)
+		}
+	}
+}
+
+func TestSnippetStops(t *testing.T) {
+	te := NewTextEditor(NewTextBuffer("x\n"))
+	text, stops := ParseSnippet("f(${2:b},\n\t${1:a})$0;")
+	te.buf.Replace(Cursor{col: 1}, Cursor{col: 1}, text)
+	te.StartSnippet(Cursor{col: 1}, text, stops)
+	want := []Cursor{{row: 1, col: 2}, {row: 0, col: 4}, {row: 1, col: 3}}
+	for i, c := range want {
+		if te.cursor != c {
+			t.Errorf("stop %d: cursor at %+v, want %+v", i, te.cursor, c)
+		}
+		te.NextSnippetStop()
+	}
+	if te.snippet != nil {
+		t.Errorf("snippet still going after $0")
+	}
+}
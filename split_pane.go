@@ -0,0 +1,453 @@
+package main
+
+import (
+	"image"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+var _ Widget = &SplitPane{}
+var _ Container = &SplitPane{}
+
+type SplitOrientation int
+
+const (
+	SplitHorizontal SplitOrientation = iota //children side by side, left to right
+	SplitVertical                           //children stacked, top to bottom
+)
+
+// ticks between two clicks on a divider for it to count as a double click
+const double_click_ticks = 20
+
+// Pane is one child of a SplitPane
+type Pane struct {
+	Widget   Widget
+	Fraction float64 //share of the split this pane gets, fractions are normalized so they don't have to add to 1
+	MinSize  int     //smallest size in logical pixels along the split direction, 0 for no limit
+	MaxSize  int     //largest size in logical pixels along the split direction, 0 for no limit
+
+	collapsed                bool
+	fraction_before_collapse float64
+}
+
+// SplitPane lays out any number of children in a row or a column with draggable dividers between them
+// Double clicking a divider collapses the smaller pane next to it, double clicking again restores it
+type SplitPane struct {
+	image.Rectangle
+	Orientation       SplitOrientation
+	Panes             []*Pane
+	border_half_width int
+	border_mode       BorderShowMode
+
+	pane_rects    []image.Rectangle
+	divider_rects []image.Rectangle
+
+	hovered_divider      int
+	dragging_divider     int
+	last_divider_click   uint64 //tick of the last click on a divider
+	last_divider_clicked int
+}
+
+// NewSplitPane splits the space evenly between widgets
+func NewSplitPane(orientation SplitOrientation, widgets ...Widget) *SplitPane {
+	sp := &SplitPane{
+		Orientation:          orientation,
+		border_half_width:    2,
+		border_mode:          ShowOnHover,
+		hovered_divider:      -1,
+		dragging_divider:     -1,
+		last_divider_clicked: -1,
+	}
+	for _, w := range widgets {
+		sp.Panes = append(sp.Panes, &Pane{Widget: w, Fraction: 1})
+	}
+	return sp
+}
+
+// Title implements Widget
+func (sp *SplitPane) Title() string {
+	return "split pane"
+}
+
+// KeyboardFocusLost implements Widget
+func (*SplitPane) KeyboardFocusLost() {
+}
+
+// TakeKeyboard implements Widget
+func (*SplitPane) TakeKeyboard() {
+}
+
+// MouseOut implements Widget
+func (sp *SplitPane) MouseOut() {
+	sp.hovered_divider = -1
+}
+
+// Children implements Container
+func (sp *SplitPane) Children() []Widget {
+	kids := make([]Widget, len(sp.Panes))
+	for i, p := range sp.Panes {
+		kids[i] = p.Widget
+	}
+	return kids
+}
+
+// ReplaceChild implements Container
+func (sp *SplitPane) ReplaceChild(old, new Widget) bool {
+	for _, p := range sp.Panes {
+		if p.Widget == old {
+			p.Widget = new
+			return true
+		}
+	}
+	return false
+}
+
+// InsertAfter adds w as a new pane right after the pane holding existing, the two share existing's space
+func (sp *SplitPane) InsertAfter(existing, w Widget) bool {
+	for i, p := range sp.Panes {
+		if p.Widget != existing {
+			continue
+		}
+		p.Fraction /= 2
+		new_pane := &Pane{Widget: w, Fraction: p.Fraction}
+		sp.Panes = append(sp.Panes[:i+1], append([]*Pane{new_pane}, sp.Panes[i+1:]...)...)
+		sp.SetRect(sp.Rectangle)
+		return true
+	}
+	return false
+}
+
+// InsertBefore adds w as a new pane right before the pane holding existing, the two share existing's space
+func (sp *SplitPane) InsertBefore(existing, w Widget) bool {
+	for i, p := range sp.Panes {
+		if p.Widget != existing {
+			continue
+		}
+		p.Fraction /= 2
+		new_pane := &Pane{Widget: w, Fraction: p.Fraction}
+		sp.Panes = append(sp.Panes[:i], append([]*Pane{new_pane}, sp.Panes[i:]...)...)
+		sp.SetRect(sp.Rectangle)
+		return true
+	}
+	return false
+}
+
+// Flatten replaces the pane holding inner with inner's own panes, they share the space it had
+func (sp *SplitPane) Flatten(inner *SplitPane) {
+	for i, p := range sp.Panes {
+		if p.Widget != inner {
+			continue
+		}
+		inner_total := 0.0
+		for _, ip := range inner.Panes {
+			inner_total += ip.Fraction
+		}
+		if inner_total <= 0 {
+			return
+		}
+		for _, ip := range inner.Panes {
+			ip.Fraction = ip.Fraction / inner_total * p.Fraction
+		}
+		sp.Panes = append(sp.Panes[:i], append(inner.Panes, sp.Panes[i+1:]...)...)
+		sp.SetRect(sp.Rectangle)
+		return
+	}
+}
+
+// RemoveChild takes the pane holding w out of the split, its space goes to the others
+func (sp *SplitPane) RemoveChild(w Widget) bool {
+	for i, p := range sp.Panes {
+		if p.Widget == w {
+			sp.Panes = append(sp.Panes[:i], sp.Panes[i+1:]...)
+			sp.SetRect(sp.Rectangle)
+			return true
+		}
+	}
+	return false
+}
+
+// Describe implements Describable
+func (sp *SplitPane) Describe() *WidgetDescriptor {
+	d := &WidgetDescriptor{Kind: "split", Orientation: sp.Orientation}
+	for _, p := range sp.Panes {
+		kid := Describe(p.Widget)
+		if kid == nil {
+			continue
+		}
+		fraction := p.Fraction
+		if p.collapsed {
+			fraction = p.fraction_before_collapse
+		}
+		d.Children = append(d.Children, kid)
+		d.Fractions = append(d.Fractions, fraction)
+		d.Collapsed = append(d.Collapsed, p.collapsed)
+		d.MinSizes = append(d.MinSizes, p.MinSize)
+		d.MaxSizes = append(d.MaxSizes, p.MaxSize)
+	}
+	return d
+}
+
+// along returns the coordinate of p along the split direction
+func (sp *SplitPane) along(p image.Point) int {
+	if sp.Orientation == SplitVertical {
+		return p.Y
+	}
+	return p.X
+}
+
+func (sp *SplitPane) length() int {
+	if sp.Orientation == SplitVertical {
+		return sp.Dy()
+	}
+	return sp.Dx()
+}
+
+// sizes works out how many pixels each pane gets, respecting collapsing and min/max sizes
+func (sp *SplitPane) sizes() []int {
+	sizes := make([]int, len(sp.Panes))
+	fixed := make([]bool, len(sp.Panes))
+	remaining := sp.length()
+	for i, p := range sp.Panes {
+		if p.collapsed {
+			fixed[i] = true
+		}
+	}
+	//clamping one pane changes what's left for the others, so go until nothing else needs clamping
+	for pass := 0; pass <= len(sp.Panes); pass++ {
+		total_fraction := 0.0
+		for i, p := range sp.Panes {
+			if !fixed[i] {
+				total_fraction += p.Fraction
+			}
+		}
+		if total_fraction <= 0 {
+			break
+		}
+		clamped := false
+		for i, p := range sp.Panes {
+			if fixed[i] {
+				continue
+			}
+			size := int(p.Fraction / total_fraction * float64(remaining))
+			if p.MinSize > 0 && size < Px(p.MinSize) {
+				size = Px(p.MinSize)
+			} else if p.MaxSize > 0 && size > Px(p.MaxSize) {
+				size = Px(p.MaxSize)
+			} else {
+				sizes[i] = size
+				continue
+			}
+			sizes[i] = size
+			fixed[i] = true
+			remaining -= size
+			clamped = true
+		}
+		if !clamped {
+			break
+		}
+	}
+	//rounding leftovers go to the last pane that can take them
+	used := 0
+	for _, s := range sizes {
+		used += s
+	}
+	for i := len(sp.Panes) - 1; i >= 0; i-- {
+		if !sp.Panes[i].collapsed {
+			sizes[i] += sp.length() - used
+			break
+		}
+	}
+	return sizes
+}
+
+// SetRect implements Widget
+func (sp *SplitPane) SetRect(rect image.Rectangle) {
+	sp.Rectangle = rect
+	sp.pane_rects = make([]image.Rectangle, len(sp.Panes))
+	sp.divider_rects = make([]image.Rectangle, max(0, len(sp.Panes)-1))
+	start := sp.along(rect.Min)
+	for i, size := range sp.sizes() {
+		r := rect
+		if sp.Orientation == SplitVertical {
+			r.Min.Y, r.Max.Y = start, start+size
+		} else {
+			r.Min.X, r.Max.X = start, start+size
+		}
+		sp.pane_rects[i] = r
+		start += size
+
+		if i < len(sp.divider_rects) {
+			d := rect
+			if sp.Orientation == SplitVertical {
+				d.Min.Y, d.Max.Y = start-Px(sp.border_half_width), start+Px(sp.border_half_width)
+			} else {
+				d.Min.X, d.Max.X = start-Px(sp.border_half_width), start+Px(sp.border_half_width)
+			}
+			sp.divider_rects[i] = d
+		}
+		if sp.Panes[i].Widget != nil && !sp.Panes[i].collapsed {
+			sp.Panes[i].Widget.SetRect(r)
+		}
+	}
+}
+
+// Draw implements Widget
+func (sp *SplitPane) Draw(target *ebiten.Image) {
+	for i, p := range sp.Panes {
+		if p.Widget != nil && !p.collapsed {
+			p.Widget.Draw(target)
+		} else if p.collapsed {
+			DrawRect(target, sp.pane_rects[i], Style.BGColorMuted)
+		}
+	}
+	for i, d := range sp.divider_rects {
+		collapsed_neighbour := sp.Panes[i].collapsed || sp.Panes[i+1].collapsed
+		if sp.border_mode == ShowAlways || i == sp.hovered_divider || i == sp.dragging_divider || collapsed_neighbour {
+			DrawRect(target, d, Style.FGColorMuted)
+		}
+	}
+}
+
+func (sp *SplitPane) divider_at(x, y int) int {
+	for i, d := range sp.divider_rects {
+		if image.Pt(x, y).In(d) {
+			return i
+		}
+	}
+	return -1
+}
+
+// visible is every child that's on screen, collapsed panes keep their old rect so they're left out
+func (sp *SplitPane) visible() []Widget {
+	kids := []Widget{}
+	for _, p := range sp.Panes {
+		if p.Widget != nil && !p.collapsed {
+			kids = append(kids, p.Widget)
+		}
+	}
+	return kids
+}
+
+func (sp *SplitPane) set_resize_cursor() {
+	if sp.Orientation == SplitVertical {
+		ebiten.SetCursorShape(ebiten.CursorShapeNSResize)
+	} else {
+		ebiten.SetCursorShape(ebiten.CursorShapeEWResize)
+	}
+}
+
+// drag_divider moves divider i to pos (screen space along the split) and takes the space from its neighbours
+func (sp *SplitPane) drag_divider(i int, pos int) {
+	before, after := sp.Panes[i], sp.Panes[i+1]
+	before.collapsed, after.collapsed = false, false
+
+	start := sp.along(sp.pane_rects[i].Min)
+	end := sp.along(sp.pane_rects[i+1].Max)
+	lo, hi := start+max(Px(before.MinSize), 5), end-max(Px(after.MinSize), 5)
+	if before.MaxSize > 0 {
+		hi = min(hi, start+Px(before.MaxSize))
+	}
+	if after.MaxSize > 0 {
+		lo = max(lo, end-Px(after.MaxSize))
+	}
+	pos = max(lo, min(pos, hi))
+
+	//keep the pair's combined fraction the same so the other panes don't move
+	shared := before.Fraction + after.Fraction
+	if end-start <= 0 {
+		return
+	}
+	before.Fraction = shared * float64(pos-start) / float64(end-start)
+	after.Fraction = shared - before.Fraction
+	sp.SetRect(sp.Rectangle)
+}
+
+// ToggleCollapse collapses the smaller pane next to divider i, or restores it if one is already collapsed
+func (sp *SplitPane) ToggleCollapse(i int) {
+	before, after := sp.Panes[i], sp.Panes[i+1]
+	for _, p := range []*Pane{before, after} {
+		if p.collapsed {
+			p.collapsed = false
+			p.Fraction = p.fraction_before_collapse
+			sp.SetRect(sp.Rectangle)
+			return
+		}
+	}
+	to_collapse := before
+	if sp.pane_rects[i+1].Dx()*sp.pane_rects[i+1].Dy() < sp.pane_rects[i].Dx()*sp.pane_rects[i].Dy() {
+		to_collapse = after
+	}
+	to_collapse.collapsed = true
+	to_collapse.fraction_before_collapse = to_collapse.Fraction
+	sp.SetRect(sp.Rectangle)
+}
+
+// MouseOver implements Widget
+func (sp *SplitPane) MouseOver(x int, y int) Widget {
+	if sp.dragging_divider >= 0 {
+		if !ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft) {
+			//let go somewhere we didn't get told about
+			sp.dragging_divider = -1
+		} else {
+			sp.set_resize_cursor()
+			sp.drag_divider(sp.dragging_divider, sp.along(image.Pt(x, y)))
+			return sp
+		}
+	}
+	sp.hovered_divider = sp.divider_at(x, y)
+	if sp.hovered_divider >= 0 {
+		sp.set_resize_cursor()
+		return sp
+	}
+	consumer := DispatchMouseOver(sp.visible(), x, y, nil)
+	if consumer == nil {
+		ebiten.SetCursorShape(ebiten.CursorShapeDefault)
+		consumer = sp
+	}
+	return consumer
+}
+
+// LMouseDown implements Widget
+func (sp *SplitPane) LMouseDown(x int, y int) Widget {
+	if d := sp.divider_at(x, y); d >= 0 {
+		if d == sp.last_divider_clicked && ticks-sp.last_divider_click < double_click_ticks {
+			sp.ToggleCollapse(d)
+			sp.last_divider_clicked = -1
+			return sp
+		}
+		sp.last_divider_clicked = d
+		sp.last_divider_click = ticks
+		sp.dragging_divider = d
+		return sp
+	}
+	return DispatchLMouseDown(sp.visible(), x, y, sp)
+}
+
+// LMouseUp implements Widget
+func (sp *SplitPane) LMouseUp(x int, y int) Widget {
+	if sp.dragging_divider >= 0 {
+		sp.dragging_divider = -1
+		return sp
+	}
+	return DispatchLMouseUp(sp.visible(), x, y, sp)
+}
+
+// RMouseDown implements Widget
+func (sp *SplitPane) RMouseDown(x int, y int) Widget {
+	return DispatchRMouseDown(sp.visible(), x, y, nil)
+}
+
+// RMouseUp implements Widget
+func (sp *SplitPane) RMouseUp(x int, y int) Widget {
+	return DispatchRMouseUp(sp.visible(), x, y, nil)
+}
+
+// MMouseDown implements Widget
+func (sp *SplitPane) MMouseDown(x int, y int) Widget {
+	return DispatchMMouseDown(sp.visible(), x, y, nil)
+}
+
+// MMouseUp implements Widget
+func (sp *SplitPane) MMouseUp(x int, y int) Widget {
+	return DispatchMMouseUp(sp.visible(), x, y, nil)
+}
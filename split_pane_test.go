@@ -0,0 +1,189 @@
+package main
+
+import (
+	"image"
+	"reflect"
+	"testing"
+)
+
+// new_split makes a split of recording widgets laid out in rect
+func new_split(orientation SplitOrientation, rect image.Rectangle, fractions ...float64) *SplitPane {
+	var events []string
+	var widgets []Widget
+	for i := range fractions {
+		widgets = append(widgets, &recording_widget{name: string(rune('a' + i)), events: &events})
+	}
+	sp := NewSplitPane(orientation, widgets...)
+	for i, f := range fractions {
+		sp.Panes[i].Fraction = f
+	}
+	sp.SetRect(rect)
+	return sp
+}
+
+// pane_sizes is how long each pane's rect is along the split
+func pane_sizes(sp *SplitPane) []int {
+	sizes := []int{}
+	for _, r := range sp.pane_rects {
+		if sp.Orientation == SplitVertical {
+			sizes = append(sizes, r.Dy())
+		} else {
+			sizes = append(sizes, r.Dx())
+		}
+	}
+	return sizes
+}
+
+func TestSplitPaneFractions(t *testing.T) {
+	tests := []struct {
+		orientation SplitOrientation
+		fractions   []float64
+		want        []int
+	}{
+		{SplitHorizontal, []float64{1, 1}, []int{200, 200}},
+		{SplitHorizontal, []float64{1, 2, 1}, []int{100, 200, 100}},
+		{SplitHorizontal, []float64{0.25, 0.75}, []int{100, 300}},
+		{SplitVertical, []float64{3, 1}, []int{300, 100}},
+		{SplitHorizontal, []float64{1, 1, 1}, []int{133, 133, 134}}, //rounding goes to the last pane
+	}
+	for _, test := range tests {
+		sp := new_split(test.orientation, image.Rect(50, 50, 450, 450), test.fractions...)
+		if got := pane_sizes(sp); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v split %v: sizes %v, want %v", test.orientation, test.fractions, got, test.want)
+		}
+		//panes cover the split end to end with no gaps
+		end := 50
+		for i, r := range sp.pane_rects {
+			if sp.along(r.Min) != end {
+				t.Errorf("%v split %v: pane %d starts at %d, want %d", test.orientation, test.fractions, i, sp.along(r.Min), end)
+			}
+			end = sp.along(r.Max)
+			if got := sp.Panes[i].Widget.(*recording_widget).Rectangle; got != r {
+				t.Errorf("%v split %v: pane %d widget got %v, want %v", test.orientation, test.fractions, i, got, r)
+			}
+		}
+		if end != 450 {
+			t.Errorf("%v split %v: panes end at %d", test.orientation, test.fractions, end)
+		}
+	}
+}
+
+func TestSplitPaneMinMaxSize(t *testing.T) {
+	sp := new_split(SplitHorizontal, image.Rect(0, 0, 400, 100), 0.1, 0.9)
+	sp.Panes[0].MinSize = 120
+	sp.SetRect(sp.Rectangle)
+	if got := pane_sizes(sp); !reflect.DeepEqual(got, []int{120, 280}) {
+		t.Errorf("min size: sizes %v, want [120 280]", got)
+	}
+	sp.drag_divider(0, 10)
+	if got := pane_sizes(sp); got[0] != 120 {
+		t.Errorf("dragged below the min size to %v", got)
+	}
+
+	sp = new_split(SplitVertical, image.Rect(0, 0, 100, 400), 1, 1)
+	sp.Panes[1].MaxSize = 100
+	sp.SetRect(sp.Rectangle)
+	if got := pane_sizes(sp); !reflect.DeepEqual(got, []int{300, 100}) {
+		t.Errorf("max size: sizes %v, want [300 100]", got)
+	}
+	sp.drag_divider(0, 50)
+	if got := pane_sizes(sp); got[1] != 100 {
+		t.Errorf("dragged past the max size to %v", got)
+	}
+}
+
+func TestSplitPaneCollapse(t *testing.T) {
+	sp := new_split(SplitHorizontal, image.Rect(0, 0, 400, 100), 1, 3)
+	sp.ToggleCollapse(0)
+	if !sp.Panes[0].collapsed || sp.Panes[1].collapsed {
+		t.Fatalf("the bigger pane was collapsed")
+	}
+	if got := pane_sizes(sp); !reflect.DeepEqual(got, []int{0, 400}) {
+		t.Errorf("collapsed sizes %v, want [0 400]", got)
+	}
+	if got := sp.visible(); len(got) != 1 || got[0] != sp.Panes[1].Widget {
+		t.Errorf("collapsed pane still counts as visible")
+	}
+
+	sp.ToggleCollapse(0)
+	if sp.Panes[0].collapsed {
+		t.Fatalf("second toggle didn't restore")
+	}
+	if got := pane_sizes(sp); !reflect.DeepEqual(got, []int{100, 300}) {
+		t.Errorf("restored sizes %v, want [100 300]", got)
+	}
+
+	//dragging a divider next to a collapsed pane brings it back
+	sp.ToggleCollapse(0)
+	sp.drag_divider(0, 200)
+	if sp.Panes[0].collapsed {
+		t.Errorf("dragging didn't restore the collapsed pane")
+	}
+}
+
+func TestSplitPaneSaved(t *testing.T) {
+	te := NewTextEditor(nil)
+	sp := NewSplitPane(SplitVertical, NewTabs(te), NewTabs(NewTextEditor(nil)))
+	sp.Panes[0].MaxSize = 900
+	sp.Panes[1].MinSize = panel_min_height
+	sp.Panes[1].Fraction = 0.3
+	sp.SetRect(image.Rect(0, 0, 400, 1000))
+	sp.ToggleCollapse(0)
+	w, err := BuildWidget(sp.Describe())
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, ok := w.(*SplitPane)
+	if !ok || len(restored.Panes) != 2 {
+		t.Fatalf("restored %T, want a split of 2", w)
+	}
+	if restored.Panes[0].MaxSize != 900 || restored.Panes[1].MinSize != panel_min_height {
+		t.Errorf("restored max %d min %d", restored.Panes[0].MaxSize, restored.Panes[1].MinSize)
+	}
+	if p := restored.Panes[1]; !p.collapsed || p.fraction_before_collapse != 0.3 {
+		t.Errorf("collapsed pane restored as collapsed %v fraction %v", p.collapsed, p.fraction_before_collapse)
+	}
+}
+
+func TestSplitRightAndDown(t *testing.T) {
+	var events []string
+	side := &recording_widget{name: "side", events: &events}
+	te := NewTextEditor(NewTextBuffer("text"))
+	editors := NewTabs(te)
+	root := NewSplitPane(SplitHorizontal, side, editors)
+	g := &Editor{MainWidget: root, screenWidth: 1000, screenHeight: 600}
+	g.Rebuild()
+	g.Focus(te)
+
+	g.SplitRight()
+	if len(root.Panes) != 3 {
+		t.Fatalf("splitting right in a horizontal split made %d panes, want 3", len(root.Panes))
+	}
+	if root.Panes[1].Fraction != root.Panes[2].Fraction {
+		t.Errorf("new group didn't get half of the old one's space")
+	}
+	right, ok := root.Panes[2].Widget.(*Tabs)
+	if !ok || len(right.Tabs) != 1 {
+		t.Fatalf("new pane is %T, want a tab group of 1", root.Panes[2].Widget)
+	}
+	view := right.Tabs[0].(*TextEditor)
+	if view == te || view.buf != te.buf {
+		t.Errorf("split didn't make a second view of the same buffer")
+	}
+	if g.FocusedEditor() != view {
+		t.Errorf("the new view isn't focused")
+	}
+
+	g.SplitDown()
+	column, ok := root.Panes[2].Widget.(*SplitPane)
+	if !ok || column.Orientation != SplitVertical || len(column.Panes) != 2 {
+		t.Fatalf("splitting down made %T, want a vertical split of 2", root.Panes[2].Widget)
+	}
+	if column.Panes[0].Widget != right {
+		t.Errorf("the group split down isn't on top")
+	}
+	top, bottom := column.pane_rects[0], column.pane_rects[1]
+	if top.Max.Y != bottom.Min.Y || top.Dx() != bottom.Dx() || top.Min.Y != 0 {
+		t.Errorf("split down laid out %v over %v", top, bottom)
+	}
+}
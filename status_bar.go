@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+	"golang.org/x/image/font"
+)
+
+// The status bar along the bottom of the window, under the widget tree rather than in it
+// it shows the last task's exit status, how many problems there are and where the cursor is
+
+// logical pixels
+const status_bar_padding = 3
+
+func status_bar_height() int {
+	return MainLineHeight() + 2*Px(status_bar_padding)
+}
+
+// main_rect is the window less the status bar, what MainWidget gets
+func (g *Editor) main_rect() image.Rectangle {
+	return image.Rect(0, 0, g.screenWidth, max(0, g.screenHeight-status_bar_height()))
+}
+
+func (g *Editor) status_rect() image.Rectangle {
+	return image.Rect(0, g.main_rect().Max.Y, g.screenWidth, g.screenHeight)
+}
+
+// status_item is a piece of the status bar, clicking it runs action if there is one
+type status_item struct {
+	text   string
+	col    color.Color
+	action func()
+}
+
+// status_items is what's in the status bar, the first ones on the left and the rest on the right
+func (g *Editor) status_items() (left, right []status_item) {
+	if run := g.task; run != nil {
+		col := Style.FGColorMuted
+		switch {
+		case run.running:
+			col = Style.BlueStrong
+		case run.Succeeded():
+			col = Style.GreenStrong
+		case !run.canceled:
+			col = Style.RedStrong
+		}
+		left = append(left, status_item{text: run.Status(), col: col, action: func() { g.ShowOutput() }})
+	}
+	if status := debug_status(); status != "" {
+		left = append(left, status_item{text: status, col: Style.YellowStrong, action: g.ShowCallStack})
+	}
+	counts := map[int]int{}
+	for _, d := range AllDiagnostics() {
+		counts[min(d.Severity, DiagnosticInfo)]++
+	}
+	problems := fmt.Sprintf("%s %d  %s %d", severity_icon(DiagnosticError), counts[DiagnosticError], severity_icon(DiagnosticWarning), counts[DiagnosticWarning])
+	col := Style.FGColorMuted
+	if counts[DiagnosticError] > 0 {
+		col = Style.RedStrong
+	}
+	right = append(right, status_item{text: problems, col: col, action: g.ShowProblems})
+	if te := g.FocusedEditor(); te != nil {
+		right = append(right, status_item{text: fmt.Sprintf("Ln %d, Col %d", te.cursor.row+1, te.cursor.col+1), col: Style.FGColorMuted})
+	}
+	return left, right
+}
+
+// status_layout is where each item goes
+func (g *Editor) status_layout() ([]status_item, []image.Rectangle) {
+	left, right := g.status_items()
+	r := g.status_rect()
+	pad := Px(status_bar_padding)
+	gap := 4 * pad
+	items := []status_item{}
+	rects := []image.Rectangle{}
+	x := r.Min.X + gap
+	for _, item := range left {
+		width := font.MeasureString(MainFontFace, item.text).Round()
+		items, rects = append(items, item), append(rects, image.Rect(x-pad, r.Min.Y, x+width+pad, r.Max.Y))
+		x += width + gap
+	}
+	x = r.Max.X - gap
+	for i := len(right) - 1; i >= 0; i-- {
+		width := font.MeasureString(MainFontFace, right[i].text).Round()
+		x -= width
+		items, rects = append(items, right[i]), append(rects, image.Rect(x-pad, r.Min.Y, x+width+pad, r.Max.Y))
+		x -= gap
+	}
+	return items, rects
+}
+
+// DrawStatusBar draws the status bar along the bottom of screen
+func (g *Editor) DrawStatusBar(screen *ebiten.Image) {
+	r := g.status_rect()
+	DrawRect(screen, r, Style.BGColorStrong)
+	mx, my := ebiten.CursorPosition()
+	items, rects := g.status_layout()
+	for i, item := range items {
+		if item.action != nil && image.Pt(mx, my).In(rects[i]) {
+			DrawRect(screen, rects[i], Translucent(Style.FGColorMuted, 0.15))
+		}
+		text.Draw(screen, item.text, MainFontFace, rects[i].Min.X+Px(status_bar_padding), r.Min.Y+Px(status_bar_padding)+MainFontPeriodFromTop, item.col)
+	}
+}
+
+// StatusBarMouse handles the mouse over the status bar, returning false if it's not there
+func (g *Editor) StatusBarMouse(x, y int) bool {
+	if !image.Pt(x, y).In(g.status_rect()) {
+		return false
+	}
+	ebiten.SetCursorShape(ebiten.CursorShapeDefault)
+	if !inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		return true
+	}
+	items, rects := g.status_layout()
+	for i, item := range items {
+		if item.action != nil && image.Pt(x, y).In(rects[i]) {
+			item.action()
+		}
+	}
+	return true
+}
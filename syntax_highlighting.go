@@ -1,31 +1,92 @@
 package main
 
 import (
+	"embed"
 	"fmt"
-	"io"
+	"io/fs"
 	"log"
-	"os"
 	"regexp"
 	"strings"
 )
 
 // literally just a nano syntax highlighter
-var definition_paths = []string{"Highlighters/go.nanorc", "Highlighters/c.nanorc"}
+// the definitions are built in so it doesn't matter where the editor is started from
+
+//go:embed Highlighters/*.nanorc
+var builtin_highlighters embed.FS
 
 // file ending to Highlighter
 var definitions []Highlighter
 
 type HighlightedExpression struct {
 	reg    *regexp.Regexp
-	fg_col string
+	scope  string //one of SyntaxScopes, "" draws it as plain text
 	bg_col string
 }
+
+// nano colour names and the scope they stand for, so nanorc files written for nano still look right
+// a color line can name a scope instead, `color keyword "\bfunc\b"`
+var nano_scopes = map[string]string{
+	"red":           "keyword",
+	"brightred":     "keyword",
+	"cyan":          "keyword",
+	"brightmagenta": "keyword",
+	"green":         "type",
+	"brightgreen":   "type",
+	"yellow":        "string",
+	"brightyellow":  "string",
+	"magenta":       "string",
+	"brightblack":   "comment",
+	"blue":          "number",
+	"brightcyan":    "number",
+	"brightblue":    "function",
+	"orange":        "operator",
+}
+
+// ScopeForColor is the scope a color line's foreground means, "" if it isn't one we know
+func ScopeForColor(fg string) string {
+	for _, scope := range SyntaxScopes {
+		if fg == scope {
+			return scope
+		}
+	}
+	return nano_scopes[fg]
+}
+
 type Highlighter struct {
 	name        string
 	file_ending *regexp.Regexp
 	comment     string
 	//string regex to string color
 	expressions []HighlightedExpression
+	//keywords and builtins listed outright in the color lines, completion offers them
+	words []HighlighterWord
+	//command that checks a file, given its path last, it prints file:line:col: message lines
+	linter string
+	//command that formats the text it's given on stdin, for languages without a format setting
+	formatter string
+}
+
+// Language is the lowercase name of the highlighter's language, like go, what settings and language servers are keyed by
+func (hl *Highlighter) Language() string {
+	return strings.ToLower(hl.name)
+}
+
+// HighlighterWord is a word a color line matches by name, like func in `color cyan "\b(func|go)\b"`
+type HighlighterWord struct {
+	Word  string
+	Scope string
+}
+
+var word_list_regex = regexp.MustCompile(`^\\b\(([A-Za-z_][A-Za-z0-9_]*(\|[A-Za-z_][A-Za-z0-9_]*)*)\)\\b$`)
+
+// listed_words is the words of a regex that's only a list of them, nil for any other regex
+func listed_words(regex string) []string {
+	m := word_list_regex.FindStringSubmatch(regex)
+	if m == nil {
+		return nil
+	}
+	return strings.Split(m[1], "|")
 }
 
 func ParseHighlighter(source string) (Highlighter, error) {
@@ -41,7 +102,7 @@ func ParseHighlighter(source string) (Highlighter, error) {
 		}
 		switch parts[0] {
 		case "syntax":
-			lang := parts[1]
+			lang := strings.Trim(parts[1], `"`)
 			regex_string := parts[2][1 : len(parts[2])-1]
 			regex, err := regexp.Compile(regex_string)
 			if err != nil {
@@ -56,6 +117,10 @@ func ParseHighlighter(source string) (Highlighter, error) {
 			comment_wout_quotes := comment_with_quotes[1 : len(comment_with_quotes)-1]
 			hl.comment = comment_wout_quotes
 			fmt.Println("comment is ", parts[1])
+		case "linter":
+			hl.linter = strings.Join(parts[1:], " ")
+		case "formatter":
+			hl.formatter = strings.Join(parts[1:], " ")
 		case "color":
 			colordef := parts[1]
 			color_parts := strings.Split(colordef, ",")
@@ -78,23 +143,22 @@ func ParseHighlighter(source string) (Highlighter, error) {
 			}
 			he := HighlightedExpression{
 				reg:    regex,
-				fg_col: fg_col,
+				scope:  ScopeForColor(fg_col),
 				bg_col: bg_col,
 			}
 			hl.expressions = append(hl.expressions, he)
+			for _, word := range listed_words(regex_wout_quotes) {
+				hl.words = append(hl.words, HighlighterWord{Word: word, Scope: he.scope})
+			}
 		}
 	}
 	return hl, nil
 }
 
 func ParseSyntaxHighlightingDefinitions() {
-	for _, filename := range definition_paths {
-		f, err := os.Open(filename)
-		if err != nil {
-			log.Println(err)
-			continue
-		}
-		bs, err := io.ReadAll(f)
+	filenames, _ := fs.Glob(builtin_highlighters, "Highlighters/*.nanorc")
+	for _, filename := range filenames {
+		bs, err := builtin_highlighters.ReadFile(filename)
 		if err != nil {
 			log.Println(err)
 			continue
@@ -108,3 +172,14 @@ func ParseSyntaxHighlightingDefinitions() {
 		definitions = append(definitions, hl)
 	}
 }
+
+// HighlighterFor picks the definition whose file ending matches path, nil if there isn't one
+func HighlighterFor(path string) *Highlighter {
+	for i := range definitions {
+		//name only gets set once the syntax line parsed, without it file_ending is empty
+		if definitions[i].name != "" && definitions[i].file_ending.MatchString(path) {
+			return &definitions[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestHighlightersAreBuiltIn(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	saved := definitions
+	defer func() { definitions = saved }()
+
+	definitions = nil
+	ParseSyntaxHighlightingDefinitions()
+	for path, language := range map[string]string{"main.go": "go", "main.c": "c"} {
+		hl := HighlighterFor(path)
+		if hl == nil {
+			t.Errorf("no highlighter for %s away from the source directory", path)
+			continue
+		}
+		if hl.Language() != language {
+			t.Errorf("%s is highlighted as %q, want %q", path, hl.Language(), language)
+		}
+	}
+}
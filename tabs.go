@@ -0,0 +1,678 @@
+package main
+
+import (
+	"image"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+	"golang.org/x/image/font"
+)
+
+var _ Widget = &Tabs{}
+
+// Dirtier is a widget with changes that aren't saved yet, its tab shows a dot instead of the close button
+type Dirtier interface {
+	Dirty() bool
+}
+
+// Closer is a widget with something to stop when its tab is closed, like a terminal's shell
+type Closer interface {
+	Close()
+}
+
+// how far the mouse has to move with a tab held before it counts as dragging, in logical pixels
+const tab_drag_threshold = 5
+
+// logical pixels the tab bar moves per notch of the scroll wheel
+const tab_scroll_step = 30
+
+type Tabs struct {
+	image.Rectangle
+	Titles          []string
+	Tabs            []Widget
+	TabHeaderRects  []image.Rectangle
+	CurrentTab      int
+	TabHeight       int
+	current_hovered int
+
+	title_widths  []int     //measured width of each title, only measured again when that title changes
+	measured_with font.Face //face the widths were measured with, a new face means measuring everything again
+	scroll        int       //how far the headers are scrolled left when they don't all fit
+	overflowing   bool      //headers are wider than the bar, show the dropdown button
+
+	close_hovered int //tab whose close button the mouse is over
+	pressed_tab   int //tab the left button went down on, -1 when not held
+	press_x       int
+	dragging_tab  bool
+
+	dropdown_open    bool
+	dropdown_hovered int
+	dropdown_rects   []image.Rectangle
+
+	close_requests []Widget //dirty tabs that were closed, the editor asks whether to save them
+}
+
+func NewTabs(tabs ...Widget) *Tabs {
+	return &Tabs{
+		current_hovered:  -1,
+		close_hovered:    -1,
+		pressed_tab:      -1,
+		dropdown_hovered: -1,
+		Tabs:             tabs,
+		CurrentTab:       0,
+		TabHeight:        2*tab_y_padding + MainLineHeight(),
+	}
+}
+
+// Title implements Widget
+func (t *Tabs) Title() string {
+	return "tabs"
+}
+
+// KeyboardFocusLost implements Widget
+func (t *Tabs) KeyboardFocusLost() {
+	t.dropdown_open = false
+}
+
+// TakeKeyboard implements Widget
+func (t *Tabs) TakeKeyboard() {
+	if t.dropdown_open && inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		t.dropdown_open = false
+	}
+}
+
+// MouseOut implements Widget
+func (t *Tabs) MouseOut() {
+	t.current_hovered = -1
+	t.close_hovered = -1
+	t.dropdown_hovered = -1
+}
+
+/*
+Public API for changing what tabs there are
+*/
+
+// AddTab puts w at the end and switches to it, returns where it went
+func (t *Tabs) AddTab(w Widget) int {
+	return t.InsertTab(len(t.Tabs), w)
+}
+
+// InsertTab puts w before tab i and switches to it
+func (t *Tabs) InsertTab(i int, w Widget) int {
+	i = max(0, min(i, len(t.Tabs)))
+	t.Tabs = append(t.Tabs[:i], append([]Widget{w}, t.Tabs[i:]...)...)
+	//the new title gets measured on the next layout
+	t.Titles = append(t.Titles[:min(i, len(t.Titles))], append([]string{""}, t.Titles[min(i, len(t.Titles)):]...)...)
+	t.title_widths = append(t.title_widths[:min(i, len(t.title_widths))], append([]int{-1}, t.title_widths[min(i, len(t.title_widths)):]...)...)
+	if !t.Rectangle.Empty() {
+		w.SetRect(t.body_rect())
+	}
+	t.Select(i)
+	return i
+}
+
+// RemoveTab takes tab i out without closing it, so it can be put somewhere else
+func (t *Tabs) RemoveTab(i int) Widget {
+	if i < 0 || i >= len(t.Tabs) {
+		return nil
+	}
+	w := t.Tabs[i]
+	t.Tabs = append(t.Tabs[:i], t.Tabs[i+1:]...)
+	if i < len(t.Titles) {
+		t.Titles = append(t.Titles[:i], t.Titles[i+1:]...)
+	}
+	if i < len(t.title_widths) {
+		t.title_widths = append(t.title_widths[:i], t.title_widths[i+1:]...)
+	}
+	if i < t.CurrentTab || t.CurrentTab >= len(t.Tabs) {
+		t.CurrentTab = max(0, t.CurrentTab-1)
+	}
+	t.current_hovered = -1
+	t.close_hovered = -1
+	t.layout_headers()
+	return w
+}
+
+// CloseTab gets rid of tab i
+// a tab with unsaved changes stays open and gets asked about instead, see TakeCloseRequests
+func (t *Tabs) CloseTab(i int) {
+	if i < 0 || i >= len(t.Tabs) {
+		return
+	}
+	if d, ok := t.Tabs[i].(Dirtier); ok && d.Dirty() {
+		for _, w := range t.close_requests {
+			if w == t.Tabs[i] {
+				return
+			}
+		}
+		t.close_requests = append(t.close_requests, t.Tabs[i])
+		return
+	}
+	t.DiscardTab(i)
+}
+
+// DiscardTab closes tab i even if it has unsaved changes
+func (t *Tabs) DiscardTab(i int) {
+	if c, ok := t.RemoveTab(i).(Closer); ok {
+		c.Close()
+	}
+}
+
+// TakeCloseRequests returns the tabs with unsaved changes that were closed since it was last called
+func (t *Tabs) TakeCloseRequests() []Widget {
+	ws := t.close_requests
+	t.close_requests = nil
+	return ws
+}
+
+// CloseOthers closes every tab except i
+func (t *Tabs) CloseOthers(i int) {
+	if i < 0 || i >= len(t.Tabs) {
+		return
+	}
+	keep := t.Tabs[i]
+	for j := len(t.Tabs) - 1; j >= 0; j-- {
+		if t.Tabs[j] != keep {
+			t.CloseTab(j)
+		}
+	}
+	t.Select(t.IndexOf(keep))
+}
+
+// MoveTab changes the order of the tabs so the one at from ends up at to
+func (t *Tabs) MoveTab(from, to int) {
+	if from < 0 || from >= len(t.Tabs) || to < 0 || to >= len(t.Tabs) || from == to {
+		return
+	}
+	current := t.current()
+	t.layout_headers()
+	w, title, width := t.Tabs[from], t.Titles[from], t.title_widths[from]
+	t.Tabs = append(t.Tabs[:from], t.Tabs[from+1:]...)
+	t.Titles = append(t.Titles[:from], t.Titles[from+1:]...)
+	t.title_widths = append(t.title_widths[:from], t.title_widths[from+1:]...)
+	t.Tabs = append(t.Tabs[:to], append([]Widget{w}, t.Tabs[to:]...)...)
+	t.Titles = append(t.Titles[:to], append([]string{title}, t.Titles[to:]...)...)
+	t.title_widths = append(t.title_widths[:to], append([]int{width}, t.title_widths[to:]...)...)
+	t.CurrentTab = t.IndexOf(current)
+	t.layout_headers()
+}
+
+// IndexOf returns which tab w is, -1 if it isn't one of ours
+func (t *Tabs) IndexOf(w Widget) int {
+	for i := range t.Tabs {
+		if t.Tabs[i] == w {
+			return i
+		}
+	}
+	return -1
+}
+
+// TabAt is the tab whose header is at (x, y), -1 if there isn't one
+func (t *Tabs) TabAt(x, y int) int {
+	t.layout_headers()
+	return t.header_at(image.Pt(x, y))
+}
+
+// Select switches to tab i and scrolls the bar so its header is showing
+func (t *Tabs) Select(i int) {
+	if i < 0 || i >= len(t.Tabs) {
+		return
+	}
+	t.CurrentTab = i
+	t.layout_headers()
+	area := t.headers_rect()
+	r := t.TabHeaderRects[i]
+	if r.Min.X < area.Min.X {
+		t.scroll -= area.Min.X - r.Min.X
+	} else if r.Max.X > area.Max.X {
+		t.scroll += r.Max.X - area.Max.X
+	}
+	t.layout_headers()
+}
+
+// CycleTab moves by dir tabs, wrapping around at the ends
+func (t *Tabs) CycleTab(dir int) {
+	if len(t.Tabs) == 0 {
+		return
+	}
+	t.Select(((t.CurrentTab+dir)%len(t.Tabs) + len(t.Tabs)) % len(t.Tabs))
+}
+
+// current is the widget of the open tab, nil if there isn't one
+func (t *Tabs) current() Widget {
+	if t.CurrentTab < 0 || t.CurrentTab >= len(t.Tabs) {
+		return nil
+	}
+	return t.Tabs[t.CurrentTab]
+}
+
+// body is the current tab as a list for the Dispatch functions, the other tabs aren't on screen
+func (t *Tabs) body() []Widget {
+	return []Widget{t.current()}
+}
+
+/*
+Geometry of the tab bar
+*/
+
+func (t *Tabs) bar_rect() image.Rectangle {
+	return image.Rect(t.Min.X, t.Min.Y, t.Max.X, t.Min.Y+t.TabHeight)
+}
+
+func (t *Tabs) body_rect() image.Rectangle {
+	r := t.Rectangle
+	r.Min.Y = min(r.Max.Y, r.Min.Y+t.TabHeight)
+	return r
+}
+
+// headers_rect is the part of the bar the headers are drawn in, everything but the dropdown button
+func (t *Tabs) headers_rect() image.Rectangle {
+	r := t.bar_rect()
+	if t.overflowing {
+		r.Max.X -= t.TabHeight
+	}
+	return r
+}
+
+func (t *Tabs) dropdown_button_rect() image.Rectangle {
+	bar := t.bar_rect()
+	return image.Rect(bar.Max.X-t.TabHeight, bar.Min.Y, bar.Max.X, bar.Max.Y)
+}
+
+func (t *Tabs) close_size() int {
+	return MainLineHeight()
+}
+
+func (t *Tabs) header_width(i int) int {
+	return tab_x_padding + max(0, t.title_widths[i]) + tab_x_padding/2 + t.close_size() + tab_x_padding/2
+}
+
+func (t *Tabs) close_rect(i int) image.Rectangle {
+	r := t.TabHeaderRects[i]
+	size := t.close_size()
+	min_x := r.Max.X - tab_x_padding/2 - size
+	min_y := r.Min.Y + (r.Dy()-size)/2
+	return image.Rect(min_x, min_y, min_x+size, min_y+size)
+}
+
+// layout_headers works out where every header goes
+// titles are only measured again when they change (or the font does) so this is cheap enough to do every frame
+func (t *Tabs) layout_headers() {
+	t.TabHeight = MainLineHeight() + 2*tab_y_padding
+	if t.measured_with != MainFontFace || len(t.Titles) != len(t.Tabs) || len(t.title_widths) != len(t.Tabs) {
+		t.measured_with = MainFontFace
+		t.Titles = make([]string, len(t.Tabs))
+		t.title_widths = make([]int, len(t.Tabs))
+		for i := range t.title_widths {
+			t.title_widths[i] = -1
+		}
+	}
+	total_width := 0
+	for i, tab := range t.Tabs {
+		if tab == nil {
+			continue
+		}
+		title := tab.Title()
+		if title != t.Titles[i] || t.title_widths[i] < 0 {
+			t.Titles[i] = title
+			t.title_widths[i] = text.BoundString(MainFontFace, title).Dx()
+		}
+		total_width += t.header_width(i)
+	}
+
+	t.overflowing = total_width > t.Dx()
+	area := t.headers_rect()
+	t.scroll = max(0, min(t.scroll, total_width-area.Dx()))
+
+	if len(t.TabHeaderRects) != len(t.Tabs) {
+		t.TabHeaderRects = make([]image.Rectangle, len(t.Tabs))
+	}
+	x := area.Min.X - t.scroll
+	for i := range t.Tabs {
+		w := t.header_width(i)
+		t.TabHeaderRects[i] = image.Rect(x, area.Min.Y, x+w, area.Max.Y)
+		x += w
+	}
+}
+
+// header_at returns the tab whose header is under pt, -1 if none
+func (t *Tabs) header_at(pt image.Point) int {
+	if !pt.In(t.headers_rect()) {
+		return -1
+	}
+	for i, r := range t.TabHeaderRects {
+		if pt.In(r) {
+			return i
+		}
+	}
+	return -1
+}
+
+// layout_dropdown makes the list of every tab that hangs under the dropdown button
+func (t *Tabs) layout_dropdown() {
+	widest := 0
+	for _, w := range t.title_widths {
+		widest = max(widest, w)
+	}
+	width := widest + 2*tab_x_padding
+	row_height := t.TabHeight
+	right := t.Max.X
+	top := t.Min.Y + t.TabHeight
+	t.dropdown_rects = make([]image.Rectangle, len(t.Tabs))
+	for i := range t.Tabs {
+		t.dropdown_rects[i] = image.Rect(right-width, top+i*row_height, right, top+(i+1)*row_height)
+	}
+}
+
+func (t *Tabs) dropdown_item_at(pt image.Point) int {
+	if !t.dropdown_open {
+		return -1
+	}
+	for i, r := range t.dropdown_rects {
+		if pt.In(r) {
+			return i
+		}
+	}
+	return -1
+}
+
+/*
+Drawing
+*/
+
+func (t *Tabs) Draw(target *ebiten.Image) {
+	t.layout_headers()
+	t.DrawTabs(target)
+	//for a myriad of reasons we can't draw the current tab
+	if current := t.current(); current != nil {
+		current.Draw(target)
+	}
+	if t.dropdown_open {
+		t.draw_dropdown(target)
+	}
+}
+
+func (t *Tabs) DrawTabs(target *ebiten.Image) {
+	DrawRect(target, t.bar_rect(), Style.BGColorMuted)
+	area := t.headers_rect()
+	clipped := target.SubImage(area).(*ebiten.Image)
+
+	for i := 0; i < len(t.Tabs); i++ {
+		my_r := t.TabHeaderRects[i]
+		if !my_r.Overlaps(area) {
+			continue
+		}
+		my_c := Style.BGColorMuted
+		if i == t.current_hovered || (t.dragging_tab && i == t.pressed_tab) {
+			my_c = Style.BGColorStrong
+		}
+
+		DrawRect(clipped, my_r, my_c)
+		text.Draw(clipped, t.Titles[i], MainFontFace, my_r.Min.X+tab_x_padding, my_r.Min.Y+MainFontPeriodFromTop+tab_y_padding, Style.FGColorStrong)
+		t.draw_close_button(clipped, i)
+		if i == t.CurrentTab {
+			ebitenutil.DrawLine(clipped, float64(my_r.Min.X), float64(my_r.Max.Y-1), float64(my_r.Max.X), float64(my_r.Max.Y-1), Style.FGColorStrong)
+		}
+	}
+	if t.overflowing {
+		t.draw_dropdown_button(target)
+	}
+}
+
+// draw_close_button draws the x for closing tab i, or a dot if the tab has unsaved changes and the mouse isn't on it
+func (t *Tabs) draw_close_button(target *ebiten.Image, i int) {
+	r := t.close_rect(i)
+	hovered := i == t.current_hovered
+	if d, ok := t.Tabs[i].(Dirtier); ok && d.Dirty() && !hovered {
+		c := image.Pt(r.Min.X+r.Dx()/2, r.Min.Y+r.Dy()/2)
+		ebitenutil.DrawCircle(target, float64(c.X), float64(c.Y), float64(r.Dx())/4, Style.FGColorMuted)
+		return
+	}
+	if !hovered && i != t.CurrentTab {
+		return
+	}
+	if i == t.close_hovered {
+		DrawRect(target, r, Style.BGColorMuted)
+	}
+	inset := r.Inset(r.Dx() / 4)
+	ebitenutil.DrawLine(target, float64(inset.Min.X), float64(inset.Min.Y), float64(inset.Max.X), float64(inset.Max.Y), Style.FGColorMuted)
+	ebitenutil.DrawLine(target, float64(inset.Min.X), float64(inset.Max.Y), float64(inset.Max.X), float64(inset.Min.Y), Style.FGColorMuted)
+}
+
+func (t *Tabs) draw_dropdown_button(target *ebiten.Image) {
+	r := t.dropdown_button_rect()
+	c := Style.BGColorMuted
+	if t.dropdown_open {
+		c = Style.BGColorStrong
+	}
+	DrawRect(target, r, c)
+	//little v pointing down
+	inset := r.Inset(r.Dx() / 3)
+	mid_x := float64(inset.Min.X+inset.Max.X) / 2
+	ebitenutil.DrawLine(target, float64(inset.Min.X), float64(inset.Min.Y), mid_x, float64(inset.Max.Y), Style.FGColorStrong)
+	ebitenutil.DrawLine(target, mid_x, float64(inset.Max.Y), float64(inset.Max.X), float64(inset.Min.Y), Style.FGColorStrong)
+}
+
+func (t *Tabs) draw_dropdown(target *ebiten.Image) {
+	t.layout_dropdown()
+	if len(t.dropdown_rects) == 0 {
+		return
+	}
+	whole := t.dropdown_rects[0].Union(t.dropdown_rects[len(t.dropdown_rects)-1])
+	DrawRect(target, whole, Style.BGColorMuted)
+	for i, r := range t.dropdown_rects {
+		if i == t.dropdown_hovered || i == t.CurrentTab {
+			DrawRect(target, r.Inset(1), Style.BGColorStrong)
+		}
+		text.Draw(target, t.Titles[i], MainFontFace, r.Min.X+tab_x_padding, r.Min.Y+MainFontPeriodFromTop+tab_y_padding, Style.FGColorStrong)
+	}
+	DrawBorders(target, whole, Style.FGColorMuted)
+}
+
+/*
+Mouse handling
+*/
+
+// drag_to moves the held tab as the mouse goes over its neighbours
+// a neighbour only swaps once the mouse is far enough over it that the swap doesn't immediately undo itself
+func (t *Tabs) drag_to(x int) {
+	for j, r := range t.TabHeaderRects {
+		if j == t.pressed_tab || x < r.Min.X || x >= r.Max.X {
+			continue
+		}
+		held_width := t.TabHeaderRects[t.pressed_tab].Dx()
+		if (j > t.pressed_tab && x > r.Max.X-held_width) || (j < t.pressed_tab && x < r.Min.X+held_width) {
+			t.MoveTab(t.pressed_tab, j)
+			t.pressed_tab = j
+		}
+		return
+	}
+}
+
+func (t *Tabs) LMouseDown(x int, y int) Widget {
+	t.layout_headers()
+	pt := image.Pt(x, y)
+	if t.overflowing && pt.In(t.dropdown_button_rect()) {
+		t.dropdown_open = !t.dropdown_open
+		return t
+	}
+	if t.dropdown_open {
+		t.dropdown_open = false
+		if i := t.dropdown_item_at(pt); i >= 0 {
+			t.Select(i)
+			return t
+		}
+	}
+	// over tabs
+	if pt.In(t.bar_rect()) {
+		if i := t.header_at(pt); i >= 0 {
+			if pt.In(t.close_rect(i)) {
+				t.CloseTab(i)
+				return t
+			}
+			t.Select(i)
+			t.pressed_tab = i
+			t.press_x = x
+		}
+		return t
+	}
+	// over body
+	return DispatchLMouseDown(t.body(), x, y, nil)
+}
+
+func (t *Tabs) LMouseUp(x int, y int) Widget {
+	was_pressed := t.pressed_tab >= 0
+	t.pressed_tab = -1
+	t.dragging_tab = false
+	// over tabs
+	if was_pressed || image.Pt(x, y).In(t.bar_rect()) || t.dropdown_item_at(image.Pt(x, y)) >= 0 {
+		return t
+	}
+	//over body
+	return DispatchLMouseUp(t.body(), x, y, nil)
+}
+
+// RMouseDown implements Widget, right clicking a header doesn't move focus
+func (t *Tabs) RMouseDown(x int, y int) Widget {
+	if image.Pt(x, y).In(t.bar_rect()) {
+		return nil
+	}
+	return DispatchRMouseDown(t.body(), x, y, nil)
+}
+
+// RMouseUp implements Widget, returns t when a header was right clicked so the editor shows the tab menu
+func (t *Tabs) RMouseUp(x int, y int) Widget {
+	t.layout_headers()
+	pt := image.Pt(x, y)
+	if pt.In(t.bar_rect()) {
+		if t.header_at(pt) >= 0 {
+			return t
+		}
+		return nil
+	}
+	return DispatchRMouseUp(t.body(), x, y, nil)
+}
+
+// MMouseDown implements Widget
+func (t *Tabs) MMouseDown(x int, y int) Widget {
+	if image.Pt(x, y).In(t.bar_rect()) {
+		return t
+	}
+	return DispatchMMouseDown(t.body(), x, y, nil)
+}
+
+// MMouseUp implements Widget, middle clicking a header closes it
+func (t *Tabs) MMouseUp(x int, y int) Widget {
+	t.layout_headers()
+	pt := image.Pt(x, y)
+	if pt.In(t.bar_rect()) {
+		if i := t.header_at(pt); i >= 0 {
+			t.CloseTab(i)
+		}
+		return t
+	}
+	return DispatchMMouseUp(t.body(), x, y, nil)
+}
+
+func (t *Tabs) MouseOver(x int, y int) Widget {
+	t.layout_headers()
+	pt := image.Pt(x, y)
+	if t.pressed_tab >= 0 && !ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft) {
+		//let go somewhere we didn't hear about
+		t.pressed_tab = -1
+		t.dragging_tab = false
+	}
+	if t.pressed_tab >= 0 {
+		if !t.dragging_tab && (x-t.press_x > Px(tab_drag_threshold) || t.press_x-x > Px(tab_drag_threshold)) {
+			t.dragging_tab = true
+		}
+		if t.dragging_tab {
+			ebiten.SetCursorShape(ebiten.CursorShapeDefault)
+			if !pt.In(t.bar_rect()) {
+				//carried out of the bar, the editor takes it from here
+				StartTabDrag(t, t.pressed_tab)
+				t.pressed_tab = -1
+				t.dragging_tab = false
+				return t
+			}
+			t.drag_to(x)
+			return t
+		}
+	}
+	if t.dropdown_open {
+		t.dropdown_hovered = t.dropdown_item_at(pt)
+		if t.dropdown_hovered >= 0 {
+			ebiten.SetCursorShape(ebiten.CursorShapeDefault)
+			return t
+		}
+	}
+	// over tabs
+	if pt.In(t.bar_rect()) {
+		ebiten.SetCursorShape(ebiten.CursorShapeDefault)
+		t.current_hovered = t.header_at(pt)
+		t.close_hovered = -1
+		if t.current_hovered >= 0 && pt.In(t.close_rect(t.current_hovered)) {
+			t.close_hovered = t.current_hovered
+		}
+		if dx, dy := ebiten.Wheel(); t.overflowing && (dx != 0 || dy != 0) {
+			t.scroll -= int((dx + dy) * float64(Px(tab_scroll_step)))
+			t.layout_headers()
+		}
+		return t
+	}
+	t.current_hovered = -1
+	t.close_hovered = -1
+	//over body
+	return DispatchMouseOver(t.body(), x, y, nil)
+}
+
+// SetRect implements Widget
+func (t *Tabs) SetRect(rect image.Rectangle) {
+	t.Rectangle = rect
+	t.layout_headers()
+	//rect for content
+	pane_rect := t.body_rect()
+	for i := 0; i < len(t.Tabs); i++ {
+		if t.Tabs[i] != nil {
+			t.Tabs[i].SetRect(pane_rect)
+		}
+	}
+}
+
+// Children implements Container
+func (t *Tabs) Children() []Widget {
+	return t.Tabs
+}
+
+// ReplaceChild implements Container
+func (t *Tabs) ReplaceChild(old, new Widget) bool {
+	for i := range t.Tabs {
+		if t.Tabs[i] == old {
+			t.Tabs[i] = new
+			return true
+		}
+	}
+	return false
+}
+
+// Describe implements Describable
+func (t *Tabs) Describe() *WidgetDescriptor {
+	d := &WidgetDescriptor{Kind: "tabs"}
+	for i, tab := range t.Tabs {
+		kid := Describe(tab)
+		if kid == nil {
+			continue
+		}
+		if i == t.CurrentTab {
+			d.ActiveTab = len(d.Children)
+		}
+		d.Children = append(d.Children, kid)
+	}
+	if len(d.Children) == 0 && len(t.Tabs) > 0 {
+		//nothing in it gets saved, like the results panels
+		return nil
+	}
+	return d
+}
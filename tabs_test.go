@@ -0,0 +1,182 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// dirty_widget is a tab with unsaved changes until it's told otherwise
+type dirty_widget struct {
+	recording_widget
+	dirty  bool
+	closed bool
+}
+
+func (dw *dirty_widget) Dirty() bool { return dw.dirty }
+func (dw *dirty_widget) Close()      { dw.closed = true }
+
+var _ Dirtier = &dirty_widget{}
+var _ Closer = &dirty_widget{}
+
+func new_dirty_tabs() (*Tabs, []*dirty_widget) {
+	var events []string
+	ws := []*dirty_widget{}
+	var tabs []Widget
+	for i, name := range []string{"a", "b", "c", "d"} {
+		w := &dirty_widget{recording_widget: recording_widget{name: name, events: &events}, dirty: i%2 == 1}
+		ws = append(ws, w)
+		tabs = append(tabs, w)
+	}
+	return NewTabs(tabs...), ws
+}
+
+func TestCloseTabKeepsDirtyTabs(t *testing.T) {
+	tabs, ws := new_dirty_tabs()
+	tabs.CloseTab(1)
+	tabs.CloseTab(1)
+	if len(tabs.Tabs) != 4 || ws[1].closed {
+		t.Fatalf("dirty tab got closed")
+	}
+	requests := tabs.TakeCloseRequests()
+	if len(requests) != 1 || requests[0] != Widget(ws[1]) {
+		t.Errorf("close requests are %v, want just b once", requests)
+	}
+	if requests := tabs.TakeCloseRequests(); len(requests) != 0 {
+		t.Errorf("close requests weren't taken: %v", requests)
+	}
+	tabs.CloseTab(0)
+	if len(tabs.Tabs) != 3 || !ws[0].closed {
+		t.Errorf("clean tab didn't close")
+	}
+	tabs.DiscardTab(tabs.IndexOf(ws[1]))
+	if len(tabs.Tabs) != 2 || !ws[1].closed {
+		t.Errorf("discarding didn't close the dirty tab")
+	}
+}
+
+func TestCloseOthersKeepsDirtyTabs(t *testing.T) {
+	tabs, ws := new_dirty_tabs()
+	tabs.CloseOthers(2)
+	if tabs.IndexOf(ws[0]) >= 0 {
+		t.Errorf("clean tab a is still open")
+	}
+	for _, w := range []*dirty_widget{ws[1], ws[2], ws[3]} {
+		if tabs.IndexOf(w) < 0 {
+			t.Errorf("%s got closed", w.name)
+		}
+	}
+	if tabs.current() != Widget(ws[2]) {
+		t.Errorf("current tab is %v, want c", tabs.current())
+	}
+	requests := tabs.TakeCloseRequests()
+	if len(requests) != 2 {
+		t.Errorf("close requests are %v, want b and d", requests)
+	}
+}
+
+func TestCloseRequestsSharedBuffer(t *testing.T) {
+	buf := NewTextBuffer("package main\n")
+	buf.Replace(Cursor{}, Cursor{}, "//edited\n")
+	left, right := NewTextEditor(buf), NewTextEditor(buf)
+	left_tabs, right_tabs := NewTabs(left), NewTabs(right)
+	g := &Editor{MainWidget: NewSplitPane(SplitHorizontal, left_tabs, right_tabs)}
+
+	//another view has the text, nothing to ask
+	left_tabs.CloseTab(0)
+	g.HandleCloseRequests()
+	if len(left_tabs.Tabs) != 0 {
+		t.Fatalf("view of a buffer that's open elsewhere didn't close")
+	}
+
+	//the last view needs an answer first
+	if HaveFileDialog() {
+		t.Skip("would pop up a real dialog")
+	}
+	right_tabs.CloseTab(0)
+	g.HandleCloseRequests()
+	if len(right_tabs.Tabs) != 1 || current_prompt == nil {
+		t.Fatalf("last view of an unsaved buffer closed without asking")
+	}
+	current_prompt.finish(2) //cancel
+	if len(right_tabs.Tabs) != 1 {
+		t.Fatalf("cancelling closed the tab")
+	}
+
+	quit := false
+	g.ConfirmQuit(func() { quit = true })
+	if quit || current_prompt == nil {
+		t.Fatalf("quit went ahead without asking about unsaved changes")
+	}
+	current_prompt.finish(-1) //escape
+	if quit {
+		t.Errorf("escaping the question quit anyway")
+	}
+
+	right_tabs.CloseTab(0)
+	g.HandleCloseRequests()
+	current_prompt.finish(1) //discard
+	if len(right_tabs.Tabs) != 0 || current_prompt != nil {
+		t.Errorf("discarding didn't close the tab")
+	}
+	g.ConfirmQuit(func() { quit = true })
+	if !quit {
+		t.Errorf("nothing unsaved left but quitting still asked")
+	}
+}
+
+func TestCloseUntouchedUntitledTab(t *testing.T) {
+	current_prompt = nil
+	te := NewTextEditor(nil)
+	tabs := NewTabs(te)
+	g := &Editor{MainWidget: tabs}
+	if te.Dirty() {
+		t.Fatalf("new untitled editor counts as unsaved")
+	}
+	quit := false
+	g.ConfirmQuit(func() { quit = true })
+	if !quit || current_prompt != nil {
+		t.Errorf("quitting asked about an untitled editor nothing was typed in")
+	}
+	tabs.CloseTab(0)
+	g.HandleCloseRequests()
+	if len(tabs.Tabs) != 0 || current_prompt != nil {
+		t.Errorf("untouched untitled tab wasn't closed without asking")
+	}
+
+	te = NewTextEditor(nil)
+	te.buf.Replace(Cursor{}, Cursor{}, "x")
+	if !te.Dirty() {
+		t.Errorf("untitled editor with text typed in counts as saved")
+	}
+}
+
+func TestOpenFileAfterClosingLastTab(t *testing.T) {
+	current_prompt = nil
+	var events []string
+	side := &recording_widget{name: "side", events: &events}
+	editors := NewTabs(NewTextEditor(nil))
+	g := &Editor{MainWidget: NewSplitPane(SplitHorizontal, side, editors)}
+	g.panel_tabs = NewTabs(&recording_widget{name: "panel", events: &events})
+	g.MainWidget = NewSplitPane(SplitVertical, g.MainWidget, g.panel_tabs)
+
+	editors.CloseTab(0)
+	g.HandleCloseRequests()
+	CollapseEmptyTabs(g.MainWidget, g.panel_tabs)
+	if !InTree(g.MainWidget, editors) {
+		t.Fatalf("the last editor group was collapsed")
+	}
+
+	path := filepath.Join(t.TempDir(), "a.txt")
+	if err := os.WriteFile(path, []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	g.Focus(g.panel_tabs)
+	if err := g.OpenFile(path); err != nil {
+		t.Fatalf("opening after closing the last tab: %v", err)
+	}
+	if len(editors.Tabs) != 1 || len(g.panel_tabs.Tabs) != 1 {
+		t.Errorf("file went to the panel group, editors have %d tabs", len(editors.Tabs))
+	}
+
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Tasks, commands like go build that run in the workspace with their output streamed into the output panel
+// Build, Test and Run are built in, a project's .ide/tasks.json can add more or replace them by name
+
+// Task is a command to run, Dir is relative to the workspace
+type Task struct {
+	Name    string `json:"name"`
+	Command string `json:"command"`
+	Dir     string `json:"dir"`
+}
+
+// the command Run runs, see the run settings
+var run_command = "go run ."
+
+func builtin_tasks() []Task {
+	return []Task{
+		{Name: "Build", Command: "go build ./..."},
+		{Name: "Test", Command: "go test ./..."},
+		{Name: "Run", Command: run_command},
+	}
+}
+
+func TasksPath() string {
+	return filepath.Join(WorkspaceDir(), ".ide", "tasks.json")
+}
+
+// ProjectTasks is the tasks in the workspace's tasks.json, a list of objects with a name, a command and optionally a dir
+func ProjectTasks() ([]Task, error) {
+	bs, err := os.ReadFile(TasksPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var tasks []Task
+	if err := json.Unmarshal(bs, &tasks); err != nil {
+		return nil, fmt.Errorf("%s: %w", TasksPath(), err)
+	}
+	return tasks, nil
+}
+
+// FindTask is the task called name, the project's version if it has one
+func FindTask(name string) (Task, bool) {
+	tasks, err := ProjectTasks()
+	if err != nil {
+		log.Println("couldn't read tasks:", err)
+	}
+	for _, t := range append(tasks, builtin_tasks()...) {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return Task{}, false
+}
+
+// TaskRun is a task that's running or has finished
+type TaskRun struct {
+	Task
+	dir            string
+	cmd            *exec.Cmd
+	reader         *os.File //our end of the pipe its output comes through
+	started, ended time.Time
+	running        bool
+	canceled       bool
+	exit_code      int
+	err            error           //it couldn't be started, or didn't exit by itself
+	output         strings.Builder //what was shown
+	events         chan task_event
+
+	//for runs that aren't plain tasks, like tests
+	args    []string                 //the command, instead of splitting Command at spaces
+	filter  func(line string) string //gets each line of output, what it returns is shown instead
+	on_done func(run *TaskRun)       //called when it's finished
+	partial string                   //output after the last newline, for filter
+}
+
+type task_event struct {
+	output string
+	done   bool
+	err    error
+}
+
+var ErrTaskRunning = errors.New("a task is already running")
+
+// Status is how the run is going, for the status bar
+func (run *TaskRun) Status() string {
+	switch {
+	case run.running:
+		return fmt.Sprintf("%s: running %s", run.Name, time.Since(run.started).Round(time.Second))
+	case run.canceled:
+		return run.Name + ": canceled"
+	case run.err != nil:
+		return fmt.Sprintf("%s: %v", run.Name, run.err)
+	}
+	return fmt.Sprintf("%s: exit status %d (%s)", run.Name, run.exit_code, run.ended.Sub(run.started).Round(100*time.Millisecond))
+}
+
+// Succeeded reports whether the run finished with exit status 0
+func (run *TaskRun) Succeeded() bool {
+	return !run.running && !run.canceled && run.err == nil && run.exit_code == 0
+}
+
+// RunTask runs the task called name, showing its output
+func (g *Editor) RunTask(name string) {
+	t, ok := FindTask(name)
+	if !ok {
+		log.Println("no task called", name)
+		return
+	}
+	if err := g.StartTask(t); err != nil {
+		log.Printf("couldn't run %s: %v", name, err)
+	}
+}
+
+// StartTask runs t in the background, one task runs at a time
+func (g *Editor) StartTask(t Task) error {
+	return g.start_task(&TaskRun{Task: t})
+}
+
+func (g *Editor) start_task(run *TaskRun) error {
+	if g.task != nil && g.task.running {
+		return ErrTaskRunning
+	}
+	t := run.Task
+	command := run.args
+	if command == nil {
+		command = strings.Fields(t.Command)
+	}
+	if len(command) == 0 {
+		return fmt.Errorf("%s has no command", t.Name)
+	}
+	run.dir, run.started, run.running = filepath.Join(WorkspaceDir(), t.Dir), time.Now(), true
+	run.events = make(chan task_event, 256)
+	g.task = run
+	op := g.ShowOutput()
+	op.Clear()
+	op.SetTitle("Output: " + t.Name)
+	op.SetDir(run.dir)
+	op.Write("\x1b[1m> " + t.Command + "\x1b[0m\n")
+
+	run.cmd = exec.Command(command[0], command[1:]...)
+	run.cmd.Dir = run.dir
+	own_process_group(run.cmd)
+	r, w, err := os.Pipe()
+	if err != nil {
+		run.finish(0, err)
+		return err
+	}
+	run.cmd.Stdout, run.cmd.Stderr = w, w
+	if err := run.cmd.Start(); err != nil {
+		r.Close()
+		w.Close()
+		run.finish(0, err)
+		op.Write(err.Error() + "\n")
+		return err
+	}
+	//the child has its own copy, ours has to go for reading to end when it exits
+	w.Close()
+	run.reader = r
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := r.Read(buf)
+			if n > 0 {
+				run.events <- task_event{output: string(buf[:n])}
+			}
+			if err != nil {
+				break
+			}
+		}
+		r.Close()
+		run.events <- task_event{done: true, err: run.cmd.Wait()}
+		close(run.events)
+	}()
+	return nil
+}
+
+func (run *TaskRun) finish(exit_code int, err error) {
+	run.running = false
+	run.ended = time.Now()
+	run.exit_code, run.err = exit_code, err
+}
+
+// CancelTask kills the running task and whatever it started
+func (g *Editor) CancelTask() {
+	if g.task == nil || !g.task.running || g.task.cmd.Process == nil {
+		return
+	}
+	g.task.canceled = true
+	if err := kill_process_group(g.task.cmd); err != nil {
+		log.Println("couldn't stop task:", err)
+	}
+	//something that left the group could still have the output open, reading has to end anyway
+	g.task.reader.Close()
+}
+
+// RerunTask runs the last task again, stopping it first if it's still going
+func (g *Editor) RerunTask() {
+	if g.task == nil {
+		return
+	}
+	old := g.task
+	if old.running {
+		g.CancelTask()
+		//the old run finishes in the background, its events go nowhere
+		old.finish(-1, nil)
+		go func() {
+			for range old.events {
+			}
+		}()
+	}
+	if err := g.start_task(&TaskRun{Task: old.Task, args: old.args, filter: old.filter, on_done: old.on_done}); err != nil {
+		log.Printf("couldn't run %s: %v", old.Name, err)
+	}
+}
+
+func (g *Editor) TaskRunning() bool {
+	return g.task != nil && g.task.running
+}
+
+func (g *Editor) HasTask() bool {
+	return g.task != nil
+}
+
+// UpdateTasks passes on what the running task printed, and notes when it's done
+func (g *Editor) UpdateTasks() {
+	run := g.task
+	if run == nil || !run.running {
+		return
+	}
+	for {
+		select {
+		case e := <-run.events:
+			if e.done {
+				if run.partial != "" {
+					g.task_output(run, run.filter(run.partial))
+				}
+				g.task_done(run, e.err)
+				return
+			}
+			if run.filter == nil {
+				g.task_output(run, e.output)
+				continue
+			}
+			lines := strings.Split(run.partial+e.output, "\n")
+			run.partial = lines[len(lines)-1]
+			for _, line := range lines[:len(lines)-1] {
+				g.task_output(run, run.filter(line))
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (g *Editor) task_output(run *TaskRun, s string) {
+	run.output.WriteString(s)
+	if g.output != nil {
+		g.output.Write(s)
+	}
+}
+
+func (g *Editor) task_done(run *TaskRun, err error) {
+	var exit *exec.ExitError
+	switch {
+	case run.canceled:
+		run.finish(-1, nil)
+	case errors.As(err, &exit):
+		run.finish(exit.ExitCode(), nil)
+	default:
+		run.finish(0, err)
+	}
+	if g.output != nil {
+		g.output.Write("\n\x1b[1m" + run.Status() + "\x1b[0m\n")
+	}
+	//anything in the output that points at a file is a problem too
+	SetDiagnostics("task", ParseToolOutput(run.output.String(), run.dir, run.Name))
+	if run.on_done != nil {
+		run.on_done(run)
+	}
+}
+
+// ShowOutput shows the output panel without taking focus from what has it, making it if there isn't one
+func (g *Editor) ShowOutput() *OutputPanel {
+	if g.output == nil {
+		g.output = NewOutputPanel("Output", WorkspaceDir())
+	}
+	g.RevealPanel(g.output)
+	return g.output
+}
+
+// the Run menu's list of the project's tasks
+func (g *Editor) tasks_menu() []MenuItem {
+	tasks, err := ProjectTasks()
+	if err != nil {
+		log.Println("couldn't read tasks:", err)
+	}
+	items := []MenuItem{}
+	for _, t := range tasks {
+		t := t
+		items = append(items, NewActionMenuItem(EscapeMnemonic(t.Name), KeyShortcut{}, func() { g.RunTask(t.Name) }).WhenEnabled(func() bool { return !g.TaskRunning() }))
+	}
+	if len(items) == 0 {
+		items = append(items, NewActionMenuItem("No Tasks in "+EscapeMnemonic(TasksPath()), KeyShortcut{}, nil))
+	}
+	return items
+}
+
+func (g *Editor) output_context_menu(op *OutputPanel) []MenuItem {
+	return []MenuItem{
+		NewActionMenuItem("&Cancel", KeyShortcut{}, g.CancelTask).WhenEnabled(g.TaskRunning),
+		NewActionMenuItem("&Re-run", KeyShortcut{}, g.RerunTask).WhenEnabled(g.HasTask),
+		NewMenuSeparator(),
+		NewActionMenuItem("C&lear", KeyShortcut{}, op.Clear),
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestTaskRuns(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no shell to run tasks with")
+	}
+	defer SetDiagnostics("task", nil)
+	var events []string
+	side := &recording_widget{name: "side", events: &events}
+	g := &Editor{MainWidget: NewSplitPane(SplitHorizontal, side, NewTabs(NewTextEditor(nil)))}
+
+	//tasks run in the workspace, which is this package's directory while testing
+	run := &TaskRun{Task: Task{Name: "Echo", Command: "echo"}, args: []string{"sh", "-c", "echo hello; echo main.go:3:1: oops"}}
+	if err := g.start_task(run); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.start_task(&TaskRun{Task: Task{Name: "Second", Command: "true"}}); err != ErrTaskRunning {
+		t.Errorf("starting another task while one runs gave %v", err)
+	}
+	until(t, g.UpdateTasks, func() bool { return !run.running })
+	if !run.Succeeded() {
+		t.Errorf("task didn't succeed: %s", run.Status())
+	}
+	if got := run.output.String(); !strings.Contains(got, "hello\n") {
+		t.Errorf("task output %q", got)
+	}
+	if ds := diagnostic_sets["task"]; len(ds) != 1 || ds[0].Message != "oops" {
+		t.Errorf("problems in the output: %+v", ds)
+	}
+
+	failing := &TaskRun{Task: Task{Name: "Fail", Command: "exit 3"}, args: []string{"sh", "-c", "exit 3"}}
+	if err := g.start_task(failing); err != nil {
+		t.Fatal(err)
+	}
+	until(t, g.UpdateTasks, func() bool { return !failing.running })
+	if failing.Succeeded() || failing.exit_code != 3 || failing.err != nil {
+		t.Errorf("failing task finished with %s", failing.Status())
+	}
+	if _, ok := diagnostic_sets["task"]; ok {
+		t.Errorf("the last task's problems weren't replaced")
+	}
+}
@@ -0,0 +1,619 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+	"golang.org/x/image/font"
+)
+
+// Terminal runs the user's shell on a pty and shows it, it can go in any tabs like an editor
+// its output is read in the background and fed to a TermScreen in Update, see UpdateTerminals
+
+// the shell terminals run, see the terminal settings, "" for $SHELL
+var terminal_shell = ""
+
+// logical pixels
+const terminal_padding = 4
+
+// every terminal that's still open, so their output is read even when they're not showing
+var terminals []*Terminal
+
+// how many terminals have been opened, for numbering them
+var terminals_opened int
+
+type Terminal struct {
+	image.Rectangle
+	screen  *TermScreen
+	number  int
+	pty     *os.File
+	cmd     *exec.Cmd
+	events  chan terminal_event
+	exited  bool
+	focused bool
+
+	scroll      int //lines scrolled back into the scrollback
+	selecting   bool
+	sel, sel_to term_pos //where the selection was started and where it's been dragged to
+}
+
+var _ Widget = &Terminal{}
+var _ Closer = &Terminal{}
+var _ ShortcutGrabber = &Terminal{}
+
+type terminal_event struct {
+	output []byte
+	done   bool
+	err    error
+}
+
+// term_pos is a cell counting lines from the oldest scrollback line, like TermScreen.Line
+type term_pos struct {
+	line, col int
+}
+
+func (p term_pos) before(q term_pos) bool {
+	return p.line < q.line || p.line == q.line && p.col < q.col
+}
+
+func shell_command() []string {
+	shell := terminal_shell
+	if shell == "" {
+		shell = os.Getenv("SHELL")
+	}
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+	return strings.Fields(shell)
+}
+
+// NewTerminal starts a shell in dir, if it can't the terminal says why
+func NewTerminal(dir string) *Terminal {
+	terminals_opened++
+	t := &Terminal{screen: NewTermScreen(80, 24), number: terminals_opened}
+	terminals = append(terminals, t)
+	pty, cmd, err := start_pty(shell_command(), dir, t.screen.cols, t.screen.rows)
+	if err != nil {
+		t.exited = true
+		t.screen.Write([]byte(fmt.Sprintf("couldn't start %s: %v\r\n", strings.Join(shell_command(), " "), err)))
+		return t
+	}
+	t.pty, t.cmd = pty, cmd
+	t.events = make(chan terminal_event, 64)
+	go func() {
+		for {
+			buf := make([]byte, 4096)
+			n, err := pty.Read(buf)
+			if n > 0 {
+				t.events <- terminal_event{output: buf[:n]}
+			}
+			if err != nil {
+				break
+			}
+		}
+		t.events <- terminal_event{done: true, err: cmd.Wait()}
+		close(t.events)
+	}()
+	return t
+}
+
+// OpenTerminal starts another terminal in the panel group under the editors
+func (g *Editor) OpenTerminal() {
+	t := NewTerminal(WorkspaceDir())
+	//ShowPanel would replace the terminal that's there, terminals are added alongside each other
+	if g.panel_tabs == nil || !InTree(g.MainWidget, g.panel_tabs) {
+		g.ShowPanel(t)
+		return
+	}
+	g.panel_tabs.AddTab(t)
+	g.Rebuild()
+	g.Focus(t)
+}
+
+// ShowTerminal focuses a terminal, starting one if none are open
+func (g *Editor) ShowTerminal() {
+	var existing *Terminal
+	Walk(g.MainWidget, func(w Widget) {
+		if t, ok := w.(*Terminal); ok && existing == nil {
+			existing = t
+		}
+	})
+	if existing == nil {
+		g.OpenTerminal()
+		return
+	}
+	if tabs, ok := FindParent(g.MainWidget, existing).(*Tabs); ok {
+		g.ShowTab(tabs, existing)
+	}
+	g.Focus(existing)
+}
+
+// UpdateTerminals passes on what terminals' programs printed, and answers their questions
+func UpdateTerminals() {
+	for _, t := range terminals {
+		t.update()
+	}
+}
+
+// StopTerminals kills every terminal's shell, for quitting
+func StopTerminals() {
+	for len(terminals) > 0 {
+		terminals[0].Close()
+	}
+}
+
+func (t *Terminal) update() {
+	if t.exited {
+		return
+	}
+	//a program printing flat out shouldn't stop the editor updating, the rest waits for the next frame
+	for i := 0; i < cap(t.events); i++ {
+		select {
+		case e := <-t.events:
+			if e.done {
+				t.exited = true
+				status := "exited"
+				if e.err != nil {
+					status = e.err.Error()
+				}
+				t.screen.Write([]byte("\r\n[process " + status + "]\r\n"))
+				t.pty.Close()
+				return
+			}
+			t.screen.Write(e.output)
+			if replies := t.screen.TakeReplies(); len(replies) > 0 {
+				t.send(replies)
+			}
+		default:
+			return
+		}
+	}
+}
+
+// send gives b to the program as if it had been typed
+func (t *Terminal) send(b []byte) {
+	if t.exited || len(b) == 0 {
+		return
+	}
+	if _, err := t.pty.Write(b); err != nil {
+		log.Println("couldn't write to terminal:", err)
+	}
+}
+
+// Close implements Closer, it kills the shell
+func (t *Terminal) Close() {
+	for i, other := range terminals {
+		if other == t {
+			terminals = append(terminals[:i], terminals[i+1:]...)
+			break
+		}
+	}
+	if t.exited {
+		return
+	}
+	t.exited = true
+	if t.cmd.Process != nil {
+		t.cmd.Process.Kill()
+	}
+	t.pty.Close()
+	//nothing reads the events now, they'd block the goroutine waiting on the shell
+	go func() {
+		for range t.events {
+		}
+	}()
+}
+
+/*
+Layout, the screen is as many cells as fit
+*/
+
+func (t *Terminal) cell_size() (int, int) {
+	return max(1, font.MeasureString(CodeFontFace, "M").Round()), CodeLineHeight()
+}
+
+// fit resizes the screen and the pty to the widget, when the widget or the font has changed size
+func (t *Terminal) fit() {
+	cw, lh := t.cell_size()
+	pad := Px(terminal_padding)
+	cols, rows := max(1, (t.Dx()-2*pad)/cw), max(1, (t.Dy()-2*pad)/lh)
+	if cols == t.screen.cols && rows == t.screen.rows {
+		return
+	}
+	t.screen.Resize(cols, rows)
+	t.scroll = min(t.scroll, len(t.screen.scrollback))
+	if !t.exited {
+		resize_pty(t.pty, cols, rows)
+	}
+}
+
+// first_line is the line of the screen showing at the top, see TermScreen.Line
+func (t *Terminal) first_line() int {
+	return len(t.screen.scrollback) - t.scroll
+}
+
+func (t *Terminal) scroll_by(lines int) {
+	t.scroll = max(0, min(t.scroll+lines, len(t.screen.scrollback)))
+}
+
+// pos_at is the cell under (x, y)
+func (t *Terminal) pos_at(x, y int) term_pos {
+	cw, lh := t.cell_size()
+	pad := Px(terminal_padding)
+	row := max(0, min((y-t.Min.Y-pad)/lh, t.screen.rows-1))
+	col := max(0, min((x-t.Min.X-pad+cw/2)/cw, t.screen.cols))
+	return term_pos{line: t.first_line() + row, col: col}
+}
+
+// selection is the selected cells in order, ok is false if there aren't any
+func (t *Terminal) selection() (from, to term_pos, ok bool) {
+	from, to = t.sel, t.sel_to
+	if to.before(from) {
+		from, to = to, from
+	}
+	return from, to, from != to
+}
+
+// Copy puts the selected text on the clipboard
+func (t *Terminal) Copy() {
+	from, to, ok := t.selection()
+	if !ok {
+		return
+	}
+	lines := []string{}
+	for i := from.line; i <= to.line && i < t.screen.LineCount(); i++ {
+		line := t.screen.Line(i)
+		start, end := 0, len(line)
+		if i == from.line {
+			start = min(from.col, len(line))
+		}
+		if i == to.line {
+			end = min(to.col, len(line))
+		}
+		lines = append(lines, line[start:end].text())
+	}
+	ClipboardWrite(strings.Join(lines, "\n"))
+}
+
+// Paste types what's on the clipboard, marked as pasted if the program asked for that
+func (t *Terminal) Paste() {
+	s := strings.ReplaceAll(ClipboardRead(), "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\n", "\r")
+	if t.screen.BracketedPaste {
+		s = "\x1b[200~" + s + "\x1b[201~"
+	}
+	t.scroll = 0
+	t.send([]byte(s))
+}
+
+// Clear empties the scrollback, the screen is the shell's to clear
+func (t *Terminal) Clear() {
+	t.screen.scrollback = nil
+	t.scroll = 0
+	t.sel, t.sel_to = term_pos{}, term_pos{}
+}
+
+func (t *Terminal) Running() bool {
+	return !t.exited
+}
+
+/*
+Keyboard
+*/
+
+// GrabsShortcut implements ShortcutGrabber, ctrl and alt with a letter are the shell's, like ctrl+c and ctrl+w
+func (t *Terminal) GrabsShortcut(ks KeyShortcut) bool {
+	if ks.mod_shift || ks.mod_meta || !ks.mod_ctrl && !ks.mod_alt {
+		return false
+	}
+	switch ks.key {
+	case ebiten.KeyLeftBracket, ebiten.KeyBackslash, ebiten.KeyRightBracket, ebiten.KeySpace:
+		return ks.mod_ctrl
+	}
+	return ks.key >= ebiten.KeyA && ks.key <= ebiten.KeyZ
+}
+
+// special keys and what they send, arrows and home and end are different in application cursor mode
+var terminal_keys = map[ebiten.Key]string{
+	ebiten.KeyEnter:     "\r",
+	ebiten.KeyBackspace: "\x7f",
+	ebiten.KeyTab:       "\t",
+	ebiten.KeyEscape:    "\x1b",
+	ebiten.KeyInsert:    "\x1b[2~",
+	ebiten.KeyDelete:    "\x1b[3~",
+	ebiten.KeyPageUp:    "\x1b[5~",
+	ebiten.KeyPageDown:  "\x1b[6~",
+}
+
+var terminal_cursor_keys = map[ebiten.Key]byte{
+	ebiten.KeyUp:    'A',
+	ebiten.KeyDown:  'B',
+	ebiten.KeyRight: 'C',
+	ebiten.KeyLeft:  'D',
+	ebiten.KeyHome:  'H',
+	ebiten.KeyEnd:   'F',
+}
+
+// key_input is what this frame's keys type, function keys are left to the editor
+func (t *Terminal) key_input() []byte {
+	ctrl := ebiten.IsKeyPressed(ebiten.KeyControl)
+	alt := ebiten.IsKeyPressed(ebiten.KeyAlt)
+	shift := ebiten.IsKeyPressed(ebiten.KeyShift)
+	meta := ebiten.IsKeyPressed(ebiten.KeyMeta)
+	var b []byte
+	for key, s := range terminal_keys {
+		if KeyJustPressedOrKeyRepeated(key) {
+			if key == ebiten.KeyTab && shift {
+				s = "\x1b[Z"
+			}
+			b = append(b, s...)
+		}
+	}
+	for key, final := range terminal_cursor_keys {
+		if !KeyJustPressedOrKeyRepeated(key) {
+			continue
+		}
+		//modifiers are sent as a parameter, 1 plus shift 1, alt 2 and ctrl 4
+		modifier := 1
+		if shift {
+			modifier++
+		}
+		if alt {
+			modifier += 2
+		}
+		if ctrl {
+			modifier += 4
+		}
+		switch {
+		case modifier > 1:
+			b = append(b, fmt.Sprintf("\x1b[1;%d%c", modifier, final)...)
+		case t.screen.AppCursorKeys:
+			b = append(b, '\x1b', 'O', final)
+		default:
+			b = append(b, '\x1b', '[', final)
+		}
+	}
+	if (ctrl || alt) && !shift && !meta {
+		for key := ebiten.KeyA; key <= ebiten.KeyZ; key++ {
+			if !KeyJustPressedOrKeyRepeated(key) {
+				continue
+			}
+			c := byte('a' + key - ebiten.KeyA)
+			if ctrl {
+				c = c - 'a' + 1
+			}
+			if alt {
+				b = append(b, '\x1b')
+			}
+			b = append(b, c)
+		}
+	}
+	if ctrl && !shift && !alt && !meta {
+		for key, c := range map[ebiten.Key]byte{ebiten.KeyLeftBracket: 0x1b, ebiten.KeyBackslash: 0x1c, ebiten.KeyRightBracket: 0x1d, ebiten.KeySpace: 0} {
+			if KeyJustPressedOrKeyRepeated(key) {
+				b = append(b, c)
+			}
+		}
+	}
+	if !ctrl && !alt && !meta {
+		b = append(b, string(ebiten.AppendInputChars(nil))...)
+	}
+	return b
+}
+
+/*
+Widget
+*/
+
+// Title implements Widget
+func (t *Terminal) Title() string {
+	title := fmt.Sprintf("Terminal %d", t.number)
+	if t.exited {
+		title += " (exited)"
+	}
+	return title
+}
+
+// Focus implements Focuser
+func (t *Terminal) Focus() {
+	t.focused = true
+}
+
+// KeyboardFocusLost implements Widget
+func (t *Terminal) KeyboardFocusLost() {
+	t.focused = false
+}
+
+// SetRect implements Widget
+func (t *Terminal) SetRect(rect image.Rectangle) {
+	t.Rectangle = rect
+	t.fit()
+}
+
+// TakeKeyboard implements Widget, keys go to the shell except ctrl+shift+c and v, which copy and paste
+func (t *Terminal) TakeKeyboard() {
+	ctrl_shift := ebiten.IsKeyPressed(ebiten.KeyControl) && ebiten.IsKeyPressed(ebiten.KeyShift)
+	switch {
+	case ctrl_shift && inpututil.IsKeyJustPressed(ebiten.KeyC):
+		t.Copy()
+		return
+	case ctrl_shift && inpututil.IsKeyJustPressed(ebiten.KeyV):
+		t.Paste()
+		return
+	case ebiten.IsKeyPressed(ebiten.KeyShift) && KeyJustPressedOrKeyRepeated(ebiten.KeyPageUp):
+		t.scroll_by(t.screen.rows - 1)
+		return
+	case ebiten.IsKeyPressed(ebiten.KeyShift) && KeyJustPressedOrKeyRepeated(ebiten.KeyPageDown):
+		t.scroll_by(1 - t.screen.rows)
+		return
+	}
+	if b := t.key_input(); len(b) > 0 && !t.exited {
+		t.scroll = 0
+		t.sel, t.sel_to = term_pos{}, term_pos{}
+		t.send(b)
+	}
+}
+
+// colors is what a cell is drawn with
+func (t *Terminal) colors(style term_style) (fg, bg color.Color) {
+	fg, bg = style.fg, style.bg
+	if fg == nil {
+		fg = Style.FGColorMuted
+		if style.bold {
+			fg = Style.FGColorStrong
+		}
+	}
+	if style.reverse {
+		fg, bg = bg, fg
+		if fg == nil {
+			fg = Style.BGColorMuted
+		}
+	}
+	return fg, bg
+}
+
+// Draw implements Widget
+func (t *Terminal) Draw(target *ebiten.Image) {
+	t.fit()
+	DrawRect(target, t.Rectangle, Style.BGColorMuted)
+	clipped, ok := target.SubImage(t.Rectangle).(*ebiten.Image)
+	if !ok {
+		return
+	}
+	cw, lh := t.cell_size()
+	pad := Px(terminal_padding)
+	from, to, selected := t.selection()
+	first := t.first_line()
+	for row := 0; row < t.screen.rows; row++ {
+		i := first + row
+		if i >= t.screen.LineCount() {
+			break
+		}
+		line := t.screen.Line(i)
+		top := t.Min.Y + pad + row*lh
+		cell_x := func(col int) int { return t.Min.X + pad + col*cw }
+		//backgrounds, then the selection, then the text in runs of the same style
+		for col := 0; col < len(line); col++ {
+			if _, bg := t.colors(line[col].style); bg != nil {
+				DrawRect(clipped, image.Rect(cell_x(col), top, cell_x(col+1), top+lh), bg)
+			}
+		}
+		if selected && i >= from.line && i <= to.line {
+			start, end := 0, len(line)
+			if i == from.line {
+				start = from.col
+			}
+			if i == to.line {
+				end = to.col
+			}
+			DrawRect(clipped, image.Rect(cell_x(start), top, cell_x(end), top+lh), Translucent(Style.BlueMuted, 0.6))
+		}
+		for start := 0; start < len(line); {
+			end := start + 1
+			for end < len(line) && line[end].style == line[start].style {
+				end++
+			}
+			s := string(runes(line[start:end]))
+			if strings.TrimSpace(s) != "" || line[start].style.underline {
+				style := line[start].style
+				fg, _ := t.colors(style)
+				text.Draw(clipped, s, CodeFaceFor(ScopeStyle{Bold: style.bold}), cell_x(start), top+CodeFontPeriodFromTop, fg)
+				if style.underline {
+					ebitenutil.DrawLine(clipped, float64(cell_x(start)), float64(top+CodeFontPeriodFromTop+2), float64(cell_x(end)), float64(top+CodeFontPeriodFromTop+2), fg)
+				}
+			}
+			start = end
+		}
+	}
+	if t.exited || t.screen.CursorHidden || t.scroll > 0 {
+		return
+	}
+	x, y := t.Min.X+pad+t.screen.col*cw, t.Min.Y+pad+t.screen.row*lh
+	cursor := image.Rect(x, y, x+cw, y+lh)
+	if t.focused {
+		DrawRect(clipped, cursor, Translucent(Style.FGColorStrong, 0.5))
+	} else {
+		DrawBorders(clipped, cursor, Style.FGColorMuted)
+	}
+}
+
+// runes is the characters of cells
+func runes(cells []term_cell) []rune {
+	rs := make([]rune, len(cells))
+	for i, c := range cells {
+		rs[i] = c.ch
+	}
+	return rs
+}
+
+// MouseOut implements Widget
+func (t *Terminal) MouseOut() {
+}
+
+// MouseOver implements Widget, the wheel scrolls back and dragging selects
+func (t *Terminal) MouseOver(x int, y int) Widget {
+	ebiten.SetCursorShape(ebiten.CursorShapeText)
+	if _, dy := ebiten.Wheel(); dy != 0 {
+		t.scroll_by(int(dy * 3))
+	}
+	if t.selecting && ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft) {
+		t.sel_to = t.pos_at(x, y)
+	}
+	return t
+}
+
+// LMouseDown implements Widget, starts selecting
+func (t *Terminal) LMouseDown(x int, y int) Widget {
+	t.selecting = true
+	t.sel = t.pos_at(x, y)
+	t.sel_to = t.sel
+	return t
+}
+
+// LMouseUp implements Widget
+func (t *Terminal) LMouseUp(x int, y int) Widget {
+	if t.selecting {
+		t.sel_to = t.pos_at(x, y)
+		t.selecting = false
+	}
+	return t
+}
+
+// RMouseDown implements Widget
+func (t *Terminal) RMouseDown(x int, y int) Widget {
+	return t
+}
+
+// RMouseUp implements Widget, it has a context menu for copying and pasting
+func (t *Terminal) RMouseUp(x int, y int) Widget {
+	return t
+}
+
+// MMouseDown implements Widget
+func (*Terminal) MMouseDown(x int, y int) Widget {
+	return nil
+}
+
+// MMouseUp implements Widget
+func (*Terminal) MMouseUp(x int, y int) Widget {
+	return nil
+}
+
+func (g *Editor) terminal_context_menu(t *Terminal) []MenuItem {
+	has_selection := func() bool { _, _, ok := t.selection(); return ok }
+	return []MenuItem{
+		NewActionMenuItem("&Copy", KeyShortcut{mod_ctrl: true, mod_shift: true, key: ebiten.KeyC}, t.Copy).WhenEnabled(has_selection),
+		NewActionMenuItem("&Paste", KeyShortcut{mod_ctrl: true, mod_shift: true, key: ebiten.KeyV}, t.Paste).WhenEnabled(t.Running),
+		NewMenuSeparator(),
+		NewActionMenuItem("C&lear Scrollback", KeyShortcut{}, t.Clear),
+		NewActionMenuItem("&New Terminal", KeyShortcut{}, g.OpenTerminal),
+	}
+}
@@ -0,0 +1,648 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// TermScreen is what a terminal shows, a grid of cells that a program's output draws on with VT100 and xterm escape sequences
+// lines scrolled off the top of the main screen are kept as scrollback, the alternate screen full screen programs use has none
+
+// how many lines scrolled off the top are kept, see the terminal settings
+var terminal_scrollback = 5000
+
+type term_style struct {
+	fg, bg    color.Color //nil for the terminal's own colours
+	bold      bool
+	underline bool
+	reverse   bool
+}
+
+type term_cell struct {
+	ch    rune
+	style term_style
+}
+
+type term_line []term_cell
+
+// text is the line without the blanks after its last character
+func (l term_line) text() string {
+	var sb strings.Builder
+	for _, c := range l {
+		sb.WriteRune(c.ch)
+	}
+	return strings.TrimRight(sb.String(), " ")
+}
+
+type term_cursor struct {
+	row, col int
+	style    term_style
+}
+
+// where the parser is in an escape sequence
+const (
+	vt_ground = iota
+	vt_escape
+	vt_charset //ESC ( and the like, the next byte picks a character set we don't do
+	vt_csi
+	vt_osc
+	vt_osc_escape //ESC in an OSC string, which ends it if \ comes next
+)
+
+type TermScreen struct {
+	cols, rows int
+	lines      []term_line
+	scrollback []term_line
+	main_lines []term_line //the main screen while the alternate one is showing
+	alt        bool
+
+	row, col     int
+	wrap_pending bool //the last column was just written, the next character goes on the next line
+	style        term_style
+	saved        term_cursor
+	top, bottom  int //scroll region, inclusive
+
+	CursorHidden   bool
+	AppCursorKeys  bool //arrows send ESC O A instead of ESC [ A
+	BracketedPaste bool
+	Title          string
+
+	state   int
+	seq     []byte //parameters of the CSI or text of the OSC being parsed
+	partial []byte //the start of a UTF-8 character split between writes
+	replies []byte //answers to the program's questions, like where the cursor is
+	version uint64 //goes up with every change
+}
+
+func NewTermScreen(cols, rows int) *TermScreen {
+	s := &TermScreen{}
+	s.Resize(cols, rows)
+	return s
+}
+
+func (s *TermScreen) blank_line() term_line {
+	l := make(term_line, s.cols)
+	for i := range l {
+		l[i] = term_cell{ch: ' ', style: term_style{bg: s.style.bg}}
+	}
+	return l
+}
+
+// Resize changes the grid to cols by rows, lines that no longer fit go into the scrollback
+func (s *TermScreen) Resize(cols, rows int) {
+	cols, rows = max(1, cols), max(1, rows)
+	if cols == s.cols && rows == s.rows {
+		return
+	}
+	fit := func(lines []term_line, scroll bool) []term_line {
+		for i, l := range lines {
+			if len(l) > cols {
+				lines[i] = l[:cols]
+			}
+			for len(lines[i]) < cols {
+				lines[i] = append(lines[i], term_cell{ch: ' '})
+			}
+		}
+		//shrinking takes lines off the top while the cursor is below the new bottom, then off the bottom
+		for len(lines) > rows {
+			if scroll && s.row > 0 {
+				s.push_scrollback(lines[0])
+				lines = lines[1:]
+				s.row--
+			} else {
+				lines = lines[:len(lines)-1]
+			}
+		}
+		for len(lines) < rows {
+			lines = append(lines, s.blank_line())
+		}
+		return lines
+	}
+	s.cols = cols
+	s.lines = fit(s.lines, !s.alt)
+	if s.main_lines != nil {
+		row := s.row
+		s.main_lines = fit(s.main_lines, false)
+		s.row = row
+	}
+	for i, l := range s.scrollback {
+		if len(l) > cols {
+			s.scrollback[i] = l[:cols]
+		}
+	}
+	s.rows = rows
+	s.top, s.bottom = 0, rows-1
+	s.row, s.col = min(s.row, rows-1), min(s.col, cols-1)
+	s.wrap_pending = false
+	s.version++
+}
+
+func (s *TermScreen) push_scrollback(l term_line) {
+	if s.alt || terminal_scrollback <= 0 {
+		return
+	}
+	s.scrollback = append(s.scrollback, l)
+	if over := len(s.scrollback) - terminal_scrollback; over > 0 {
+		s.scrollback = append(s.scrollback[:0], s.scrollback[over:]...)
+	}
+}
+
+// Line is line i counting from the oldest scrollback line, the screen's lines come after the scrollback
+func (s *TermScreen) Line(i int) term_line {
+	if i < len(s.scrollback) {
+		return s.scrollback[i]
+	}
+	return s.lines[i-len(s.scrollback)]
+}
+
+// LineCount is how many lines Line has
+func (s *TermScreen) LineCount() int {
+	return len(s.scrollback) + len(s.lines)
+}
+
+// TakeReplies returns what the terminal should send back to the program since it was last asked
+func (s *TermScreen) TakeReplies() []byte {
+	r := s.replies
+	s.replies = nil
+	return r
+}
+
+/*
+Parsing
+*/
+
+// Write feeds the program's output through the parser
+func (s *TermScreen) Write(b []byte) {
+	s.version++
+	if len(s.partial) > 0 {
+		b = append(s.partial, b...)
+		s.partial = nil
+	}
+	for len(b) > 0 {
+		c := b[0]
+		if s.state != vt_ground || c < 0x80 {
+			s.byte(c)
+			b = b[1:]
+			continue
+		}
+		if !utf8.FullRune(b) {
+			s.partial = append([]byte(nil), b...)
+			return
+		}
+		r, size := utf8.DecodeRune(b)
+		s.put(r)
+		b = b[size:]
+	}
+}
+
+func (s *TermScreen) byte(c byte) {
+	switch s.state {
+	case vt_ground:
+		s.control_or_print(c)
+	case vt_escape:
+		s.escape(c)
+	case vt_charset:
+		s.state = vt_ground
+	case vt_csi:
+		switch {
+		case c >= 0x40 && c <= 0x7e:
+			s.state = vt_ground
+			s.csi(string(s.seq), c)
+		case c == 0x1b:
+			s.state = vt_escape
+		case c >= 0x20:
+			s.seq = append(s.seq, c)
+		default:
+			//control characters still work in the middle of a sequence
+			s.control_or_print(c)
+		}
+	case vt_osc:
+		switch c {
+		case 0x07:
+			s.state = vt_ground
+			s.osc(string(s.seq))
+		case 0x1b:
+			s.state = vt_osc_escape
+		default:
+			s.seq = append(s.seq, c)
+		}
+	case vt_osc_escape:
+		s.state = vt_ground
+		s.osc(string(s.seq))
+		if c != '\\' {
+			s.byte(c)
+		}
+	}
+}
+
+func (s *TermScreen) control_or_print(c byte) {
+	switch c {
+	case 0x1b:
+		s.state = vt_escape
+	case '\r':
+		s.col, s.wrap_pending = 0, false
+	case '\n', 0x0b, 0x0c:
+		s.linefeed()
+	case 0x08:
+		s.col, s.wrap_pending = max(0, s.col-1), false
+	case '\t':
+		s.col, s.wrap_pending = min(s.cols-1, (s.col/8+1)*8), false
+	default:
+		if c >= 0x20 && c < 0x7f {
+			s.put(rune(c))
+		}
+	}
+}
+
+func (s *TermScreen) escape(c byte) {
+	s.state = vt_ground
+	switch c {
+	case '[':
+		s.state, s.seq = vt_csi, s.seq[:0]
+	case ']':
+		s.state, s.seq = vt_osc, s.seq[:0]
+	case '(', ')', '*', '+':
+		s.state = vt_charset
+	case '7':
+		s.save_cursor()
+	case '8':
+		s.restore_cursor()
+	case 'D':
+		s.linefeed()
+	case 'E':
+		s.col = 0
+		s.linefeed()
+	case 'M':
+		s.reverse_index()
+	case 'c':
+		*s = TermScreen{cols: s.cols, rows: s.rows, scrollback: s.scrollback, version: s.version + 1}
+		s.lines = make([]term_line, s.rows)
+		for i := range s.lines {
+			s.lines[i] = s.blank_line()
+		}
+		s.bottom = s.rows - 1
+	}
+}
+
+// put writes r at the cursor and moves it on, wrapping onto the next line at the edge
+func (s *TermScreen) put(r rune) {
+	if s.wrap_pending {
+		s.col, s.wrap_pending = 0, false
+		s.linefeed()
+	}
+	s.lines[s.row][s.col] = term_cell{ch: r, style: s.style}
+	if s.col == s.cols-1 {
+		s.wrap_pending = true
+	} else {
+		s.col++
+	}
+}
+
+func (s *TermScreen) linefeed() {
+	s.wrap_pending = false
+	if s.row == s.bottom {
+		s.scroll_up(1)
+	} else if s.row < s.rows-1 {
+		s.row++
+	}
+}
+
+func (s *TermScreen) reverse_index() {
+	s.wrap_pending = false
+	if s.row == s.top {
+		s.scroll_down(1)
+	} else if s.row > 0 {
+		s.row--
+	}
+}
+
+// scroll_up moves the scroll region's lines up n, the ones off the top of the whole screen go to the scrollback
+func (s *TermScreen) scroll_up(n int) {
+	n = min(n, s.bottom-s.top+1)
+	for i := 0; i < n; i++ {
+		if s.top == 0 {
+			s.push_scrollback(s.lines[0])
+		}
+		copy(s.lines[s.top:s.bottom], s.lines[s.top+1:s.bottom+1])
+		s.lines[s.bottom] = s.blank_line()
+	}
+}
+
+func (s *TermScreen) scroll_down(n int) {
+	n = min(n, s.bottom-s.top+1)
+	for i := 0; i < n; i++ {
+		copy(s.lines[s.top+1:s.bottom+1], s.lines[s.top:s.bottom])
+		s.lines[s.top] = s.blank_line()
+	}
+}
+
+func (s *TermScreen) save_cursor() {
+	s.saved = term_cursor{row: s.row, col: s.col, style: s.style}
+}
+
+func (s *TermScreen) restore_cursor() {
+	s.row, s.col, s.style = min(s.saved.row, s.rows-1), min(s.saved.col, s.cols-1), s.saved.style
+	s.wrap_pending = false
+}
+
+// move_to puts the cursor at row, col, kept on screen
+func (s *TermScreen) move_to(row, col int) {
+	s.row, s.col = max(0, min(row, s.rows-1)), max(0, min(col, s.cols-1))
+	s.wrap_pending = false
+}
+
+// erase blanks columns from up to to of row
+func (s *TermScreen) erase(row, from, to int) {
+	for i := max(0, from); i < min(to, s.cols); i++ {
+		s.lines[row][i] = term_cell{ch: ' ', style: term_style{bg: s.style.bg}}
+	}
+}
+
+// csi_params is the numbers in a CSI sequence's parameters, missing ones are 0
+func csi_params(params string) []int {
+	ns := []int{}
+	for _, p := range strings.Split(params, ";") {
+		n, _ := strconv.Atoi(p)
+		ns = append(ns, n)
+	}
+	return ns
+}
+
+func (s *TermScreen) csi(params string, final byte) {
+	//? marks DEC private sequences, > and = xterm's own, the plain versions of those mean something else
+	var prefix byte
+	if params != "" && strings.IndexByte("?>=", params[0]) >= 0 {
+		prefix, params = params[0], params[1:]
+	}
+	ps := csi_params(params)
+	//arg is parameter i, or def if it's missing or 0
+	arg := func(i, def int) int {
+		if i < len(ps) && ps[i] > 0 {
+			return ps[i]
+		}
+		return def
+	}
+	switch final {
+	case 'A':
+		//the cursor stops at the edge of the scroll region if it starts in it
+		limit := s.top
+		if s.row < s.top {
+			limit = 0
+		}
+		s.move_to(max(s.row-arg(0, 1), limit), s.col)
+	case 'B':
+		limit := s.bottom
+		if s.row > s.bottom {
+			limit = s.rows - 1
+		}
+		s.move_to(min(s.row+arg(0, 1), limit), s.col)
+	case 'C':
+		s.move_to(s.row, s.col+arg(0, 1))
+	case 'D':
+		s.move_to(s.row, s.col-arg(0, 1))
+	case 'E':
+		s.move_to(s.row+arg(0, 1), 0)
+	case 'F':
+		s.move_to(s.row-arg(0, 1), 0)
+	case 'G', '`':
+		s.move_to(s.row, arg(0, 1)-1)
+	case 'd':
+		s.move_to(arg(0, 1)-1, s.col)
+	case 'H', 'f':
+		s.move_to(arg(0, 1)-1, arg(1, 1)-1)
+	case 'J':
+		switch arg(0, 0) {
+		case 0:
+			s.erase(s.row, s.col, s.cols)
+			for row := s.row + 1; row < s.rows; row++ {
+				s.erase(row, 0, s.cols)
+			}
+		case 1:
+			s.erase(s.row, 0, s.col+1)
+			for row := 0; row < s.row; row++ {
+				s.erase(row, 0, s.cols)
+			}
+		case 2:
+			for row := 0; row < s.rows; row++ {
+				s.erase(row, 0, s.cols)
+			}
+		case 3:
+			s.scrollback = nil
+		}
+		s.wrap_pending = false
+	case 'K':
+		switch arg(0, 0) {
+		case 0:
+			s.erase(s.row, s.col, s.cols)
+		case 1:
+			s.erase(s.row, 0, s.col+1)
+		case 2:
+			s.erase(s.row, 0, s.cols)
+		}
+		s.wrap_pending = false
+	case 'X':
+		s.erase(s.row, s.col, s.col+arg(0, 1))
+		s.wrap_pending = false
+	case '@':
+		line := s.lines[s.row]
+		n := min(arg(0, 1), s.cols-s.col)
+		copy(line[s.col+n:], line[s.col:])
+		s.erase(s.row, s.col, s.col+n)
+		s.wrap_pending = false
+	case 'P':
+		line := s.lines[s.row]
+		n := min(arg(0, 1), s.cols-s.col)
+		copy(line[s.col:], line[s.col+n:])
+		s.erase(s.row, s.cols-n, s.cols)
+		s.wrap_pending = false
+	case 'L', 'M':
+		if s.row < s.top || s.row > s.bottom {
+			return
+		}
+		//lines are inserted and deleted by scrolling the part of the region from the cursor down
+		top := s.top
+		s.top = s.row
+		if final == 'L' {
+			s.scroll_down(arg(0, 1))
+		} else {
+			s.scroll_up_in_place(arg(0, 1))
+		}
+		s.top = top
+		s.col, s.wrap_pending = 0, false
+	case 'S':
+		s.scroll_up(arg(0, 1))
+	case 'T':
+		if prefix == 0 {
+			s.scroll_down(arg(0, 1))
+		}
+	case 'm':
+		if prefix == 0 {
+			s.style = apply_term_sgr(s.style, ps)
+		}
+	case 'r':
+		if prefix != 0 {
+			return
+		}
+		top, bottom := arg(0, 1)-1, arg(1, s.rows)-1
+		if top < bottom && bottom < s.rows {
+			s.top, s.bottom = top, bottom
+			s.move_to(0, 0)
+		}
+	case 's':
+		if prefix == 0 {
+			s.save_cursor()
+		}
+	case 'u':
+		if prefix == 0 {
+			s.restore_cursor()
+		}
+	case 'h', 'l':
+		if prefix == '?' {
+			for _, mode := range ps {
+				s.set_mode(mode, final == 'h')
+			}
+		}
+	case 'n':
+		if prefix != 0 {
+			return
+		}
+		switch arg(0, 0) {
+		case 5:
+			s.replies = append(s.replies, "\x1b[0n"...)
+		case 6:
+			s.replies = append(s.replies, fmt.Sprintf("\x1b[%d;%dR", s.row+1, s.col+1)...)
+		}
+	case 'c':
+		if arg(0, 0) == 0 && prefix == 0 {
+			//a VT100 with advanced video, which is what programs expect of xterm
+			s.replies = append(s.replies, "\x1b[?1;2c"...)
+		}
+	}
+}
+
+// scroll_up_in_place is scroll_up without the lines going to the scrollback, for deleting lines
+func (s *TermScreen) scroll_up_in_place(n int) {
+	n = min(n, s.bottom-s.top+1)
+	for i := 0; i < n; i++ {
+		copy(s.lines[s.top:s.bottom], s.lines[s.top+1:s.bottom+1])
+		s.lines[s.bottom] = s.blank_line()
+	}
+}
+
+// set_mode turns on or off one of the DEC private modes, the ones from CSI ? n h and CSI ? n l
+func (s *TermScreen) set_mode(mode int, on bool) {
+	switch mode {
+	case 1:
+		s.AppCursorKeys = on
+	case 25:
+		s.CursorHidden = !on
+	case 2004:
+		s.BracketedPaste = on
+	case 47, 1047, 1049:
+		if on == s.alt {
+			return
+		}
+		if mode == 1049 && on {
+			s.save_cursor()
+		}
+		if on {
+			s.main_lines, s.lines = s.lines, nil
+			for i := 0; i < s.rows; i++ {
+				s.lines = append(s.lines, s.blank_line())
+			}
+		} else {
+			s.lines, s.main_lines = s.main_lines, nil
+		}
+		s.alt = on
+		s.top, s.bottom = 0, s.rows-1
+		if mode == 1049 && !on {
+			s.restore_cursor()
+		}
+	}
+}
+
+func (s *TermScreen) osc(text string) {
+	code, value, _ := strings.Cut(text, ";")
+	if code == "0" || code == "2" {
+		s.Title = value
+	}
+}
+
+// apply_term_sgr is style after the SGR parameters codes, which set colours and attributes
+func apply_term_sgr(style term_style, codes []int) term_style {
+	for i := 0; i < len(codes); i++ {
+		switch n := codes[i]; {
+		case n == 0:
+			style = term_style{}
+		case n == 1:
+			style.bold = true
+		case n == 22:
+			style.bold = false
+		case n == 4:
+			style.underline = true
+		case n == 24:
+			style.underline = false
+		case n == 7:
+			style.reverse = true
+		case n == 27:
+			style.reverse = false
+		case n >= 30 && n <= 37:
+			style.fg = ansi_color(n - 30)
+		case n >= 90 && n <= 97:
+			style.fg = xterm_color(n - 90 + 8)
+		case n == 39:
+			style.fg = nil
+		case n >= 40 && n <= 47:
+			style.bg = ansi_color(n - 40)
+		case n >= 100 && n <= 107:
+			style.bg = xterm_color(n - 100 + 8)
+		case n == 49:
+			style.bg = nil
+		case n == 38 || n == 48:
+			//256 colour and true colour, which take more parameters
+			var col color.Color
+			if i+2 < len(codes) && codes[i+1] == 5 {
+				col = xterm_color(codes[i+2])
+				i += 2
+			} else if i+4 < len(codes) && codes[i+1] == 2 {
+				col = color.RGBA{uint8(codes[i+2]), uint8(codes[i+3]), uint8(codes[i+4]), 0xff}
+				i += 4
+			} else {
+				continue
+			}
+			if n == 38 {
+				style.fg = col
+			} else {
+				style.bg = col
+			}
+		}
+	}
+	return style
+}
+
+// xterm_color is colour n of xterm's 256, the first 16 come from the theme
+func xterm_color(n int) color.Color {
+	switch {
+	case n < 8:
+		return ansi_color(n)
+	case n < 16:
+		//the bright ones, the theme only has one of each
+		return ansi_color(n - 8)
+	case n < 232:
+		n -= 16
+		level := func(v int) uint8 {
+			if v == 0 {
+				return 0
+			}
+			return uint8(55 + v*40)
+		}
+		return color.RGBA{level(n / 36), level(n / 6 % 6), level(n % 6), 0xff}
+	case n < 256:
+		v := uint8(8 + (n-232)*10)
+		return color.RGBA{v, v, v, 0xff}
+	}
+	return Style.FGColorStrong
+}
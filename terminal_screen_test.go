@@ -0,0 +1,211 @@
+package main
+
+import (
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+// screen_lines is the text of each line on screen, not counting the scrollback
+func screen_lines(s *TermScreen) []string {
+	lines := []string{}
+	for i := len(s.scrollback); i < s.LineCount(); i++ {
+		lines = append(lines, s.Line(i).text())
+	}
+	return lines
+}
+
+func TestTermScreenSequences(t *testing.T) {
+	const numbered = "1\r\n2\r\n3\r\n4"
+	tests := []struct {
+		name     string
+		cols     int
+		input    string
+		want     []string
+		row, col int
+	}{
+		{"plain", 10, "hello", []string{"hello", "", "", ""}, 0, 5},
+		{"newlines", 10, "ab\r\ncd", []string{"ab", "cd", "", ""}, 1, 2},
+		{"wrap", 4, "abcdef", []string{"abcd", "ef", "", ""}, 1, 2},
+		{"backspace and tab", 20, "abc\bX\tY", []string{"abX     Y", "", "", ""}, 0, 9},
+		{"move", 10, "\x1b[2;3Hx", []string{"", "  x", "", ""}, 1, 3},
+		{"move clamped", 10, "\x1b[9;99Hx", []string{"", "", "", "         x"}, 3, 9},
+		{"erase to end", 10, "abcdef\x1b[3G\x1b[K", []string{"ab", "", "", ""}, 0, 2},
+		{"erase screen", 10, numbered + "\x1b[2J", []string{"", "", "", ""}, 3, 1},
+		{"insert chars", 10, "abcdef\r\x1b[2C\x1b[2@XY", []string{"abXYcdef", "", "", ""}, 0, 4},
+		{"insert chars at the edge", 6, "abcdef\x1b[4G\x1b[9@", []string{"abc", "", "", ""}, 0, 3},
+		{"delete chars", 10, "abcdef\r\x1b[C\x1b[2P", []string{"adef", "", "", ""}, 0, 1},
+		{"insert line", 10, numbered + "\x1b[2H\x1b[L", []string{"1", "", "2", "3"}, 1, 0},
+		{"delete lines", 10, numbered + "\x1b[2H\x1b[2M", []string{"1", "4", "", ""}, 1, 0},
+		{"insert line in region", 10, numbered + "\x1b[1;3r\x1b[2H\x1b[L", []string{"1", "", "2", "4"}, 1, 0},
+		{"scroll region", 10, numbered + "\x1b[2;3r\x1b[3H\nx", []string{"1", "3", "x", "4"}, 2, 1},
+		{"reverse index at region top", 10, numbered + "\x1b[2;3r\x1b[2H\x1bMx", []string{"1", "x", "2", "4"}, 1, 1},
+		{"region outside cursor", 10, numbered + "\x1b[1;2r\x1b[4H\nx", []string{"1", "2", "3", "x"}, 3, 1},
+		{"save and restore", 10, "ab\x1b7\x1b[3;5Hc\x1b8d", []string{"abd", "", "    c", ""}, 0, 3},
+	}
+	for _, test := range tests {
+		s := NewTermScreen(test.cols, 4)
+		s.Write([]byte(test.input))
+		if got := screen_lines(s); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: screen %q, want %q", test.name, got, test.want)
+		}
+		if s.row != test.row || s.col != test.col {
+			t.Errorf("%s: cursor at %d,%d, want %d,%d", test.name, s.row, s.col, test.row, test.col)
+		}
+	}
+}
+
+func TestTermScreenScrollback(t *testing.T) {
+	s := NewTermScreen(10, 3)
+	s.Write([]byte("a\r\nb\r\nc\r\nd\r\ne"))
+	if s.LineCount() != 5 || s.Line(0).text() != "a" || s.Line(1).text() != "b" {
+		t.Errorf("scrollback has %d lines starting %q", s.LineCount()-3, s.Line(0).text())
+	}
+	if got := screen_lines(s); !reflect.DeepEqual(got, []string{"c", "d", "e"}) {
+		t.Errorf("screen %q", got)
+	}
+	//a scroll region that doesn't start at the top throws away what scrolls out of it
+	s.Write([]byte("\x1b[2;3r\x1b[3H\n"))
+	if s.LineCount() != 5 {
+		t.Errorf("scrolling inside a region added to the scrollback")
+	}
+	if got := screen_lines(s); !reflect.DeepEqual(got, []string{"c", "e", ""}) {
+		t.Errorf("after scrolling the region the screen is %q", got)
+	}
+	s.Write([]byte("\x1b[3J"))
+	if s.LineCount() != 3 {
+		t.Errorf("ESC [ 3 J left %d lines", s.LineCount())
+	}
+}
+
+func TestTermScreenAltScreen(t *testing.T) {
+	s := NewTermScreen(10, 2)
+	s.Write([]byte("x\r\nmain"))
+	s.Write([]byte("\x1b[?1049h"))
+	if !s.alt {
+		t.Fatalf("1049 didn't switch to the alternate screen")
+	}
+	if got := screen_lines(s); !reflect.DeepEqual(got, []string{"", ""}) {
+		t.Errorf("alternate screen starts with %q", got)
+	}
+	s.Write([]byte("\x1b[Hone\r\ntwo\r\nthree\r\nfour"))
+	if got := screen_lines(s); !reflect.DeepEqual(got, []string{"three", "four"}) {
+		t.Errorf("alternate screen shows %q", got)
+	}
+	if len(s.scrollback) != 0 {
+		t.Errorf("alternate screen scrolled %d lines into the scrollback", len(s.scrollback))
+	}
+	s.Write([]byte("\x1b[?1049l"))
+	if got := screen_lines(s); !reflect.DeepEqual(got, []string{"x", "main"}) {
+		t.Errorf("back on the main screen it shows %q", got)
+	}
+	if s.row != 1 || s.col != 4 {
+		t.Errorf("cursor back at %d,%d, want 1,4", s.row, s.col)
+	}
+}
+
+func TestTermScreenSGR(t *testing.T) {
+	s := NewTermScreen(10, 1)
+	s.Write([]byte("\x1b[1;31ma\x1b[38;5;196mb\x1b[48;2;1;2;3mc\x1b[39;22md\x1b[0me"))
+	line := s.Line(0)
+	truecolor := color.RGBA{1, 2, 3, 0xff}
+	want := []term_style{
+		{fg: ansi_color(1), bold: true},
+		{fg: xterm_color(196), bold: true},
+		{fg: xterm_color(196), bg: truecolor, bold: true},
+		{bg: truecolor},
+		{},
+	}
+	for i, style := range want {
+		if !reflect.DeepEqual(line[i].style, style) {
+			t.Errorf("cell %d %q style %+v, want %+v", i, line[i].ch, line[i].style, style)
+		}
+	}
+	if got := xterm_color(196); got != (color.RGBA{255, 0, 0, 0xff}) {
+		t.Errorf("colour 196 is %v", got)
+	}
+	if got := xterm_color(232); got != (color.RGBA{8, 8, 8, 0xff}) {
+		t.Errorf("colour 232 is %v", got)
+	}
+	//erased cells keep the background colour
+	s.Write([]byte("\x1b[44m\r\x1b[K"))
+	if line := s.Line(0); line[5].style.bg != ansi_color(4) {
+		t.Errorf("erased cell background %v", line[5].style.bg)
+	}
+}
+
+func TestTermScreenSplitUTF8(t *testing.T) {
+	s := NewTermScreen(10, 1)
+	euro := []byte("€")
+	writes := [][]byte{{'a', 0xc3}, {0xa9, 'b'}, euro[:1], euro[1:2], euro[2:], []byte("c")}
+	for _, w := range writes {
+		s.Write(w)
+	}
+	if got := s.Line(0).text(); got != "aéb€c" {
+		t.Errorf("line is %q, want aéb€c", got)
+	}
+	if s.col != 5 {
+		t.Errorf("cursor at column %d, want 5", s.col)
+	}
+}
+
+func TestTermScreenResize(t *testing.T) {
+	s := NewTermScreen(6, 4)
+	s.Write([]byte("1\r\n2\r\n3\r\nfourth"))
+	s.Resize(4, 2)
+	if got := screen_lines(s); !reflect.DeepEqual(got, []string{"3", "four"}) {
+		t.Errorf("shrunk screen %q", got)
+	}
+	if s.LineCount() != 4 || s.Line(0).text() != "1" || s.Line(1).text() != "2" {
+		t.Errorf("lines off the top didn't go to the scrollback")
+	}
+	if s.row != 1 || s.col != 3 {
+		t.Errorf("cursor at %d,%d, want 1,3", s.row, s.col)
+	}
+
+	s.Resize(8, 3)
+	if got := screen_lines(s); !reflect.DeepEqual(got, []string{"3", "four", ""}) {
+		t.Errorf("grown screen %q", got)
+	}
+	s.Write([]byte("\x1b[3;8Hx"))
+	if got := s.Line(s.LineCount() - 1).text(); got != "       x" {
+		t.Errorf("new column wasn't usable, last line %q", got)
+	}
+
+	//with the cursor at the top, shrinking drops lines off the bottom instead
+	s = NewTermScreen(6, 3)
+	s.Write([]byte("a\r\nb\x1b[H"))
+	s.Resize(6, 1)
+	if got := screen_lines(s); !reflect.DeepEqual(got, []string{"a"}) || s.LineCount() != 1 {
+		t.Errorf("shrunk under the cursor to %q with %d lines", got, s.LineCount())
+	}
+}
+
+func TestTermScreenReplies(t *testing.T) {
+	s := NewTermScreen(10, 4)
+	tests := []struct{ input, want string }{
+		{"\x1b[2;5H\x1b[6n", "\x1b[2;5R"},
+		{"\x1b[5n", "\x1b[0n"},
+		{"\x1b[c", "\x1b[?1;2c"},
+		{"\x1b[>c", ""},
+		{"\x1b[?6n", ""},
+	}
+	for _, test := range tests {
+		s.Write([]byte(test.input))
+		if got := string(s.TakeReplies()); got != test.want {
+			t.Errorf("%q replied %q, want %q", test.input, got, test.want)
+		}
+	}
+	if got := s.TakeReplies(); len(got) != 0 {
+		t.Errorf("replies weren't cleared, got %q", got)
+	}
+
+	s.Write([]byte("\x1b]0;first\x07"))
+	if s.Title != "first" {
+		t.Errorf("title %q after OSC ending in BEL", s.Title)
+	}
+	s.Write([]byte("\x1b]2;second\x1b\\"))
+	if s.Title != "second" {
+		t.Errorf("title %q after OSC ending in ST", s.Title)
+	}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+// TestExplorer lists the workspace's packages and their tests with how they did last run
+// a failed test's output is listed under it, clicking a line that points at a file jumps there
+// it's a ResultsPanel that keeps itself up to date, like the problems panel
+type TestExplorer struct {
+	*ResultsPanel
+	packages     []TestPackage
+	rows         []test_row      //what each item is
+	collapsed    map[string]bool //package directories folded up
+	version      uint64          //test_results_version the items were built from
+	test_request *TestRequest
+}
+
+// test_row is what an item of the explorer stands for, Test is "" for a package's row
+type test_row struct {
+	Dir, Test string
+	output    bool //a line of the test's output
+}
+
+var _ Widget = &TestExplorer{}
+var _ Jumper = &TestExplorer{}
+
+// the most output lines shown under a failed test
+const test_explorer_output_lines = 10
+
+func NewTestExplorer() *TestExplorer {
+	tx := &TestExplorer{ResultsPanel: NewResultsPanel("Tests", nil), collapsed: map[string]bool{}}
+	tx.Rediscover()
+	return tx
+}
+
+// ShowTestExplorer shows the test explorer, switching to it if it's already open
+func (g *Editor) ShowTestExplorer() {
+	var existing *TestExplorer
+	Walk(g.MainWidget, func(w Widget) {
+		if tx, ok := w.(*TestExplorer); ok {
+			existing = tx
+		}
+	})
+	if existing == nil {
+		g.ShowPanel(NewTestExplorer())
+		return
+	}
+	if tabs, ok := FindParent(g.MainWidget, existing).(*Tabs); ok {
+		g.ShowTab(tabs, existing)
+	}
+}
+
+// Rediscover looks for tests again, for after they've been added or removed
+func (tx *TestExplorer) Rediscover() {
+	tx.packages = FindTests(WorkspaceDir())
+	tx.build()
+}
+
+// Refresh rebuilds the list if any results have changed since
+func (tx *TestExplorer) Refresh() {
+	if tx.version != test_results_version {
+		tx.build()
+	}
+}
+
+func (tx *TestExplorer) build() {
+	tx.version = test_results_version
+	root := WorkspaceDir()
+	items := []ResultItem{}
+	rows := []test_row{}
+	count := 0
+	for _, p := range tx.packages {
+		name, err := filepath.Rel(root, p.Dir)
+		if err != nil || name == "." {
+			name = filepath.Base(p.Dir)
+		}
+		arrow := "v "
+		if tx.collapsed[p.Dir] {
+			arrow = "> "
+		}
+		items = append(items, ResultItem{
+			Location: NavLocation{Path: p.Tests[0].Path},
+			Label:    arrow + filepath.ToSlash(name),
+			Preview:  package_summary(p),
+			Color:    test_status_color(package_status(p)),
+		})
+		rows = append(rows, test_row{Dir: p.Dir})
+		count += len(p.Tests)
+		if tx.collapsed[p.Dir] {
+			continue
+		}
+		for _, t := range p.Tests {
+			status, preview := TestNotRun, ""
+			r := TestResultFor(p.Dir, t.Name)
+			if r != nil {
+				status, preview = r.Status, test_status_text(r)
+			}
+			items = append(items, ResultItem{
+				Location: NavLocation{Path: t.Path, Cursor: Cursor{row: t.Row}},
+				Label:    "    " + t.Name,
+				Preview:  preview,
+				Color:    test_status_color(status),
+			})
+			rows = append(rows, test_row{Dir: p.Dir, Test: t.Name})
+			if r == nil || r.Status != TestFailed {
+				continue
+			}
+			for _, line := range failure_lines(r.Output) {
+				loc := NavLocation{Path: t.Path, Cursor: Cursor{row: t.Row}}
+				if ds := ParseToolOutput(strings.TrimSpace(line), p.Dir, t.Name); len(ds) > 0 {
+					loc = NavLocation{Path: ds[0].Path, Cursor: ds[0].From}
+				}
+				items = append(items, ResultItem{Location: loc, Label: "        ", Preview: line})
+				rows = append(rows, test_row{Dir: p.Dir, Test: t.Name, output: true})
+			}
+		}
+	}
+	tx.items, tx.rows = items, rows
+	tx.title = fmt.Sprintf("Tests (%d)", count)
+	tx.selected = min(tx.selected, len(items)-1)
+	tx.hovered = -1
+	tx.clamp_scroll()
+}
+
+// failure_lines is what a failed test said, without go test's own === and --- lines
+func failure_lines(output []string) []string {
+	lines := []string{}
+	for _, line := range output {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "=== ") || strings.HasPrefix(trimmed, "--- ") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) > test_explorer_output_lines {
+		lines = append(lines[:test_explorer_output_lines], "...")
+	}
+	return lines
+}
+
+// package_status is the package's result if it ran as a whole, otherwise the worst of its tests'
+func package_status(p TestPackage) int {
+	if r := TestResultFor(p.Dir, ""); r != nil {
+		return r.Status
+	}
+	status := TestNotRun
+	for _, t := range p.Tests {
+		r := TestResultFor(p.Dir, t.Name)
+		switch {
+		case r == nil:
+		case r.Status == TestFailed || r.Status == TestRunning:
+			return r.Status
+		case r.Status == TestPassed:
+			status = TestPassed
+		}
+	}
+	return status
+}
+
+func package_summary(p TestPackage) string {
+	passed, failed := 0, 0
+	for _, t := range p.Tests {
+		if r := TestResultFor(p.Dir, t.Name); r != nil {
+			switch r.Status {
+			case TestPassed:
+				passed++
+			case TestFailed:
+				failed++
+			}
+		}
+	}
+	if passed+failed == 0 {
+		return fmt.Sprintf("%d tests", len(p.Tests))
+	}
+	return fmt.Sprintf("%d tests, %d passed, %d failed", len(p.Tests), passed, failed)
+}
+
+// Toggle folds or unfolds the package of row i
+func (tx *TestExplorer) Toggle(i int) {
+	if i < 0 || i >= len(tx.rows) {
+		return
+	}
+	dir := tx.rows[i].Dir
+	tx.collapsed[dir] = !tx.collapsed[dir]
+	tx.build()
+	for j, row := range tx.rows {
+		if row.Dir == dir && row.Test == "" {
+			tx.selected = j
+			tx.scroll_to(j)
+		}
+	}
+}
+
+// Run runs what row i is, its package or its test
+func (tx *TestExplorer) Run(i int) {
+	if i < 0 || i >= len(tx.rows) {
+		return
+	}
+	tx.test_request = &TestRequest{Dir: tx.rows[i].Dir, Test: tx.rows[i].Test}
+}
+
+// RunPackage runs the whole package of row i
+func (tx *TestExplorer) RunPackage(i int) {
+	if i < 0 || i >= len(tx.rows) {
+		return
+	}
+	tx.test_request = &TestRequest{Dir: tx.rows[i].Dir}
+}
+
+// RunAll runs every package's tests
+func (tx *TestExplorer) RunAll() {
+	tx.test_request = &TestRequest{}
+}
+
+// TakeTestRequest returns what was asked to run since it was last asked, if anything
+func (tx *TestExplorer) TakeTestRequest() (TestRequest, bool) {
+	req := tx.test_request
+	tx.test_request = nil
+	if req == nil {
+		return TestRequest{}, false
+	}
+	return *req, true
+}
+
+/*
+Widget, the mouse methods hand back the explorer and not the ResultsPanel in it so it's what gets focus
+*/
+
+// TakeKeyboard implements Widget, Enter on a package folds it and Ctrl+Enter runs the selection
+func (tx *TestExplorer) TakeKeyboard() {
+	if inpututil.IsKeyJustPressed(ebiten.KeyEnter) && tx.selected >= 0 && tx.selected < len(tx.rows) {
+		switch {
+		case ebiten.IsKeyPressed(ebiten.KeyControl):
+			tx.Run(tx.selected)
+		case tx.rows[tx.selected].Test == "":
+			tx.Toggle(tx.selected)
+		default:
+			tx.activate(tx.selected)
+		}
+		return
+	}
+	tx.ResultsPanel.TakeKeyboard()
+}
+
+// MouseOver implements Widget
+func (tx *TestExplorer) MouseOver(x int, y int) Widget {
+	tx.ResultsPanel.MouseOver(x, y)
+	return tx
+}
+
+// LMouseDown implements Widget, clicking a package folds it and clicking a test jumps to it
+func (tx *TestExplorer) LMouseDown(x int, y int) Widget {
+	if i := tx.row_at(x, y); i >= 0 && tx.rows[i].Test == "" {
+		tx.selected = i
+		tx.Toggle(i)
+		return tx
+	}
+	tx.ResultsPanel.LMouseDown(x, y)
+	return tx
+}
+
+// LMouseUp implements Widget
+func (tx *TestExplorer) LMouseUp(x int, y int) Widget {
+	return tx
+}
+
+// RMouseDown implements Widget, selects the row so the context menu acts on it
+func (tx *TestExplorer) RMouseDown(x int, y int) Widget {
+	if i := tx.row_at(x, y); i >= 0 {
+		tx.selected = i
+	}
+	return tx
+}
+
+// RMouseUp implements Widget, it has a context menu for running tests
+func (tx *TestExplorer) RMouseUp(x int, y int) Widget {
+	return tx
+}
+
+func (g *Editor) test_explorer_context_menu(tx *TestExplorer) []MenuItem {
+	selected := func() bool { return tx.selected >= 0 && tx.selected < len(tx.rows) }
+	can_run := func() bool { return selected() && !g.TaskRunning() }
+	return []MenuItem{
+		NewActionMenuItem("&Run", KeyShortcut{mod_ctrl: true, key: ebiten.KeyEnter}, func() { tx.Run(tx.selected) }).WhenEnabled(can_run),
+		NewActionMenuItem("Run &Package", KeyShortcut{}, func() { tx.RunPackage(tx.selected) }).WhenEnabled(can_run),
+		NewActionMenuItem("Run &All", KeyShortcut{}, tx.RunAll).WhenEnabled(func() bool { return !g.TaskRunning() }),
+		NewMenuSeparator(),
+		NewActionMenuItem("Re&fresh", KeyShortcut{}, tx.Rediscover),
+	}
+}
@@ -0,0 +1,563 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"image"
+	"image/color"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+	"golang.org/x/image/font"
+)
+
+// Go tests, found by parsing _test.go files and run with go test -json so each test's result and output can be picked out
+// every run writes a coverage profile, which editors show as green and red lines
+
+// TestFunc is a func TestXxx(t *testing.T) in a file
+type TestFunc struct {
+	Name string
+	Path string
+	Row  int
+}
+
+// GoTestFuncs is the tests declared in src, a file that doesn't parse has what parsed before the error
+func GoTestFuncs(path, src string) []TestFunc {
+	fset := token.NewFileSet()
+	f, _ := parser.ParseFile(fset, path, src, parser.SkipObjectResolution)
+	if f == nil {
+		return nil
+	}
+	tests := []TestFunc{}
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv != nil || !is_test_name(fn.Name.Name) || !takes_testing_t(fn) {
+			continue
+		}
+		tests = append(tests, TestFunc{Name: fn.Name.Name, Path: path, Row: fset.Position(fn.Name.Pos()).Line - 1})
+	}
+	return tests
+}
+
+// is_test_name is the go tool's rule, Test and then anything not starting with a lower case letter
+func is_test_name(name string) bool {
+	if !strings.HasPrefix(name, "Test") {
+		return false
+	}
+	r, _ := utf8.DecodeRuneInString(name[len("Test"):])
+	return r == utf8.RuneError || !unicode.IsLower(r)
+}
+
+func takes_testing_t(fn *ast.FuncDecl) bool {
+	params := fn.Type.Params.List
+	if len(params) != 1 || len(params[0].Names) > 1 {
+		return false
+	}
+	star, ok := params[0].Type.(*ast.StarExpr)
+	if !ok {
+		return false
+	}
+	sel, ok := star.X.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	pkg, ok := sel.X.(*ast.Ident)
+	return ok && pkg.Name == "testing" && sel.Sel.Name == "T"
+}
+
+// TestPackage is a directory with tests in it
+type TestPackage struct {
+	Dir   string
+	Tests []TestFunc
+}
+
+// skip_dir is a directory the go tool ignores
+func skip_dir(name string) bool {
+	return name != "." && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "vendor" || name == "testdata")
+}
+
+// FindTests is every package under root with tests, in order of directory
+func FindTests(root string) []TestPackage {
+	by_dir := map[string]*TestPackage{}
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != root && skip_dir(d.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		tests := GoTestFuncs(path, string(src))
+		if len(tests) == 0 {
+			return nil
+		}
+		dir := filepath.Dir(path)
+		if by_dir[dir] == nil {
+			by_dir[dir] = &TestPackage{Dir: dir}
+		}
+		by_dir[dir].Tests = append(by_dir[dir].Tests, tests...)
+		return nil
+	})
+	packages := []TestPackage{}
+	for _, p := range by_dir {
+		sort.SliceStable(p.Tests, func(i, j int) bool { return p.Tests[i].Name < p.Tests[j].Name })
+		packages = append(packages, *p)
+	}
+	sort.Slice(packages, func(i, j int) bool { return packages[i].Dir < packages[j].Dir })
+	return packages
+}
+
+/*
+Results
+*/
+
+const (
+	TestNotRun = iota
+	TestRunning
+	TestPassed
+	TestFailed
+	TestSkipped
+)
+
+// TestResult is how a test, or a whole package, did in the last run of it
+type TestResult struct {
+	Status  int
+	Elapsed float64 //seconds
+	Output  []string
+}
+
+// by package directory and test name, "" for the package itself
+var test_results = map[string]map[string]*TestResult{}
+
+// goes up whenever test_results changes
+var test_results_version uint64
+
+// TestResultFor is the result of test in the package in dir, nil if it hasn't run
+func TestResultFor(dir, test string) *TestResult {
+	return test_results[dir][test]
+}
+
+func result_for(dir, test string) *TestResult {
+	if test_results[dir] == nil {
+		test_results[dir] = map[string]*TestResult{}
+	}
+	r := test_results[dir][test]
+	if r == nil {
+		r = &TestResult{}
+		test_results[dir][test] = r
+	}
+	return r
+}
+
+func test_status_color(status int) color.Color {
+	switch status {
+	case TestRunning:
+		return Style.BlueStrong
+	case TestPassed:
+		return Style.GreenStrong
+	case TestFailed:
+		return Style.RedStrong
+	case TestSkipped:
+		return Style.YellowStrong
+	}
+	return Style.FGColorMuted
+}
+
+func test_status_text(r *TestResult) string {
+	switch r.Status {
+	case TestRunning:
+		return "running"
+	case TestPassed:
+		return fmt.Sprintf("passed (%.2fs)", r.Elapsed)
+	case TestFailed:
+		return fmt.Sprintf("FAILED (%.2fs)", r.Elapsed)
+	case TestSkipped:
+		return "skipped"
+	}
+	return ""
+}
+
+// module_path is the module declared in root's go.mod, "" if there isn't one
+func module_path(root string) string {
+	f, err := os.Open(filepath.Join(root, "go.mod"))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) >= 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`)
+		}
+	}
+	return ""
+}
+
+// package_dir is the directory of a package in the workspace's module, from its import path
+func package_dir(import_path string) string {
+	root := WorkspaceDir()
+	module := module_path(root)
+	if module == "" || import_path != module && !strings.HasPrefix(import_path, module+"/") {
+		return ""
+	}
+	return filepath.Join(root, filepath.FromSlash(strings.TrimPrefix(import_path, module)))
+}
+
+// test_event is a line of go test -json
+type test_event struct {
+	Action  string
+	Package string
+	Test    string
+	Elapsed float64
+	Output  string
+}
+
+// test_output_filter takes go test -json's lines, recording results and passing on the output for the output panel
+func test_output_filter() func(line string) string {
+	dirs := map[string]string{}
+	return func(line string) string {
+		var e test_event
+		if !strings.HasPrefix(line, "{") || json.Unmarshal([]byte(line), &e) != nil {
+			//build errors and the like aren't json
+			return line + "\n"
+		}
+		dir, ok := dirs[e.Package]
+		if !ok {
+			dir = package_dir(e.Package)
+			dirs[e.Package] = dir
+		}
+		if dir == "" {
+			return e.Output
+		}
+		test_results_version++
+		r := result_for(dir, e.Test)
+		switch e.Action {
+		case "run", "start":
+			*r = TestResult{Status: TestRunning}
+		case "pass":
+			r.Status, r.Elapsed = TestPassed, e.Elapsed
+		case "fail":
+			r.Status, r.Elapsed = TestFailed, e.Elapsed
+		case "skip":
+			r.Status, r.Elapsed = TestSkipped, e.Elapsed
+		case "output":
+			r.Output = append(r.Output, strings.TrimRight(e.Output, "\n"))
+			//subtests' output goes with their test too
+			if top, _, sub := strings.Cut(e.Test, "/"); sub {
+				parent := result_for(dir, top)
+				parent.Output = append(parent.Output, strings.TrimRight(e.Output, "\n"))
+			}
+		}
+		return e.Output
+	}
+}
+
+// coverage_profile is where runs write their coverage, each run replaces it
+func coverage_profile() string {
+	return filepath.Join(os.TempDir(), "ide-coverage.out")
+}
+
+// RunTests runs go test on the package in dir, or just test in it, or every package if dir is ""
+func (g *Editor) RunTests(dir, test string) {
+	root := WorkspaceDir()
+	target, name := "./...", "Tests"
+	if dir != "" {
+		rel, err := filepath.Rel(root, dir)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			log.Println("can only test packages in the workspace:", dir)
+			return
+		}
+		target, name = "./"+filepath.ToSlash(rel), filepath.ToSlash(rel)
+	}
+	args := []string{"go", "test", "-json", "-coverprofile=" + coverage_profile()}
+	if test != "" {
+		args = append(args, "-run", "^"+test+"$")
+		name = test
+	}
+	args = append(args, target)
+	run := &TaskRun{Task: Task{Name: "Test " + name, Command: strings.Join(args, " ")}, args: args, filter: test_output_filter(), on_done: load_coverage}
+	if err := g.start_task(run); err != nil {
+		log.Println("couldn't run tests:", err)
+		return
+	}
+	//tests that aren't going to run again keep their results, the ones that are start over
+	for d, results := range test_results {
+		if dir == "" || d == dir {
+			for t := range results {
+				if test == "" || t == test || t == "" || strings.HasPrefix(t, test+"/") {
+					delete(results, t)
+				}
+			}
+		}
+	}
+	test_results_version++
+}
+
+func (g *Editor) RunAllTests() {
+	g.RunTests("", "")
+}
+
+// RunTestAtCursor runs the test the cursor is in, or the focused file's package if it's not in one
+func (g *Editor) RunTestAtCursor() {
+	te := g.FocusedEditor()
+	if te == nil || te.buf.filepath == "" {
+		return
+	}
+	test := ""
+	for _, t := range te.test_funcs() {
+		if t.Row <= te.cursor.row {
+			test = t.Name
+		}
+	}
+	g.RunTests(filepath.Dir(te.buf.filepath), test)
+}
+
+/*
+Coverage
+*/
+
+// coverage_block is a stretch of code that either ran or didn't
+type coverage_block struct {
+	from, to Cursor
+	covered  bool
+}
+
+// by file
+var coverage = map[string][]coverage_block{}
+
+var show_coverage = true
+
+func ToggleCoverage() {
+	show_coverage = !show_coverage
+}
+
+// load_coverage reads the profile the run wrote, replacing the coverage of the files in it
+func load_coverage(run *TaskRun) {
+	f, err := os.Open(coverage_profile())
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	covered := parse_cover_profile(f, package_dir)
+	for path, blocks := range covered {
+		coverage[path] = blocks
+	}
+	os.Remove(coverage_profile())
+}
+
+// parse_cover_profile reads a -coverprofile file, dir_of turns its import paths into directories
+// lines look like example.com/m/pkg/file.go:12.5,14.2 3 1, the block, how many statements and how many times it ran
+func parse_cover_profile(r io.Reader, dir_of func(import_path string) string) map[string][]coverage_block {
+	covered := map[string][]coverage_block{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		colon := strings.LastIndexByte(line, ':')
+		if colon < 0 || strings.HasPrefix(line, "mode:") {
+			continue
+		}
+		fields := strings.Fields(line[colon+1:])
+		if len(fields) != 3 {
+			continue
+		}
+		var from, to Cursor
+		if _, err := fmt.Sscanf(fields[0], "%d.%d,%d.%d", &from.row, &from.col, &to.row, &to.col); err != nil {
+			continue
+		}
+		count, _ := strconv.Atoi(fields[2])
+		file := line[:colon]
+		dir := dir_of(strings.TrimSuffix(file, "/"+filepath.Base(file)))
+		if dir == "" {
+			continue
+		}
+		path := filepath.Join(dir, filepath.Base(file))
+		from.row, from.col, to.row, to.col = from.row-1, from.col-1, to.row-1, to.col-1
+		covered[path] = append(covered[path], coverage_block{from: from, to: to, covered: count > 0})
+	}
+	return covered
+}
+
+// DrawCoverage shades the lines of te's file the last test run covered green and the ones it didn't red
+func (te *TextEditor) DrawCoverage(target *ebiten.Image) {
+	blocks := coverage[te.buf.filepath]
+	if !show_coverage || len(blocks) == 0 {
+		return
+	}
+	rows := map[int]bool{}
+	for _, b := range blocks {
+		for row := b.from.row; row <= b.to.row; row++ {
+			//a line with anything that didn't run counts as not covered
+			if was, seen := rows[row]; !seen || was {
+				rows[row] = b.covered
+			}
+		}
+	}
+	origin := te.text_origin()
+	for row, covered := range rows {
+		y := te.line_top(row)
+		if row < te.first_row() || y >= te.Dy() || row >= len(te.buf.lines) {
+			continue
+		}
+		col := Translucent(Style.RedMuted, 0.25)
+		if covered {
+			col = Translucent(Style.GreenMuted, 0.25)
+		}
+		DrawRect(target, image.Rect(origin.X, origin.Y+y, te.Max.X, origin.Y+y+CodeLineHeight()), col)
+	}
+}
+
+/*
+In the editor, run buttons in the gutter and results at the end of the line
+*/
+
+// test_funcs is the tests in te's file, worked out again only when it's changed
+func (te *TextEditor) test_funcs() []TestFunc {
+	if !strings.HasSuffix(te.buf.filepath, "_test.go") {
+		return nil
+	}
+	if te.tests == nil || te.tests_version != te.buf.version {
+		te.tests = GoTestFuncs(te.buf.filepath, te.buf.Text())
+		te.tests_version = te.buf.version
+	}
+	return te.tests
+}
+
+// test_at_row is the test declared on row, "" if there isn't one
+func (te *TextEditor) test_at_row(row int) string {
+	for _, t := range te.test_funcs() {
+		if t.Row == row {
+			return t.Name
+		}
+	}
+	return ""
+}
+
+// DrawTests draws a run button by each test, coloured by how it did, with its result after the line
+func (te *TextEditor) DrawTests(target *ebiten.Image) {
+	tests := te.test_funcs()
+	if len(tests) == 0 {
+		return
+	}
+	dir := filepath.Dir(te.buf.filepath)
+	origin := te.text_origin()
+	for _, t := range tests {
+		y := te.line_top(t.Row)
+		if t.Row < te.first_row() || y >= te.Dy() || t.Row >= len(te.buf.lines) {
+			continue
+		}
+		status := TestNotRun
+		r := TestResultFor(dir, t.Name)
+		if r != nil {
+			status = r.Status
+		}
+		size := min(te.gutter_width(), CodeLineHeight()) - Px(4)
+		button := image.Rect(0, 0, size, size).Add(image.Pt(te.Min.X+(te.gutter_width()-size)/2, te.Min.Y+y+(CodeLineHeight()-size)/2))
+		DrawRunButton(target, button, test_status_color(status))
+		if r == nil || r.Status == TestNotRun {
+			continue
+		}
+		x := origin.X + font.MeasureString(CodeFontFace, te.buf.lines[t.Row]).Round() + Px(16)
+		text.Draw(target, test_status_text(r), CodeFontFace, x, origin.Y+y+text_edit_top_padding+CodeFontPeriodFromTop, test_status_color(r.Status))
+	}
+}
+
+// DrawRunButton draws a triangle pointing right filling r
+func DrawRunButton(target *ebiten.Image, r image.Rectangle, col color.Color) {
+	w := r.Dx()
+	cy := float64(r.Min.Y) + float64(r.Dy())/2
+	for i := 0; i < w; i++ {
+		half := float64(r.Dy()) / 2 * float64(w-i) / float64(w)
+		x := float64(r.Min.X + i)
+		ebitenutil.DrawLine(target, x, cy-half, x, cy+half, col)
+	}
+}
+
+// test_tooltip is a test's output, for hovering its run button, the end of it if there's a lot
+func (te *TextEditor) test_tooltip(row int) []TooltipLine {
+	test := te.test_at_row(row)
+	if test == "" {
+		return nil
+	}
+	r := TestResultFor(filepath.Dir(te.buf.filepath), test)
+	if r == nil || len(r.Output) == 0 {
+		return TooltipText("Run " + test)
+	}
+	lines := []TooltipLine{}
+	for _, line := range r.Output[max(0, len(r.Output)-test_tooltip_lines):] {
+		lines = append(lines, TooltipLine{Text: line, Code: true})
+	}
+	return lines
+}
+
+const test_tooltip_lines = 30
+
+// TestRequest is a test an editor's run button asked to run
+type TestRequest struct {
+	Dir, Test string
+}
+
+// TakeTestRequest returns the test whose run button was clicked since it was last asked, if any
+func (te *TextEditor) TakeTestRequest() (TestRequest, bool) {
+	req := te.test_request
+	te.test_request = nil
+	if req == nil {
+		return TestRequest{}, false
+	}
+	return *req, true
+}
+
+// test_click runs the test if (x, y) is on its run button, returning false if it isn't
+func (te *TextEditor) test_click(x, y int) bool {
+	if x >= te.text_origin().X {
+		return false
+	}
+	row := te.row_at(y)
+	test := te.test_at_row(row)
+	if test == "" {
+		return false
+	}
+	te.test_request = &TestRequest{Dir: filepath.Dir(te.buf.filepath), Test: test}
+	return true
+}
+
+// UpdateTests runs tests that editors' run buttons and the test explorer asked for, and refreshes the explorer
+func (g *Editor) UpdateTests() {
+	Walk(g.MainWidget, func(w Widget) {
+		var req TestRequest
+		var ok bool
+		switch w := w.(type) {
+		case *TextEditor:
+			req, ok = w.TakeTestRequest()
+		case *TestExplorer:
+			req, ok = w.TakeTestRequest()
+			w.Refresh()
+		}
+		if ok && !g.TaskRunning() {
+			g.RunTests(req.Dir, req.Test)
+		}
+	})
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// TextBuffer is the text of a file, several TextEditors can look at the same buffer
+// so that one file can be shown side by side
+type TextBuffer struct {
+	lines    []string
+	version  uint64 //goes up on every edit so views know when they need to redraw
+	saved    bool   //is the file saved to disk
+	filepath string
+	filename string
+
+	watchers []func(tb *TextBuffer, e TextEdit)
+	marks    []*Mark
+}
+
+// TextEdit is one change to a buffer, the text from From up to To swapped for Text
+// From and To are byte offsets into lines as they were before the edit
+type TextEdit struct {
+	From, To Cursor
+	Text     string
+}
+
+// Mark is a spot in a buffer that moves with the text around it as edits are made
+// text inserted right where it is goes before a right mark and after a left one
+type Mark struct {
+	Cursor Cursor
+	right  bool
+}
+
+// Before reports whether c comes before o in the text
+func (c Cursor) Before(o Cursor) bool {
+	return c.row < o.row || c.row == o.row && c.col < o.col
+}
+
+// moved follows the edit that replaced from up to to with text ending at end
+func (m *Mark) moved(from, to, end Cursor) {
+	c := m.Cursor
+	switch {
+	case c.Before(from):
+	case to.Before(c) || c == to && from != to:
+		if c.row == to.row {
+			c.col = end.col + c.col - to.col
+		}
+		c.row += end.row - to.row
+	case m.right:
+		c = end
+	default:
+		c = from
+	}
+	m.Cursor = c
+}
+
+// NewTextBuffer makes a buffer holding s, it counts as saved until it's edited so an untouched one has nothing to lose
+func NewTextBuffer(s string) *TextBuffer {
+	return &TextBuffer{
+		lines: strings.Split(s, "\n"),
+		saved: true,
+	}
+}
+
+// Changed marks the buffer as edited
+func (tb *TextBuffer) Changed() {
+	tb.version++
+	tb.saved = false
+}
+
+// SetText swaps the whole text for s, without counting as an edit to save
+func (tb *TextBuffer) SetText(s string) {
+	tb.notify(TextEdit{To: tb.End(), Text: s})
+	old_end := tb.End()
+	tb.lines = strings.Split(s, "\n")
+	for _, m := range tb.marks {
+		m.moved(Cursor{}, old_end, tb.End())
+	}
+	tb.version++
+}
+
+// End is the cursor after the last character
+func (tb *TextBuffer) End() Cursor {
+	last := len(tb.lines) - 1
+	if last < 0 {
+		return Cursor{}
+	}
+	return Cursor{row: last, col: len(tb.lines[last])}
+}
+
+// Watch has f told about every edit, before it's made so f can still see what's being replaced
+func (tb *TextBuffer) Watch(f func(tb *TextBuffer, e TextEdit)) {
+	tb.watchers = append(tb.watchers, f)
+}
+
+// AddMark puts a mark at c, RemoveMark it once it's not needed so edits stop moving it
+func (tb *TextBuffer) AddMark(c Cursor, right bool) *Mark {
+	m := &Mark{Cursor: tb.ClampCursor(c), right: right}
+	tb.marks = append(tb.marks, m)
+	return m
+}
+
+func (tb *TextBuffer) RemoveMark(m *Mark) {
+	for i, mark := range tb.marks {
+		if mark == m {
+			tb.marks = append(tb.marks[:i], tb.marks[i+1:]...)
+			return
+		}
+	}
+}
+
+func (tb *TextBuffer) notify(e TextEdit) {
+	for _, w := range tb.watchers {
+		w(tb, e)
+	}
+}
+
+// Replace swaps the text from from up to to for s, which can be several lines, and returns where s ends
+// every edit goes through here so watchers see them all
+func (tb *TextBuffer) Replace(from, to Cursor, s string) Cursor {
+	from, to = tb.ClampCursor(from), tb.ClampCursor(to)
+	if to.Before(from) {
+		from, to = to, from
+	}
+	tb.notify(TextEdit{From: from, To: to, Text: s})
+
+	before, after := tb.lines[from.row][:from.col], tb.lines[to.row][to.col:]
+	inserted := strings.Split(s, "\n")
+	last := len(inserted) - 1
+	end := Cursor{row: from.row + last, col: len(inserted[last])}
+	if last == 0 {
+		end.col += len(before)
+	}
+	inserted[0] = before + inserted[0]
+	inserted[last] += after
+
+	lines := make([]string, 0, len(tb.lines)-(to.row-from.row)+last)
+	lines = append(lines, tb.lines[:from.row]...)
+	lines = append(lines, inserted...)
+	lines = append(lines, tb.lines[to.row+1:]...)
+	tb.lines = lines
+	for _, m := range tb.marks {
+		m.moved(from, to, end)
+	}
+	tb.Changed()
+	return end
+}
+
+func (tb *TextBuffer) Text() string {
+	return strings.Join(tb.lines, "\n")
+}
+
+// Offset is how many bytes into Text() c is
+func (tb *TextBuffer) Offset(c Cursor) int {
+	c = tb.ClampCursor(c)
+	off := c.col
+	for _, line := range tb.lines[:c.row] {
+		off += len(line) + 1
+	}
+	return off
+}
+
+func (tb *TextBuffer) SetPath(path string) {
+	tb.filepath = path
+	tb.filename = filepath.Base(path)
+}
+
+// ClampCursor moves c back inside the buffer, needed when another view removed the text it was on
+func (tb *TextBuffer) ClampCursor(c Cursor) Cursor {
+	if len(tb.lines) == 0 {
+		tb.lines = []string{""}
+	}
+	c.row = max(0, min(c.row, len(tb.lines)-1))
+	c.col = max(0, min(c.col, len(tb.lines[c.row])))
+	return c
+}
+
+// LoadTextBuffer reads the file at path into a new buffer
+func LoadTextBuffer(path string) (*TextBuffer, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tb := NewTextBuffer(string(bs))
+	tb.SetPath(path)
+	return tb, nil
+}
+
+// Save writes the buffer to its file
+func (tb *TextBuffer) Save() error {
+	if tb.filepath == "" {
+		return errors.New("buffer has no file to save to")
+	}
+	if err := os.WriteFile(tb.filepath, []byte(tb.Text()), 0o644); err != nil {
+		return err
+	}
+	tb.saved = true
+	return nil
+}
+
+// SaveAs writes the buffer to path and makes that its file from now on
+func (tb *TextBuffer) SaveAs(path string) error {
+	old_path := tb.filepath
+	tb.SetPath(path)
+	if err := tb.Save(); err != nil {
+		tb.SetPath(old_path)
+		return err
+	}
+	return nil
+}
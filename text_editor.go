@@ -4,7 +4,9 @@ import (
 	"image"
 	"image/color"
 	"log"
+	"regexp"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
@@ -19,58 +21,128 @@ type Cursor struct {
 }
 type TextEditor struct {
 	image.Rectangle
-	text               []string
+	buf                *TextBuffer
+	drawn_version      uint64 //version of buf that text_tex was drawn from
 	text_tex           *ebiten.Image
 	cursor             Cursor
 	scroll             float64
 	last_interact_time uint64 //tick alue of the last time we interacted (used to keep cursor alive while we're editing)
 	ReadOnly           bool   //can we edit this textbox
 	focused            bool   //does this textbox have keyboard focus
-	saved              bool   //is the file saved to disk
 	uptodate           bool
 
 	highlighter *Highlighter
+	peek        *PeekView //another file's code shown inline under a line, nil most of the time
 
-	filepath string
-	filename string
+	completion         *CompletionPopup
+	completion_request *CompletionRequest
+	completions_asked  int //counts requests so answers to old ones can be dropped
+	snippet            *snippet_session
+	hover              *hover_state //the symbol the mouse last rested on
+
+	tests         []TestFunc //the tests in the file, if it's a _test.go file
+	tests_version uint64     //version of buf that tests was found in
+	test_request  *TestRequest
+}
+
+func NewTextEditor(buf *TextBuffer) *TextEditor {
+	if buf == nil {
+		buf = NewTextBuffer("")
+	}
+	return &TextEditor{buf: buf, drawn_version: buf.version}
+}
+
+// OpenTextEditor makes an editor for the file at path, highlighted if we know the language
+func OpenTextEditor(path string) (*TextEditor, error) {
+	buf, err := LoadTextBuffer(path)
+	if err != nil {
+		return nil, err
+	}
+	return BufferEditor(buf), nil
+}
+
+// BufferEditor makes an editor for a file that's already loaded, so views of the same file share their text
+func BufferEditor(buf *TextBuffer) *TextEditor {
+	te := NewTextEditor(buf)
+	te.highlighter = HighlighterFor(buf.filepath)
+	return te
+}
+
+// Describe implements Describable
+func (te *TextEditor) Describe() *WidgetDescriptor {
+	return &WidgetDescriptor{
+		Kind:      "editor",
+		File:      te.buf.filepath,
+		CursorRow: te.cursor.row,
+		CursorCol: te.cursor.col,
+		Scroll:    te.scroll,
+	}
+}
+
+// NewView makes another editor looking at the same buffer, edits in one show up in the other
+func (te *TextEditor) NewView() *TextEditor {
+	view := NewTextEditor(te.buf)
+	view.cursor = te.cursor
+	view.scroll = te.scroll
+	view.highlighter = te.highlighter
+	view.ReadOnly = te.ReadOnly
+	return view
 }
 
 // Title implements Widget
 func (te *TextEditor) Title() string {
-	if te.filepath == "" {
-		return "untitled*"
-	} else {
-		s := te.filename
-		if !te.saved {
-			s += "*"
-		}
-		return s
+	if te.buf.filepath == "" {
+		return "untitled"
 	}
+	return te.buf.filename
+}
+
+// Dirty implements Dirtier
+func (te *TextEditor) Dirty() bool {
+	return !te.buf.saved
+}
+
+// Focus implements Focuser
+func (te *TextEditor) Focus() {
+	te.focused = true
 }
 
 func (te *TextEditor) KeyboardFocusLost() {
 	te.focused = false
+	te.CloseCompletion()
+	if te.peek != nil {
+		te.peek.Blur()
+	}
 }
 
 // Draw implements Widget
 func (te *TextEditor) Draw(target *ebiten.Image) {
 	ebitenutil.DrawRect(target, float64(te.Min.X), float64(te.Min.Y), float64(te.Dx()), float64(te.Dy()), Style.BGColorMuted)
-	if !te.uptodate {
+	if !te.uptodate || te.drawn_version != te.buf.version {
+		te.cursor = te.buf.ClampCursor(te.cursor)
 		te.DrawTextTexture()
 	}
 	//}
+	te.DrawCoverage(target)
+	te.DrawExecutionLine(target)
+	origin := te.text_origin()
 	geo := ebiten.GeoM{}
-	geo.Translate(float64(te.Min.X), float64(te.Min.Y))
+	geo.Translate(float64(origin.X), float64(origin.Y))
 	target.DrawImage(te.text_tex, &ebiten.DrawImageOptions{
 		GeoM:          geo,
 		ColorM:        ebiten.ColorM{},
 		CompositeMode: 0,
 		Filter:        0,
 	})
+	te.DrawBreakpoints(target)
+	te.DrawTests(target)
+	te.DrawDiagnostics(target)
+	te.DrawPeek(target)
 	if te.ReadOnly {
 		return
 	}
 	te.DrawCursor(target)
+	te.DrawSnippet(target)
 	if te.scroll > 0 {
 		//Draw "shadow" from the top
 		y := te.Rectangle.Min.Y
@@ -87,52 +159,57 @@ func (te *TextEditor) DrawCursor(target *ebiten.Image) {
 	if !te.focused {
 		return
 	}
-	y := te.cursor.row * CodeFontSize
-	start := te.Min
-	width := font.MeasureString(CodeFontFace, te.text[te.cursor.row][:te.cursor.col]).Round()
+	if te.peek != nil && te.peek.focused {
+		return
+	}
+	y := te.line_top(te.cursor.row)
+	if y < 0 || y >= te.Dy() {
+		return
+	}
+	start := te.text_origin()
+	width := font.MeasureString(CodeFontFace, te.buf.lines[te.cursor.row][:te.cursor.col]).Round()
 	if ((ticks-te.last_interact_time)/40)%2 == 0 {
 		move_over := 1
 		width += move_over
-		ebitenutil.DrawLine(target, float64(start.X+width), float64(start.Y+y), float64(start.X+width), float64(start.Y+y+CodeFontSize), Style.FGColorMuted)
+		ebitenutil.DrawLine(target, float64(start.X+width), float64(start.Y+y), float64(start.X+width), float64(start.Y+y+CodeLineHeight()), Style.FGColorMuted)
 	}
 }
 
 func (te *TextEditor) DrawTextTexture() {
 
-	needed_dims := text.BoundString(CodeFontFace, strings.Join(te.text, "\n"))
+	needed_dims := text.BoundString(CodeFontFace, strings.Join(te.buf.lines, "\n"))
 	needed_dims.Max.Y += CodeFontPeriodFromTop
 	needed_dims.Max.X = max(needed_dims.Max.X, 1)
-	if te.text_tex == nil || (te.Rectangle.Dx() != te.text_tex.Bounds().Dx() || te.Rectangle.Dy() != te.text_tex.Bounds().Dy()) {
-		te.text_tex = ebiten.NewImage(te.Dx(), te.Dy())
+	width := max(1, te.Dx()-te.gutter_width())
+	if te.text_tex == nil || (width != te.text_tex.Bounds().Dx() || te.Rectangle.Dy() != te.text_tex.Bounds().Dy()) {
+		te.text_tex = ebiten.NewImage(width, te.Dy())
 	}
 	//draw background
 	te.text_tex.Fill(color.RGBA{})
-	if te.highlighter != nil {
+	if te.highlighter != nil || LigaturesOn() {
 		te.DrawWithHighlighting()
 	} else {
-		//log.Println("uncool drawing")
 		//no ability to draw with syntax highlighting
-		text.Draw(te.text_tex, strings.Join(te.text, "\n"), CodeFontFace, 0, text_edit_top_padding+CodeFontPeriodFromTop, Style.FGColorMuted) //@optimmize iterate through text and draw each line individuall. saves time by skipping the join
-
+		//lines under a peek view are pushed down past it, so they're drawn separately
+		first, split := te.first_row(), len(te.buf.lines)
+		if te.peek_showing() {
+			split = te.peek.row + 1
+		}
+		text.Draw(te.text_tex, strings.Join(te.buf.lines[first:split], "\n"), CodeFontFace, 0, text_edit_top_padding+CodeFontPeriodFromTop, Style.FGColorMuted)
+		if split < len(te.buf.lines) {
+			text.Draw(te.text_tex, strings.Join(te.buf.lines[split:], "\n"), CodeFontFace, 0, text_edit_top_padding+CodeFontPeriodFromTop+te.line_top(split), Style.FGColorMuted)
+		}
 	}
 	te.uptodate = true
+	te.drawn_version = te.buf.version
 }
 func (te *TextEditor) DrawWithHighlighting() {
-	colors := map[string]color.Color{
-		"red":         Style.RedMuted,
-		"brightred":   Style.RedStrong,
-		"blue":        Style.BlueMuted,
-		"brightblue":  Style.BlueStrong,
-		"green":       Style.GreenMuted,
-		"brightgreen": Style.GreenStrong,
-		"yellow":      Style.YellowMuted,
-		"cyan":        Style.AquaStrong,
-		"magenta":     Style.PurpleMuted,
-		"brightblack": Style.Gray,
-		"orange":      Style.OrangeMuted,
-	}
-	topleft := image.Pt(0, 0) //top left of the line
-	for _, line := range te.text {
+	for row := te.first_row(); row < len(te.buf.lines); row++ {
+		line := te.buf.lines[row]
+		topleft := image.Pt(0, te.line_top(row)) //top left of the line
+		if topleft.Y >= te.Dy() {
+			break
+		}
 		lineusage := make([]string, len(line))
 		use := func(start, end int, col string) {
 			for i := max(0, start); i < min(len(lineusage), end); i++ {
@@ -148,8 +225,7 @@ func (te *TextEditor) DrawWithHighlighting() {
 			return false
 		}
 		//for each highlighter regex, draw all that it can
-		if te.highlighter.expressions != nil && len(te.highlighter.expressions) > 0 {
-
+		if te.highlighter != nil {
 			for i := len(te.highlighter.expressions) - 1; i >= 0; i-- {
 				exp := te.highlighter.expressions[i]
 
@@ -158,77 +234,169 @@ func (te *TextEditor) DrawWithHighlighting() {
 					start := startnend[0]
 					end := startnend[len(startnend)-1]
 					if !already_used(start, end) {
-						use(start, end, exp.fg_col)
+						use(start, end, exp.scope)
 					}
 
 				}
 			}
-			rs := []rune(line)
-
-			for i, r := range rs {
-				fg_col, col_exists := colors[lineusage[i]]
-				if !col_exists {
-					fg_col = Style.FGColorMuted
-				}
+		}
+		//the theme says how each scope looks, anything unhighlighted is plain text
+		style_at := func(i int) ScopeStyle {
+			style, has_style := Style.Scopes[lineusage[i]]
+			if !has_style || style.Color == nil {
+				style.Color = Style.FGColorMuted
+			}
+			return style
+		}
+		baseline := text_edit_top_padding + CodeFontPeriodFromTop + topleft.Y
+
+		//ligatures replace the characters they cover, but every character keeps its own cell
+		ligated := make([]bool, len(line))
+		for _, glyph := range SubstitutedGlyphs(line) {
+			end := glyph.Offset
+			for n := 0; n < glyph.Runes && end < len(line); n++ {
+				_, size := utf8.DecodeRuneInString(line[end:])
+				end += size
+			}
+			for i := glyph.Offset; i < end; i++ {
+				ligated[i] = true
+			}
+			advance := font.MeasureString(CodeFontFace, line[:glyph.Offset]).Round()
+			DrawShapedGlyph(te.text_tex, glyph.GID, topleft.X+advance+glyph.X, baseline, style_at(glyph.Offset).Color)
+		}
 
-				advance := font.MeasureString(CodeFontFace, string(rs[:i])).Round()
-				text.Draw(te.text_tex, string(r), CodeFontFace, topleft.X+advance, text_edit_top_padding+CodeFontPeriodFromTop+topleft.Y, fg_col)
+		for i, r := range line {
+			style := style_at(i)
+			advance := font.MeasureString(CodeFontFace, line[:i]).Round()
+			if !ligated[i] {
+				text.Draw(te.text_tex, string(r), CodeFaceFor(style), topleft.X+advance, baseline, style.Color)
+			}
+			if style.Underline {
+				width := font.MeasureString(CodeFontFace, string(r)).Round()
+				ebitenutil.DrawLine(te.text_tex, float64(topleft.X+advance), float64(baseline+2), float64(topleft.X+advance+width), float64(baseline+2), style.Color)
 			}
 		}
-		topleft.Y += CodeFontSize
 	}
 }
 
+// logical pixels left of the text for diagnostics' icons
+const editor_gutter = 14
+
+func (te *TextEditor) gutter_width() int {
+	return Px(editor_gutter)
+}
+
+// text_origin is the screen point the text texture starts at, right of the gutter
+func (te *TextEditor) text_origin() image.Point {
+	return te.Min.Add(image.Pt(te.gutter_width(), 0))
+}
+
+/*
+Scrolling, scroll is the first line showing
+*/
+
+func (te *TextEditor) first_row() int {
+	return max(0, min(int(te.scroll), len(te.buf.lines)-1))
+}
+
+// line_top is how far below the top of the editor row starts, negative if it's scrolled off
+func (te *TextEditor) line_top(row int) int {
+	y := (row - te.first_row()) * CodeLineHeight()
+	if te.peek_showing() && row > te.peek.row {
+		y += te.peek.height()
+	}
+	return y
+}
+
+// row_at is the line at screen height y, the peek view's line if y is in the peek view
+func (te *TextEditor) row_at(y int) int {
+	y -= te.Min.Y
+	if te.peek_showing() {
+		peek_top := te.line_top(te.peek.row) + CodeLineHeight()
+		if y >= peek_top+te.peek.height() {
+			y -= te.peek.height()
+		} else if y >= peek_top {
+			return te.peek.row
+		}
+	}
+	if y < 0 {
+		return te.first_row() - 1
+	}
+	return te.first_row() + y/CodeLineHeight()
+}
+
+// ScrollTo makes row the first line showing
+func (te *TextEditor) ScrollTo(row int) {
+	row = max(0, min(row, len(te.buf.lines)-1))
+	if row != te.first_row() {
+		te.scroll = float64(row)
+		te.MarkRedraw()
+	}
+}
+
+// ScrollToCursor scrolls just far enough that the cursor is showing
+func (te *TextEditor) ScrollToCursor() {
+	showing := max(1, te.Dy()/CodeLineHeight())
+	if te.peek_showing() && te.cursor.row > te.peek.row {
+		showing = max(1, showing-te.peek.height()/CodeLineHeight())
+	}
+	first := te.first_row()
+	if te.cursor.row < first {
+		te.ScrollTo(te.cursor.row)
+	} else if te.cursor.row >= first+showing {
+		te.ScrollTo(te.cursor.row - showing + 1)
+	}
+}
+
+// SetHighlighter changes how the text is coloured, nil for plain text
+func (te *TextEditor) SetHighlighter(hl *Highlighter) {
+	te.highlighter = hl
+	te.MarkRedraw()
+}
+
 func (te *TextEditor) MarkRedraw() {
 	te.uptodate = false
 }
+
+// Changed marks the buffer as edited so every view of it redraws
+func (te *TextEditor) Changed() {
+	te.buf.Changed()
+	te.MarkRedraw()
+}
 func (te *TextEditor) EnterText(s string) {
+	te.type_over_placeholder()
 	te.Interacted()
-	before := te.text[te.cursor.row][:te.cursor.col]
-	after := te.text[te.cursor.row][te.cursor.col:]
-	te.text[te.cursor.row] = before + s + after
-	te.cursor.col += len(s)
+	te.cursor = te.buf.Replace(te.cursor, te.cursor, s)
 	te.MarkRedraw()
+	if strings.HasSuffix(s, ".") {
+		te.request_completion(CompletionRequest{Trigger: "."})
+	}
 }
 
 func (te *TextEditor) Backspace() {
+	if te.type_over_placeholder() {
+		te.Interacted()
+		te.MarkRedraw()
+		return
+	}
 	te.Interacted()
 
 	//already at top left, can't do anything
 	if te.cursor.col == 0 && te.cursor.row == 0 {
 		return
 	}
+	from := Cursor{row: te.cursor.row, col: te.cursor.col}
 	if te.cursor.col == 0 {
-		var prev_line_len = 0
-
 		//combine this line with previous
-		this_line := te.text[te.cursor.row]
-		up_to := te.text[0:te.cursor.row]
-		after := []string{}
-		if te.cursor.row+1 < len(te.text) {
-			after = te.text[te.cursor.row+1:]
-		}
-		te.text = append(up_to, after...)
-		te.text[te.cursor.row-1] += this_line
-		te.cursor.row--
-		te.cursor.col = prev_line_len
-		te.MarkRedraw()
-		return
+		from = Cursor{row: te.cursor.row - 1, col: len(te.buf.lines[te.cursor.row-1])}
+	} else {
+		//make sure we're not out in left field
+		from.col = min(len(te.buf.lines[te.cursor.row]), from.col)
+		_, size := utf8.DecodeLastRuneInString(te.buf.lines[te.cursor.row][:from.col])
+		from.col -= size
 	}
-	//just change this line
-	//make sure we're not out in left field
-	te.cursor.col = min(len(te.text[te.cursor.row]), te.cursor.col)
-	line := te.text[te.cursor.row]
-	before := line[:te.cursor.col-1]
-	after := ""
-	if te.cursor.col < len(line) {
-		after = line[te.cursor.col:]
-	}
-	line = before + after
-	te.text[te.cursor.row] = line
-	te.cursor.col--
+	te.cursor = te.buf.Replace(from, te.cursor, "")
 	te.MarkRedraw()
-	te.Interacted()
 }
 func (te *TextEditor) CursorLeft() {
 	te.Interacted()
@@ -236,7 +404,7 @@ func (te *TextEditor) CursorLeft() {
 		return
 	}
 	if te.cursor.col == 0 {
-		prev_line_end := len(te.text[te.cursor.row-1])
+		prev_line_end := len(te.buf.lines[te.cursor.row-1])
 		te.cursor.row--
 		te.cursor.col = prev_line_end
 		return
@@ -246,9 +414,9 @@ func (te *TextEditor) CursorLeft() {
 func (te *TextEditor) CursorRight() {
 	te.Interacted()
 	//if at the end of a line
-	if te.cursor.col > len(te.text[te.cursor.row])-1 {
+	if te.cursor.col > len(te.buf.lines[te.cursor.row])-1 {
 		//if at the end of the file, cant go to the next line
-		if te.cursor.row >= len(te.text)-1 {
+		if te.cursor.row >= len(te.buf.lines)-1 {
 			return
 		}
 		te.cursor.row++
@@ -256,7 +424,7 @@ func (te *TextEditor) CursorRight() {
 		return
 	}
 	//just go right
-	if te.cursor.col < len(te.text[te.cursor.row]) {
+	if te.cursor.col < len(te.buf.lines[te.cursor.row]) {
 		te.cursor.col++
 	}
 
@@ -265,12 +433,12 @@ func (te *TextEditor) CursorDown() {
 	te.Interacted()
 
 	//already at the bottom of the file
-	if te.cursor.row >= len(te.text)-1 {
-		te.cursor.col = len(te.text[te.cursor.row])
+	if te.cursor.row >= len(te.buf.lines)-1 {
+		te.cursor.col = len(te.buf.lines[te.cursor.row])
 		return
 	}
 	te.cursor.row++
-	te.cursor.col = min(te.cursor.col, len(te.text[te.cursor.row]))
+	te.cursor.col = min(te.cursor.col, len(te.buf.lines[te.cursor.row]))
 
 }
 func (te *TextEditor) CursorUp() {
@@ -281,45 +449,38 @@ func (te *TextEditor) CursorUp() {
 		return
 	}
 	te.cursor.row--
-	te.cursor.col = min(te.cursor.col, len(te.text[te.cursor.row]))
+	te.cursor.col = min(te.cursor.col, len(te.buf.lines[te.cursor.row]))
 }
 func (te *TextEditor) Newline() {
+	te.InsertText("\n")
+}
+
+// InsertText puts s at the cursor, s can be several lines
+func (te *TextEditor) InsertText(s string) {
 	te.Interacted()
+	te.cursor = te.buf.Replace(te.cursor, te.cursor, s)
 	te.MarkRedraw()
-
-	line := te.text[te.cursor.row]
-	line_before := line[:te.cursor.col]
-	line_after := line[te.cursor.col:]
-
-	lines_before := te.text[:te.cursor.row] //up to line with cursor
-	lines_after := []string{}
-	if te.cursor.row+1 < len(te.text) {
-		lines_after = te.text[te.cursor.row+1:] //the rest starting at the line after where the cursor is
-	}
-	newtext := make([]string, len(lines_before), len(te.text)+1)
-	copy(newtext, lines_before)
-	newtext = append(newtext, line_before, line_after)
-	newtext = append(newtext, lines_after...)
-	te.text = newtext
-	te.cursor.row++
-	te.cursor.col = 0
 }
+
 func (te *TextEditor) SetText(s string) {
-	te.text = strings.Split(s, "\n")
+	te.buf.SetText(s)
+	te.MarkRedraw()
 }
 
 func (te *TextEditor) HandleShortcuts() {
 	local_shortcuts := map[KeyShortcut]func(){
-		{key: ebiten.KeyEnd}:               te.EndLine,
-		{key: ebiten.KeyHome}:              te.StartLine,
-		{key: ebiten.KeyBackspace}:         te.Backspace,
-		{key: ebiten.KeyTab}:               te.Tab,
-		{key: ebiten.KeyEnter}:             te.Newline,
-		{key: ebiten.KeyLeft}:              te.CursorLeft,
-		{key: ebiten.KeyRight}:             te.CursorRight,
-		{key: ebiten.KeyUp}:                te.CursorUp,
-		{key: ebiten.KeyDown}:              te.CursorDown,
-		{mod_ctrl: true, key: ebiten.KeyA}: te.SelectAll,
+		{key: ebiten.KeyEnd}:                   te.EndLine,
+		{key: ebiten.KeyHome}:                  te.StartLine,
+		{key: ebiten.KeyBackspace}:             te.Backspace,
+		{key: ebiten.KeyTab}:                   te.Tab,
+		{key: ebiten.KeyEnter}:                 te.Newline,
+		{key: ebiten.KeyLeft}:                  te.CursorLeft,
+		{key: ebiten.KeyRight}:                 te.CursorRight,
+		{key: ebiten.KeyUp}:                    te.CursorUp,
+		{key: ebiten.KeyDown}:                  te.CursorDown,
+		{key: ebiten.KeyEscape}:                te.Escape,
+		{mod_ctrl: true, key: ebiten.KeyA}:     te.SelectAll,
+		{mod_ctrl: true, key: ebiten.KeySpace}: te.RequestCompletion,
 	}
 	ctrl_state := ebiten.IsKeyPressed(ebiten.KeyControl)
 	shift_state := ebiten.IsKeyPressed(ebiten.KeyShift)
@@ -342,6 +503,17 @@ func (te *TextEditor) HandleShortcuts() {
 	}
 }
 func (te *TextEditor) TakeKeyboard() {
+	if te.PeekKeyboard() {
+		return
+	}
+	te.cursor = te.buf.ClampCursor(te.cursor)
+	defer func() {
+		te.update_completion()
+		te.ScrollToCursor()
+	}()
+	if te.CompletionKeys() {
+		return
+	}
 	te.HandleShortcuts()
 
 	if te.ReadOnly {
@@ -362,8 +534,15 @@ func (te *TextEditor) Interacted() {
 	te.last_interact_time = ticks
 }
 
+// LMouseDown implements Widget, puts the cursor where was clicked
 func (te *TextEditor) LMouseDown(x int, y int) Widget {
 	te.focused = true
+	te.CloseCompletion()
+	if te.PeekClick(x, y) || te.test_click(x, y) || te.breakpoint_click(x, y) {
+		return te
+	}
+	te.cursor = te.CursorAt(x, y)
+	te.Interacted()
 	return te
 }
 
@@ -372,11 +551,64 @@ func (te *TextEditor) LMouseUp(x int, y int) Widget {
 	return te
 }
 
+// RMouseDown implements Widget, moves the cursor to where was clicked so the context menu acts there
+func (te *TextEditor) RMouseDown(x int, y int) Widget {
+	te.cursor = te.CursorAt(x, y)
+	te.Interacted()
+	return te
+}
+
+// RMouseUp implements Widget
+func (te *TextEditor) RMouseUp(x int, y int) Widget {
+	return te
+}
+
+// MMouseDown implements Widget
+func (te *TextEditor) MMouseDown(x int, y int) Widget {
+	return te
+}
+
+// MMouseUp implements Widget
+func (te *TextEditor) MMouseUp(x int, y int) Widget {
+	return te
+}
+
+// CursorAt is the cursor position closest to the screen point (x, y)
+func (te *TextEditor) CursorAt(x, y int) Cursor {
+	c := te.buf.ClampCursor(Cursor{row: te.row_at(y)})
+	line := te.buf.lines[c.row]
+	x -= te.text_origin().X
+	best := -1
+	for i := 0; i <= len(line); i++ {
+		if i < len(line) && !utf8.RuneStart(line[i]) {
+			continue
+		}
+		dist := font.MeasureString(CodeFontFace, line[:i]).Round() - x
+		if dist < 0 {
+			dist = -dist
+		}
+		if best < 0 || dist < best {
+			best = dist
+			c.col = i
+		}
+	}
+	return c
+}
+
 func (*TextEditor) MouseOut() {
 }
 
 func (te *TextEditor) MouseOver(x int, y int) Widget {
+	if te.peek_showing() && image.Pt(x, y).In(te.peek_rect()) {
+		return te.peek.editor.MouseOver(x, y)
+	}
 	ebiten.SetCursorShape(ebiten.CursorShapeText)
+	if _, dy := ebiten.Wheel(); dy != 0 {
+		te.ScrollTo(te.first_row() - int(dy*3))
+	}
+	if MouseRested() {
+		te.hover_tooltip(x, y)
+	}
 	return te
 }
 
@@ -390,18 +622,122 @@ func (te *TextEditor) SetRect(rect image.Rectangle) {
 Shortcut functions
 Press the key combo and do these common actions
 */
+// how many spaces Tab inserts
+var tab_width = 4
+
+// Tab goes to the next tab stop of a snippet being filled in, or indents
 func (te *TextEditor) Tab() {
-	te.EnterText("    ")
+	if te.snippet != nil {
+		te.NextSnippetStop()
+		return
+	}
+	te.EnterText(strings.Repeat(" ", tab_width))
+}
+
+// Escape closes the completion popup and stops tabbing through a snippet
+func (te *TextEditor) Escape() {
+	te.CloseCompletion()
+	te.EndSnippet()
 }
 func (te *TextEditor) SelectAll() {
 	log.Println("Selectall unimplemented")
 	te.Interacted()
 }
 func (te *TextEditor) EndLine() {
-	te.cursor.col = len(te.text[te.cursor.row])
+	te.cursor.col = len(te.buf.lines[te.cursor.row])
 	te.Interacted()
 }
 func (te *TextEditor) StartLine() {
 	te.cursor.col = 0
 	te.Interacted()
 }
+
+// There's no selection yet, so copy and cut take the whole line the cursor is on
+func (te *TextEditor) Copy() {
+	ClipboardWrite(te.buf.lines[te.cursor.row] + "\n")
+	te.Interacted()
+}
+func (te *TextEditor) Cut() {
+	if te.ReadOnly {
+		return
+	}
+	te.Copy()
+	row := te.cursor.row
+	switch {
+	case len(te.buf.lines) == 1:
+		te.buf.Replace(Cursor{}, te.buf.End(), "")
+	case row == len(te.buf.lines)-1:
+		//the last line has no newline of its own, take the one before it
+		te.buf.Replace(Cursor{row: row - 1, col: len(te.buf.lines[row-1])}, te.buf.End(), "")
+	default:
+		te.buf.Replace(Cursor{row: row}, Cursor{row: row + 1}, "")
+	}
+	te.cursor = te.buf.ClampCursor(Cursor{row: row})
+	te.MarkRedraw()
+}
+func (te *TextEditor) Paste() {
+	if te.ReadOnly {
+		return
+	}
+	if s := ClipboardRead(); s != "" {
+		te.InsertText(strings.ReplaceAll(s, "\r\n", "\n"))
+	}
+}
+
+// WordAt is the identifier the cursor c is in or just after, "" if there isn't one
+func (te *TextEditor) WordAt(c Cursor) string {
+	c = te.buf.ClampCursor(c)
+	line := te.buf.lines[c.row]
+	start, end := te.WordStart(c).col, c.col
+	for end < len(line) && is_word_byte(line[end]) {
+		end++
+	}
+	return line[start:end]
+}
+
+// WordStart is the start of the identifier c is in or just after, c itself if there isn't one
+func (te *TextEditor) WordStart(c Cursor) Cursor {
+	c = te.buf.ClampCursor(c)
+	line := te.buf.lines[c.row]
+	for c.col > 0 && is_word_byte(line[c.col-1]) {
+		c.col--
+	}
+	return c
+}
+
+// is_word_byte is whether b can be part of an identifier, anything outside ASCII counts so names in other scripts work
+func is_word_byte(b byte) bool {
+	return b == '_' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9' || b >= 0x80
+}
+
+// GoToDefinition jumps to where the word under the cursor is declared in this file
+// it only knows declarations that start a line, like func, type, var and const
+func (te *TextEditor) GoToDefinition() {
+	if c, ok := te.FindDeclaration(te.WordAt(te.cursor)); ok {
+		te.JumpCursor(c)
+	}
+}
+
+// FindDeclaration is where word is declared in this file, the guess GoToDefinition makes without a language server
+func (te *TextEditor) FindDeclaration(word string) (Cursor, bool) {
+	if word == "" {
+		return Cursor{}, false
+	}
+	decl := regexp.MustCompile(`^\s*(func|type|var|const|def|class|fn|struct|let)\s+(\([^)]*\)\s*)?` + regexp.QuoteMeta(word) + `\b`)
+	for row, line := range te.buf.lines {
+		if loc := decl.FindStringIndex(line); loc != nil {
+			return Cursor{row: row, col: loc[1] - len(word)}, true
+		}
+	}
+	return Cursor{}, false
+}
+
+// JumpCursor moves the cursor to c, scrolling it a third of the way down if it was off screen
+func (te *TextEditor) JumpCursor(c Cursor) {
+	te.cursor = te.buf.ClampCursor(c)
+	te.Interacted()
+	first, showing := te.first_row(), max(1, te.Dy()/CodeLineHeight())
+	if te.cursor.row < first || te.cursor.row >= first+showing {
+		te.ScrollTo(te.cursor.row - showing/3)
+	}
+}
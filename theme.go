@@ -0,0 +1,441 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/color"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Themes are JSON files of colours
+//
+//	{
+//		"name": "Gruvbox Dark",
+//		"base": "some-other-theme",     anything not given here comes from this one, gruvbox dark if there's no base
+//		"colors": {"bg_strong": "#1D2019", ...},
+//		"scopes": {"keyword": "#FB4934", "comment": {"color": "#928374", "italic": true}, ...}
+//	}
+//
+// colors are the UI palette, scopes are what syntax highlighting draws each kind of token in
+// a scope is either just a colour or an object that can also make it bold, italic or underlined
+// the built in themes live in Themes/, files in ThemeDir() show up alongside them and win if they have the same id
+// .tmTheme files from TextMate or VS Code can go in ThemeDir() too
+
+//go:embed Themes/*.json
+var builtin_themes embed.FS
+
+const default_theme = "gruvbox-dark"
+
+// the scopes syntax highlighting knows about
+var SyntaxScopes = []string{"keyword", "type", "string", "comment", "number", "function", "operator"}
+
+// Theme is a loaded colour scheme
+type Theme struct {
+	ID     string //file name without the extension, what the session remembers
+	Name   string
+	Path   string //file on disk it came from, "" for built in themes
+	Colors StyleColors
+}
+
+type theme_file struct {
+	Name   string                     `json:"name"`
+	Base   string                     `json:"base"`
+	Colors map[string]string          `json:"colors"`
+	Scopes map[string]json.RawMessage `json:"scopes"`
+}
+
+// ScopeStyle is how syntax highlighting draws one scope
+// bold and italic only show if the code font has those styles, see CodeFaceFor
+type ScopeStyle struct {
+	Color     color.Color
+	Bold      bool
+	Italic    bool
+	Underline bool
+}
+
+type scope_file struct {
+	Color     *string `json:"color"`
+	Bold      *bool   `json:"bold"`
+	Italic    *bool   `json:"italic"`
+	Underline *bool   `json:"underline"`
+}
+
+// parse_scope reads a scope from a theme file, anything it doesn't set stays as it is in base
+func parse_scope(raw json.RawMessage, base ScopeStyle) (ScopeStyle, error) {
+	var sf scope_file
+	var just_color string
+	if err := json.Unmarshal(raw, &just_color); err == nil {
+		sf.Color = &just_color
+	} else if err := json.Unmarshal(raw, &sf); err != nil {
+		return base, errors.New("should be a colour or {\"color\", \"bold\", \"italic\", \"underline\"}")
+	}
+	if sf.Color != nil {
+		c, err := ParseThemeColor(*sf.Color)
+		if err != nil {
+			return base, err
+		}
+		base.Color = c
+	}
+	if sf.Bold != nil {
+		base.Bold = *sf.Bold
+	}
+	if sf.Italic != nil {
+		base.Italic = *sf.Italic
+	}
+	if sf.Underline != nil {
+		base.Underline = *sf.Underline
+	}
+	return base, nil
+}
+
+// the theme being used, Style holds its colours
+var current_theme *Theme
+
+// theme_colors maps the names used in theme files to the palette entries they set
+func theme_colors(s *StyleColors) map[string]*color.Color {
+	return map[string]*color.Color{
+		"bg_strong":     &s.BGColorStrong,
+		"fg_strong":     &s.FGColorStrong,
+		"bg_muted":      &s.BGColorMuted,
+		"fg_muted":      &s.FGColorMuted,
+		"red_strong":    &s.RedStrong,
+		"red_muted":     &s.RedMuted,
+		"green_strong":  &s.GreenStrong,
+		"green_muted":   &s.GreenMuted,
+		"yellow_strong": &s.YellowStrong,
+		"yellow_muted":  &s.YellowMuted,
+		"blue_strong":   &s.BlueStrong,
+		"blue_muted":    &s.BlueMuted,
+		"purple_strong": &s.PurpleStrong,
+		"purple_muted":  &s.PurpleMuted,
+		"aqua_strong":   &s.AquaStrong,
+		"aqua_muted":    &s.AquaMuted,
+		"orange_strong": &s.OrangeStrong,
+		"orange_muted":  &s.OrangeMuted,
+		"white":         &s.White,
+		"gray":          &s.Gray,
+	}
+}
+
+// ParseThemeColor reads #RGB, #RRGGBB or #RRGGBBAA
+func ParseThemeColor(s string) (color.RGBA, error) {
+	hex := strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	if len(hex) != 8 || !strings.HasPrefix(strings.TrimSpace(s), "#") {
+		return color.RGBA{}, fmt.Errorf("%q isn't a #RRGGBB colour", s)
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("%q isn't a #RRGGBB colour", s)
+	}
+	c := color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}
+	//ebiten wants premultiplied alpha
+	return color.RGBAModel.Convert(c).(color.RGBA), nil
+}
+
+// copy_style copies s so changing the copy's scopes doesn't change s
+func copy_style(s StyleColors) StyleColors {
+	scopes := make(map[string]ScopeStyle, len(s.Scopes))
+	for k, v := range s.Scopes {
+		scopes[k] = v
+	}
+	s.Scopes = scopes
+	return s
+}
+
+// ParseTheme reads a theme file, starting from base for anything it doesn't set
+func ParseTheme(bs []byte, base StyleColors) (name string, colors StyleColors, err error) {
+	var tf theme_file
+	if err := json.Unmarshal(bs, &tf); err != nil {
+		return "", colors, err
+	}
+	colors = copy_style(base)
+	fields := theme_colors(&colors)
+	for key, value := range tf.Colors {
+		field, ok := fields[key]
+		if !ok {
+			return "", colors, fmt.Errorf("unknown colour %q", key)
+		}
+		c, err := ParseThemeColor(value)
+		if err != nil {
+			return "", colors, fmt.Errorf("colour %s: %w", key, err)
+		}
+		*field = c
+	}
+	for scope, value := range tf.Scopes {
+		style, err := parse_scope(value, colors.Scopes[scope])
+		if err != nil {
+			return "", colors, fmt.Errorf("scope %s: %w", scope, err)
+		}
+		colors.Scopes[scope] = style
+	}
+	return tf.Name, colors, nil
+}
+
+// ThemeDir is where the user's own themes go
+func ThemeDir() string {
+	return filepath.Join(ConfigDir(), "themes")
+}
+
+// ThemeInfo is a theme that can be picked, without loading it
+type ThemeInfo struct {
+	ID   string
+	Name string
+	Path string //"" for built in themes
+}
+
+// AvailableThemes lists the built in themes and the ones in ThemeDir, sorted by name
+func AvailableThemes() []ThemeInfo {
+	by_id := map[string]ThemeInfo{}
+	builtins, _ := fs.Glob(builtin_themes, "Themes/*.json")
+	for _, path := range builtins {
+		id := strings.TrimSuffix(filepath.Base(path), ".json")
+		by_id[id] = ThemeInfo{ID: id, Name: theme_name(builtin_themes, path, id)}
+	}
+	entries, _ := os.ReadDir(ThemeDir())
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		if e.IsDir() || (ext != ".json" && ext != ".tmTheme") {
+			continue
+		}
+		id := strings.TrimSuffix(e.Name(), ext)
+		path := filepath.Join(ThemeDir(), e.Name())
+		name := id
+		if ext == ".json" {
+			name = theme_name(os.DirFS(ThemeDir()), e.Name(), id)
+		}
+		by_id[id] = ThemeInfo{ID: id, Name: name, Path: path}
+	}
+	themes := make([]ThemeInfo, 0, len(by_id))
+	for _, info := range by_id {
+		themes = append(themes, info)
+	}
+	sort.Slice(themes, func(i, j int) bool { return themes[i].Name < themes[j].Name })
+	return themes
+}
+
+// theme_name is the name a theme file gives itself, fallback if it can't be read
+func theme_name(fsys fs.FS, path, fallback string) string {
+	bs, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		return fallback
+	}
+	var tf theme_file
+	if json.Unmarshal(bs, &tf) != nil || tf.Name == "" {
+		return fallback
+	}
+	return tf.Name
+}
+
+var ErrNoSuchTheme = errors.New("no theme with that id")
+
+// LoadTheme loads the theme called id, a user theme if there is one, otherwise a built in one
+func LoadTheme(id string) (*Theme, error) {
+	return load_theme(id, 0)
+}
+
+// bases can have bases of their own, but not forever
+const max_theme_bases = 8
+
+func load_theme(id string, depth int) (*Theme, error) {
+	if depth > max_theme_bases {
+		return nil, fmt.Errorf("theme %s: too many bases, is one its own base?", id)
+	}
+	t := &Theme{ID: id}
+	var bs []byte
+	user_path := filepath.Join(ThemeDir(), id)
+	if _, err := os.Stat(user_path + ".tmTheme"); err == nil {
+		return ImportTmTheme(user_path + ".tmTheme")
+	}
+	if b, err := os.ReadFile(user_path + ".json"); err == nil {
+		bs = b
+		t.Path = user_path + ".json"
+	} else if b, err := builtin_themes.ReadFile("Themes/" + id + ".json"); err == nil {
+		bs = b
+	} else {
+		return nil, fmt.Errorf("%w: %s", ErrNoSuchTheme, id)
+	}
+
+	var tf theme_file
+	if err := json.Unmarshal(bs, &tf); err != nil {
+		return nil, fmt.Errorf("theme %s: %w", id, err)
+	}
+	base := StyleColors{Scopes: map[string]ScopeStyle{}}
+	if tf.Base == "" && id != default_theme {
+		tf.Base = default_theme
+	} else if tf.Base == "" && t.Path != "" {
+		//a customized copy of the default theme, anything it leaves out comes from the built in one
+		bs, err := builtin_themes.ReadFile("Themes/" + default_theme + ".json")
+		check(err)
+		_, base, err = ParseTheme(bs, base)
+		check(err)
+	}
+	if tf.Base != "" {
+		base_theme, err := load_theme(tf.Base, depth+1)
+		if err != nil {
+			return nil, fmt.Errorf("theme %s: %w", id, err)
+		}
+		base = base_theme.Colors
+	}
+	name, colors, err := ParseTheme(bs, base)
+	if err != nil {
+		return nil, fmt.Errorf("theme %s: %w", id, err)
+	}
+	t.Name = name
+	if t.Name == "" {
+		t.Name = id
+	}
+	t.Colors = colors
+	return t, nil
+}
+
+// UseTheme makes t the theme everything is drawn with
+func UseTheme(t *Theme) {
+	current_theme = t
+	Style = copy_style(t.Colors)
+	theme_checked_at = time.Now()
+}
+
+// CurrentThemeID is the theme in use, what the theme setting is
+func CurrentThemeID() string {
+	if current_theme == nil {
+		return default_theme
+	}
+	return current_theme.ID
+}
+
+// SetTheme switches to the theme called id and remembers it in the settings
+// switching to the theme we're already using reloads it
+func (g *Editor) SetTheme(id string) {
+	if id == CurrentThemeID() {
+		g.ReloadTheme()
+		return
+	}
+	ChangeSetting("theme", id)
+}
+
+// ReloadTheme rereads the current theme and redraws everything with it
+func (g *Editor) ReloadTheme() {
+	t, err := LoadTheme(CurrentThemeID())
+	if err != nil {
+		log.Println("couldn't load theme:", err)
+		return
+	}
+	UseTheme(t)
+	g.Restyle()
+}
+
+// Restyle redraws the widgets that keep drawings made with the old colours
+func (g *Editor) Restyle() {
+	Walk(g.MainWidget, func(w Widget) {
+		if te, ok := w.(*TextEditor); ok {
+			te.MarkRedraw()
+		}
+	})
+}
+
+// CustomizeTheme copies the current theme into ThemeDir, if it isn't there already, and opens it
+// saving it reloads the theme
+func (g *Editor) CustomizeTheme() {
+	if current_theme == nil {
+		return
+	}
+	path := current_theme.Path
+	if path == "" {
+		bs, err := builtin_themes.ReadFile("Themes/" + current_theme.ID + ".json")
+		if err != nil {
+			log.Println("couldn't copy theme:", err)
+			return
+		}
+		path = filepath.Join(ThemeDir(), current_theme.ID+".json")
+		if err := os.MkdirAll(ThemeDir(), 0o755); err != nil {
+			log.Println("couldn't copy theme:", err)
+			return
+		}
+		if err := os.WriteFile(path, bs, 0o644); err != nil {
+			log.Println("couldn't copy theme:", err)
+			return
+		}
+		g.SetTheme(current_theme.ID)
+	}
+	if err := g.OpenFile(path); err != nil {
+		log.Println("couldn't open theme:", err)
+	}
+}
+
+// ImportThemeDialog copies a .tmTheme file the user picks into ThemeDir and switches to it
+func (g *Editor) ImportThemeDialog() {
+	PickFile("Import .tmTheme", false, g.ImportTheme)
+}
+
+// ImportTheme copies the .tmTheme file at path into ThemeDir and switches to it
+func (g *Editor) ImportTheme(path string) {
+	if _, err := ImportTmTheme(path); err != nil {
+		log.Println("couldn't import theme:", err)
+		return
+	}
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		log.Println("couldn't import theme:", err)
+		return
+	}
+	id := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if err := os.MkdirAll(ThemeDir(), 0o755); err != nil {
+		log.Println("couldn't import theme:", err)
+		return
+	}
+	if err := os.WriteFile(filepath.Join(ThemeDir(), id+".tmTheme"), bs, 0o644); err != nil {
+		log.Println("couldn't import theme:", err)
+		return
+	}
+	g.SetTheme(id)
+}
+
+/*
+Hot reloading, the current theme's file gets checked every so often and reloaded if it's changed
+*/
+
+const theme_check_interval = time.Second
+
+var theme_checked_at time.Time
+
+// ReloadThemeIfChanged reloads the current theme if its file has been written since it was loaded
+func (g *Editor) ReloadThemeIfChanged() {
+	if current_theme == nil || current_theme.Path == "" || time.Since(theme_checked_at) < theme_check_interval {
+		return
+	}
+	last_check := theme_checked_at
+	theme_checked_at = time.Now()
+	info, err := os.Stat(current_theme.Path)
+	if err != nil || !info.ModTime().After(last_check) {
+		return
+	}
+	t, err := LoadTheme(current_theme.ID)
+	if err != nil {
+		//probably saved halfway through an edit, keep what we've got
+		log.Println("couldn't reload theme:", err)
+		return
+	}
+	UseTheme(t)
+	g.Restyle()
+}
+
+func init() {
+	t, err := LoadTheme(default_theme)
+	check(err)
+	UseTheme(t)
+}
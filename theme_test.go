@@ -0,0 +1,325 @@
+package main
+
+import (
+	"errors"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func rgb(r, g, b uint8) color.RGBA {
+	return color.RGBA{r, g, b, 0xff}
+}
+
+func TestParseThemeColor(t *testing.T) {
+	tests := []struct {
+		in   string
+		want color.RGBA
+		ok   bool
+	}{
+		{"#102030", rgb(0x10, 0x20, 0x30), true},
+		{" #abc ", rgb(0xaa, 0xbb, 0xcc), true},
+		{"#FFFFFF80", color.RGBA{0x80, 0x80, 0x80, 0x80}, true}, //premultiplied
+		{"102030", color.RGBA{}, false},
+		{"#12345", color.RGBA{}, false},
+		{"#gggggg", color.RGBA{}, false},
+	}
+	for _, test := range tests {
+		got, err := ParseThemeColor(test.in)
+		if (err == nil) != test.ok || got != test.want {
+			t.Errorf("%q: got %v, %v, want %v ok %v", test.in, got, err, test.want, test.ok)
+		}
+	}
+}
+
+func TestParseTheme(t *testing.T) {
+	base := StyleColors{
+		BGColorStrong: rgb(1, 1, 1),
+		FGColorStrong: rgb(2, 2, 2),
+		Scopes: map[string]ScopeStyle{
+			"keyword": {Color: rgb(3, 3, 3), Bold: true},
+			"comment": {Color: rgb(4, 4, 4), Italic: true},
+		},
+	}
+	tests := []struct {
+		name   string
+		json   string
+		check  func(StyleColors) bool
+		errors bool
+	}{
+		{"colour", `{"colors": {"bg_strong": "#0A0B0C"}}`, func(s StyleColors) bool {
+			return s.BGColorStrong == rgb(10, 11, 12) && s.FGColorStrong == rgb(2, 2, 2)
+		}, false},
+		{"scope as a colour keeps the rest", `{"scopes": {"keyword": "#050505"}}`, func(s StyleColors) bool {
+			return s.Scopes["keyword"] == ScopeStyle{Color: rgb(5, 5, 5), Bold: true}
+		}, false},
+		{"scope as an object", `{"scopes": {"comment": {"italic": false, "underline": true}}}`, func(s StyleColors) bool {
+			return s.Scopes["comment"] == ScopeStyle{Color: rgb(4, 4, 4), Underline: true}
+		}, false},
+		{"new scope", `{"scopes": {"number": {"color": "#060606", "bold": true}}}`, func(s StyleColors) bool {
+			return s.Scopes["number"] == ScopeStyle{Color: rgb(6, 6, 6), Bold: true} && len(s.Scopes) == 3
+		}, false},
+		{"unknown colour", `{"colors": {"mauve": "#000000"}}`, nil, true},
+		{"bad colour", `{"colors": {"bg_strong": "black"}}`, nil, true},
+		{"bad scope", `{"scopes": {"keyword": 12}}`, nil, true},
+		{"not json", `{`, nil, true},
+	}
+	for _, test := range tests {
+		_, colors, err := ParseTheme([]byte(test.json), base)
+		if (err != nil) != test.errors {
+			t.Errorf("%s: error %v", test.name, err)
+			continue
+		}
+		if test.check != nil && !test.check(colors) {
+			t.Errorf("%s: got %+v", test.name, colors)
+		}
+	}
+	if base.Scopes["keyword"].Color != rgb(3, 3, 3) || len(base.Scopes) != 2 {
+		t.Errorf("parsing changed the base's scopes")
+	}
+}
+
+// in_theme_dir points ThemeDir at a temporary directory holding files
+func in_theme_dir(t *testing.T, files map[string]string) string {
+	config := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", config)
+	t.Setenv("HOME", config)
+	if err := os.MkdirAll(ThemeDir(), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(ThemeDir(), name), []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ThemeDir()
+}
+
+func TestLoadThemeBase(t *testing.T) {
+	in_theme_dir(t, map[string]string{
+		"mine.json": `{
+			"name": "Mine",
+			"base": "solarized-dark",
+			"colors": {"bg_strong": "#010203"},
+			"scopes": {"keyword": {"underline": true}}
+		}`,
+		"loop-a.json":    `{"base": "loop-b"}`,
+		"loop-b.json":    `{"base": "loop-a"}`,
+		"orphan.json":    `{"base": "not-a-theme"}`,
+		"no-name.json":   `{"colors": {"red_strong": "#FF0000"}}`,
+		"solarized.json": `{"base": "solarized-light"}`,
+	})
+	base, err := LoadTheme("solarized-dark")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mine, err := LoadTheme("mine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mine.Name != "Mine" || mine.Path == "" {
+		t.Errorf("loaded as %q from %q", mine.Name, mine.Path)
+	}
+	if mine.Colors.BGColorStrong != rgb(1, 2, 3) {
+		t.Errorf("bg_strong %v, want the theme's own", mine.Colors.BGColorStrong)
+	}
+	if mine.Colors.FGColorStrong != base.Colors.FGColorStrong || mine.Colors.Gray != base.Colors.Gray {
+		t.Errorf("colours the theme leaves out didn't come from its base")
+	}
+	want := base.Colors.Scopes["keyword"]
+	want.Underline = true
+	if got := mine.Colors.Scopes["keyword"]; got != want {
+		t.Errorf("keyword %+v, want %+v", got, want)
+	}
+	if mine.Colors.Scopes["string"] != base.Colors.Scopes["string"] {
+		t.Errorf("string scope didn't come from the base")
+	}
+
+	//bases of bases, the user's theme is based on a built in one based on another
+	chained, err := LoadTheme("solarized")
+	if err != nil {
+		t.Fatal(err)
+	}
+	light, _ := LoadTheme("solarized-light")
+	if chained.Colors.BGColorStrong != light.Colors.BGColorStrong || chained.Colors.RedStrong != base.Colors.RedStrong {
+		t.Errorf("chained bases weren't both applied")
+	}
+
+	//no base means the default theme is the base
+	plain, err := LoadTheme("no-name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	def, _ := LoadTheme(default_theme)
+	if plain.Name != "no-name" || plain.Colors.RedStrong != rgb(255, 0, 0) || plain.Colors.BGColorStrong != def.Colors.BGColorStrong {
+		t.Errorf("theme without a base loaded as %q with bg %v", plain.Name, plain.Colors.BGColorStrong)
+	}
+
+	if _, err := LoadTheme("loop-a"); err == nil {
+		t.Errorf("themes that are each other's base loaded")
+	}
+	if _, err := LoadTheme("orphan"); !errors.Is(err, ErrNoSuchTheme) {
+		t.Errorf("missing base gave %v", err)
+	}
+}
+
+const test_tm_theme = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>name</key>
+	<string>Test Theme</string>
+	<key>settings</key>
+	<array>
+		<dict>
+			<key>settings</key>
+			<dict>
+				<key>background</key>
+				<string>#101010</string>
+				<key>foreground</key>
+				<string>#E0E0E0</string>
+				<key>caret</key>
+				<string>not a colour</string>
+			</dict>
+		</dict>
+		<dict>
+			<key>scope</key>
+			<string>keyword.control.import</string>
+			<key>settings</key>
+			<dict>
+				<key>foreground</key>
+				<string>#AA0000</string>
+			</dict>
+		</dict>
+		<dict>
+			<key>scope</key>
+			<string>keyword</string>
+			<key>settings</key>
+			<dict>
+				<key>foreground</key>
+				<string>#FF0000</string>
+				<key>fontStyle</key>
+				<string>bold</string>
+			</dict>
+		</dict>
+		<dict>
+			<key>scope</key>
+			<string>entity.name.function, support.function</string>
+			<key>settings</key>
+			<dict>
+				<key>foreground</key>
+				<string>#00FF00</string>
+				<key>fontStyle</key>
+				<string>italic underline</string>
+			</dict>
+		</dict>
+		<dict>
+			<key>scope</key>
+			<string>source.go string.quoted</string>
+			<key>settings</key>
+			<dict>
+				<key>foreground</key>
+				<string>#0000FF</string>
+			</dict>
+		</dict>
+		<dict>
+			<key>scope</key>
+			<string>comment</string>
+			<key>settings</key>
+			<dict>
+				<key>fontStyle</key>
+				<string>italic</string>
+			</dict>
+		</dict>
+		<dict>
+			<key>scope</key>
+			<string>variable</string>
+			<key>settings</key>
+			<dict>
+				<key>foreground</key>
+				<string>#123456</string>
+			</dict>
+		</dict>
+	</array>
+</dict>
+</plist>
+`
+
+func TestImportTmTheme(t *testing.T) {
+	dir := in_theme_dir(t, map[string]string{"test.tmTheme": test_tm_theme})
+	def, err := LoadTheme(default_theme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	theme, err := ImportTmTheme(filepath.Join(dir, "test.tmTheme"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if theme.ID != "test" || theme.Name != "Test Theme" {
+		t.Errorf("imported as %q called %q", theme.ID, theme.Name)
+	}
+	colors := []struct {
+		name      string
+		got, want color.Color
+	}{
+		{"bg_muted", theme.Colors.BGColorMuted, rgb(0x10, 0x10, 0x10)},
+		{"fg_muted", theme.Colors.FGColorMuted, rgb(0xe0, 0xe0, 0xe0)},
+		{"fg_strong", theme.Colors.FGColorStrong, def.Colors.FGColorStrong}, //the caret wasn't a colour
+		{"bg_strong", theme.Colors.BGColorStrong, def.Colors.BGColorStrong},
+	}
+	for _, c := range colors {
+		if c.got != c.want {
+			t.Errorf("%s is %v, want %v", c.name, c.got, c.want)
+		}
+	}
+	scopes := []struct {
+		scope string
+		want  ScopeStyle
+	}{
+		{"keyword", ScopeStyle{Color: rgb(0xff, 0, 0), Bold: true}}, //plain keyword beats keyword.control.import
+		{"function", ScopeStyle{Color: rgb(0, 0xff, 0), Italic: true, Underline: true}},
+		{"string", ScopeStyle{Color: rgb(0, 0, 0xff)}},
+		{"comment", def.Colors.Scopes["comment"]}, //no foreground, so the rule is skipped
+		{"number", def.Colors.Scopes["number"]},
+	}
+	for _, s := range scopes {
+		if got := theme.Colors.Scopes[s.scope]; got != s.want {
+			t.Errorf("scope %s is %+v, want %+v", s.scope, got, s.want)
+		}
+	}
+	if len(theme.Colors.Scopes) != len(def.Colors.Scopes) {
+		t.Errorf("import added scopes we don't have: %v", theme.Colors.Scopes)
+	}
+
+	//a .tmTheme in the theme directory loads by its id
+	loaded, err := LoadTheme("test")
+	if err != nil || loaded.Colors.Scopes["keyword"].Color != rgb(0xff, 0, 0) {
+		t.Errorf("loading by id gave %v", err)
+	}
+}
+
+func TestTmScopeFor(t *testing.T) {
+	tests := []struct {
+		selector string
+		scope    string
+		extra    int
+		ok       bool
+	}{
+		{"keyword", "keyword", 0, true},
+		{"keyword.control.import", "keyword", 2, true},
+		{"keyword.operator", "operator", 0, true},
+		{"source.go comment.line", "comment", 1, true},
+		{" storage.type.go ", "type", 1, true},
+		{"storage.modifier", "keyword", 1, true},
+		{"keywords", "", 0, false},
+		{"variable.other", "", 0, false},
+		{"", "", 0, false},
+	}
+	for _, test := range tests {
+		scope, extra, ok := tm_scope_for(test.selector)
+		if scope != test.scope || extra != test.extra || ok != test.ok {
+			t.Errorf("%q: got %q %d %v, want %q %d %v", test.selector, scope, extra, ok, test.scope, test.extra, test.ok)
+		}
+	}
+}
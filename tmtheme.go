@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// .tmTheme files are TextMate colour schemes, which Sublime Text and VS Code can use too
+// they're XML property lists, a dict of global settings plus a list of rules colouring TextMate scopes
+// we only have a few scopes so each rule gets mapped onto the closest one, see tm_scopes
+
+// which of our scopes a TextMate scope selector colours, more specific selectors first
+var tm_scopes = []struct{ prefix, scope string }{
+	{"keyword.operator", "operator"},
+	{"constant.numeric", "number"},
+	{"entity.name.function", "function"},
+	{"support.function", "function"},
+	{"entity.name.type", "type"},
+	{"support.type", "type"},
+	{"storage.type", "type"},
+	{"comment", "comment"},
+	{"string", "string"},
+	{"keyword", "keyword"},
+	{"storage", "keyword"},
+}
+
+// the global settings and the palette entries they set
+var tm_globals = []struct{ setting, color string }{
+	{"background", "bg_muted"},
+	{"foreground", "fg_muted"},
+	{"lineHighlight", "bg_strong"},
+	{"caret", "fg_strong"},
+}
+
+// tm_scope_for says which of our scopes selector colours, and how far past our scope's prefix it goes
+// a rule for "keyword" is a better fit for keywords than one for "keyword.control.import"
+func tm_scope_for(selector string) (scope string, extra int, ok bool) {
+	parts := strings.Fields(selector)
+	if len(parts) == 0 {
+		return "", 0, false
+	}
+	//"source.go string" colours strings in go files, the last part is what gets coloured
+	last := parts[len(parts)-1]
+	for _, s := range tm_scopes {
+		if last == s.prefix || strings.HasPrefix(last, s.prefix+".") {
+			return s.scope, strings.Count(last[len(s.prefix):], "."), true
+		}
+	}
+	return "", 0, false
+}
+
+// ImportTmTheme reads a .tmTheme file, anything it doesn't set comes from the default theme
+func ImportTmTheme(path string) (*Theme, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	root, err := ParsePlist(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	top, ok := root.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: not a theme", path)
+	}
+	rules, _ := top["settings"].([]interface{})
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("%s: no settings", path)
+	}
+
+	base, err := LoadTheme(default_theme)
+	if err != nil {
+		return nil, err
+	}
+	t := &Theme{
+		ID:     strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+		Path:   path,
+		Colors: copy_style(base.Colors),
+	}
+	t.Name, _ = top["name"].(string)
+	if t.Name == "" {
+		t.Name = t.ID
+	}
+	fields := theme_colors(&t.Colors)
+	best := map[string]int{} //scope -> extra of the rule that coloured it
+	for _, r := range rules {
+		rule, _ := r.(map[string]interface{})
+		settings, _ := rule["settings"].(map[string]interface{})
+		if settings == nil {
+			continue
+		}
+		selectors, has_scope := rule["scope"].(string)
+		if !has_scope {
+			//the rule without a scope is the global settings
+			for _, g := range tm_globals {
+				if s, ok := settings[g.setting].(string); ok {
+					if c, err := ParseThemeColor(s); err == nil {
+						*fields[g.color] = c
+					}
+				}
+			}
+			continue
+		}
+		fg, _ := settings["foreground"].(string)
+		c, err := ParseThemeColor(fg)
+		if err != nil {
+			continue
+		}
+		style := ScopeStyle{Color: c}
+		font_style, _ := settings["fontStyle"].(string)
+		for _, f := range strings.Fields(font_style) {
+			switch f {
+			case "bold":
+				style.Bold = true
+			case "italic":
+				style.Italic = true
+			case "underline":
+				style.Underline = true
+			}
+		}
+		for _, selector := range strings.Split(selectors, ",") {
+			scope, extra, ok := tm_scope_for(selector)
+			if !ok {
+				continue
+			}
+			if prev, seen := best[scope]; seen && prev <= extra {
+				continue
+			}
+			best[scope] = extra
+			t.Colors.Scopes[scope] = style
+		}
+	}
+	return t, nil
+}
+
+var ErrBadPlist = errors.New("malformed property list")
+
+// ParsePlist reads an XML property list
+// dicts come back as map[string]interface{}, arrays as []interface{}, true and false as bool and everything else as its text
+func ParsePlist(r io.Reader) (interface{}, error) {
+	dec := xml.NewDecoder(r)
+	dec.Strict = false //some themes have doctypes pointing at apple.com, which is fine, we don't fetch them
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, ErrBadPlist
+		}
+		if start, ok := tok.(xml.StartElement); ok && start.Name.Local != "plist" {
+			return plist_value(dec, start)
+		}
+	}
+}
+
+func plist_value(dec *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	switch start.Name.Local {
+	case "dict":
+		dict := map[string]interface{}{}
+		key := ""
+		for {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, ErrBadPlist
+			}
+			switch tok := tok.(type) {
+			case xml.StartElement:
+				if tok.Name.Local == "key" {
+					if err := dec.DecodeElement(&key, &tok); err != nil {
+						return nil, ErrBadPlist
+					}
+					continue
+				}
+				v, err := plist_value(dec, tok)
+				if err != nil {
+					return nil, err
+				}
+				dict[key] = v
+			case xml.EndElement:
+				return dict, nil
+			}
+		}
+	case "array":
+		arr := []interface{}{}
+		for {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, ErrBadPlist
+			}
+			switch tok := tok.(type) {
+			case xml.StartElement:
+				v, err := plist_value(dec, tok)
+				if err != nil {
+					return nil, err
+				}
+				arr = append(arr, v)
+			case xml.EndElement:
+				return arr, nil
+			}
+		}
+	case "true", "false":
+		if err := dec.Skip(); err != nil {
+			return nil, ErrBadPlist
+		}
+		return start.Name.Local == "true", nil
+	default:
+		var s string
+		if err := dec.DecodeElement(&s, &start); err != nil {
+			return nil, ErrBadPlist
+		}
+		return strings.TrimSpace(s), nil
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"image"
+	"regexp"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text"
+	"golang.org/x/image/font"
+)
+
+// Tooltips, text by the mouse pointer once it's stopped over something that has one
+// widgets call ShowTooltip from MouseOver every update they want it showing, it's cleared before each update
+
+// how many ticks the mouse has to stay still for before tooltips show
+const tooltip_delay = 30
+
+// logical pixels
+const tooltip_padding = 6
+const tooltip_max_width = 500
+
+// Tooltip is what's showing, Lines are already wrapped to fit
+type Tooltip struct {
+	Lines []TooltipLine
+	At    image.Point //the mouse position it's for
+}
+
+// TooltipLine is a line of a tooltip, code is shown in the code font and isn't wrapped
+type TooltipLine struct {
+	Text string
+	Code bool
+}
+
+var current_tooltip *Tooltip
+
+var last_mouse image.Point
+var mouse_moved_at uint64
+
+// track_mouse notes where the mouse is, call it once per update before anything asks MouseRested
+func track_mouse(x, y int) {
+	current_tooltip = nil
+	if pt := image.Pt(x, y); pt != last_mouse {
+		last_mouse = pt
+		mouse_moved_at = ticks
+	}
+}
+
+// MouseRested reports whether the mouse has been still long enough for a tooltip
+func MouseRested() bool {
+	return ticks-mouse_moved_at >= tooltip_delay
+}
+
+// ShowTooltip shows s by (x, y) this update
+func ShowTooltip(s string, x, y int) {
+	ShowTooltipLines(TooltipText(s), x, y)
+}
+
+// ShowTooltipLines shows lines made by TooltipText and TooltipMarkdown by (x, y) this update
+func ShowTooltipLines(lines []TooltipLine, x, y int) {
+	if len(lines) == 0 {
+		return
+	}
+	current_tooltip = &Tooltip{Lines: lines, At: image.Pt(x, y)}
+}
+
+// TooltipText is plain text as tooltip lines
+func TooltipText(s string) []TooltipLine {
+	lines := []TooltipLine{}
+	for _, line := range wrap_text(s, MainFontFace, Px(tooltip_max_width)) {
+		lines = append(lines, TooltipLine{Text: line})
+	}
+	return lines
+}
+
+var markdown_link = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+var markdown_emphasis = regexp.MustCompile("\\*\\*|`")
+var markdown_escape = regexp.MustCompile(`\\([\\` + "`" + `*_{}\[\]()#+\-.!<>])`)
+
+// markdown_inline strips the markup from a line of text, links become their text
+func markdown_inline(s string) string {
+	s = markdown_link.ReplaceAllString(s, "$1")
+	s = markdown_emphasis.ReplaceAllString(s, "")
+	return markdown_escape.ReplaceAllString(s, "$1")
+}
+
+// TooltipMarkdown is markdown as tooltip lines, like what language servers send for hovers
+// code blocks are code, paragraphs are wrapped and headings, lists and inline markup are flattened to text
+func TooltipMarkdown(md string) []TooltipLine {
+	lines := []TooltipLine{}
+	paragraph := []string{}
+	//a blank line between blocks, never two and never at the start
+	gap := func() {
+		if len(lines) > 0 && lines[len(lines)-1] != (TooltipLine{}) {
+			lines = append(lines, TooltipLine{})
+		}
+	}
+	end_paragraph := func() {
+		if len(paragraph) > 0 {
+			gap()
+			lines = append(lines, TooltipText(markdown_inline(strings.Join(paragraph, " ")))...)
+			paragraph = paragraph[:0]
+		}
+	}
+	in_fence, in_indented := false, false
+	for _, line := range strings.Split(strings.ReplaceAll(md, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "```"):
+			end_paragraph()
+			if !in_fence {
+				gap()
+			}
+			in_fence = !in_fence
+			in_indented = false
+		case in_fence:
+			lines = append(lines, TooltipLine{Text: strings.ReplaceAll(line, "\t", "    "), Code: true})
+		case trimmed == "":
+			end_paragraph()
+			in_indented = false
+		case len(paragraph) == 0 && (strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t")):
+			if !in_indented {
+				gap()
+				in_indented = true
+			}
+			lines = append(lines, TooltipLine{Text: strings.ReplaceAll(strings.TrimPrefix(strings.TrimPrefix(line, "\t"), "    "), "\t", "    "), Code: true})
+		case strings.Trim(trimmed, "-*_") == "":
+			//a horizontal rule
+			end_paragraph()
+		case strings.HasPrefix(trimmed, "#"):
+			end_paragraph()
+			paragraph = append(paragraph, strings.TrimSpace(strings.TrimLeft(trimmed, "#")))
+			end_paragraph()
+		case strings.HasPrefix(trimmed, "- ") || strings.HasPrefix(trimmed, "* "):
+			end_paragraph()
+			lines = append(lines, TooltipText("• "+markdown_inline(trimmed[2:]))...)
+		default:
+			in_indented = false
+			paragraph = append(paragraph, trimmed)
+		}
+	}
+	end_paragraph()
+	for len(lines) > 0 && lines[len(lines)-1] == (TooltipLine{}) {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// wrap_text breaks s into lines no wider than width, at spaces where it can
+func wrap_text(s string, face font.Face, width int) []string {
+	lines := []string{}
+	for _, paragraph := range strings.Split(strings.TrimRight(s, "\n"), "\n") {
+		line := ""
+		for _, word := range strings.Split(paragraph, " ") {
+			next := word
+			if line != "" {
+				next = line + " " + word
+			}
+			if line != "" && font.MeasureString(face, next).Round() > width {
+				lines = append(lines, line)
+				next = word
+			}
+			line = next
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// DrawTooltip draws the tooltip under and to the right of the mouse, kept on screen
+func DrawTooltip(target *ebiten.Image) {
+	tt := current_tooltip
+	if tt == nil {
+		return
+	}
+	pad := Px(tooltip_padding)
+	width, height := 0, 0
+	for _, line := range tt.Lines {
+		face, line_height := tooltip_face(line)
+		width = max(width, font.MeasureString(face, line.Text).Round())
+		height += line_height
+	}
+	size := image.Pt(width+2*pad, height+2*pad)
+	at := tt.At.Add(image.Pt(Px(12), Px(16)))
+	bounds := target.Bounds()
+	if at.X+size.X > bounds.Max.X {
+		at.X = max(bounds.Min.X, bounds.Max.X-size.X)
+	}
+	if at.Y+size.Y > bounds.Max.Y {
+		at.Y = max(bounds.Min.Y, tt.At.Y-size.Y-Px(4))
+	}
+	r := image.Rectangle{Min: at, Max: at.Add(size)}
+	DrawRect(target, r, Style.BGColorStrong)
+	DrawBorders(target, r, Style.FGColorMuted)
+	clipped, ok := target.SubImage(r).(*ebiten.Image)
+	if !ok {
+		return
+	}
+	y := r.Min.Y + pad
+	for _, line := range tt.Lines {
+		face, line_height := tooltip_face(line)
+		if line.Code {
+			text.Draw(clipped, line.Text, face, r.Min.X+pad, y+CodeFontPeriodFromTop, Style.FGColorMuted)
+		} else {
+			text.Draw(clipped, line.Text, face, r.Min.X+pad, y+MainFontPeriodFromTop, Style.FGColorStrong)
+		}
+		y += line_height
+	}
+}
+
+func tooltip_face(line TooltipLine) (font.Face, int) {
+	if line.Code {
+		return CodeFontFace, CodeLineHeight()
+	}
+	return MainFontFace, MainLineHeight()
+}
@@ -9,10 +9,12 @@ import (
 	"github.com/hajimehoshi/ebiten/v2/inpututil"
 )
 
+// how long a key is held before it repeats and how often it does then, in ticks
+var key_repeat_delay = 20
+var key_repeat_interval = 3
+
 func KeyJustPressedOrKeyRepeated(key ebiten.Key) bool {
-	delay_before_repeat := 20
-	repeat_frequency := 3
-	if ebiten.IsKeyPressed(key) && inpututil.KeyPressDuration(key) > delay_before_repeat && inpututil.KeyPressDuration(key)%repeat_frequency == 0 {
+	if ebiten.IsKeyPressed(key) && inpututil.KeyPressDuration(key) > key_repeat_delay && inpututil.KeyPressDuration(key)%key_repeat_interval == 0 {
 		return true
 	}
 	if inpututil.IsKeyJustPressed(key) {
@@ -99,3 +101,12 @@ func DrawBorders(target *ebiten.Image, r image.Rectangle, color color.Color) {
 	//right
 	ebitenutil.DrawLine(target, float64(tr.X), float64(tr.Y), float64(br.X), float64(br.Y), color)
 }
+
+// Translucent returns c at the given opacity (0 to 1), premultiplied the way ebiten wants it
+func Translucent(c color.Color, opacity float64) color.RGBA {
+	r, g, b, a := c.RGBA()
+	scale := func(v uint32) uint8 {
+		return uint8(float64(v>>8) * opacity)
+	}
+	return color.RGBA{R: scale(r), G: scale(g), B: scale(b), A: scale(a)}
+}